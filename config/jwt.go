@@ -0,0 +1,249 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"tawtheeq-backend/jwtkeys"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	// JWTSigningAlg is the algorithm new access tokens are signed with.
+	JWTSigningAlg string
+	// JWTKeys holds the RS256 and EdDSA keys. It is loaded even when tokens
+	// are signed with HS256, so tokens of keys switched away from stay valid.
+	JWTKeys *jwtkeys.Keyring
+	// JWTHS256AcceptUntil keeps HS256 tokens valid after switching to RS256
+	// or EdDSA, until the tokens signed before the switch have expired.
+	JWTHS256AcceptUntil time.Time
+)
+
+// jwtKeysReloadInterval limits how often an unknown kid rereads the key
+// directory.
+const jwtKeysReloadInterval = 10 * time.Second
+
+var (
+	jwtKeysReloadMu sync.Mutex
+	jwtKeysReloaded time.Time
+)
+
+// jwtKeysDir returns the directory of the token keys, from JWT_KEYS_DIR
+// (default assets/keys/jwt).
+func jwtKeysDir() string {
+	if dir := os.Getenv("JWT_KEYS_DIR"); dir != "" {
+		return dir
+	}
+	return "assets/keys/jwt"
+}
+
+// configuredJWTAlg returns JWT_SIGNING_ALG: HS256 (default), RS256 or
+// EdDSA.
+func configuredJWTAlg() (string, error) {
+	alg := os.Getenv("JWT_SIGNING_ALG")
+	if alg == "" {
+		alg = jwt.SigningMethodHS256.Alg()
+	}
+	if alg != jwt.SigningMethodHS256.Alg() && !jwtkeys.ValidAlg(alg) {
+		return "", fmt.Errorf("❌ JWT_SIGNING_ALG must be HS256, RS256 or EdDSA, not %q", alg)
+	}
+	return alg, nil
+}
+
+// hs256AcceptUntil reads JWT_HS256_ACCEPT_UNTIL, an RFC 3339 time. It is
+// zero when unset.
+func hs256AcceptUntil() (time.Time, error) {
+	value := os.Getenv("JWT_HS256_ACCEPT_UNTIL")
+	if value == "" {
+		return time.Time{}, nil
+	}
+	until, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("❌ JWT_HS256_ACCEPT_UNTIL must be an RFC 3339 time: %w", err)
+	}
+	return until, nil
+}
+
+// InitJWT loads the token keys. With RS256 or EdDSA a first key is created
+// when the directory has none; a current key of another algorithm has to
+// be rotated with "rotate-jwt-key".
+func InitJWT() error {
+	alg, err := configuredJWTAlg()
+	if err != nil {
+		return err
+	}
+	keys, err := jwtkeys.Load(jwtKeysDir())
+	if err != nil {
+		return fmt.Errorf("❌ failed to load JWT keys: %w", err)
+	}
+	until, err := hs256AcceptUntil()
+	if err != nil {
+		return err
+	}
+	JWTSigningAlg, JWTKeys, JWTHS256AcceptUntil = alg, keys, time.Time{}
+
+	if alg == jwt.SigningMethodHS256.Alg() {
+		if os.Getenv("JWT_SECRET") == "" {
+			return fmt.Errorf("❌ JWT_SECRET must be set to sign tokens with HS256")
+		}
+		fmt.Println("⚠️  Access tokens are signed with the shared JWT_SECRET (HS256)")
+		return nil
+	}
+
+	current := keys.Current()
+	if current == nil {
+		if current, err = keys.Rotate(alg); err != nil {
+			return fmt.Errorf("❌ failed to create JWT key: %w", err)
+		}
+		fmt.Printf("✅ Created JWT key %s\n", current.ID)
+	}
+	if current.Alg != alg {
+		return fmt.Errorf("❌ current JWT key %s is %s, run rotate-jwt-key to switch to %s", current.ID, current.Alg, alg)
+	}
+	if time.Now().Before(until) {
+		if os.Getenv("JWT_SECRET") == "" {
+			return fmt.Errorf("❌ JWT_SECRET must be set to accept HS256 tokens until %s", until.Format(time.RFC3339))
+		}
+		JWTHS256AcceptUntil = until
+		fmt.Printf("⚠️  HS256 tokens are accepted until %s\n", until.Format(time.RFC3339))
+	}
+	fmt.Printf("✅ Access tokens are signed with %s key %s\n", alg, current.ID)
+	return nil
+}
+
+// SignJWT signs claims with the current key, naming it in the kid header.
+func SignJWT(claims jwt.Claims) (string, error) {
+	if JWTSigningAlg == jwt.SigningMethodHS256.Alg() {
+		return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(os.Getenv("JWT_SECRET")))
+	}
+	key := JWTKeys.Current()
+	if key == nil || key.Alg != JWTSigningAlg {
+		return "", fmt.Errorf("no current %s JWT key", JWTSigningAlg)
+	}
+	token := jwt.NewWithClaims(key.Method(), claims)
+	token.Header["kid"] = key.ID
+	return token.SignedString(key.Signer())
+}
+
+// acceptHS256 reports whether HS256 tokens are valid: when they are what
+// is signed, or during the transition away from them.
+func acceptHS256() bool {
+	if JWTSigningAlg == jwt.SigningMethodHS256.Alg() {
+		return true
+	}
+	return time.Now().Before(JWTHS256AcceptUntil)
+}
+
+// ParseJWT verifies a token signed by SignJWT. RS256 and EdDSA tokens are
+// checked against the key named by their kid, HS256 tokens against
+// JWT_SECRET while acceptHS256 allows them.
+func ParseJWT(tokenStr string) (*jwt.Token, error) {
+	return jwt.Parse(tokenStr, func(t *jwt.Token) (interface{}, error) {
+		if t.Method.Alg() == jwt.SigningMethodHS256.Alg() {
+			secret := os.Getenv("JWT_SECRET")
+			if !acceptHS256() || secret == "" {
+				return nil, errors.New("HS256 tokens are not accepted")
+			}
+			return []byte(secret), nil
+		}
+
+		kid, _ := t.Header["kid"].(string)
+		key, err := JWTKeys.Key(kid)
+		if errors.Is(err, jwtkeys.ErrUnknownKey) && reloadJWTKeys() {
+			key, err = JWTKeys.Key(kid)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if key.Alg != t.Method.Alg() {
+			return nil, fmt.Errorf("key %s is not a %s key", kid, t.Method.Alg())
+		}
+		return key.Public(), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg(), jwtkeys.RS256, jwtkeys.EdDSA}))
+}
+
+// reloadJWTKeys rereads the key directory, at most every 10 seconds, for
+// tokens signed with a key another instance rotated in. It reports whether
+// the keys were reread.
+func reloadJWTKeys() bool {
+	jwtKeysReloadMu.Lock()
+	defer jwtKeysReloadMu.Unlock()
+	if time.Since(jwtKeysReloaded) < jwtKeysReloadInterval {
+		return false
+	}
+	jwtKeysReloaded = time.Now()
+	if err := JWTKeys.Reload(); err != nil {
+		fmt.Printf("⚠️  Failed to reload JWT keys: %v\n", err)
+		return false
+	}
+	return true
+}
+
+// WatchJWTKeys rereads the key directory every minute, so that a key
+// rotated by "rotate-jwt-key" is used to sign without a restart.
+func WatchJWTKeys() {
+	go func() {
+		ticker := time.NewTicker(time.Minute)
+		defer ticker.Stop()
+		for range ticker.C {
+			reloadJWTKeys()
+		}
+	}()
+}
+
+// RotateJWTKey creates a key for alg (JWT_SIGNING_ALG when empty) and makes
+// it the current one.
+func RotateJWTKey(alg string) error {
+	if alg == "" {
+		configured, err := configuredJWTAlg()
+		if err != nil {
+			return err
+		}
+		alg = configured
+	}
+	keys, err := jwtkeys.Load(jwtKeysDir())
+	if err != nil {
+		return err
+	}
+	key, err := keys.Rotate(alg)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("✅ Created %s key %s, new tokens are signed with it\n", key.Alg, key.ID)
+	return nil
+}
+
+// RetireJWTKey removes a key that was rotated out. Tokens it signed are
+// rejected afterwards, so it should be retired once they have expired.
+func RetireJWTKey(kid string) error {
+	keys, err := jwtkeys.Load(jwtKeysDir())
+	if err != nil {
+		return err
+	}
+	if err := keys.Retire(kid); err != nil {
+		return err
+	}
+	fmt.Printf("✅ Retired key %s\n", kid)
+	return nil
+}
+
+// ListJWTKeys prints the keys in the key directory.
+func ListJWTKeys() error {
+	keys, err := jwtkeys.Load(jwtKeysDir())
+	if err != nil {
+		return err
+	}
+	current := keys.Current()
+	for _, key := range keys.Keys() {
+		state := ""
+		if current != nil && key.ID == current.ID {
+			state = "current"
+		}
+		fmt.Printf("%-26s %-6s %s %s\n", key.ID, key.Alg, key.CreatedAt.Format(time.RFC3339), state)
+	}
+	return nil
+}
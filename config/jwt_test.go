@@ -0,0 +1,139 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const testJWTSecret = "test-secret-that-is-long-enough-for-hs256"
+
+// initTestJWT runs InitJWT against a fresh key directory.
+func initTestJWT(t *testing.T, alg string, secret string, acceptUntil string) {
+	t.Helper()
+	t.Setenv("JWT_KEYS_DIR", t.TempDir())
+	t.Setenv("JWT_SIGNING_ALG", alg)
+	t.Setenv("JWT_SECRET", secret)
+	t.Setenv("JWT_HS256_ACCEPT_UNTIL", acceptUntil)
+	if err := InitJWT(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func testClaims() jwt.MapClaims {
+	return jwt.MapClaims{"id": "user", "jti": "token", "exp": time.Now().Add(time.Minute).Unix()}
+}
+
+// hs256Token signs claims with the shared secret, the way tokens were
+// signed before switching to RS256 or EdDSA.
+func hs256Token(t *testing.T) string {
+	t.Helper()
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, testClaims()).SignedString([]byte(testJWTSecret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestSignAndParseJWT(t *testing.T) {
+	for _, alg := range []string{"HS256", "RS256", "EdDSA"} {
+		t.Run(alg, func(t *testing.T) {
+			initTestJWT(t, alg, testJWTSecret, "")
+			signed, err := SignJWT(testClaims())
+			if err != nil {
+				t.Fatal(err)
+			}
+			token, err := ParseJWT(signed)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if token.Method.Alg() != alg {
+				t.Errorf("signed with %s, want %s", token.Method.Alg(), alg)
+			}
+			if claims := token.Claims.(jwt.MapClaims); claims["id"] != "user" {
+				t.Errorf("claims = %v", claims)
+			}
+		})
+	}
+}
+
+func TestParseJWTAcceptsHS256(t *testing.T) {
+	tests := []struct {
+		name        string
+		alg         string
+		acceptUntil string
+		want        bool
+	}{
+		{"signing with HS256", "HS256", "", true},
+		{"switched away", "EdDSA", "", false},
+		{"during the transition", "EdDSA", time.Now().Add(time.Hour).Format(time.RFC3339), true},
+		{"after the transition", "RS256", time.Now().Add(-time.Hour).Format(time.RFC3339), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			initTestJWT(t, tt.alg, testJWTSecret, tt.acceptUntil)
+			_, err := ParseJWT(hs256Token(t))
+			if got := err == nil; got != tt.want {
+				t.Errorf("HS256 token accepted = %v (%v), want %v", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestInitJWTConfiguration(t *testing.T) {
+	tests := []struct {
+		name        string
+		alg         string
+		secret      string
+		acceptUntil string
+	}{
+		{"HS256 without a secret", "HS256", "", ""},
+		{"unknown algorithm", "ES256", testJWTSecret, ""},
+		{"invalid transition time", "EdDSA", testJWTSecret, "tomorrow"},
+		{"transition without a secret", "EdDSA", "", time.Now().Add(time.Hour).Format(time.RFC3339)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("JWT_KEYS_DIR", t.TempDir())
+			t.Setenv("JWT_SIGNING_ALG", tt.alg)
+			t.Setenv("JWT_SECRET", tt.secret)
+			t.Setenv("JWT_HS256_ACCEPT_UNTIL", tt.acceptUntil)
+			if err := InitJWT(); err == nil {
+				t.Error("InitJWT succeeded")
+			}
+		})
+	}
+}
+
+func TestParseJWTRotatedKeys(t *testing.T) {
+	initTestJWT(t, "RS256", "", "")
+	old := JWTKeys.Current()
+	before, err := SignJWT(testClaims())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := JWTKeys.Rotate("RS256"); err != nil {
+		t.Fatal(err)
+	}
+	after, err := SignJWT(testClaims())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, signed := range map[string]string{"before": before, "after": after} {
+		if _, err := ParseJWT(signed); err != nil {
+			t.Errorf("token signed %s the rotation: %v", name, err)
+		}
+	}
+
+	if err := JWTKeys.Retire(old.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ParseJWT(before); err == nil {
+		t.Error("token of a retired key accepted")
+	}
+	if _, err := ParseJWT(after); err != nil {
+		t.Errorf("token of the current key: %v", err)
+	}
+}
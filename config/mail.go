@@ -0,0 +1,50 @@
+package config
+
+import (
+	"fmt"
+	"os"
+
+	"tawtheeq-backend/mail"
+)
+
+var (
+	Mailer        mail.Transport
+	MailTransport string
+	MailFrom      string
+	MailFromName  string
+)
+
+// InitMail opens the transport named by MAIL_TRANSPORT. When it is not set
+// the transport is "smtp" if SMTP_HOST is set and "log" otherwise. Mail is
+// sent from MAIL_FROM (default SMTP_EMAIL) as MAIL_FROM_NAME.
+func InitMail() error {
+	transport := os.Getenv("MAIL_TRANSPORT")
+	if transport == "" {
+		transport = "log"
+		if os.Getenv("SMTP_HOST") != "" {
+			transport = "smtp"
+		}
+	}
+
+	t, err := mail.Open(transport)
+	if err != nil {
+		return fmt.Errorf("❌ failed to init mail: %w", err)
+	}
+
+	MailFrom = os.Getenv("MAIL_FROM")
+	if MailFrom == "" {
+		MailFrom = os.Getenv("SMTP_EMAIL")
+	}
+	if MailFrom == "" {
+		MailFrom = "no-reply@localhost"
+	}
+	MailFromName = os.Getenv("MAIL_FROM_NAME")
+	if MailFromName == "" {
+		MailFromName = "Tawtheeq"
+	}
+
+	Mailer = t
+	MailTransport = transport
+	fmt.Printf("✅ Mail initialized with %s transport\n", transport)
+	return nil
+}
@@ -7,6 +7,8 @@ import (
 	"strconv"
 	"time"
 
+	"tawtheeq-backend/utils"
+
 	"github.com/redis/go-redis/v9"
 )
 
@@ -16,8 +18,26 @@ var (
 	RateLimitEnabled bool
 	RateLimitMax     int
 	RateLimitWindow  time.Duration
+	// StatsCacheTTL is how long dashboard statistics are cached in Redis;
+	// zero disables the cache.
+	StatsCacheTTL time.Duration
 )
 
+// connectRedis opens the shared Redis client once.
+func connectRedis() error {
+	if Redis != nil {
+		return nil
+	}
+	client := redis.NewClient(&redis.Options{
+		Addr: os.Getenv("REDIS_ADDR"),
+	})
+	if _, err := client.Ping(Ctx).Result(); err != nil {
+		return err
+	}
+	Redis = client
+	return nil
+}
+
 func InitRateLimiting() {
 
 	RateLimitEnabled = os.Getenv("RATE_LIMIT_ENABLED") == "true"
@@ -40,12 +60,28 @@ func InitRateLimiting() {
 	}
 	RateLimitWindow = time.Duration(sec) * time.Second
 
-	Redis = redis.NewClient(&redis.Options{
-		Addr: os.Getenv("REDIS_ADDR"),
-	})
-	if _, err := Redis.Ping(Ctx).Result(); err != nil {
+	if err := connectRedis(); err != nil {
 		panic("❌ Failed to connect to Redis: " + err.Error())
 	}
 
 	fmt.Printf("✅ Rate Limiting ENABLED - %d req / %ds\n", RateLimitMax, int(RateLimitWindow.Seconds()))
 }
+
+// InitStatsCache enables caching of dashboard statistics for
+// STATS_CACHE_TTL seconds. Statistics are computed on every request when it
+// is unset or Redis cannot be reached.
+func InitStatsCache() {
+	sec, err := strconv.Atoi(os.Getenv("STATS_CACHE_TTL"))
+	if err != nil || sec <= 0 {
+		fmt.Println("⚠️  Statistics cache is DISABLED")
+		return
+	}
+
+	if err := connectRedis(); err != nil {
+		utils.HandleError(err, "Failed to connect to Redis, statistics cache is disabled", utils.Warning)
+		return
+	}
+	StatsCacheTTL = time.Duration(sec) * time.Second
+
+	fmt.Printf("✅ Statistics cache ENABLED - %ds\n", sec)
+}
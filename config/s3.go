@@ -17,7 +17,11 @@ func InitS3() error {
 		fmt.Println("✅ S3 is disabled.")
 		return nil
 	}
+	return connectS3()
+}
 
+// connectS3 creates S3Client and makes sure the bucket exists.
+func connectS3() error {
 	endpoint := os.Getenv("S3_ENDPOINT")
 	accessKey := os.Getenv("S3_ACCESS_KEY")
 	secretKey := os.Getenv("S3_SECRET_KEY")
@@ -0,0 +1,50 @@
+package config
+
+import (
+	"fmt"
+	"time"
+
+	"tawtheeq-backend/utils"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// TokenDenylistEnabled reports whether revoked access tokens are tracked in
+// Redis. Without it revocation only stops refreshes and access tokens stay
+// valid until they expire.
+var TokenDenylistEnabled bool
+
+const tokenDenylistPrefix = "jwt_denylist:"
+
+// InitTokenDenylist connects to Redis to keep the IDs of revoked access
+// tokens.
+func InitTokenDenylist() {
+	if err := connectRedis(); err != nil {
+		utils.HandleError(err, "Failed to connect to Redis, revoked access tokens stay valid until they expire", utils.Warning)
+		return
+	}
+	TokenDenylistEnabled = true
+
+	fmt.Println("✅ Token denylist ENABLED")
+}
+
+// DenyToken rejects the access token with ID jti until it expires.
+func DenyToken(jti string, expiresAt time.Time) error {
+	ttl := time.Until(expiresAt)
+	if !TokenDenylistEnabled || jti == "" || ttl <= 0 {
+		return nil
+	}
+	return Redis.Set(Ctx, tokenDenylistPrefix+jti, 1, ttl).Err()
+}
+
+// IsTokenDenied reports whether the access token with ID jti was revoked.
+func IsTokenDenied(jti string) (bool, error) {
+	if !TokenDenylistEnabled {
+		return false, nil
+	}
+	err := Redis.Get(Ctx, tokenDenylistPrefix+jti).Err()
+	if err == redis.Nil {
+		return false, nil
+	}
+	return err == nil, err
+}
@@ -0,0 +1,83 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"tawtheeq-backend/models"
+	"tawtheeq-backend/repositories"
+	"tawtheeq-backend/utils"
+)
+
+// UserAccessCacheTTL is how long the role and team of a user are cached in
+// Redis; zero looks them up on every request.
+var UserAccessCacheTTL time.Duration
+
+const userAccessPrefix = "user_access:"
+
+// InitUserAccessCache caches the role and team of users for
+// USER_ACCESS_CACHE_TTL seconds (default 30). Handlers that change them
+// drop the cached entry, so the TTL only bounds changes made elsewhere.
+func InitUserAccessCache() {
+	sec, err := strconv.Atoi(os.Getenv("USER_ACCESS_CACHE_TTL"))
+	if err != nil || sec < 0 {
+		sec = 30
+	}
+	if sec == 0 {
+		fmt.Println("⚠️  User access cache is DISABLED")
+		return
+	}
+
+	if err := connectRedis(); err != nil {
+		utils.HandleError(err, "Failed to connect to Redis, user access cache is disabled", utils.Warning)
+		return
+	}
+	UserAccessCacheTTL = time.Duration(sec) * time.Second
+
+	fmt.Printf("✅ User access cache ENABLED - %ds\n", sec)
+}
+
+// UserAccess returns the current role and team of a user, from the cache
+// when it holds them.
+func UserAccess(userID string) (*models.UserAccess, error) {
+	key := userAccessPrefix + userID
+	if UserAccessCacheTTL > 0 {
+		if data, err := Redis.Get(Ctx, key).Bytes(); err == nil {
+			var access models.UserAccess
+			if json.Unmarshal(data, &access) == nil {
+				return &access, nil
+			}
+		}
+	}
+
+	access, err := repositories.NewUserRepository(DB).FindAccess(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if UserAccessCacheTTL > 0 {
+		data, _ := json.Marshal(access)
+		if err := Redis.Set(Ctx, key, data, UserAccessCacheTTL).Err(); err != nil {
+			utils.HandleError(err, "Failed to cache user access", utils.Warning)
+		}
+	}
+	return access, nil
+}
+
+// InvalidateUserAccess drops the cached role and team of users whose role
+// or team changed.
+func InvalidateUserAccess(userIDs ...string) {
+	if UserAccessCacheTTL <= 0 || len(userIDs) == 0 {
+		return
+	}
+	keys := make([]string, len(userIDs))
+	for i, id := range userIDs {
+		keys[i] = userAccessPrefix + id
+	}
+	if err := Redis.Del(Ctx, keys...).Err(); err != nil {
+		utils.HandleError(err, "Failed to invalidate user access cache", utils.Error)
+	}
+}
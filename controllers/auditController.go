@@ -0,0 +1,220 @@
+// AuditController
+package controllers
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"tawtheeq-backend/config"
+	"tawtheeq-backend/i18n"
+	"tawtheeq-backend/models"
+	"tawtheeq-backend/repositories"
+	"tawtheeq-backend/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// auditActorSystem is the actor role of changes made by background jobs.
+const auditActorSystem = "system"
+
+// auditJSON serialises a before/after snapshot. nil stays empty.
+func auditJSON(v interface{}) string {
+	if v == nil {
+		return ""
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		utils.HandleError(err, "Failed to encode audit snapshot", utils.Warning)
+		return ""
+	}
+	return string(data)
+}
+
+// recordAudit appends an audit event for a change made by the current
+// request. before and after are snapshots of the changed values; pass nil
+// when there is nothing to show. Failures are logged but never fail the
+// request that already made the change.
+func recordAudit(c *fiber.Ctx, action string, targetType string, targetID string, before interface{}, after interface{}) {
+	event := &models.AuditEvent{
+		Action:     action,
+		TargetType: targetType,
+		TargetID:   targetID,
+		Before:     auditJSON(before),
+		After:      auditJSON(after),
+		IP:         c.IP(),
+	}
+	if userID, ok := c.Locals("userID").(string); ok && userID != "" {
+		event.ActorID = &userID
+	}
+	if role, ok := c.Locals("userRole").(string); ok {
+		event.ActorRole = role
+	}
+	if requestID, ok := c.Locals("requestid").(string); ok {
+		event.RequestID = requestID
+	}
+
+	saveAuditEvent(event)
+}
+
+// recordSystemAudit appends an audit event for a change made by a background
+// job rather than a request.
+func recordSystemAudit(action string, targetType string, targetID string, before interface{}, after interface{}) {
+	saveAuditEvent(&models.AuditEvent{
+		ActorRole:  auditActorSystem,
+		Action:     action,
+		TargetType: targetType,
+		TargetID:   targetID,
+		Before:     auditJSON(before),
+		After:      auditJSON(after),
+	})
+}
+
+func saveAuditEvent(event *models.AuditEvent) {
+	auditRepo := repositories.NewAuditEventRepository(config.DB)
+	if err := auditRepo.Create(event); err != nil {
+		utils.HandleError(err, fmt.Sprintf("Failed to record audit event %s on %s %s", event.Action, event.TargetType, event.TargetID), utils.Error)
+	}
+}
+
+// userAuditSnapshot is the part of a user recorded in audit events.
+func userAuditSnapshot(user *models.User) fiber.Map {
+	return fiber.Map{"full_name": user.FullName, "email": user.Email, "role": user.Role}
+}
+
+// teamAuditSnapshot is the part of a team recorded in audit events.
+func teamAuditSnapshot(team *models.Team) fiber.Map {
+	return fiber.Map{"name": team.Name, "leader_id": team.LeaderID, "verification_visibility": team.VerificationVisibility}
+}
+
+// auditFilterFromQuery reads the audit filters shared by the list and export
+// endpoints.
+func auditFilterFromQuery(c *fiber.Ctx) (models.AuditEventFilter, error) {
+	filter := models.AuditEventFilter{
+		ActorID:    c.Query("actor_id"),
+		Action:     c.Query("action"),
+		TargetType: c.Query("target_type"),
+		TargetID:   c.Query("target_id"),
+		RequestID:  c.Query("request_id"),
+	}
+	if v := c.Query("from"); v != "" {
+		from, err := time.Parse("2006-01-02", v)
+		if err != nil {
+			return filter, i18n.Errorf("invalid_from_date")
+		}
+		filter.From = &from
+	}
+	if v := c.Query("to"); v != "" {
+		to, err := time.Parse("2006-01-02", v)
+		if err != nil {
+			return filter, i18n.Errorf("invalid_to_date")
+		}
+		to = to.AddDate(0, 0, 1)
+		filter.To = &to
+	}
+	return filter, nil
+}
+
+// GetAuditEvents godoc
+// @Summary List audit events
+// @Description Lists recorded changes, newest first, filtered by actor, action, target, request and date
+// @Tags audit
+// @Produce json
+// @Param actor_id query string false "User who made the change"
+// @Param action query string false "Action, e.g. user.role_change"
+// @Param target_type query string false "user, team, document, stamp_template or storage"
+// @Param target_id query string false "ID of the changed object"
+// @Param request_id query string false "Request ID"
+// @Param from query string false "Start date (YYYY-MM-DD)"
+// @Param to query string false "End date, inclusive (YYYY-MM-DD)"
+// @Param limit query int false "Limit" default(50)
+// @Param page query int false "Page" default(1)
+// @Param cursor query string false "meta.next_cursor of the previous page"
+// @Success 200 {object} models.ListResponse{data=[]models.AuditEvent}
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /audit [get]
+// @Security Bearer
+func GetAuditEvents(c *fiber.Ctx) error {
+	filter, err := auditFilterFromQuery(c)
+	if err != nil {
+		return sendErrorFrom(c, fiber.StatusBadRequest, err)
+	}
+
+	p, err := paginationFromQuery(c, 50)
+	if err != nil {
+		return sendErrorFrom(c, fiber.StatusBadRequest, err)
+	}
+
+	auditRepo := repositories.NewAuditEventRepository(config.DB)
+	events, total, err := auditRepo.Find(filter, p)
+	if err != nil {
+		utils.HandleError(err, "Failed to fetch audit events", utils.Error)
+		return sendError(c, fiber.StatusInternalServerError, "audit_events_fetch_failed")
+	}
+
+	return sendList(c, events, p, total, nextCursor(p, events, func(e models.AuditEvent) models.Cursor {
+		return models.Cursor{Time: e.CreatedAt, ID: e.ID}
+	}))
+}
+
+// ExportAuditEvents godoc
+// @Summary Export audit events as CSV
+// @Description Streams every audit event matching the filters as CSV, oldest first
+// @Tags audit
+// @Produce text/csv
+// @Param actor_id query string false "User who made the change"
+// @Param action query string false "Action, e.g. user.role_change"
+// @Param target_type query string false "user, team, document, stamp_template or storage"
+// @Param target_id query string false "ID of the changed object"
+// @Param request_id query string false "Request ID"
+// @Param from query string false "Start date (YYYY-MM-DD)"
+// @Param to query string false "End date, inclusive (YYYY-MM-DD)"
+// @Success 200 {file} file
+// @Failure 400 {object} models.ErrorResponse
+// @Router /audit/export [get]
+// @Security Bearer
+func ExportAuditEvents(c *fiber.Ctx) error {
+	filter, err := auditFilterFromQuery(c)
+	if err != nil {
+		return sendErrorFrom(c, fiber.StatusBadRequest, err)
+	}
+
+	filename := fmt.Sprintf("audit-%s.csv", time.Now().Format("20060102-150405"))
+	c.Set(fiber.HeaderContentType, "text/csv; charset=utf-8")
+	c.Set(fiber.HeaderContentDisposition, contentDisposition(filename))
+
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		out := csv.NewWriter(w)
+		out.Write([]string{"created_at", "actor_id", "actor_role", "action", "target_type", "target_id", "before", "after", "ip", "request_id"})
+
+		auditRepo := repositories.NewAuditEventRepository(config.DB)
+		err := auditRepo.Each(filter, func(e models.AuditEvent) error {
+			actor := ""
+			if e.ActorID != nil {
+				actor = *e.ActorID
+			}
+			out.Write([]string{
+				e.CreatedAt.UTC().Format(time.RFC3339),
+				actor,
+				e.ActorRole,
+				e.Action,
+				e.TargetType,
+				e.TargetID,
+				e.Before,
+				e.After,
+				e.IP,
+				e.RequestID,
+			})
+			out.Flush()
+			return out.Error()
+		})
+		if err != nil {
+			utils.HandleError(err, "Failed to export audit events", utils.Error)
+		}
+		out.Flush()
+	})
+	return nil
+}
@@ -2,6 +2,10 @@
 package controllers
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"fmt"
 	"os"
 	"strconv"
@@ -18,9 +22,168 @@ import (
 	"golang.org/x/crypto/bcrypt"
 )
 
+// accessTokenTTL returns how long access tokens are valid, from
+// JWT_ACCESS_TTL_MINUTES (default 15).
+func accessTokenTTL() time.Duration {
+	minutes, err := strconv.Atoi(os.Getenv("JWT_ACCESS_TTL_MINUTES"))
+	if err != nil || minutes <= 0 {
+		minutes = 15
+	}
+	return time.Duration(minutes) * time.Minute
+}
+
+// refreshTokenTTL returns how long a refresh token can be used, from
+// JWT_REFRESH_TTL_DAYS (default 30). Every refresh starts the period again.
+func refreshTokenTTL() time.Duration {
+	days, err := strconv.Atoi(os.Getenv("JWT_REFRESH_TTL_DAYS"))
+	if err != nil || days <= 0 {
+		days = 30
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// hashRefreshToken returns the form refresh tokens are stored in. They are
+// random, so a plain SHA-256 is enough.
+func hashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// session is what a login or a refresh hands out.
+type session struct {
+	accessToken  string
+	refreshToken string
+	teamID       string
+	row          *models.RefreshToken
+}
+
+// newSession signs an access token for user and builds the refresh token
+// that goes with it, in the login family. The refresh token still has to be
+// stored.
+func newSession(user *models.User, familyID string) (*session, error) {
+	// role and team are informational, requests look them up again
+	access, err := repositories.NewUserRepository(config.DB).FindAccess(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	teamId := access.TeamID
+
+	now := time.Now()
+	jti := uuid.New().String()
+	accessExpiresAt := now.Add(accessTokenTTL())
+	claims := jwt.MapClaims{
+		"id":     user.ID,
+		"email":  user.Email,
+		"role":   access.Role,
+		"teamId": teamId,
+		"jti":    jti,
+		"iat":    now.Unix(),
+		"exp":    accessExpiresAt.Unix(),
+	}
+	signedToken, err := config.SignJWT(claims)
+	if err != nil {
+		return nil, err
+	}
+
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return nil, err
+	}
+	refreshToken := base64.RawURLEncoding.EncodeToString(raw)
+
+	return &session{
+		accessToken:  signedToken,
+		refreshToken: refreshToken,
+		teamID:       teamId,
+		row: &models.RefreshToken{
+			UserID:          user.ID,
+			FamilyID:        familyID,
+			TokenHash:       hashRefreshToken(refreshToken),
+			AccessTokenID:   jti,
+			AccessExpiresAt: accessExpiresAt,
+			ExpiresAt:       now.Add(refreshTokenTTL()),
+		},
+	}, nil
+}
+
+// sessionResponse is the body of a login or a refresh.
+func sessionResponse(user *models.User, s *session) fiber.Map {
+	return fiber.Map{
+		"token":         s.accessToken,
+		"refresh_token": s.refreshToken,
+		"expires_in":    int(accessTokenTTL().Seconds()),
+		"user": fiber.Map{
+			"id":     user.ID,
+			"name":   user.FullName,
+			"email":  user.Email,
+			"role":   user.Role,
+			"teamId": s.teamID,
+		},
+	}
+}
+
+// denyAccessTokens revokes the access token issued with each refresh token.
+// Every login and refresh issues one access token with a refresh token of
+// its own, so the tokens of a session cover all of its access tokens.
+func denyAccessTokens(tokens []models.RefreshToken) {
+	for _, token := range tokens {
+		if err := config.DenyToken(token.AccessTokenID, token.AccessExpiresAt); err != nil {
+			utils.HandleError(err, fmt.Sprintf("Failed to deny access token of session %s", token.FamilyID), utils.Error)
+		}
+	}
+}
+
+// revokeUserTokens ends every session of a user, for when their password or
+// role changes or they are removed. It is logged rather than returned since
+// the change that calls for it has already been made.
+func revokeUserTokens(userID string) {
+	tokens, err := repositories.NewRefreshTokenRepository(config.DB).RevokeUser(userID)
+	if err != nil {
+		utils.HandleError(err, fmt.Sprintf("Failed to revoke sessions of user %s", userID), utils.Error)
+	}
+	denyAccessTokens(tokens)
+}
+
+// revokeTokenFamily ends one session.
+func revokeTokenFamily(familyID string) {
+	tokens, err := repositories.NewRefreshTokenRepository(config.DB).RevokeFamily(familyID)
+	if err != nil {
+		utils.HandleError(err, fmt.Sprintf("Failed to revoke session %s", familyID), utils.Error)
+	}
+	denyAccessTokens(tokens)
+}
+
+// StartRefreshTokenCleaner removes expired refresh tokens every hour.
+func StartRefreshTokenCleaner() {
+	go func() {
+		ticker := time.NewTicker(time.Hour)
+		defer ticker.Stop()
+
+		for {
+			refreshRepo := repositories.NewRefreshTokenRepository(config.DB)
+			if _, err := refreshRepo.DeleteExpiredBefore(time.Now()); err != nil {
+				utils.HandleError(err, "Failed to prune refresh tokens", utils.Warning)
+			}
+			<-ticker.C
+		}
+	}()
+}
+
+// GetJWKS godoc
+// @Summary Access token keys
+// @Description Public keys access tokens are signed with, as a JSON Web Key Set, so other services can verify them. Tokens name their key in the kid header. Empty while tokens are signed with HS256
+// @Tags auth
+// @Produce json
+// @Success 200 {object} jwtkeys.JWKSet
+// @Router /auth/jwks [get]
+func GetJWKS(c *fiber.Ctx) error {
+	c.Set(fiber.HeaderCacheControl, "public, max-age=300")
+	return c.JSON(config.JWTKeys.JWKS())
+}
+
 // Login godoc
 // @Summary Login
-// @Description Login user and return JWT token
+// @Description Login user and return a short-lived access token and a refresh token
 // @Tags auth
 // @Accept json
 // @Produce json
@@ -32,73 +195,177 @@ import (
 // @Router /auth/login [post]
 // @Security Bearer
 func Login(c *fiber.Ctx) error {
-	expHours, _ := strconv.Atoi(os.Getenv("JWT_EXP_HOURS"))
-	if expHours <= 0 {
-		expHours = 72
-	}
-
 	var input models.LoginInput
 	if err := c.BodyParser(&input); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid input", "created_at": time.Now()})
+		return sendError(c, fiber.StatusBadRequest, "invalid_input")
 	}
 
 	repo := repositories.NewUserRepository(config.DB)
 	user, err := repo.FindByEmail(input.Email)
 	if err != nil {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid email or password", "created_at": time.Now()})
+		return sendError(c, fiber.StatusUnauthorized, "invalid_credentials")
 	}
 
 	err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(input.Password))
 	if err != nil {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid email or password", "created_at": time.Now()})
+		return sendError(c, fiber.StatusUnauthorized, "invalid_credentials")
 	}
 
-	// teamId
-	teamId, err := getMyTeamID(user.ID)
+	s, err := newSession(user, uuid.New().String())
+	if err == nil {
+		err = repositories.NewRefreshTokenRepository(config.DB).Create(s.row)
+	}
 	if err != nil {
-		teamId = ""
+		utils.HandleError(err, fmt.Sprintf("Failed to start session for user %s", user.ID), utils.Error)
+		return sendError(c, fiber.StatusInternalServerError, "token_generation_failed")
 	}
 
-	claims := jwt.MapClaims{
-		"id":     user.ID,
-		"email":  user.Email,
-		"role":   user.Role,
-		"teamId": teamId,
-		"exp":    time.Now().Add(time.Hour * time.Duration(expHours)).Unix(),
+	return c.JSON(sessionResponse(user, s))
+}
+
+// refreshState is what a presented refresh token allows.
+type refreshState int
+
+const (
+	refreshUsable refreshState = iota
+	refreshInvalid
+	// refreshReused is a rotated token coming back, which means someone else
+	// holds a copy.
+	refreshReused
+)
+
+// refreshTokenState decides whether token can be traded at now.
+func refreshTokenState(token *models.RefreshToken, now time.Time) refreshState {
+	if token.RevokedAt != nil {
+		if token.ReplacedByID != nil {
+			return refreshReused
+		}
+		return refreshInvalid
+	}
+	if now.After(token.ExpiresAt) {
+		return refreshInvalid
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	secret := os.Getenv("JWT_SECRET")
-	signedToken, err := token.SignedString([]byte(secret))
+	return refreshUsable
+}
+
+// RefreshToken godoc
+// @Summary Refresh tokens
+// @Description Trade a refresh token for a new access token and a new refresh token. The old refresh token stops working; using it again ends the session
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param input body models.RefreshTokenInput true "Refresh token"
+// @Success 200 {object} models.LoginResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /auth/refresh [post]
+func RefreshToken(c *fiber.Ctx) error {
+	var input models.RefreshTokenInput
+	if err := c.BodyParser(&input); err != nil || input.RefreshToken == "" {
+		return sendError(c, fiber.StatusBadRequest, "invalid_input")
+	}
+
+	refreshRepo := repositories.NewRefreshTokenRepository(config.DB)
+	current, err := refreshRepo.FindByHash(hashRefreshToken(input.RefreshToken))
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not generate token", "created_at": time.Now()})
+		return sendError(c, fiber.StatusUnauthorized, "invalid_refresh_token")
+	}
+	switch refreshTokenState(current, time.Now()) {
+	case refreshReused:
+		utils.HandleError(fmt.Errorf("refresh token %s reused", current.ID), fmt.Sprintf("Revoking session %s of user %s", current.FamilyID, current.UserID), utils.Warning)
+		revokeTokenFamily(current.FamilyID)
+		recordAudit(c, "user.refresh_token_reuse", models.AuditTargetUser, current.UserID, nil, fiber.Map{"session": current.FamilyID})
+		return sendError(c, fiber.StatusUnauthorized, "invalid_refresh_token")
+	case refreshInvalid:
+		return sendError(c, fiber.StatusUnauthorized, "invalid_refresh_token")
 	}
 
-	return c.JSON(fiber.Map{
-		"token": signedToken,
-		"user": fiber.Map{
-			"id":     user.ID,
-			"name":   user.FullName,
-			"email":  user.Email,
-			"role":   user.Role,
-			"teamId": teamId,
-		},
-	})
+	user, err := repositories.NewUserRepository(config.DB).FindByID(current.UserID)
+	if err != nil {
+		return sendError(c, fiber.StatusUnauthorized, "invalid_refresh_token")
+	}
+
+	s, err := newSession(user, current.FamilyID)
+	if err != nil {
+		utils.HandleError(err, fmt.Sprintf("Failed to refresh session %s", current.FamilyID), utils.Error)
+		return sendError(c, fiber.StatusInternalServerError, "token_generation_failed")
+	}
+	rotated, err := refreshRepo.Rotate(current, s.row)
+	if err != nil {
+		utils.HandleError(err, fmt.Sprintf("Failed to rotate refresh token of session %s", current.FamilyID), utils.Error)
+		return sendError(c, fiber.StatusInternalServerError, "token_generation_failed")
+	}
+	if !rotated {
+		return sendError(c, fiber.StatusUnauthorized, "invalid_refresh_token")
+	}
+
+	return c.JSON(sessionResponse(user, s))
 }
 
-// getMyTeamID retrieves the team ID associated with the given user ID.
-func getMyTeamID(userId string) (string, error) {
-	repo := repositories.NewTeamRepository(config.DB)
-	team, err := repo.FindTeamByLeaderId(userId)
-	if err == nil && team != nil {
-		return team.ID, nil
+// Logout godoc
+// @Summary Logout
+// @Description End the session of the refresh token and revoke the access token the request is sent with. With all=true every session of the user ends. access_token_revoked is false when the access token could not be revoked and stays valid until it expires
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param input body models.RefreshTokenInput false "Refresh token"
+// @Param all query bool false "End every session of the user"
+// @Success 200 {object} fiber.Map
+// @Failure 400 {object} models.ErrorResponse
+// @Router /auth/logout [post]
+// @Security Bearer
+func Logout(c *fiber.Ctx) error {
+	var input models.RefreshTokenInput
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&input); err != nil {
+			return sendError(c, fiber.StatusBadRequest, "invalid_input")
+		}
+	}
+	userID, _ := c.Locals("userID").(string)
+	tokenID, _ := c.Locals("tokenID").(string)
+	if input.RefreshToken == "" && tokenID == "" {
+		return sendError(c, fiber.StatusBadRequest, "invalid_input")
 	}
-	team, err = repo.FindTeamByMemberId(userId)
-	if err != nil || team == nil {
-		return "", err
+
+	if input.RefreshToken != "" {
+		refreshRepo := repositories.NewRefreshTokenRepository(config.DB)
+		// a refresh token from another account cannot end its session
+		token, err := refreshRepo.FindByHash(hashRefreshToken(input.RefreshToken))
+		if err == nil && (userID == "" || token.UserID == userID) {
+			revokeTokenFamily(token.FamilyID)
+			if userID == "" {
+				userID = token.UserID
+			}
+		}
 	}
-	return team.ID, nil
+	// without the Redis denylist the access token cannot be revoked, and the
+	// caller has to know it stays valid until it expires
+	accessRevoked := false
+	if tokenID != "" && config.TokenDenylistEnabled {
+		expiresAt, _ := c.Locals("tokenExpiresAt").(time.Time)
+		if err := config.DenyToken(tokenID, expiresAt); err != nil {
+			utils.HandleError(err, fmt.Sprintf("Failed to deny access token %s", tokenID), utils.Error)
+		} else {
+			accessRevoked = true
+		}
+	}
+	if c.QueryBool("all") && tokenID != "" {
+		revokeUserTokens(userID)
+	}
+	if userID != "" {
+		recordAudit(c, "user.logout", models.AuditTargetUser, userID, nil, fiber.Map{"all": c.QueryBool("all") && tokenID != "", "access_token_revoked": accessRevoked})
+	}
+
+	if tokenID != "" && !accessRevoked {
+		return c.JSON(fiber.Map{"message": localize(c, "logged_out_token_valid"), "access_token_revoked": false})
+	}
+	return c.JSON(fiber.Map{"message": localize(c, "logged_out"), "access_token_revoked": accessRevoked})
 }
 
+// passwordResetValidity is how long a password reset link can be used.
+const passwordResetValidity = 15 * time.Minute
+
 // ForgotPassword godoc
 // @Summary Send password reset email
 // @Description Sends a reset password link to the user's email if it exists
@@ -108,6 +375,7 @@ func getMyTeamID(userId string) (string, error) {
 // @Param input body models.ForgotPasswordInput true "User email"
 // @Success 200 {object} fiber.Map
 // @Failure 400 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
 // @Router /auth/forgot-password [post]
 func ForgotPassword(c *fiber.Ctx) error {
 	type Request struct {
@@ -115,30 +383,39 @@ func ForgotPassword(c *fiber.Ctx) error {
 	}
 	var req Request
 	if err := c.BodyParser(&req); err != nil {
-		return c.Status(400).JSON(fiber.Map{"error": "Invalid input"})
+		return sendError(c, 400, "invalid_input")
 	}
 
 	userRepo := repositories.NewUserRepository(config.DB)
 	user, err := userRepo.FindByEmail(req.Email)
 	if err != nil {
-		return c.Status(200).JSON(fiber.Map{"message": "If email exists, reset link sent", "created_at": time.Now()})
+		return c.Status(200).JSON(fiber.Map{"message": localize(c, "reset_link_sent"), "created_at": time.Now()})
 
 	}
 
 	token := utils.GenerateResetToken()
 	resetLink := fmt.Sprintf("%s?token=%s", os.Getenv("FRONTEND_RESET_PASSWORD"), token)
 
-	config.DB.Create(&models.PasswordResetToken{
+	err = config.DB.Create(&models.PasswordResetToken{
 		ID:        uuid.New().String(),
 		UserID:    user.ID,
 		Token:     token,
-		ExpiresAt: time.Now().Add(15 * time.Minute),
-	})
+		ExpiresAt: time.Now().Add(passwordResetValidity),
+	}).Error
+	if err != nil {
+		utils.HandleError(err, "Failed to store password reset token", utils.Error)
+		return sendError(c, fiber.StatusInternalServerError, "reset_link_failed")
+	}
 
-	body := fmt.Sprintf("Click this link to reset your password:\n\n%s", resetLink)
-	utils.SendEmail(user.Email, "Reset your password", body)
+	err = queueEmail(user, models.EmailPasswordReset, user.ID, fiber.Map{
+		"ResetLink":      resetLink,
+		"ExpiresMinutes": int(passwordResetValidity.Minutes()),
+	})
+	if err != nil {
+		return sendError(c, fiber.StatusInternalServerError, "reset_link_failed")
+	}
 
-	return c.JSON(fiber.Map{"message": "If email exists, reset link sent", "created_at": time.Now()})
+	return c.JSON(fiber.Map{"message": localize(c, "reset_link_sent"), "created_at": time.Now()})
 }
 
 // ResetPassword godoc
@@ -158,19 +435,19 @@ func ResetPassword(c *fiber.Ctx) error {
 	}
 	var req Request
 	if err := c.BodyParser(&req); err != nil {
-		return c.Status(400).JSON(fiber.Map{"error": "Invalid input"})
+		return sendError(c, 400, "invalid_input")
 	}
 
 	var reset models.PasswordResetToken
 	err := config.DB.Where("token = ?", req.Token).First(&reset).Error
 	if err != nil || time.Now().After(reset.ExpiresAt) {
-		return c.Status(400).JSON(fiber.Map{"error": "Invalid or expired token"})
+		return sendError(c, 400, "invalid_reset_token")
 	}
 
 	userRepo := repositories.NewUserRepository(config.DB)
 	user, err := userRepo.FindByID(reset.UserID)
 	if err != nil {
-		return c.Status(400).JSON(fiber.Map{"error": "User not found"})
+		return sendError(c, 400, "user_not_found")
 	}
 
 	hashed, _ := bcrypt.GenerateFromPassword([]byte(req.NewPassword), 10)
@@ -178,6 +455,10 @@ func ResetPassword(c *fiber.Ctx) error {
 	config.DB.Save(&user)
 
 	config.DB.Delete(&reset)
+	revokeUserTokens(user.ID)
+
+	recordAudit(c, "user.password_reset", models.AuditTargetUser, user.ID, nil, nil)
+	queueEmail(user, models.EmailPasswordChanged, user.ID, fiber.Map{"ChangedAt": emailTime(time.Now())})
 
-	return c.JSON(fiber.Map{"message": "Password updated successfully"})
+	return c.JSON(fiber.Map{"message": localize(c, "password_updated")})
 }
@@ -0,0 +1,46 @@
+package controllers
+
+import (
+	"testing"
+	"time"
+
+	"tawtheeq-backend/models"
+)
+
+func TestRefreshTokenState(t *testing.T) {
+	now := time.Now()
+	revokedAt := now.Add(-time.Minute)
+	replacedBy := "next"
+
+	tests := []struct {
+		name  string
+		token models.RefreshToken
+		want  refreshState
+	}{
+		{"live", models.RefreshToken{ExpiresAt: now.Add(time.Hour)}, refreshUsable},
+		{"expired", models.RefreshToken{ExpiresAt: now.Add(-time.Second)}, refreshInvalid},
+		{"logged out", models.RefreshToken{ExpiresAt: now.Add(time.Hour), RevokedAt: &revokedAt}, refreshInvalid},
+		{"rotated", models.RefreshToken{ExpiresAt: now.Add(time.Hour), RevokedAt: &revokedAt, ReplacedByID: &replacedBy}, refreshReused},
+		{"rotated and expired", models.RefreshToken{ExpiresAt: now.Add(-time.Hour), RevokedAt: &revokedAt, ReplacedByID: &replacedBy}, refreshReused},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := refreshTokenState(&tt.token, now); got != tt.want {
+				t.Errorf("refreshTokenState = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHashRefreshToken(t *testing.T) {
+	a, b := hashRefreshToken("token-a"), hashRefreshToken("token-b")
+	if a == b {
+		t.Error("different tokens hash the same")
+	}
+	if a != hashRefreshToken("token-a") {
+		t.Error("hash is not stable")
+	}
+	if len(a) != 64 || a == "token-a" {
+		t.Errorf("hash %q is not a hex SHA-256", a)
+	}
+}
@@ -0,0 +1,145 @@
+// DocumentContentController
+package controllers
+
+import (
+	"fmt"
+	"strings"
+
+	"tawtheeq-backend/config"
+	"tawtheeq-backend/models"
+	"tawtheeq-backend/repositories"
+	"tawtheeq-backend/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	contentSnippetsPerDocument = 3
+	contentSnippetRadius       = 80
+)
+
+// indexDocumentContent stores the text extracted from a PDF before it was
+// stamped, so the document can be found by what it says.
+func indexDocumentContent(documentID string, pages []string) {
+	if len(pages) == 0 {
+		return
+	}
+	text := strings.Join(pages, utils.PageSeparator)
+	if strings.TrimSpace(strings.ReplaceAll(text, utils.PageSeparator, "")) == "" {
+		return
+	}
+
+	contentRepo := repositories.NewDocumentContentRepository(config.DB)
+	err := contentRepo.Create(&models.DocumentContent{
+		DocumentID:     documentID,
+		Text:           text,
+		NormalizedText: utils.NormalizeText(text),
+		Pages:          len(pages),
+	})
+	if err != nil {
+		utils.HandleError(err, fmt.Sprintf("Failed to index text of document %s", documentID), utils.Warning)
+	}
+}
+
+// fulltextQuery turns search terms into a MySQL boolean mode query requiring
+// every term, each matched as a word prefix.
+func fulltextQuery(terms []string) string {
+	operators := strings.NewReplacer(`+`, " ", `-`, " ", `<`, " ", `>`, " ", `(`, " ", `)`, " ", `~`, " ", `*`, " ", `"`, " ", `@`, " ")
+	parts := make([]string, 0, len(terms))
+	for _, term := range terms {
+		for _, word := range strings.Fields(operators.Replace(term)) {
+			parts = append(parts, "+"+word+"*")
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// SearchDocumentContent godoc
+// @Summary Search document text
+// @Description Finds signed PDFs by the text they contain, most relevant first, with excerpts around the matches. Arabic diacritics, tatweel and alef, ya, waw and ta marbuta variants are ignored. Highlights are [start, end) character offsets into each excerpt. Accepts the filters of /documents/search and the same role and team scope
+// @Tags documents
+// @Produce json
+// @Param q query string true "Words the document contains"
+// @Param format query string false "File format, e.g. pdf"
+// @Param signed_by_user_id query string false "Signer ID"
+// @Param team_id query string false "Signing team ID"
+// @Param from query string false "Signed on or after (YYYY-MM-DD)"
+// @Param to query string false "Signed on or before (YYYY-MM-DD)"
+// @Param tags query string false "Comma separated tags; documents must carry all of them"
+// @Param limit query int false "Limit" default(10)
+// @Param page query int false "Page" default(1)
+// @Success 200 {object} models.ListResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /documents/search/content [get]
+// @Security Bearer
+func SearchDocumentContent(c *fiber.Ctx) error {
+	terms := utils.SearchTerms(c.Query("q"))
+	match := fulltextQuery(terms)
+	if match == "" {
+		return sendError(c, fiber.StatusBadRequest, "query_required")
+	}
+
+	filter, err := documentSearchFilterFromQuery(c)
+	if err != nil {
+		return sendErrorFrom(c, fiber.StatusBadRequest, err)
+	}
+	// q is the content query here, not a file name filter
+	filter.Query = ""
+
+	p, err := paginationFromQuery(c, models.DefaultPageSize)
+	if err != nil {
+		return sendErrorFrom(c, fiber.StatusBadRequest, err)
+	}
+	// results are ranked by relevance, which a cursor cannot follow
+	if p.Cursor != nil {
+		return sendErrorFrom(c, fiber.StatusBadRequest, errCursorUnsupported)
+	}
+
+	docRepo := repositories.NewDocumentRepository(config.DB)
+	matches, err := docRepo.SearchContent(filter, match, p)
+	if err != nil {
+		utils.HandleError(err, "Failed to search document text", utils.Error)
+		return sendError(c, fiber.StatusInternalServerError, "document_search_failed")
+	}
+	total, err := docRepo.CountContent(filter, match)
+	if err != nil {
+		utils.HandleError(err, "Failed to count document text matches", utils.Warning)
+	}
+
+	ids := make([]string, 0, len(matches))
+	for _, m := range matches {
+		ids = append(ids, m.DocumentID)
+	}
+	docs, err := docRepo.FindWithRelationsByIDs(ids)
+	if err != nil {
+		utils.HandleError(err, "Failed to load matching documents", utils.Error)
+		return sendError(c, fiber.StatusInternalServerError, "document_search_failed")
+	}
+	byID := make(map[string]*models.Document, len(docs))
+	for i := range docs {
+		byID[docs[i].ID] = &docs[i]
+	}
+
+	contentRepo := repositories.NewDocumentContentRepository(config.DB)
+	contents, err := contentRepo.FindByDocumentIDs(ids)
+	if err != nil {
+		utils.HandleError(err, "Failed to load document text", utils.Warning)
+	}
+
+	results := make([]fiber.Map, 0, len(matches))
+	for _, m := range matches {
+		doc, ok := byID[m.DocumentID]
+		if !ok {
+			continue
+		}
+		pages := strings.Split(contents[m.DocumentID].Text, utils.PageSeparator)
+		results = append(results, fiber.Map{
+			"document": models.BuildDocumentResponse(doc),
+			"score":    m.Score,
+			"snippets": utils.ContentSnippets(pages, terms, contentSnippetsPerDocument, contentSnippetRadius),
+		})
+	}
+
+	return sendList(c, results, p, total, "")
+}
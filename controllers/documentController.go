@@ -1,13 +1,10 @@
 package controllers
 
 import (
-	"bytes"
-	"context"
+	"errors"
 	"fmt"
 	"os"
-	"strconv"
 	"strings"
-	"time"
 
 	"tawtheeq-backend/config"
 	"tawtheeq-backend/models"
@@ -15,9 +12,80 @@ import (
 	"tawtheeq-backend/utils"
 
 	"github.com/gofiber/fiber/v2"
-	"github.com/minio/minio-go/v7"
+	"gorm.io/gorm"
 )
 
+const (
+	DuplicateScopeUser   = "user"
+	DuplicateScopeTeam   = "team"
+	DuplicateScopeGlobal = "global"
+)
+
+// duplicateScope returns DUPLICATE_SCOPE: which existing documents block a
+// new upload of the same content. It defaults to global.
+func duplicateScope() string {
+	switch strings.ToLower(os.Getenv("DUPLICATE_SCOPE")) {
+	case DuplicateScopeUser:
+		return DuplicateScopeUser
+	case DuplicateScopeTeam:
+		return DuplicateScopeTeam
+	default:
+		return DuplicateScopeGlobal
+	}
+}
+
+// findDuplicateDocument returns a document with the same content hash inside
+// the duplicate scope, or nil. In global scope a team may still sign content
+// another team has signed when resign is requested and
+// DUPLICATE_ALLOW_TEAM_RESIGN is true; only its own team's copies count then.
+// Callers without a team fall back from team to user scope.
+func findDuplicateDocument(hash string, userID string, teamID string, resign bool) (*models.Document, error) {
+	scope := duplicateScope()
+	if scope == DuplicateScopeGlobal && resign && os.Getenv("DUPLICATE_ALLOW_TEAM_RESIGN") == "true" {
+		scope = DuplicateScopeTeam
+	}
+	if scope == DuplicateScopeTeam && teamID == "" {
+		scope = DuplicateScopeUser
+	}
+
+	docRepo := repositories.NewDocumentRepository(config.DB)
+	var doc *models.Document
+	var err error
+	switch scope {
+	case DuplicateScopeUser:
+		doc, err = docRepo.FindByHashForUser(hash, userID)
+	case DuplicateScopeTeam:
+		doc, err = docRepo.FindByHashForTeam(hash, teamID)
+	default:
+		doc, err = docRepo.FindByHash(hash)
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	return doc, err
+}
+
+// sendDuplicateDocument answers an upload of content that was already signed
+// within the duplicate scope. Only callers allowed to see the existing
+// document get it described.
+func sendDuplicateDocument(c *fiber.Ctx, existingDoc *models.Document) error {
+	if !canAccessDocument(c, existingDoc) {
+		return sendError(c, fiber.StatusBadRequest, "file_already_signed")
+	}
+	repoDocument := repositories.NewDocumentRepository(config.DB)
+	if withRelations, err := repoDocument.FindWithRelations(existingDoc.ID); err == nil {
+		existingDoc = withRelations
+	}
+	return c.Status(fiber.StatusBadRequest).JSON(
+		fiber.Map{
+			"error":    localize(c, "file_already_exists"),
+			"code":     "file_already_exists",
+			"createAt": existingDoc.CreatedAt,
+			"document": models.BuildDocumentResponse(existingDoc),
+		},
+	)
+}
+
 // HideDocumentFromMe godoc
 // @Summary Hide document
 // @Description Hide document
@@ -38,9 +106,13 @@ func HideDocumentFromMe(c *fiber.Ctx) error {
 	err := docRepo.HideFromUser(id, userId)
 	if err != nil {
 		utils.HandleError(err, fmt.Sprintf("Failed to hide document %s", id), utils.Error)
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to hide document"})
+		return sendError(c, fiber.StatusInternalServerError, "document_hide_failed")
 	}
-	return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Document hidden successfully"})
+	recordAudit(c, "document.hide_from_user", models.AuditTargetDocument, id, fiber.Map{"is_hidden": false}, fiber.Map{"is_hidden": true})
+	emitDocumentWebhookByID(models.WebhookEventDocumentHidden, id, func(doc *models.Document) bool {
+		return doc.IsHidden && doc.SignedByUserID == userId
+	})
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": localize(c, "document_hidden")})
 }
 
 // HideDocumentFromMyTeam godoc
@@ -52,20 +124,28 @@ func HideDocumentFromMe(c *fiber.Ctx) error {
 // @Param id path string true "Document ID"
 // @Success 200 {object} models.DocumentResponse
 // @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
 // @Failure 404 {object} models.ErrorResponse
 // @Router /documents/myteam/{id}/hide [get]
 // @Security Bearer
 func HideDocumentFromMyTeam(c *fiber.Ctx) error {
 	docRepo := repositories.NewDocumentRepository(config.DB)
 	id := c.Params("id")
-	teamID := c.Locals("team_id").(string)
+	teamID, ok := c.Locals("teamId").(string)
+	if !ok || teamID == "" {
+		return sendError(c, fiber.StatusForbidden, "not_in_team")
+	}
 
 	err := docRepo.HideFromTeam(id, teamID)
 	if err != nil {
 		utils.HandleError(err, fmt.Sprintf("Failed to hide document %s", id), utils.Error)
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to hide document"})
+		return sendError(c, fiber.StatusInternalServerError, "document_hide_failed")
 	}
-	return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Document hidden successfully"})
+	recordAudit(c, "document.hide_from_team", models.AuditTargetDocument, id, fiber.Map{"is_hidden": false}, fiber.Map{"is_hidden": true})
+	emitDocumentWebhookByID(models.WebhookEventDocumentHidden, id, func(doc *models.Document) bool {
+		return doc.IsHidden && doc.SignedByTeamID != nil && *doc.SignedByTeamID == teamID
+	})
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": localize(c, "document_hidden")})
 }
 
 // HideDocumentSuperAdmin godoc
@@ -87,9 +167,11 @@ func HideDocumentSuperAdmin(c *fiber.Ctx) error {
 	err := docRepo.Hide(id)
 	if err != nil {
 		utils.HandleError(err, fmt.Sprintf("Failed to hide document %s", id), utils.Error)
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to hide document"})
+		return sendError(c, fiber.StatusInternalServerError, "document_hide_failed")
 	}
-	return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Document hidden successfully"})
+	recordAudit(c, "document.hide", models.AuditTargetDocument, id, fiber.Map{"is_hidden": false}, fiber.Map{"is_hidden": true})
+	emitDocumentWebhookByID(models.WebhookEventDocumentHidden, id, func(doc *models.Document) bool { return doc.IsHidden })
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": localize(c, "document_hidden")})
 }
 
 // ShowDocumentSuperAdmin	godoc
@@ -111,9 +193,11 @@ func ShowDocumentSuperAdmin(c *fiber.Ctx) error {
 	err := docRepo.Show(id)
 	if err != nil {
 		utils.HandleError(err, fmt.Sprintf("Failed to show document %s", id), utils.Error)
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to show document"})
+		return sendError(c, fiber.StatusInternalServerError, "document_show_failed")
 	}
-	return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Document shown successfully"})
+	recordAudit(c, "document.show", models.AuditTargetDocument, id, fiber.Map{"is_hidden": true}, fiber.Map{"is_hidden": false})
+	emitDocumentWebhookByID(models.WebhookEventDocumentShown, id, func(doc *models.Document) bool { return !doc.IsHidden })
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": localize(c, "document_shown")})
 }
 
 // GetAllDocumentsFromMyTeam godoc
@@ -124,32 +208,32 @@ func ShowDocumentSuperAdmin(c *fiber.Ctx) error {
 // @Produce json
 // @Param limit query int false "Limit"
 // @Param page query int false "Page"
-// @Success 200 {object} models.DocumentResponse
+// @Param cursor query string false "meta.next_cursor of the previous page"
+// @Success 200 {object} models.ListResponse{data=[]models.Document}
 // @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
 // @Failure 404 {object} models.ErrorResponse
 // @Router /documents/myteam [get]
+// @Security Bearer
 func GetAllDocumentsFromMyTeam(c *fiber.Ctx) error {
 	docRepo := repositories.NewDocumentRepository(config.DB)
-	teamID := c.Locals("team_id").(string)
+	teamID, ok := c.Locals("teamId").(string)
+	if !ok || teamID == "" {
+		return sendError(c, fiber.StatusForbidden, "not_in_team")
+	}
 
-	limit, _ := strconv.Atoi(c.Query("limit", "10"))
-	page, _ := strconv.Atoi(c.Query("page", "1"))
-	offset := (page - 1) * limit
+	p, err := paginationFromQuery(c, models.DefaultPageSize)
+	if err != nil {
+		return sendErrorFrom(c, fiber.StatusBadRequest, err)
+	}
 
-	docs, err := docRepo.FindByTeamVisible(teamID, limit, offset)
+	docs, total, err := docRepo.FindByTeamVisible(teamID, p)
 	if err != nil {
 		utils.HandleError(err, "Failed to fetch documents", utils.Warning)
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch documents"})
+		return sendError(c, fiber.StatusInternalServerError, "documents_fetch_failed")
 	}
 
-	return c.JSON(fiber.Map{
-		"documents": docs,
-		"meta": fiber.Map{
-			"page":   page,
-			"limit":  limit,
-			"offset": offset,
-		},
-	})
+	return sendList(c, docs, p, total, nextCursor(p, docs, documentCreated))
 }
 
 // GetAllDocumentsFromMeHidden godoc
@@ -160,7 +244,8 @@ func GetAllDocumentsFromMyTeam(c *fiber.Ctx) error {
 // @Produce json
 // @Param limit query int false "Limit"
 // @Param page query int false "Page"
-// @Success 200 {object} models.DocumentResponse
+// @Param cursor query string false "meta.next_cursor of the previous page"
+// @Success 200 {object} models.ListResponse{data=[]models.Document}
 // @Failure 400 {object} models.ErrorResponse
 // @Failure 404 {object} models.ErrorResponse
 // @Router /documents/me/hidden [get]
@@ -169,24 +254,18 @@ func GetAllDocumentsFromMeHidden(c *fiber.Ctx) error {
 	docRepo := repositories.NewDocumentRepository(config.DB)
 	userId := c.Locals("userID").(string)
 
-	limit, _ := strconv.Atoi(c.Query("limit", "10"))
-	page, _ := strconv.Atoi(c.Query("page", "1"))
-	offset := (page - 1) * limit
+	p, err := paginationFromQuery(c, models.DefaultPageSize)
+	if err != nil {
+		return sendErrorFrom(c, fiber.StatusBadRequest, err)
+	}
 
-	docs, err := docRepo.FindByUserHidden(userId, limit, offset)
+	docs, total, err := docRepo.FindByUserHidden(userId, p)
 	if err != nil {
 		utils.HandleError(err, "Failed to fetch documents", utils.Warning)
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch documents"})
+		return sendError(c, fiber.StatusInternalServerError, "documents_fetch_failed")
 	}
 
-	return c.JSON(fiber.Map{
-		"documents": docs,
-		"meta": fiber.Map{
-			"page":   page,
-			"limit":  limit,
-			"offset": offset,
-		},
-	})
+	return sendList(c, docs, p, total, nextCursor(p, docs, documentCreated))
 }
 
 // GetAllDocumentsFromMeVisible godoc
@@ -197,7 +276,8 @@ func GetAllDocumentsFromMeHidden(c *fiber.Ctx) error {
 // @Produce json
 // @Param limit query int false "Limit"
 // @Param page query int false "Page"
-// @Success 200 {object} models.DocumentResponse
+// @Param cursor query string false "meta.next_cursor of the previous page"
+// @Success 200 {object} models.ListResponse{data=[]models.Document}
 // @Failure 400 {object} models.ErrorResponse
 // @Failure 404 {object} models.ErrorResponse
 // @Router /documents/user/me [get]
@@ -206,24 +286,18 @@ func GetAllDocumentsFromMeVisible(c *fiber.Ctx) error {
 	docRepo := repositories.NewDocumentRepository(config.DB)
 	userId := c.Locals("userID").(string)
 
-	limit, _ := strconv.Atoi(c.Query("limit", "10"))
-	page, _ := strconv.Atoi(c.Query("page", "1"))
-	offset := (page - 1) * limit
+	p, err := paginationFromQuery(c, models.DefaultPageSize)
+	if err != nil {
+		return sendErrorFrom(c, fiber.StatusBadRequest, err)
+	}
 
-	docs, err := docRepo.FindByUserVisible(userId, limit, offset)
+	docs, total, err := docRepo.FindByUserVisible(userId, p)
 	if err != nil {
 		utils.HandleError(err, "Failed to fetch documents", utils.Warning)
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch documents"})
+		return sendError(c, fiber.StatusInternalServerError, "documents_fetch_failed")
 	}
 
-	return c.JSON(fiber.Map{
-		"documents": docs,
-		"meta": fiber.Map{
-			"page":   page,
-			"limit":  limit,
-			"offset": offset,
-		},
-	})
+	return sendList(c, docs, p, total, nextCursor(p, docs, documentCreated))
 }
 
 // GetAllDocumentsFromUserHidden godoc
@@ -235,7 +309,8 @@ func GetAllDocumentsFromMeVisible(c *fiber.Ctx) error {
 // @Param user_id path string true "User ID"
 // @Param limit query int false "Limit"
 // @Param page query int false "Page"
-// @Success 200 {object} models.DocumentResponse
+// @Param cursor query string false "meta.next_cursor of the previous page"
+// @Success 200 {object} models.ListResponse{data=[]models.Document}
 // @Failure 400 {object} models.ErrorResponse
 // @Failure 404 {object} models.ErrorResponse
 // @Router /documents/user/{user_id}/hidden [get]
@@ -244,24 +319,18 @@ func GetAllDocumentsFromUserHidden(c *fiber.Ctx) error {
 	docRepo := repositories.NewDocumentRepository(config.DB)
 	userID := c.Params("user_id")
 
-	limit, _ := strconv.Atoi(c.Query("limit", "10"))
-	page, _ := strconv.Atoi(c.Query("page", "1"))
-	offset := (page - 1) * limit
+	p, err := paginationFromQuery(c, models.DefaultPageSize)
+	if err != nil {
+		return sendErrorFrom(c, fiber.StatusBadRequest, err)
+	}
 
-	docs, err := docRepo.FindByUserHidden(userID, limit, offset)
+	docs, total, err := docRepo.FindByUserHidden(userID, p)
 	if err != nil {
 		utils.HandleError(err, "Failed to fetch documents", utils.Warning)
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch documents"})
+		return sendError(c, fiber.StatusInternalServerError, "documents_fetch_failed")
 	}
 
-	return c.JSON(fiber.Map{
-		"documents": docs,
-		"meta": fiber.Map{
-			"page":   page,
-			"limit":  limit,
-			"offset": offset,
-		},
-	})
+	return sendList(c, docs, p, total, nextCursor(p, docs, documentCreated))
 }
 
 // GetAllDocumentsFromUserVisible godoc
@@ -273,7 +342,8 @@ func GetAllDocumentsFromUserHidden(c *fiber.Ctx) error {
 // @Param user_id path string true "User ID"
 // @Param limit query int false "Limit"
 // @Param page query int false "Page"
-// @Success 200 {object} models.DocumentResponse
+// @Param cursor query string false "meta.next_cursor of the previous page"
+// @Success 200 {object} models.ListResponse{data=[]models.Document}
 // @Failure 400 {object} models.ErrorResponse
 // @Failure 404 {object} models.ErrorResponse
 // @Router /documents/user/{user_id}/visible [get]
@@ -282,24 +352,18 @@ func GetAllDocumentsFromUserVisible(c *fiber.Ctx) error {
 	docRepo := repositories.NewDocumentRepository(config.DB)
 	userID := c.Params("user_id")
 
-	limit, _ := strconv.Atoi(c.Query("limit", "10"))
-	page, _ := strconv.Atoi(c.Query("page", "1"))
-	offset := (page - 1) * limit
+	p, err := paginationFromQuery(c, models.DefaultPageSize)
+	if err != nil {
+		return sendErrorFrom(c, fiber.StatusBadRequest, err)
+	}
 
-	docs, err := docRepo.FindByUserVisible(userID, limit, offset)
+	docs, total, err := docRepo.FindByUserVisible(userID, p)
 	if err != nil {
 		utils.HandleError(err, "Failed to fetch documents", utils.Warning)
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch documents"})
+		return sendError(c, fiber.StatusInternalServerError, "documents_fetch_failed")
 	}
 
-	return c.JSON(fiber.Map{
-		"documents": docs,
-		"meta": fiber.Map{
-			"page":   page,
-			"limit":  limit,
-			"offset": offset,
-		},
-	})
+	return sendList(c, docs, p, total, nextCursor(p, docs, documentCreated))
 }
 
 // GetAllDocumentsFromTeamHidden godoc
@@ -311,7 +375,8 @@ func GetAllDocumentsFromUserVisible(c *fiber.Ctx) error {
 // @Param team_id path string true "Team ID"
 // @Param limit query int false "Limit"
 // @Param page query int false "Page"
-// @Success 200 {object} models.DocumentResponse
+// @Param cursor query string false "meta.next_cursor of the previous page"
+// @Success 200 {object} models.ListResponse{data=[]models.Document}
 // @Failure 400 {object} models.ErrorResponse
 // @Failure 404 {object} models.ErrorResponse
 // @Router /documents/team/{team_id}/hidden [get]
@@ -320,24 +385,18 @@ func GetAllDocumentsFromTeamHidden(c *fiber.Ctx) error {
 	docRepo := repositories.NewDocumentRepository(config.DB)
 	teamID := c.Params("team_id")
 
-	limit, _ := strconv.Atoi(c.Query("limit", "10"))
-	page, _ := strconv.Atoi(c.Query("page", "1"))
-	offset := (page - 1) * limit
+	p, err := paginationFromQuery(c, models.DefaultPageSize)
+	if err != nil {
+		return sendErrorFrom(c, fiber.StatusBadRequest, err)
+	}
 
-	docs, err := docRepo.FindByTeamHidden(teamID, limit, offset)
+	docs, total, err := docRepo.FindByTeamHidden(teamID, p)
 	if err != nil {
 		utils.HandleError(err, "Failed to fetch documents", utils.Warning)
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch documents"})
+		return sendError(c, fiber.StatusInternalServerError, "documents_fetch_failed")
 	}
 
-	return c.JSON(fiber.Map{
-		"documents": docs,
-		"meta": fiber.Map{
-			"page":   page,
-			"limit":  limit,
-			"offset": offset,
-		},
-	})
+	return sendList(c, docs, p, total, nextCursor(p, docs, documentCreated))
 }
 
 // GetAllDocumentsFromTeamVisible godoc
@@ -349,7 +408,8 @@ func GetAllDocumentsFromTeamHidden(c *fiber.Ctx) error {
 // @Param team_id path string true "Team ID"
 // @Param limit query int false "Limit"
 // @Param page query int false "Page"
-// @Success 200 {object} models.DocumentResponse
+// @Param cursor query string false "meta.next_cursor of the previous page"
+// @Success 200 {object} models.ListResponse{data=[]models.Document}
 // @Failure 400 {object} models.ErrorResponse
 // @Failure 404 {object} models.ErrorResponse
 // @Router /documents/team/{team_id}/visible [get]
@@ -358,24 +418,18 @@ func GetAllDocumentsFromTeamVisible(c *fiber.Ctx) error {
 	docRepo := repositories.NewDocumentRepository(config.DB)
 	teamID := c.Params("team_id")
 
-	limit, _ := strconv.Atoi(c.Query("limit", "10"))
-	page, _ := strconv.Atoi(c.Query("page", "1"))
-	offset := (page - 1) * limit
+	p, err := paginationFromQuery(c, models.DefaultPageSize)
+	if err != nil {
+		return sendErrorFrom(c, fiber.StatusBadRequest, err)
+	}
 
-	docs, err := docRepo.FindByTeamVisible(teamID, limit, offset)
+	docs, total, err := docRepo.FindByTeamVisible(teamID, p)
 	if err != nil {
 		utils.HandleError(err, "Failed to fetch documents", utils.Warning)
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch documents"})
+		return sendError(c, fiber.StatusInternalServerError, "documents_fetch_failed")
 	}
 
-	return c.JSON(fiber.Map{
-		"documents": docs,
-		"meta": fiber.Map{
-			"page":   page,
-			"limit":  limit,
-			"offset": offset,
-		},
-	})
+	return sendList(c, docs, p, total, nextCursor(p, docs, documentCreated))
 }
 
 // GetAllDocumentsHidden godoc
@@ -386,7 +440,8 @@ func GetAllDocumentsFromTeamVisible(c *fiber.Ctx) error {
 // @Produce json
 // @Param limit query int false "Limit"
 // @Param page query int false "Page"
-// @Success 200 {object} models.DocumentResponse
+// @Param cursor query string false "meta.next_cursor of the previous page"
+// @Success 200 {object} models.ListResponse{data=[]models.Document}
 // @Failure 400 {object} models.ErrorResponse
 // @Failure 404 {object} models.ErrorResponse
 // @Router /documents/hidden [get]
@@ -394,24 +449,18 @@ func GetAllDocumentsFromTeamVisible(c *fiber.Ctx) error {
 func GetAllDocumentsHidden(c *fiber.Ctx) error {
 	docRepo := repositories.NewDocumentRepository(config.DB)
 
-	limit, _ := strconv.Atoi(c.Query("limit", "10"))
-	page, _ := strconv.Atoi(c.Query("page", "1"))
-	offset := (page - 1) * limit
+	p, err := paginationFromQuery(c, models.DefaultPageSize)
+	if err != nil {
+		return sendErrorFrom(c, fiber.StatusBadRequest, err)
+	}
 
-	docs, err := docRepo.FindAllHidden(limit, offset)
+	docs, total, err := docRepo.FindAllHidden(p)
 	if err != nil {
 		utils.HandleError(err, "Failed to fetch documents", utils.Warning)
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch documents"})
+		return sendError(c, fiber.StatusInternalServerError, "documents_fetch_failed")
 	}
-	return c.JSON(fiber.Map{
-		"documents": docs,
-		"meta": fiber.Map{
-			"page":   page,
-			"limit":  limit,
-			"offset": offset,
-		},
-	})
 
+	return sendList(c, docs, p, total, nextCursor(p, docs, documentCreated))
 }
 
 // GetAllDocumentsVisible godoc
@@ -422,7 +471,8 @@ func GetAllDocumentsHidden(c *fiber.Ctx) error {
 // @Produce json
 // @Param limit query int false "Limit"
 // @Param page query int false "Page"
-// @Success 200 {object} models.DocumentResponse
+// @Param cursor query string false "meta.next_cursor of the previous page"
+// @Success 200 {object} models.ListResponse{data=[]models.Document}
 // @Failure 400 {object} models.ErrorResponse
 // @Failure 404 {object} models.ErrorResponse
 // @Router /documents/visible [get]
@@ -430,24 +480,18 @@ func GetAllDocumentsHidden(c *fiber.Ctx) error {
 func GetAllDocumentsVisible(c *fiber.Ctx) error {
 	docRepo := repositories.NewDocumentRepository(config.DB)
 
-	limit, _ := strconv.Atoi(c.Query("limit", "10"))
-	page, _ := strconv.Atoi(c.Query("page", "1"))
-	offset := (page - 1) * limit
+	p, err := paginationFromQuery(c, models.DefaultPageSize)
+	if err != nil {
+		return sendErrorFrom(c, fiber.StatusBadRequest, err)
+	}
 
-	docs, err := docRepo.FindAllVisible(limit, offset)
+	docs, total, err := docRepo.FindAllVisible(p)
 	if err != nil {
 		utils.HandleError(err, "Failed to fetch documents", utils.Warning)
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch documents"})
+		return sendError(c, fiber.StatusInternalServerError, "documents_fetch_failed")
 	}
-	return c.JSON(fiber.Map{
-		"documents": docs,
-		"meta": fiber.Map{
-			"page":   page,
-			"limit":  limit,
-			"offset": offset,
-		},
-	})
 
+	return sendList(c, docs, p, total, nextCursor(p, docs, documentCreated))
 }
 
 // SignFileHandlerNew godoc
@@ -457,6 +501,20 @@ func GetAllDocumentsVisible(c *fiber.Ctx) error {
 // @Accept multipart/form-data
 // @Produce json
 // @Param file formData file true "File to upload"
+// @Param template_id formData string false "Stamp template ID (defaults to the team template)"
+// @Param pages formData string false "PDF pages to stamp: all, first, last or a list such as 1,3" default(all)
+// @Param anchor formData string false "Stamp box anchor: top-left, top-center, top-right, middle-left, center, middle-right, bottom-left, bottom-center, bottom-right. Empty keeps the full-width bar"
+// @Param offset_x formData number false "Horizontal offset from the anchor (pixels for images, points for PDFs)"
+// @Param offset_y formData number false "Vertical offset from the anchor (pixels for images, points for PDFs)"
+// @Param width formData number false "Stamp box width (defaults to the page width)"
+// @Param height formData number false "Stamp box height (defaults to fit the text and QR code)"
+// @Param resign formData bool false "Sign content another team already signed as a new document (needs DUPLICATE_ALLOW_TEAM_RESIGN)"
+// @Param title formData string false "Document title"
+// @Param description formData string false "Document description"
+// @Param reference_number formData string false "Free-form reference number"
+// @Param tags formData string false "Comma separated tags"
+// @Param custom_fields formData string false "JSON object with values for the team's custom fields"
+// @Param seal_metadata formData bool false "Sign the metadata so it can no longer be changed"
 // @Success 200 {object} models.UploadResponse
 // @Failure 400 {object} models.ErrorResponse
 // @Failure 500 {object} models.ErrorResponse
@@ -464,27 +522,25 @@ func GetAllDocumentsVisible(c *fiber.Ctx) error {
 // @Security Bearer
 func SignFileHandler(c *fiber.Ctx) error {
 
-	uploadDir := ""
-	if os.Getenv("S3_ENABLED") == "true" {
-		uploadDir = os.Getenv("TEMP_DIR")
-		if uploadDir == "" {
-			utils.HandleError(
-				fmt.Errorf("TEMP_DIR not set"),
-				"TEMP_DIR not set, using default ./temp",
-				utils.Error,
-			)
-			uploadDir = "./temp"
-		}
-	} else {
-		uploadDir = os.Getenv("LOCALLY_UPLOAD_DIR")
-		if uploadDir == "" {
-			utils.HandleError(
-				fmt.Errorf("LOCALLY_UPLOAD_DIR not set"),
-				"LOCALLY_UPLOAD_DIR not set, using default ./uploads",
-				utils.Error,
-			)
-			uploadDir = "./uploads"
-		}
+	userVal := c.Locals("userID")
+	userId := ""
+	if userVal != nil {
+		userId, _ = userVal.(string)
+	}
+	teamVal := c.Locals("teamId")
+	teamId := ""
+	if teamVal != nil {
+		teamId, _ = teamVal.(string)
+	}
+
+	if userId == "" {
+		utils.HandleError(fmt.Errorf("userID not found"), "User ID not found", utils.Warning)
+		return sendError(c, fiber.StatusUnauthorized, "missing_user_id")
+	}
+
+	uploadDir := os.Getenv("TEMP_DIR")
+	if uploadDir == "" {
+		uploadDir = "./temp"
 	}
 
 	// upload the file temporarily
@@ -492,6 +548,13 @@ func SignFileHandler(c *fiber.Ctx) error {
 	if err != nil {
 		return utils.HandleError(err, "Failed to upload file", utils.Error)
 	}
+	// the upload is stamped in place and copied into storage, so the temp
+	// file goes on every path
+	defer func() {
+		if err := os.Remove(localPath); err != nil {
+			utils.HandleError(err, "Failed to remove temporary file", utils.Warning)
+		}
+	}()
 	defer localFile.Close()
 
 	// get the hash of the file
@@ -500,23 +563,39 @@ func SignFileHandler(c *fiber.Ctx) error {
 		return utils.HandleError(err, "Failed to calculate file hash", utils.Error)
 	}
 
-	// check if the file already exists
-	repoDocument := repositories.NewDocumentRepository(config.DB)
-	existingDoc, _ := repoDocument.FindByHash(hash)
+	// check if the file was already signed within the duplicate scope
+	existingDoc, err := findDuplicateDocument(hash, userId, teamId, c.FormValue("resign") == "true")
+	if err != nil {
+		utils.HandleError(err, "Failed to check for duplicate documents", utils.Error)
+		return sendError(c, fiber.StatusInternalServerError, "duplicate_check_failed")
+	}
 	if existingDoc != nil {
-		// remove the temporary file
-		if err := os.Remove(localPath); err != nil {
-			utils.HandleError(err, "Failed to remove temporary file", utils.Warning)
-		}
+		return sendDuplicateDocument(c, existingDoc)
+	}
 
-		// return the existing document
-		return c.Status(fiber.StatusBadRequest).JSON(
-			fiber.Map{
-				"error":    "File already exists",
-				"createAt": existingDoc.CreatedAt,
-				"document": existingDoc,
-			},
-		)
+	// title, tags and other metadata, checked before the file is stamped
+	metadata := &models.Document{}
+	metadataInput, err := documentMetadataFromForm(c)
+	if err == nil {
+		err = applyDocumentMetadata(metadata, metadataInput, teamId)
+	}
+	if err != nil {
+		return sendErrorFrom(c, fiber.StatusBadRequest, err)
+	}
+
+	// stamp look, pages and placement, checked against the real page sizes
+	stampOpts, err := stampOptionsFromForm(c, localPath, teamId)
+	if err != nil {
+		return sendErrorFrom(c, fiber.StatusBadRequest, err)
+	}
+	stampOpts.QRContent = buildQRContent(id, hash, userId)
+
+	// the text has to be read before stamping turns the pages into images
+	var pageTexts []string
+	if strings.HasSuffix(strings.ToLower(ext), ".pdf") {
+		if pageTexts, err = utils.ExtractPDFText(localPath); err != nil {
+			utils.HandleError(err, "Failed to extract PDF text, document will not be found by content", utils.Warning)
+		}
 	}
 
 	// generate a signature for the file
@@ -527,90 +606,111 @@ func SignFileHandler(c *fiber.Ctx) error {
 
 	// update image or pdf with the signature
 	if strings.HasSuffix(strings.ToLower(ext), ".jpg") || strings.HasSuffix(strings.ToLower(ext), ".jpeg") || strings.HasSuffix(strings.ToLower(ext), ".png") {
-		if err := utils.AddIDToImage(localPath, id, signature); err != nil {
+		if err := utils.AddIDToImage(localPath, id, signature, stampOpts); err != nil {
 			return utils.HandleError(err, "Failed to add ID to image", utils.Error)
 		}
 	}
 
 	if strings.HasSuffix(strings.ToLower(ext), ".pdf") {
-		if err := utils.AddIDToPDF(localPath, id, signature); err != nil {
+		if err := utils.AddIDToPDF(localPath, id, signature, stampOpts); err != nil {
 			return utils.HandleError(err, "Failed to add ID to PDF", utils.Error)
 		}
 	}
 
-	// upload the file to S3
-	newRandomHash, err := utils.CalculateFileHash(localPath)
+	// perceptual hashes of the stamped file, used to trace altered copies
+	perceptualHashes, err := utils.ComputePerceptualHashes(localPath, 0)
 	if err != nil {
-		return utils.HandleError(err, "Failed to calculate file hash", utils.Error)
+		utils.HandleError(err, "Failed to compute perceptual hashes", utils.Warning)
 	}
 
-	hashedFileName := ""
-	if os.Getenv("S3_ENABLED") == "true" {
-		hashedFileName = fmt.Sprintf("%s%s", newRandomHash, ext)
-		bucket := os.Getenv("S3_BUCKET")
-
-		// check if file already exists in S3
-		_, statErr := config.S3Client.StatObject(context.Background(), bucket, hashedFileName, minio.StatObjectOptions{})
-		if statErr != nil {
-			fileBytes, err := os.ReadFile(localPath)
-			if err != nil {
-				return utils.HandleError(err, "Failed to read file for S3 upload", utils.Error)
-			}
-
-			_, err = config.S3Client.PutObject(context.Background(), bucket, hashedFileName, bytes.NewReader(fileBytes), int64(len(fileBytes)), minio.PutObjectOptions{
-				ContentType: "application/octet-stream",
-			})
-			if err != nil {
-				return utils.HandleError(err, "Failed to upload file to S3", utils.Error)
-			}
-		}
-
-		// remove tmp file
-		if err := os.Remove(localPath); err != nil {
-			utils.HandleError(err, "Failed to remove temporary file", utils.Warning)
-		}
-
-	} else {
-		hashedFileName = localFileName
+	// move the stamped file into storage
+	newRandomHash, err := utils.CalculateFileHash(localPath)
+	if err != nil {
+		return utils.HandleError(err, "Failed to calculate file hash", utils.Error)
 	}
 
-	// save in database
-	userVal := c.Locals("userID")
-	userId := ""
-	if userVal != nil {
-		userId, _ = userVal.(string)
-	}
-	teamVal := c.Locals("teamId")
-	teamId := ""
-	if teamVal != nil {
-		teamId, _ = teamVal.(string)
+	stampedInfo, err := os.Stat(localPath)
+	if err != nil {
+		return utils.HandleError(err, "Failed to read signed file size", utils.Error)
 	}
 
-	if userId == "" {
-		utils.HandleError(fmt.Errorf("userID not found"), "User ID not found", utils.Warning)
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "User ID not found"})
+	hashedFileName := fmt.Sprintf("%s%s", newRandomHash, ext)
+	if err := storeFile(localPath, hashedFileName, documentContentType(ext)); err != nil {
+		return utils.HandleError(err, "Failed to store signed file", utils.Error)
 	}
 
+	// save in database
 	docRepo := repositories.NewDocumentRepository(config.DB)
 	doc := &models.Document{
-		OriginalName:   hashedFileName,
+		ID:             id,
+		OriginalName:   localFileName,
+		StorageKey:     hashedFileName,
 		FileFormat:     ext,
+		FileSize:       stampedInfo.Size(),
 		Hash:           hash,
 		Signature:      signature,
 		SignedByUserID: userId,
+
+		Title:           metadata.Title,
+		Description:     metadata.Description,
+		ReferenceNumber: metadata.ReferenceNumber,
+		Tags:            metadata.Tags,
+		CustomFields:    metadata.CustomFields,
 	}
 
 	if teamId != "" {
 		doc.SignedByTeamID = &teamId
 	}
 
-	if err := docRepo.Create(doc); err != nil {
+	if metadataInput.Seal {
+		if err := sealDocumentMetadata(doc); err != nil {
+			return utils.HandleError(err, "Failed to seal document metadata", utils.Error)
+		}
+	}
+
+	// the same content may have been signed while this file was stamped, so
+	// the check is repeated under the hash lock before the row goes in
+	err = docRepo.WithHashLock(hash, func() error {
+		existingDoc, err = findDuplicateDocument(hash, userId, teamId, c.FormValue("resign") == "true")
+		if err != nil || existingDoc != nil {
+			return err
+		}
+		return docRepo.Create(doc)
+	})
+	if err != nil || existingDoc != nil {
+		if err := RemoveFile(hashedFileName); err != nil {
+			utils.HandleError(err, fmt.Sprintf("Failed to remove stored file %s", hashedFileName), utils.Warning)
+		}
+	}
+	if err != nil {
 		utils.HandleError(err, "Failed to create document", utils.Error)
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to create document"})
+		return sendError(c, fiber.StatusInternalServerError, "document_create_failed")
 	}
+	if existingDoc != nil {
+		return sendDuplicateDocument(c, existingDoc)
+	}
+
+	phashRepo := repositories.NewPerceptualHashRepository(config.DB)
+	if err := phashRepo.CreateForDocument(doc.ID, perceptualHashes); err != nil {
+		utils.HandleError(err, fmt.Sprintf("Failed to store perceptual hashes for document %s", doc.ID), utils.Warning)
+	}
+	indexDocumentContent(doc.ID, pageTexts)
+
+	recordAudit(c, "document.sign", models.AuditTargetDocument, doc.ID, nil, fiber.Map{
+		"original_name": doc.OriginalName,
+		"hash":          doc.Hash,
+		"team_id":       doc.SignedByTeamID,
+		"title":         doc.Title,
+		"sealed":        doc.MetadataSignature != "",
+	})
+	emitDocumentWebhook(models.WebhookEventDocumentSigned, doc)
+	signedMail := emailDocument(doc)
+	signedMail["SignedAt"] = emailTime(doc.CreatedAt)
+	signedMail["VerifyURL"] = utils.VerifyURL(doc.ID)
+	queueEmailToUserID(userId, models.EmailDocumentSigned, doc.ID, signedMail)
 
 	return c.JSON(fiber.Map{
-		"message":   "File signed and uploaded successfully",
+		"message":   localize(c, "file_signed"),
 		"file":      hashedFileName,
 		"signature": signature,
 		"document":  doc,
@@ -619,22 +719,40 @@ func SignFileHandler(c *fiber.Ctx) error {
 
 // VerifyFileByIdHandler godoc
 // @Summary Verify file by ID
-// @Description Verify file by ID
+// @Description Verify file by ID. Anonymous callers get the public projection chosen by the signing team; the signer, members of the signing team and super admins get the full document
 // @Tags documents
 // @Accept json
 // @Produce json
 // @Param id path string true "Document ID"
-// @Success 200 {object} models.DocumentResponse
+// @Success 200 {object} models.PublicVerificationResponse
 // @Failure 400 {object} models.ErrorResponse
 // @Failure 404 {object} models.ErrorResponse
+// @Failure 410 {object} models.PublicVerificationResponse "Document was withdrawn by its signer"
 // @Router /verify/{id} [get]
 func VerifyFileByIdHandler(c *fiber.Ctx) error {
 	id := c.Params("id")
 	DocumentRepo := repositories.NewDocumentRepository(config.DB)
 	doc, err := DocumentRepo.FindWithRelations(id)
 	if err != nil {
+		if deleted, err := DocumentRepo.FindDeletedWithRelations(id); err == nil {
+			recordVerification(c, deleted, models.VerificationMethodID, models.VerificationResultWithdrawn)
+			resp := models.BuildWithdrawnVerificationResponse(deleted, verificationVisibility(deleted))
+			resp.MetadataIntact = documentMetadataIntact(deleted)
+			return c.Status(fiber.StatusGone).JSON(resp)
+		}
 		utils.HandleError(err, fmt.Sprintf("Document not found: %s", id), utils.Warning)
-		return c.Status(404).JSON(models.ErrorResponse{Error: "Document not found", CreateAt: time.Now()})
+		recordVerification(c, nil, models.VerificationMethodID, models.VerificationResultNotFound)
+		return sendError(c, 404, "document_not_found")
+	}
+	recordVerification(c, doc, models.VerificationMethodID, models.VerificationResultValid)
+
+	intact := documentMetadataIntact(doc)
+	if canAccessDocument(c, doc) {
+		resp := models.BuildDocumentResponse(doc)
+		resp.MetadataIntact = intact
+		return c.Status(200).JSON(resp)
 	}
-	return c.Status(200).JSON(doc)
+	resp := models.BuildPublicVerificationResponse(doc, verificationVisibility(doc))
+	resp.MetadataIntact = intact
+	return c.Status(200).JSON(resp)
 }
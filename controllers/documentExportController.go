@@ -0,0 +1,521 @@
+// DocumentExportController
+package controllers
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"tawtheeq-backend/config"
+	"tawtheeq-backend/models"
+	"tawtheeq-backend/repositories"
+	"tawtheeq-backend/storage"
+	"tawtheeq-backend/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// documentExportPrefix is the storage prefix of background export files.
+// The storage scrubber leaves these keys alone.
+const documentExportPrefix = "exports/"
+
+var documentExportContentTypes = map[string]string{
+	models.ExportFormatCSV:  "text/csv; charset=utf-8",
+	models.ExportFormatXLSX: "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+	models.ExportFormatPDF:  "application/pdf",
+}
+
+// documentExportSlots limits how many background exports run at once.
+var documentExportSlots = make(chan struct{}, 2)
+
+// documentRegisterColumns are the register columns. Widths are relative
+// and only used by the PDF layout.
+var documentRegisterColumns = []struct {
+	name  string
+	label string
+	width float64
+}{
+	{"id", "ID", 11},
+	{"title", "Title", 12},
+	{"original_name", "File name", 12},
+	{"reference_number", "Reference", 7},
+	{"signed_by", "Signed by", 9},
+	{"team", "Team", 8},
+	{"signed_at", "Signed at", 7.5},
+	{"updated_at", "Updated at", 7.5},
+	{"hash", "Hash", 17},
+	{"verification_count", "Verifications", 5},
+}
+
+// documentExportSyncLimit is the largest register streamed in the request,
+// from DOCUMENT_EXPORT_SYNC_LIMIT (default 1000). Larger ones run in the
+// background.
+func documentExportSyncLimit() int64 {
+	limit, err := strconv.ParseInt(os.Getenv("DOCUMENT_EXPORT_SYNC_LIMIT"), 10, 64)
+	if err != nil || limit < 0 {
+		limit = 1000
+	}
+	return limit
+}
+
+// documentExportRetention returns how long background export files are
+// kept, from DOCUMENT_EXPORT_RETENTION_HOURS (default 24).
+func documentExportRetention() time.Duration {
+	hours, err := strconv.Atoi(os.Getenv("DOCUMENT_EXPORT_RETENTION_HOURS"))
+	if err != nil || hours <= 0 {
+		hours = 24
+	}
+	return time.Duration(hours) * time.Hour
+}
+
+// documentRegisterFont is the font of PDF registers, the one used for
+// stamps so Arabic names render the same way.
+func documentRegisterFont() string {
+	if path := os.Getenv("IMAGE_FONT_PATH"); path != "" {
+		return path
+	}
+	return "assets/fonts/Cairo.ttf"
+}
+
+func documentRegisterTitle(filter models.DocumentSearchFilter) string {
+	title := "Document register"
+	if filter.From != nil {
+		title += " from " + filter.From.Format("2006-01-02")
+	}
+	if filter.To != nil {
+		// To is exclusive
+		title += " to " + filter.To.AddDate(0, 0, -1).Format("2006-01-02")
+	}
+	return title
+}
+
+func documentRegisterRow(doc *models.Document) []string {
+	team := ""
+	if doc.SignedByTeam != nil {
+		team = doc.SignedByTeam.Name
+	}
+	signer := doc.SignedByUser.FullName
+	if signer == "" {
+		signer = doc.SignedByUser.Email
+	}
+	return []string{
+		doc.ID,
+		doc.Title,
+		doc.OriginalName,
+		doc.ReferenceNumber,
+		signer,
+		team,
+		doc.CreatedAt.Format("2006-01-02 15:04:05"),
+		doc.UpdatedAt.Format("2006-01-02 15:04:05"),
+		doc.Hash,
+		strconv.Itoa(doc.VerificationCount),
+	}
+}
+
+// registerWriter receives the rows of a register in one export format.
+type registerWriter interface {
+	WriteRow(cells []string) error
+	Close() error
+}
+
+type csvRegister struct {
+	out *csv.Writer
+}
+
+func (r csvRegister) WriteRow(cells []string) error {
+	escaped := make([]string, len(cells))
+	for i, cell := range cells {
+		escaped[i] = csvSafeCell(cell)
+	}
+	r.out.Write(escaped)
+	return r.out.Error()
+}
+
+// csvSafeCell keeps spreadsheet programs from reading a cell as a formula.
+// Titles, file names and signer names come from users, so a leading = + - @
+// tab or carriage return is escaped with a quote.
+func csvSafeCell(cell string) string {
+	if cell != "" && strings.ContainsRune("=+-@\t\r", rune(cell[0])) {
+		return "'" + cell
+	}
+	return cell
+}
+
+func (r csvRegister) Close() error {
+	r.out.Flush()
+	return r.out.Error()
+}
+
+// pdfRegister lays the whole table out in memory and writes it on Close.
+type pdfRegister struct {
+	table *utils.PDFTable
+	w     io.Writer
+}
+
+func (r pdfRegister) WriteRow(cells []string) error {
+	return r.table.WriteRow(cells)
+}
+
+func (r pdfRegister) Close() error {
+	_, err := r.table.WriteTo(r.w)
+	return err
+}
+
+func newRegisterWriter(format string, w io.Writer, title string) (registerWriter, error) {
+	names := make([]string, 0, len(documentRegisterColumns))
+	labels := make([]string, 0, len(documentRegisterColumns))
+	widths := make([]float64, 0, len(documentRegisterColumns))
+	for _, col := range documentRegisterColumns {
+		names = append(names, col.name)
+		labels = append(labels, col.label)
+		widths = append(widths, col.width)
+	}
+
+	switch format {
+	case models.ExportFormatXLSX:
+		x, err := utils.NewXLSXWriter(w, "Register")
+		if err != nil {
+			return nil, err
+		}
+		return x, x.WriteHeader(labels)
+	case models.ExportFormatPDF:
+		table, err := utils.NewPDFTable(title, labels, widths, documentRegisterFont())
+		if err != nil {
+			return nil, err
+		}
+		return pdfRegister{table: table, w: w}, nil
+	default:
+		out := csv.NewWriter(w)
+		return csvRegister{out: out}, out.Write(names)
+	}
+}
+
+// writeDocumentRegister writes every document matching filter to w and
+// returns the number of rows written.
+func writeDocumentRegister(w io.Writer, format string, filter models.DocumentSearchFilter) (int, error) {
+	register, err := newRegisterWriter(format, w, documentRegisterTitle(filter))
+	if err != nil {
+		return 0, err
+	}
+
+	rows := 0
+	docRepo := repositories.NewDocumentRepository(config.DB)
+	err = docRepo.EachSearch(filter, func(doc models.Document) error {
+		rows++
+		return register.WriteRow(documentRegisterRow(&doc))
+	})
+	if err != nil {
+		return rows, err
+	}
+	return rows, register.Close()
+}
+
+// startDocumentExport records a background export and builds it once a
+// slot is free.
+func startDocumentExport(userID string, format string, filter models.DocumentSearchFilter) (*models.DocumentExport, error) {
+	filterJSON, _ := json.Marshal(filter)
+	export := &models.DocumentExport{
+		Format:            format,
+		Status:            models.ExportStatusRunning,
+		RequestedByUserID: userID,
+		Filter:            string(filterJSON),
+	}
+	exportRepo := repositories.NewDocumentExportRepository(config.DB)
+	if err := exportRepo.Create(export); err != nil {
+		return nil, err
+	}
+
+	job := *export
+	go func() {
+		documentExportSlots <- struct{}{}
+		defer func() { <-documentExportSlots }()
+		runDocumentExport(&job, filter)
+	}()
+	return export, nil
+}
+
+func runDocumentExport(export *models.DocumentExport, filter models.DocumentSearchFilter) {
+	exportRepo := repositories.NewDocumentExportRepository(config.DB)
+	finish := func(err error) {
+		now := time.Now()
+		export.FinishedAt = &now
+		export.Status = models.ExportStatusCompleted
+		if err != nil {
+			export.Status = models.ExportStatusFailed
+			export.Error = err.Error()
+			utils.HandleError(err, fmt.Sprintf("Document export %s failed", export.ID), utils.Error)
+		} else {
+			expires := now.Add(documentExportRetention())
+			export.ExpiresAt = &expires
+		}
+		if err := exportRepo.Update(export); err != nil {
+			utils.HandleError(err, "Failed to save document export", utils.Error)
+		}
+	}
+
+	tempDir := os.Getenv("TEMP_DIR")
+	if tempDir == "" {
+		tempDir = "./temp"
+	}
+	os.MkdirAll(tempDir, os.ModePerm)
+	file, err := os.CreateTemp(tempDir, "export-*."+export.Format)
+	if err != nil {
+		finish(err)
+		return
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	buffered := bufio.NewWriter(file)
+	rows, err := writeDocumentRegister(buffered, export.Format, filter)
+	if err == nil {
+		err = buffered.Flush()
+	}
+	if err != nil {
+		finish(err)
+		return
+	}
+	export.Rows = rows
+
+	info, err := file.Stat()
+	if err != nil {
+		finish(err)
+		return
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		finish(err)
+		return
+	}
+	key := documentExportPrefix + export.ID + "." + export.Format
+	if err := config.Storage.Put(context.Background(), key, file, info.Size(), documentExportContentTypes[export.Format]); err != nil {
+		finish(err)
+		return
+	}
+	export.StorageKey = key
+	export.Size = info.Size()
+	finish(nil)
+}
+
+// removeExpiredDocumentExports deletes export files past their retention.
+func removeExpiredDocumentExports() {
+	exportRepo := repositories.NewDocumentExportRepository(config.DB)
+	exports, err := exportRepo.FindExpired(time.Now())
+	if err != nil {
+		utils.HandleError(err, "Failed to list expired document exports", utils.Error)
+		return
+	}
+	for _, export := range exports {
+		if export.StorageKey != "" {
+			err := config.Storage.Delete(context.Background(), export.StorageKey)
+			if err != nil && !errors.Is(err, storage.ErrNotFound) {
+				utils.HandleError(err, fmt.Sprintf("Failed to remove document export %s", export.ID), utils.Warning)
+				continue
+			}
+		}
+		if err := exportRepo.Delete(export.ID); err != nil {
+			utils.HandleError(err, fmt.Sprintf("Failed to delete document export %s", export.ID), utils.Warning)
+		}
+	}
+}
+
+// StartDocumentExportCleaner closes exports interrupted by a restart and
+// removes expired export files every hour.
+func StartDocumentExportCleaner() {
+	exportRepo := repositories.NewDocumentExportRepository(config.DB)
+	if err := exportRepo.MarkRunningAsFailed("interrupted by restart"); err != nil {
+		utils.HandleError(err, "Failed to close stale document exports", utils.Warning)
+	}
+
+	go func() {
+		ticker := time.NewTicker(time.Hour)
+		defer ticker.Stop()
+		for {
+			removeExpiredDocumentExports()
+			<-ticker.C
+		}
+	}()
+}
+
+// findDocumentExport returns the export with the given ID if the caller
+// requested it or is a super admin.
+func findDocumentExport(c *fiber.Ctx, id string) (*models.DocumentExport, error) {
+	exportRepo := repositories.NewDocumentExportRepository(config.DB)
+	export, err := exportRepo.FindByID(id)
+	if err != nil {
+		return nil, err
+	}
+	role, _ := c.Locals("userRole").(string)
+	userID, _ := c.Locals("userID").(string)
+	if role != string(models.SuperAdminRole) && export.RequestedByUserID != userID {
+		return nil, fmt.Errorf("document export %s belongs to another user", id)
+	}
+	return export, nil
+}
+
+// ExportDocuments godoc
+// @Summary Export a document register
+// @Description Builds a register of the documents matching the search filters, with ID, title, file name, reference, signer, team, dates, hash and verification count. Registers of up to DOCUMENT_EXPORT_SYNC_LIMIT documents are streamed in the response; larger ones, or any with async=true, are built in the background and answered with 202 and the export to poll. Super admins export every document; team leaders their own and their team's visible documents, other users their own visible documents
+// @Tags documents
+// @Produce text/csv
+// @Produce application/vnd.openxmlformats-officedocument.spreadsheetml.sheet
+// @Produce application/pdf
+// @Param format query string false "csv, xlsx or pdf" default(csv)
+// @Param async query bool false "Always build in the background" default(false)
+// @Param q query string false "Text found in the file name, title or reference number"
+// @Param original_name query string false "Part of the original file name"
+// @Param signed_by_user_id query string false "Signer ID"
+// @Param team_id query string false "Signing team ID"
+// @Param from query string false "Signed on or after (YYYY-MM-DD)"
+// @Param to query string false "Signed on or before (YYYY-MM-DD)"
+// @Param hash query string false "Hash prefix"
+// @Param hidden query string false "true, false or any (super admins only)" default(any)
+// @Param tags query string false "Comma separated tags; documents must carry all of them"
+// @Success 200 {file} file
+// @Success 202 {object} models.DocumentExport
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /documents/export [get]
+// @Security Bearer
+func ExportDocuments(c *fiber.Ctx) error {
+	format := strings.ToLower(c.Query("format", models.ExportFormatCSV))
+	if _, ok := documentExportContentTypes[format]; !ok {
+		return sendError(c, fiber.StatusBadRequest, "invalid_export_format")
+	}
+	filter, err := documentSearchFilterFromQuery(c)
+	if err != nil {
+		return sendErrorFrom(c, fiber.StatusBadRequest, err)
+	}
+	if format == models.ExportFormatPDF {
+		if _, err := os.Stat(documentRegisterFont()); err != nil {
+			utils.HandleError(err, "Register font is missing", utils.Error)
+			return sendError(c, fiber.StatusInternalServerError, "pdf_export_unavailable")
+		}
+	}
+
+	docRepo := repositories.NewDocumentRepository(config.DB)
+	total, err := docRepo.CountSearch(filter)
+	if err != nil {
+		utils.HandleError(err, "Failed to count documents", utils.Error)
+		return sendError(c, fiber.StatusInternalServerError, "document_export_failed")
+	}
+
+	if c.Query("async") == "true" || total > documentExportSyncLimit() {
+		userID, _ := c.Locals("userID").(string)
+		export, err := startDocumentExport(userID, format, filter)
+		if err != nil {
+			utils.HandleError(err, "Failed to start document export", utils.Error)
+			return sendError(c, fiber.StatusInternalServerError, "document_export_failed")
+		}
+		return c.Status(fiber.StatusAccepted).JSON(export)
+	}
+
+	filename := fmt.Sprintf("documents-%s.%s", time.Now().Format("20060102-150405"), format)
+	c.Set(fiber.HeaderContentType, documentExportContentTypes[format])
+	c.Set(fiber.HeaderContentDisposition, contentDisposition(filename))
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		if _, err := writeDocumentRegister(w, format, filter); err != nil {
+			utils.HandleError(err, "Failed to export documents", utils.Error)
+		}
+	})
+	return nil
+}
+
+// GetDocumentExports godoc
+// @Summary List document exports
+// @Description Lists the background exports of the caller, newest first. Super admins see every export
+// @Tags documents
+// @Produce json
+// @Param limit query int false "Limit" default(10)
+// @Param page query int false "Page" default(1)
+// @Param cursor query string false "meta.next_cursor of the previous page"
+// @Success 200 {object} models.ListResponse{data=[]models.DocumentExport}
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /documents/exports [get]
+// @Security Bearer
+func GetDocumentExports(c *fiber.Ctx) error {
+	p, err := paginationFromQuery(c, models.DefaultPageSize)
+	if err != nil {
+		return sendErrorFrom(c, fiber.StatusBadRequest, err)
+	}
+
+	userID, _ := c.Locals("userID").(string)
+	if role, _ := c.Locals("userRole").(string); role == string(models.SuperAdminRole) {
+		userID = ""
+	}
+	exportRepo := repositories.NewDocumentExportRepository(config.DB)
+	exports, total, err := exportRepo.FindByUser(userID, p)
+	if err != nil {
+		utils.HandleError(err, "Failed to fetch document exports", utils.Error)
+		return sendError(c, fiber.StatusInternalServerError, "exports_fetch_failed")
+	}
+
+	return sendList(c, exports, p, total, nextCursor(p, exports, func(e models.DocumentExport) models.Cursor {
+		return models.Cursor{Time: e.CreatedAt, ID: e.ID}
+	}))
+}
+
+// GetDocumentExport godoc
+// @Summary Get a document export
+// @Description Returns the status of a background export
+// @Tags documents
+// @Produce json
+// @Param id path string true "Export ID"
+// @Success 200 {object} models.DocumentExport
+// @Failure 404 {object} models.ErrorResponse
+// @Router /documents/exports/{id} [get]
+// @Security Bearer
+func GetDocumentExport(c *fiber.Ctx) error {
+	id := c.Params("id")
+	export, err := findDocumentExport(c, id)
+	if err != nil {
+		utils.HandleError(err, fmt.Sprintf("Document export not found: %s", id), utils.Warning)
+		return sendError(c, fiber.StatusNotFound, "export_not_found")
+	}
+	return c.JSON(export)
+}
+
+// DownloadDocumentExport godoc
+// @Summary Download a document export
+// @Description Downloads the file of a completed background export
+// @Tags documents
+// @Produce text/csv
+// @Produce application/vnd.openxmlformats-officedocument.spreadsheetml.sheet
+// @Produce application/pdf
+// @Param id path string true "Export ID"
+// @Success 200 {file} file
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /documents/exports/{id}/download [get]
+// @Security Bearer
+func DownloadDocumentExport(c *fiber.Ctx) error {
+	id := c.Params("id")
+	export, err := findDocumentExport(c, id)
+	if err != nil {
+		utils.HandleError(err, fmt.Sprintf("Document export not found: %s", id), utils.Warning)
+		return sendError(c, fiber.StatusNotFound, "export_not_found")
+	}
+	if export.Status != models.ExportStatusCompleted {
+		return sendError(c, fiber.StatusConflict, "export_not_ready", export.Status)
+	}
+
+	reader, err := config.Storage.Get(context.Background(), export.StorageKey)
+	if err != nil {
+		utils.HandleError(err, fmt.Sprintf("Failed to read document export %s", id), utils.Error)
+		return sendError(c, fiber.StatusInternalServerError, "export_read_failed")
+	}
+
+	filename := fmt.Sprintf("documents-%s.%s", export.CreatedAt.Format("20060102-150405"), export.Format)
+	c.Set(fiber.HeaderContentType, documentExportContentTypes[export.Format])
+	c.Set(fiber.HeaderContentDisposition, contentDisposition(filename))
+	return c.SendStream(reader)
+}
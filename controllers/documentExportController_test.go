@@ -0,0 +1,44 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/csv"
+	"testing"
+)
+
+func TestCSVSafeCell(t *testing.T) {
+	tests := []struct {
+		cell, want string
+	}{
+		{"", ""},
+		{"Contract 7", "Contract 7"},
+		{"=HYPERLINK(\"http://x\")", "'=HYPERLINK(\"http://x\")"},
+		{"+1", "'+1"},
+		{"-2+3", "'-2+3"},
+		{"@SUM(A1)", "'@SUM(A1)"},
+		{"\tcmd", "'\tcmd"},
+		{"\rcmd", "'\rcmd"},
+		{"a=b", "a=b"},
+		{"عقد =1", "عقد =1"},
+	}
+	for _, tt := range tests {
+		if got := csvSafeCell(tt.cell); got != tt.want {
+			t.Errorf("csvSafeCell(%q) = %q, want %q", tt.cell, got, tt.want)
+		}
+	}
+}
+
+func TestCSVRegisterEscapesRows(t *testing.T) {
+	var buf bytes.Buffer
+	out := csv.NewWriter(&buf)
+	register := csvRegister{out: out}
+	if err := register.WriteRow([]string{"id", "=1+1", "-report.pdf"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := register.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := buf.String(), "id,'=1+1,'-report.pdf\n"; got != want {
+		t.Errorf("row %q, want %q", got, want)
+	}
+}
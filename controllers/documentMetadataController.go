@@ -0,0 +1,442 @@
+// DocumentMetadataController
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"tawtheeq-backend/config"
+	"tawtheeq-backend/i18n"
+	"tawtheeq-backend/models"
+	"tawtheeq-backend/repositories"
+	"tawtheeq-backend/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	maxDocumentTitle       = 255
+	maxDocumentDescription = 5000
+	maxDocumentReference   = 100
+	maxDocumentTags        = 20
+	maxDocumentTag         = 50
+	maxDocumentFields      = 50
+	maxDocumentFieldValue  = 1000
+)
+
+var documentFieldKeyPattern = regexp.MustCompile(`^[a-z][a-z0-9_]{0,63}$`)
+
+// documentTags trims, lowercases and de-duplicates tags.
+func documentTags(tags []string) ([]models.DocumentTag, error) {
+	seen := map[string]bool{}
+	result := make([]models.DocumentTag, 0, len(tags))
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || seen[tag] {
+			continue
+		}
+		if utf8.RuneCountInString(tag) > maxDocumentTag {
+			return nil, i18n.Errorf("tag_too_long", maxDocumentTag)
+		}
+		seen[tag] = true
+		result = append(result, models.DocumentTag{Tag: tag})
+	}
+	if len(result) > maxDocumentTags {
+		return nil, i18n.Errorf("too_many_tags", maxDocumentTags)
+	}
+	return result, nil
+}
+
+// documentCustomFields checks values against the custom fields defined by
+// teamID. Unknown keys and values of the wrong type are rejected, required
+// fields must be present and empty values are dropped.
+func documentCustomFields(teamID string, values map[string]string) (models.DocumentCustomFields, error) {
+	fields := []models.DocumentField{}
+	if teamID != "" {
+		var err error
+		fieldRepo := repositories.NewDocumentFieldRepository(config.DB)
+		fields, err = fieldRepo.FindByTeam(teamID)
+		if err != nil {
+			return nil, utils.HandleError(err, fmt.Sprintf("Failed to load document fields of team %s", teamID), utils.Error)
+		}
+	}
+
+	defined := map[string]models.DocumentField{}
+	for _, f := range fields {
+		defined[f.Key] = f
+	}
+
+	result := models.DocumentCustomFields{}
+	for key, value := range values {
+		field, ok := defined[key]
+		if !ok {
+			return nil, i18n.Errorf("unknown_custom_field", key)
+		}
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+		if utf8.RuneCountInString(value) > maxDocumentFieldValue {
+			return nil, i18n.Errorf("field_value_too_long", field.Label, maxDocumentFieldValue)
+		}
+		switch field.Type {
+		case models.DocumentFieldTypeNumber:
+			if _, err := strconv.ParseFloat(value, 64); err != nil {
+				return nil, i18n.Errorf("field_not_number", field.Label)
+			}
+		case models.DocumentFieldTypeDate:
+			if _, err := time.Parse("2006-01-02", value); err != nil {
+				return nil, i18n.Errorf("field_not_date", field.Label)
+			}
+		}
+		result[key] = value
+	}
+
+	for _, f := range fields {
+		if _, ok := result[f.Key]; f.Required && !ok {
+			return nil, i18n.Errorf("field_required", f.Label)
+		}
+	}
+	return result, nil
+}
+
+// applyDocumentMetadata copies the fields set in input onto doc after
+// validating them. teamID selects the custom field definitions.
+func applyDocumentMetadata(doc *models.Document, input *models.DocumentMetadataInput, teamID string) error {
+	if input.Title != nil {
+		title := strings.TrimSpace(*input.Title)
+		if utf8.RuneCountInString(title) > maxDocumentTitle {
+			return i18n.Errorf("title_too_long", maxDocumentTitle)
+		}
+		doc.Title = title
+	}
+	if input.Description != nil {
+		description := strings.TrimSpace(*input.Description)
+		if utf8.RuneCountInString(description) > maxDocumentDescription {
+			return i18n.Errorf("description_too_long", maxDocumentDescription)
+		}
+		doc.Description = description
+	}
+	if input.ReferenceNumber != nil {
+		reference := strings.TrimSpace(*input.ReferenceNumber)
+		if utf8.RuneCountInString(reference) > maxDocumentReference {
+			return i18n.Errorf("reference_too_long", maxDocumentReference)
+		}
+		doc.ReferenceNumber = reference
+	}
+	if input.Tags != nil {
+		tags, err := documentTags(*input.Tags)
+		if err != nil {
+			return err
+		}
+		doc.Tags = tags
+	}
+
+	// new documents (not stored yet) are always checked so required fields
+	// cannot be skipped at upload; stored ones only when the values change
+	if input.CustomFields == nil && !doc.CreatedAt.IsZero() {
+		return nil
+	}
+	values := map[string]string{}
+	if input.CustomFields != nil {
+		values = *input.CustomFields
+	}
+	fields, err := documentCustomFields(teamID, values)
+	if err != nil {
+		return err
+	}
+	doc.CustomFields = fields
+	return nil
+}
+
+// documentMetadataFromForm reads the metadata fields of an upload form. Only
+// the fields present in the form are set.
+func documentMetadataFromForm(c *fiber.Ctx) (*models.DocumentMetadataInput, error) {
+	input := &models.DocumentMetadataInput{Seal: c.FormValue("seal_metadata") == "true"}
+	form, err := c.MultipartForm()
+	if err != nil {
+		return input, nil
+	}
+
+	value := func(name string) *string {
+		if v, ok := form.Value[name]; ok && len(v) > 0 {
+			return &v[0]
+		}
+		return nil
+	}
+	input.Title = value("title")
+	input.Description = value("description")
+	input.ReferenceNumber = value("reference_number")
+	if tags := value("tags"); tags != nil {
+		list := strings.Split(*tags, ",")
+		input.Tags = &list
+	}
+	if raw := value("custom_fields"); raw != nil && strings.TrimSpace(*raw) != "" {
+		fields := map[string]string{}
+		if err := json.Unmarshal([]byte(*raw), &fields); err != nil {
+			return nil, i18n.Errorf("invalid_custom_fields")
+		}
+		input.CustomFields = &fields
+	}
+	return input, nil
+}
+
+// sealDocumentMetadata signs the current metadata of doc with the document
+// signing key.
+func sealDocumentMetadata(doc *models.Document) error {
+	payload, err := models.DocumentMetadataPayload(doc)
+	if err != nil {
+		return err
+	}
+	signature, err := generateSignature(payload)
+	if err != nil {
+		return err
+	}
+	doc.MetadataSignature = signature
+	return nil
+}
+
+// documentMetadataIntact reports whether sealed metadata still matches its
+// signature, or nil when the metadata of doc is not sealed.
+func documentMetadataIntact(doc *models.Document) *bool {
+	if doc.MetadataSignature == "" {
+		return nil
+	}
+	intact := false
+	payload, err := models.DocumentMetadataPayload(doc)
+	if err == nil {
+		err = verifySignature(payload, doc.MetadataSignature)
+	}
+	if err != nil {
+		utils.HandleError(err, fmt.Sprintf("Sealed metadata of document %s does not match its signature", doc.ID), utils.Warning)
+	} else {
+		intact = true
+	}
+	return &intact
+}
+
+// documentMetadataSnapshot is the part of a document recorded in audit events
+// for metadata changes.
+func documentMetadataSnapshot(doc *models.Document) fiber.Map {
+	return fiber.Map{
+		"title":            doc.Title,
+		"description":      doc.Description,
+		"reference_number": doc.ReferenceNumber,
+		"tags":             doc.TagNames(),
+		"custom_fields":    doc.CustomFields,
+		"sealed":           doc.MetadataSignature != "",
+	}
+}
+
+// UpdateDocumentMetadata godoc
+// @Summary Update document metadata
+// @Description Change the title, description, reference number, tags and custom fields of a document. Omitted fields are kept. With seal=true the metadata is signed; sealed metadata can no longer be changed
+// @Tags documents
+// @Accept json
+// @Produce json
+// @Param id path string true "Document ID"
+// @Param input body models.DocumentMetadataInput true "Metadata"
+// @Success 200 {object} models.DocumentResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /documents/{id}/metadata [put]
+// @Security Bearer
+func UpdateDocumentMetadata(c *fiber.Ctx) error {
+	id := c.Params("id")
+	docRepo := repositories.NewDocumentRepository(config.DB)
+	doc, err := docRepo.FindWithRelations(id)
+	if err != nil {
+		utils.HandleError(err, fmt.Sprintf("Document not found: %s", id), utils.Warning)
+		return sendError(c, fiber.StatusNotFound, "document_not_found")
+	}
+	if !canManageDocument(c, doc) {
+		return sendError(c, fiber.StatusForbidden, "access_denied")
+	}
+	if doc.MetadataSignature != "" {
+		return sendError(c, fiber.StatusConflict, "metadata_sealed")
+	}
+
+	input := new(models.DocumentMetadataInput)
+	if err := c.BodyParser(input); err != nil {
+		utils.HandleError(err, "Failed to parse request body", utils.Error)
+		return sendError(c, fiber.StatusBadRequest, "invalid_input")
+	}
+
+	before := documentMetadataSnapshot(doc)
+	teamID := ""
+	if doc.SignedByTeamID != nil {
+		teamID = *doc.SignedByTeamID
+	}
+	if err := applyDocumentMetadata(doc, input, teamID); err != nil {
+		return sendErrorFrom(c, fiber.StatusBadRequest, err)
+	}
+	if input.Seal {
+		if err := sealDocumentMetadata(doc); err != nil {
+			utils.HandleError(err, fmt.Sprintf("Failed to seal metadata of document %s", id), utils.Error)
+			return sendError(c, fiber.StatusInternalServerError, "metadata_seal_failed")
+		}
+	}
+
+	if err := docRepo.UpdateMetadata(doc); err != nil {
+		utils.HandleError(err, fmt.Sprintf("Failed to update metadata of document %s", id), utils.Error)
+		return sendError(c, fiber.StatusInternalServerError, "metadata_update_failed")
+	}
+	recordAudit(c, "document.metadata_change", models.AuditTargetDocument, id, before, documentMetadataSnapshot(doc))
+
+	resp := models.BuildDocumentResponse(doc)
+	resp.MetadataIntact = documentMetadataIntact(doc)
+	return c.JSON(resp)
+}
+
+// getDocumentFields answers with the custom field definitions of teamID.
+func getDocumentFields(c *fiber.Ctx, teamID string) error {
+	fieldRepo := repositories.NewDocumentFieldRepository(config.DB)
+	fields, err := fieldRepo.FindByTeam(teamID)
+	if err != nil {
+		utils.HandleError(err, fmt.Sprintf("Failed to fetch document fields of team %s", teamID), utils.Error)
+		return sendError(c, fiber.StatusInternalServerError, "document_fields_fetch_failed")
+	}
+	return c.JSON(fiber.Map{"fields": fields})
+}
+
+// setDocumentFields replaces the custom field definitions of teamID with the
+// ones in the request body.
+func setDocumentFields(c *fiber.Ctx, teamID string) error {
+	var input models.DocumentFieldsInput
+	if err := c.BodyParser(&input); err != nil {
+		utils.HandleError(err, "Failed to parse request body", utils.Error)
+		return sendError(c, fiber.StatusBadRequest, "invalid_input")
+	}
+	if len(input.Fields) > maxDocumentFields {
+		return sendError(c, fiber.StatusBadRequest, "too_many_fields", maxDocumentFields)
+	}
+
+	teamRepo := repositories.NewTeamRepository(config.DB)
+	if _, err := teamRepo.FindByID(teamID); err != nil {
+		utils.HandleError(err, fmt.Sprintf("Failed to find team %s", teamID), utils.Error)
+		return sendError(c, fiber.StatusNotFound, "team_not_found")
+	}
+
+	seen := map[string]bool{}
+	fields := make([]models.DocumentField, 0, len(input.Fields))
+	for i, f := range input.Fields {
+		key := strings.TrimSpace(f.Key)
+		label := strings.TrimSpace(f.Label)
+		fieldType := f.Type
+		if fieldType == "" {
+			fieldType = models.DocumentFieldTypeText
+		}
+		switch {
+		case !documentFieldKeyPattern.MatchString(key):
+			return sendError(c, fiber.StatusBadRequest, "invalid_field_key", key)
+		case seen[key]:
+			return sendError(c, fiber.StatusBadRequest, "duplicate_field_key", key)
+		case label == "" || utf8.RuneCountInString(label) > 255:
+			return sendError(c, fiber.StatusBadRequest, "invalid_field_label", key)
+		case !models.ValidDocumentFieldType(fieldType):
+			return sendError(c, fiber.StatusBadRequest, "invalid_field_type")
+		}
+		seen[key] = true
+		fields = append(fields, models.DocumentField{
+			TeamID:   teamID,
+			Key:      key,
+			Label:    label,
+			Type:     fieldType,
+			Required: f.Required,
+			Position: i,
+		})
+	}
+
+	fieldRepo := repositories.NewDocumentFieldRepository(config.DB)
+	before, err := fieldRepo.FindByTeam(teamID)
+	if err != nil {
+		utils.HandleError(err, fmt.Sprintf("Failed to fetch document fields of team %s", teamID), utils.Warning)
+	}
+	if err := fieldRepo.ReplaceForTeam(teamID, fields); err != nil {
+		utils.HandleError(err, fmt.Sprintf("Failed to update document fields of team %s", teamID), utils.Error)
+		return sendError(c, fiber.StatusInternalServerError, "document_fields_update_failed")
+	}
+	recordAudit(c, "team.document_fields_change", models.AuditTargetTeam, teamID, before, fields)
+
+	return c.JSON(fiber.Map{"fields": fields})
+}
+
+// GetTeamDocumentFields godoc
+// @Summary Get team document fields
+// @Description Lists the custom metadata fields a team's documents carry
+// @Tags teams
+// @Produce json
+// @Param id path string true "Team ID"
+// @Success 200 {array} models.DocumentField
+// @Failure 500 {object} models.ErrorResponse
+// @Router /teams/{id}/document-fields [get]
+// @Security Bearer
+func GetTeamDocumentFields(c *fiber.Ctx) error {
+	return getDocumentFields(c, c.Params("id"))
+}
+
+// UpdateTeamDocumentFields godoc
+// @Summary Update team document fields
+// @Description Replaces the custom metadata fields of a team. Keys use lowercase letters, digits and _; types are text, number or date. Values already stored on documents are kept
+// @Tags teams
+// @Accept json
+// @Produce json
+// @Param id path string true "Team ID"
+// @Param input body models.DocumentFieldsInput true "Field definitions"
+// @Success 200 {array} models.DocumentField
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /teams/{id}/document-fields [put]
+// @Security Bearer
+func UpdateTeamDocumentFields(c *fiber.Ctx) error {
+	return setDocumentFields(c, c.Params("id"))
+}
+
+// GetMyTeamDocumentFields godoc
+// @Summary Get my team document fields
+// @Description Lists the custom metadata fields your team's documents carry
+// @Tags teams
+// @Produce json
+// @Success 200 {array} models.DocumentField
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /my/team/document-fields [get]
+// @Security Bearer
+func GetMyTeamDocumentFields(c *fiber.Ctx) error {
+	teamId, ok := c.Locals("teamId").(string)
+	if !ok || teamId == "" {
+		utils.HandleError(fmt.Errorf("invalid or missing user context"), "Invalid or missing user context", utils.Error)
+		return sendError(c, fiber.StatusBadRequest, "missing_user_context")
+	}
+	return getDocumentFields(c, teamId)
+}
+
+// UpdateMyTeamDocumentFields godoc
+// @Summary Update my team document fields
+// @Description Replaces the custom metadata fields of your team
+// @Tags teams
+// @Accept json
+// @Produce json
+// @Param input body models.DocumentFieldsInput true "Field definitions"
+// @Success 200 {array} models.DocumentField
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /my/team/document-fields [put]
+// @Security Bearer
+func UpdateMyTeamDocumentFields(c *fiber.Ctx) error {
+	teamId, ok := c.Locals("teamId").(string)
+	if !ok || teamId == "" {
+		utils.HandleError(fmt.Errorf("invalid or missing user context"), "Invalid or missing user context", utils.Error)
+		return sendError(c, fiber.StatusBadRequest, "missing_user_context")
+	}
+	return setDocumentFields(c, teamId)
+}
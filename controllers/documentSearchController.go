@@ -0,0 +1,158 @@
+// DocumentSearchController
+package controllers
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"tawtheeq-backend/config"
+	"tawtheeq-backend/i18n"
+	"tawtheeq-backend/models"
+	"tawtheeq-backend/repositories"
+	"tawtheeq-backend/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+var hashPrefixPattern = regexp.MustCompile(`^[0-9a-f]{1,64}$`)
+
+// documentSearchFilterFromQuery reads the search filters from the query
+// string and limits them to what the caller may see: super admins search
+// everything, team leaders their own documents and their team's, other users
+// their own. Only super admins search hidden documents.
+func documentSearchFilterFromQuery(c *fiber.Ctx) (models.DocumentSearchFilter, error) {
+	filter := models.DocumentSearchFilter{
+		Query:          strings.TrimSpace(c.Query("q")),
+		OriginalName:   strings.TrimSpace(c.Query("original_name")),
+		SignedByUserID: c.Query("signed_by_user_id"),
+		SignedByTeamID: c.Query("team_id"),
+		HashPrefix:     strings.ToLower(c.Query("hash")),
+	}
+
+	if format := strings.ToLower(c.Query("format")); format != "" {
+		if !strings.HasPrefix(format, ".") {
+			format = "." + format
+		}
+		filter.FileFormat = format
+	}
+	if filter.HashPrefix != "" && !hashPrefixPattern.MatchString(filter.HashPrefix) {
+		return filter, i18n.Errorf("invalid_hash")
+	}
+	if v := c.Query("tags"); v != "" {
+		tags, err := documentTags(strings.Split(v, ","))
+		if err != nil {
+			return filter, err
+		}
+		for _, t := range tags {
+			filter.Tags = append(filter.Tags, t.Tag)
+		}
+	}
+	if v := c.Query("hidden"); v != "" && v != "any" {
+		hidden, err := strconv.ParseBool(v)
+		if err != nil {
+			return filter, i18n.Errorf("invalid_hidden")
+		}
+		filter.Hidden = &hidden
+	}
+	if v := c.Query("from"); v != "" {
+		from, err := time.Parse("2006-01-02", v)
+		if err != nil {
+			return filter, i18n.Errorf("invalid_from_date")
+		}
+		filter.From = &from
+	}
+	if v := c.Query("to"); v != "" {
+		to, err := time.Parse("2006-01-02", v)
+		if err != nil {
+			return filter, i18n.Errorf("invalid_to_date")
+		}
+		to = to.AddDate(0, 0, 1)
+		filter.To = &to
+	}
+
+	role, _ := c.Locals("userRole").(string)
+	if role == string(models.SuperAdminRole) {
+		return filter, nil
+	}
+	if filter.Hidden != nil && *filter.Hidden {
+		return filter, i18n.Errorf("hidden_search_forbidden")
+	}
+	visible := false
+	filter.Hidden = &visible
+	filter.ScopeUserID, _ = c.Locals("userID").(string)
+	if role == string(models.TeamLeaderRole) {
+		filter.ScopeTeamID, _ = c.Locals("teamId").(string)
+	}
+	return filter, nil
+}
+
+// SearchDocuments godoc
+// @Summary Search documents
+// @Description Filters documents by name, format, signer, team, date range, hash prefix, hidden flag and tags. Super admins search every document; team leaders their own and their team's visible documents, other users their own visible documents
+// @Tags documents
+// @Produce json
+// @Param q query string false "Text found in the file name, title or reference number"
+// @Param original_name query string false "Part of the original file name"
+// @Param format query string false "File format, e.g. pdf"
+// @Param signed_by_user_id query string false "Signer ID"
+// @Param team_id query string false "Signing team ID"
+// @Param from query string false "Signed on or after (YYYY-MM-DD)"
+// @Param to query string false "Signed on or before (YYYY-MM-DD)"
+// @Param hash query string false "Hash prefix"
+// @Param hidden query string false "true, false or any (super admins only)" default(any)
+// @Param tags query string false "Comma separated tags; documents must carry all of them"
+// @Param sort query string false "created_at, updated_at, title, reference_number, file_format or verification_count" default(created_at)
+// @Param order query string false "asc or desc" default(desc)
+// @Param limit query int false "Limit" default(10)
+// @Param page query int false "Page" default(1)
+// @Param cursor query string false "meta.next_cursor of the previous page (newest first order only)"
+// @Success 200 {object} models.ListResponse{data=[]models.DocumentResponse}
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /documents/search [get]
+// @Security Bearer
+func SearchDocuments(c *fiber.Ctx) error {
+	filter, err := documentSearchFilterFromQuery(c)
+	if err != nil {
+		return sendErrorFrom(c, fiber.StatusBadRequest, err)
+	}
+
+	sort := c.Query("sort", "created_at")
+	if !repositories.ValidDocumentSort(sort) {
+		return sendError(c, fiber.StatusBadRequest, "invalid_sort")
+	}
+	order := strings.ToLower(c.Query("order", "desc"))
+	if order != "asc" && order != "desc" {
+		return sendError(c, fiber.StatusBadRequest, "invalid_order")
+	}
+
+	p, err := paginationFromQuery(c, models.DefaultPageSize)
+	if err != nil {
+		return sendErrorFrom(c, fiber.StatusBadRequest, err)
+	}
+	// cursors follow the newest first order only
+	newestFirst := sort == "created_at" && order == "desc"
+	if p.Cursor != nil && !newestFirst {
+		return sendErrorFrom(c, fiber.StatusBadRequest, errCursorUnsupported)
+	}
+
+	docRepo := repositories.NewDocumentRepository(config.DB)
+	docs, total, err := docRepo.Search(filter, sort, order == "desc", p)
+	if err != nil {
+		utils.HandleError(err, "Failed to search documents", utils.Error)
+		return sendError(c, fiber.StatusInternalServerError, "document_search_failed")
+	}
+
+	results := make([]models.DocumentResponse, 0, len(docs))
+	for i := range docs {
+		results = append(results, models.BuildDocumentResponse(&docs[i]))
+	}
+
+	next := ""
+	if newestFirst {
+		next = nextCursor(p, docs, documentCreated)
+	}
+	return sendList(c, results, p, total, next)
+}
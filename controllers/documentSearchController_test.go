@@ -0,0 +1,67 @@
+package controllers
+
+import (
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	"tawtheeq-backend/i18n"
+	"tawtheeq-backend/models"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestDocumentSearchFilterScope(t *testing.T) {
+	tests := []struct {
+		name         string
+		role         models.Role
+		query        string
+		scopeUser    string
+		scopeTeam    string
+		hiddenFilter string
+		code         string
+	}{
+		{"super admin", models.SuperAdminRole, "?hidden=true", "", "", "true", ""},
+		{"super admin any", models.SuperAdminRole, "", "", "", "any", ""},
+		{"team leader", models.TeamLeaderRole, "", "user-1", "team-1", "false", ""},
+		{"team member", models.TeamMemberRole, "?hidden=any", "user-1", "", "false", ""},
+		{"team member visible", models.TeamMemberRole, "?hidden=false", "user-1", "", "false", ""},
+		{"team member hidden", models.TeamMemberRole, "?hidden=true", "", "", "", "hidden_search_forbidden"},
+		{"team leader hidden", models.TeamLeaderRole, "?hidden=1", "", "", "", "hidden_search_forbidden"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := fiber.New()
+			var got models.DocumentSearchFilter
+			var err error
+			app.Get("/", func(c *fiber.Ctx) error {
+				c.Locals("userRole", string(tt.role))
+				c.Locals("userID", "user-1")
+				c.Locals("teamId", "team-1")
+				got, err = documentSearchFilterFromQuery(c)
+				return nil
+			})
+			if _, testErr := app.Test(httptest.NewRequest("GET", "/"+tt.query, nil)); testErr != nil {
+				t.Fatal(testErr)
+			}
+
+			if tt.code != "" {
+				var coded *i18n.Error
+				if !errors.As(err, &coded) || coded.Code != tt.code {
+					t.Errorf("error %v, want %s", err, tt.code)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			hidden := "any"
+			if got.Hidden != nil {
+				hidden = map[bool]string{true: "true", false: "false"}[*got.Hidden]
+			}
+			if got.ScopeUserID != tt.scopeUser || got.ScopeTeamID != tt.scopeTeam || hidden != tt.hiddenFilter {
+				t.Errorf("scope user %q team %q hidden %s, want %q %q %s", got.ScopeUserID, got.ScopeTeamID, hidden, tt.scopeUser, tt.scopeTeam, tt.hiddenFilter)
+			}
+		})
+	}
+}
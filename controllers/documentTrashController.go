@@ -0,0 +1,325 @@
+// DocumentTrashController
+package controllers
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"tawtheeq-backend/config"
+	"tawtheeq-backend/models"
+	"tawtheeq-backend/repositories"
+	"tawtheeq-backend/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+const documentPurgeBatch = 100
+
+// documentTrashRetention returns how long deleted documents can be restored,
+// from DOCUMENT_TRASH_RETENTION_DAYS (default 30).
+func documentTrashRetention() time.Duration {
+	days, err := strconv.Atoi(os.Getenv("DOCUMENT_TRASH_RETENTION_DAYS"))
+	if err != nil || days < 0 {
+		days = 30
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// canManageDocument reports whether the caller may delete or restore doc:
+// super admins, the signer and the leader of the signing team.
+func canManageDocument(c *fiber.Ctx, doc *models.Document) bool {
+	role, _ := c.Locals("userRole").(string)
+	if role == string(models.SuperAdminRole) {
+		return true
+	}
+	userID, _ := c.Locals("userID").(string)
+	if userID != "" && doc.SignedByUserID == userID {
+		return true
+	}
+	teamID, _ := c.Locals("teamId").(string)
+	return role == string(models.TeamLeaderRole) && teamID != "" && doc.SignedByTeamID != nil && *doc.SignedByTeamID == teamID
+}
+
+// purgeDocument removes the stored file of doc and then its row. The row is
+// kept when the file cannot be removed so the purge can be retried. A file
+// that was never matched to a key is left for the storage scrubber.
+func purgeDocument(doc *models.Document) error {
+	if doc.StorageKey != "" {
+		if err := RemoveFile(doc.StorageKey); err != nil {
+			return err
+		}
+	}
+	docRepo := repositories.NewDocumentRepository(config.DB)
+	return docRepo.Purge(doc.ID)
+}
+
+// purgeExpiredDocuments purges every document that stayed in the trash
+// longer than the retention window.
+func purgeExpiredDocuments() {
+	docRepo := repositories.NewDocumentRepository(config.DB)
+	cutoff := time.Now().Add(-documentTrashRetention())
+
+	for {
+		docs, err := docRepo.FindDeletedBefore(cutoff, documentPurgeBatch)
+		if err != nil {
+			utils.HandleError(err, "Failed to list expired documents", utils.Error)
+			return
+		}
+
+		failed := 0
+		for i := range docs {
+			doc := &docs[i]
+			if err := purgeDocument(doc); err != nil {
+				utils.HandleError(err, fmt.Sprintf("Failed to purge document %s", doc.ID), utils.Error)
+				failed++
+				continue
+			}
+			recordSystemAudit("document.purge", models.AuditTargetDocument, doc.ID, fiber.Map{
+				"original_name": doc.OriginalName,
+				"hash":          doc.Hash,
+				"deleted_at":    doc.DeletedAt.Time,
+			}, nil)
+		}
+
+		// stop on a short batch, or when nothing in this batch could be
+		// purged so failing rows are not retried in a loop
+		if len(docs) < documentPurgeBatch || failed == len(docs) {
+			return
+		}
+	}
+}
+
+// notifyExpiringDocuments warns the signers of documents that will be
+// purged within MAIL_EXPIRY_NOTICE_DAYS, once per deletion.
+func notifyExpiringDocuments() {
+	notice := emailExpiryNotice()
+	if notice <= 0 {
+		return
+	}
+	retention := documentTrashRetention()
+	docRepo := repositories.NewDocumentRepository(config.DB)
+	now := time.Now()
+
+	for {
+		docs, err := docRepo.FindPurgeNoticeDue(now.Add(-retention), now.Add(notice-retention), documentPurgeBatch)
+		if err != nil {
+			utils.HandleError(err, "Failed to list documents about to be purged", utils.Error)
+			return
+		}
+
+		queued := 0
+		for i := range docs {
+			doc := &docs[i]
+			user, err := repositories.NewUserRepository(config.DB).FindByID(doc.SignedByUserID)
+			if err != nil {
+				continue
+			}
+			data := emailDocument(doc)
+			data["PurgeAfter"] = emailTime(doc.DeletedAt.Time.Add(retention))
+			if queueEmail(user, models.EmailDocumentExpiring, doc.ID, data) == nil {
+				queued++
+			}
+		}
+
+		// documents whose signer is gone stay in the list, so stop when a
+		// batch queued nothing
+		if len(docs) < documentPurgeBatch || queued == 0 {
+			return
+		}
+	}
+}
+
+// StartDocumentPurger purges expired documents from the trash at startup and
+// then every hour, after warning the signers of documents purged soon.
+func StartDocumentPurger() {
+	go func() {
+		ticker := time.NewTicker(time.Hour)
+		defer ticker.Stop()
+		for {
+			purgeExpiredDocuments()
+			notifyExpiringDocuments()
+			<-ticker.C
+		}
+	}()
+}
+
+// DeleteDocument godoc
+// @Summary Delete document
+// @Description Move a document to the trash. It can be restored within DOCUMENT_TRASH_RETENTION_DAYS; afterwards it and its file are purged. Verifying a deleted document reports it as withdrawn
+// @Tags documents
+// @Produce json
+// @Param id path string true "Document ID"
+// @Success 200 {object} models.SuccessResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /documents/{id}/remove [delete]
+// @Security Bearer
+func DeleteDocument(c *fiber.Ctx) error {
+	id := c.Params("id")
+	docRepo := repositories.NewDocumentRepository(config.DB)
+	doc, err := docRepo.FindByID(id)
+	if err != nil {
+		utils.HandleError(err, fmt.Sprintf("Document not found: %s", id), utils.Warning)
+		return sendError(c, fiber.StatusNotFound, "document_not_found")
+	}
+	if !canManageDocument(c, doc) {
+		return sendError(c, fiber.StatusForbidden, "access_denied")
+	}
+
+	userID, _ := c.Locals("userID").(string)
+	if err := docRepo.SoftDelete(id, userID); err != nil {
+		utils.HandleError(err, fmt.Sprintf("Failed to delete document %s", id), utils.Error)
+		return sendError(c, fiber.StatusInternalServerError, "document_delete_failed")
+	}
+	recordAudit(c, "document.delete", models.AuditTargetDocument, id, fiber.Map{"deleted": false}, fiber.Map{"deleted": true})
+	emitDocumentWebhook(models.WebhookEventDocumentRevoked, doc)
+
+	purgeAfter := time.Now().Add(documentTrashRetention())
+	revokedMail := emailDocument(doc)
+	revokedMail["PurgeAfter"] = emailTime(purgeAfter)
+	revokedMail["RevokedBy"] = userID
+	if actor, err := repositories.NewUserRepository(config.DB).FindByID(userID); err == nil {
+		revokedMail["RevokedBy"] = actor.FullName
+	}
+	queueEmailToUserID(doc.SignedByUserID, models.EmailDocumentRevoked, doc.ID, revokedMail)
+
+	return c.JSON(fiber.Map{
+		"message":     localize(c, "document_trashed"),
+		"purge_after": purgeAfter.Format("2006-01-02 15:04:05"),
+	})
+}
+
+// GetDocumentTrash godoc
+// @Summary List deleted documents
+// @Description Lists documents in the trash, most recently deleted first. Super admins see every document (optionally filtered by team_id or user_id), team leaders their team's and others their own
+// @Tags documents
+// @Produce json
+// @Param team_id query string false "Team ID (super admins only)"
+// @Param user_id query string false "Signer ID (super admins only)"
+// @Param limit query int false "Limit" default(10)
+// @Param page query int false "Page" default(1)
+// @Param cursor query string false "meta.next_cursor of the previous page"
+// @Success 200 {object} models.ListResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /documents/trash [get]
+// @Security Bearer
+func GetDocumentTrash(c *fiber.Ctx) error {
+	role, _ := c.Locals("userRole").(string)
+	var userID, teamID string
+	switch role {
+	case string(models.SuperAdminRole):
+		userID = c.Query("user_id")
+		teamID = c.Query("team_id")
+	case string(models.TeamLeaderRole):
+		teamID, _ = c.Locals("teamId").(string)
+		if teamID == "" {
+			userID, _ = c.Locals("userID").(string)
+		}
+	default:
+		userID, _ = c.Locals("userID").(string)
+	}
+
+	p, err := paginationFromQuery(c, models.DefaultPageSize)
+	if err != nil {
+		return sendErrorFrom(c, fiber.StatusBadRequest, err)
+	}
+
+	docRepo := repositories.NewDocumentRepository(config.DB)
+	docs, total, err := docRepo.FindTrash(userID, teamID, p)
+	if err != nil {
+		utils.HandleError(err, "Failed to fetch deleted documents", utils.Error)
+		return sendError(c, fiber.StatusInternalServerError, "documents_fetch_failed")
+	}
+
+	retention := documentTrashRetention()
+	items := make([]fiber.Map, 0, len(docs))
+	for i := range docs {
+		items = append(items, fiber.Map{
+			"document":    models.BuildDocumentResponse(&docs[i]),
+			"deleted_by":  docs[i].DeletedByUserID,
+			"purge_after": docs[i].DeletedAt.Time.Add(retention).Format("2006-01-02 15:04:05"),
+		})
+	}
+
+	return sendList(c, items, p, total, nextCursor(p, docs, func(doc models.Document) models.Cursor {
+		return models.Cursor{Time: doc.DeletedAt.Time, ID: doc.ID}
+	}))
+}
+
+// RestoreDocument godoc
+// @Summary Restore document
+// @Description Take a document out of the trash while the retention window is still open
+// @Tags documents
+// @Produce json
+// @Param id path string true "Document ID"
+// @Success 200 {object} models.DocumentResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 410 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /documents/{id}/restore [put]
+// @Security Bearer
+func RestoreDocument(c *fiber.Ctx) error {
+	id := c.Params("id")
+	docRepo := repositories.NewDocumentRepository(config.DB)
+	doc, err := docRepo.FindDeletedWithRelations(id)
+	if err != nil {
+		utils.HandleError(err, fmt.Sprintf("Deleted document not found: %s", id), utils.Warning)
+		return sendError(c, fiber.StatusNotFound, "document_not_in_trash")
+	}
+	if !canManageDocument(c, doc) {
+		return sendError(c, fiber.StatusForbidden, "access_denied")
+	}
+	if time.Since(doc.DeletedAt.Time) > documentTrashRetention() {
+		return sendError(c, fiber.StatusGone, "retention_window_passed")
+	}
+
+	if err := docRepo.Restore(id); err != nil {
+		utils.HandleError(err, fmt.Sprintf("Failed to restore document %s", id), utils.Error)
+		return sendError(c, fiber.StatusInternalServerError, "document_restore_failed")
+	}
+	recordAudit(c, "document.restore", models.AuditTargetDocument, id, fiber.Map{"deleted": true}, fiber.Map{"deleted": false})
+
+	doc.DeletedAt = gorm.DeletedAt{}
+	doc.DeletedByUserID = nil
+	emitDocumentWebhook(models.WebhookEventDocumentRestored, doc)
+	return c.JSON(models.BuildDocumentResponse(doc))
+}
+
+// PurgeDocument godoc
+// @Summary Purge document
+// @Description Permanently remove a document from the trash together with its stored file, without waiting for the retention window
+// @Tags documents
+// @Produce json
+// @Param id path string true "Document ID"
+// @Success 200 {object} models.SuccessResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /documents/{id}/purge [delete]
+// @Security Bearer
+func PurgeDocument(c *fiber.Ctx) error {
+	id := c.Params("id")
+	docRepo := repositories.NewDocumentRepository(config.DB)
+	doc, err := docRepo.FindDeletedWithRelations(id)
+	if err != nil {
+		utils.HandleError(err, fmt.Sprintf("Deleted document not found: %s", id), utils.Warning)
+		return sendError(c, fiber.StatusNotFound, "document_not_in_trash")
+	}
+
+	if err := purgeDocument(doc); err != nil {
+		utils.HandleError(err, fmt.Sprintf("Failed to purge document %s", id), utils.Error)
+		return sendError(c, fiber.StatusInternalServerError, "document_purge_failed")
+	}
+	recordAudit(c, "document.purge", models.AuditTargetDocument, id, fiber.Map{
+		"original_name": doc.OriginalName,
+		"hash":          doc.Hash,
+		"deleted_at":    doc.DeletedAt.Time,
+	}, nil)
+
+	return c.JSON(fiber.Map{"message": localize(c, "document_purged"), "document_id": id})
+}
@@ -0,0 +1,336 @@
+// EmailController
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"tawtheeq-backend/config"
+	"tawtheeq-backend/mail"
+	"tawtheeq-backend/models"
+	"tawtheeq-backend/repositories"
+	"tawtheeq-backend/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	emailBatchSize   = 20
+	emailBackoffBase = time.Minute
+	emailBackoffMax  = 6 * time.Hour
+	emailSendTimeout = 30 * time.Second
+)
+
+// emailWake tells the sender that emails were queued.
+var emailWake = make(chan struct{}, 1)
+
+// emailMaxAttempts returns how often an email is tried before it is marked
+// failed, from MAIL_MAX_ATTEMPTS (default 6).
+func emailMaxAttempts() int {
+	attempts, err := strconv.Atoi(os.Getenv("MAIL_MAX_ATTEMPTS"))
+	if err != nil || attempts <= 0 {
+		attempts = 6
+	}
+	return attempts
+}
+
+// emailRetention returns how long sent and failed emails are kept, from
+// MAIL_RETENTION_DAYS (default 30).
+func emailRetention() time.Duration {
+	days, err := strconv.Atoi(os.Getenv("MAIL_RETENTION_DAYS"))
+	if err != nil || days <= 0 {
+		days = 30
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// emailExpiryNotice returns how long before a deleted document is purged
+// its signer is warned, from MAIL_EXPIRY_NOTICE_DAYS (default 3, 0 turns
+// the warning off).
+func emailExpiryNotice() time.Duration {
+	days, err := strconv.Atoi(os.Getenv("MAIL_EXPIRY_NOTICE_DAYS"))
+	if err != nil || days < 0 {
+		days = 3
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// emailDefaultLanguage returns the language of users without a preference,
+// from MAIL_DEFAULT_LANGUAGE (default en).
+func emailDefaultLanguage() string {
+	lang := os.Getenv("MAIL_DEFAULT_LANGUAGE")
+	if !mail.HasLanguage(lang) {
+		lang = "en"
+	}
+	return lang
+}
+
+// emailLanguage returns the language emails to user are written in.
+func emailLanguage(user *models.User) string {
+	if mail.HasLanguage(user.Language) {
+		return user.Language
+	}
+	return emailDefaultLanguage()
+}
+
+// emailBackoff returns the wait before the attempt after attempts failed
+// ones: 1m, 2m, 4m, ... up to 6h.
+func emailBackoff(attempts int) time.Duration {
+	wait := emailBackoffBase
+	for i := 1; i < attempts && wait < emailBackoffMax; i++ {
+		wait *= 2
+	}
+	if wait > emailBackoffMax {
+		wait = emailBackoffMax
+	}
+	return wait
+}
+
+func wakeEmailSender() {
+	select {
+	case emailWake <- struct{}{}:
+	default:
+	}
+}
+
+// frontendURL returns the address of the web app, from FRONTEND_ORIGIN.
+func frontendURL() string {
+	if origin := os.Getenv("FRONTEND_ORIGIN"); origin != "" {
+		return origin
+	}
+	return "http://localhost:3000"
+}
+
+// emailTime formats times shown in emails.
+func emailTime(t time.Time) string {
+	return t.Format("2006-01-02 15:04")
+}
+
+// emailDocument is the part of a document shown in emails. It is named by
+// its title, or the uploaded file name.
+func emailDocument(doc *models.Document) fiber.Map {
+	name := doc.Title
+	if name == "" {
+		name = doc.OriginalName
+	}
+	return fiber.Map{"Document": name, "DocumentID": doc.ID}
+}
+
+// queueEmail renders template for user in their language and puts it in
+// the outbox. reference names what the email is about, such as a document
+// ID. data is completed with the user's name.
+func queueEmail(user *models.User, template string, reference string, data fiber.Map) error {
+	lang := emailLanguage(user)
+	data["Name"] = user.FullName
+	rendered, err := mail.Render(template, lang, data)
+	if err != nil {
+		return utils.HandleError(err, fmt.Sprintf("Failed to render %s email for user %s", template, user.ID), utils.Error)
+	}
+
+	now := time.Now()
+	userID := user.ID
+	msg := &models.EmailMessage{
+		UserID:        &userID,
+		To:            user.Email,
+		Template:      template,
+		Reference:     reference,
+		Language:      lang,
+		Subject:       rendered.Subject,
+		TextBody:      rendered.Text,
+		HTMLBody:      rendered.HTML,
+		Status:        models.EmailPending,
+		NextAttemptAt: &now,
+	}
+	if err := repositories.NewEmailRepository(config.DB).Create(msg); err != nil {
+		return utils.HandleError(err, fmt.Sprintf("Failed to queue %s email for user %s", template, user.ID), utils.Error)
+	}
+	wakeEmailSender()
+	return nil
+}
+
+// queueEmailToUserID is queueEmail for a user that still has to be loaded.
+func queueEmailToUserID(userID string, template string, reference string, data fiber.Map) {
+	user, err := repositories.NewUserRepository(config.DB).FindByID(userID)
+	if err != nil {
+		utils.HandleError(err, fmt.Sprintf("Failed to load user %s for %s email", userID, template), utils.Warning)
+		return
+	}
+	queueEmail(user, template, reference, data)
+}
+
+// StartEmailSender sends queued emails as they come in, retrying failures
+// with exponential backoff. Finished emails are pruned every hour.
+func StartEmailSender() {
+	go func() {
+		ticker := time.NewTicker(10 * time.Second)
+		defer ticker.Stop()
+		prune := time.NewTicker(time.Hour)
+		defer prune.Stop()
+
+		pruneEmails()
+		for {
+			sendDueEmails()
+			select {
+			case <-emailWake:
+			case <-ticker.C:
+			case <-prune.C:
+				pruneEmails()
+			}
+		}
+	}()
+}
+
+// sendDueEmails sends due emails one after the other, in batches.
+func sendDueEmails() {
+	emailRepo := repositories.NewEmailRepository(config.DB)
+	for {
+		due, err := emailRepo.FindDue(time.Now(), emailBatchSize)
+		if err != nil {
+			utils.HandleError(err, "Failed to find due emails", utils.Error)
+			return
+		}
+		for i := range due {
+			attemptEmail(&due[i])
+		}
+		if len(due) < emailBatchSize {
+			return
+		}
+	}
+}
+
+// attemptEmail sends an email once and schedules the next attempt when it
+// fails.
+func attemptEmail(msg *models.EmailMessage) {
+	emailRepo := repositories.NewEmailRepository(config.DB)
+	claimed, err := emailRepo.Claim(msg, time.Now().Add(2*emailSendTimeout))
+	if err != nil {
+		utils.HandleError(err, fmt.Sprintf("Failed to claim email %s", msg.ID), utils.Error)
+		return
+	}
+	if !claimed {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), emailSendTimeout)
+	err = config.Mailer.Send(ctx, mail.Message{
+		From:     config.MailFrom,
+		FromName: config.MailFromName,
+		To:       msg.To,
+		Subject:  msg.Subject,
+		Text:     msg.TextBody,
+		HTML:     msg.HTMLBody,
+	})
+	cancel()
+
+	now := time.Now()
+	msg.Attempts++
+	msg.Error = ""
+	if err == nil {
+		msg.Status = models.EmailSent
+		msg.SentAt = &now
+		msg.NextAttemptAt = nil
+		msg.TextBody = ""
+		msg.HTMLBody = ""
+	} else {
+		msg.Error = err.Error()
+		utils.HandleError(err, fmt.Sprintf("Failed to send email %s (attempt %d)", msg.ID, msg.Attempts), utils.Warning)
+		if msg.Attempts >= emailMaxAttempts() {
+			msg.Status = models.EmailFailed
+			msg.NextAttemptAt = nil
+		} else {
+			next := now.Add(emailBackoff(msg.Attempts))
+			msg.NextAttemptAt = &next
+		}
+	}
+
+	if err := emailRepo.Update(msg); err != nil {
+		utils.HandleError(err, fmt.Sprintf("Failed to save email %s", msg.ID), utils.Error)
+	}
+}
+
+// pruneEmails removes finished emails past the retention. Expiry warnings
+// are kept at least as long as the trash keeps documents, since they mark
+// the documents already warned about.
+func pruneEmails() {
+	retention := emailRetention()
+	if trash := documentTrashRetention(); trash > retention {
+		retention = trash
+	}
+	emailRepo := repositories.NewEmailRepository(config.DB)
+	if _, err := emailRepo.DeleteFinishedBefore(time.Now().Add(-retention)); err != nil {
+		utils.HandleError(err, "Failed to prune emails", utils.Warning)
+	}
+}
+
+// GetEmails godoc
+// @Summary List queued emails
+// @Description The email outbox, newest first, with the outcome of the last attempt of each email. Bodies are not returned
+// @Tags emails
+// @Produce json
+// @Param status query string false "pending, sent or failed"
+// @Param template query string false "welcome, password_reset, password_changed, document_signed, document_revoked or document_expiring"
+// @Param limit query int false "Limit" default(10)
+// @Param page query int false "Page" default(1)
+// @Param cursor query string false "meta.next_cursor of the previous page"
+// @Success 200 {object} models.ListResponse{data=[]models.EmailMessage}
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /emails [get]
+// @Security Bearer
+func GetEmails(c *fiber.Ctx) error {
+	p, err := paginationFromQuery(c, models.DefaultPageSize)
+	if err != nil {
+		return sendErrorFrom(c, fiber.StatusBadRequest, err)
+	}
+
+	emailRepo := repositories.NewEmailRepository(config.DB)
+	msgs, total, err := emailRepo.FindAll(c.Query("status"), c.Query("template"), p)
+	if err != nil {
+		utils.HandleError(err, "Failed to fetch emails", utils.Error)
+		return sendError(c, fiber.StatusInternalServerError, "emails_fetch_failed")
+	}
+	return sendList(c, msgs, p, total, nextCursor(p, msgs, func(msg models.EmailMessage) models.Cursor {
+		return models.Cursor{Time: msg.CreatedAt, ID: msg.ID}
+	}))
+}
+
+// RetryEmail godoc
+// @Summary Retry a failed email
+// @Description Queue a failed email again with a fresh set of attempts
+// @Tags emails
+// @Produce json
+// @Param id path string true "Email ID"
+// @Success 200 {object} models.EmailMessage
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /emails/{id}/retry [post]
+// @Security Bearer
+func RetryEmail(c *fiber.Ctx) error {
+	id := c.Params("id")
+	emailRepo := repositories.NewEmailRepository(config.DB)
+	msg, err := emailRepo.FindByID(id)
+	if err != nil {
+		utils.HandleError(err, fmt.Sprintf("Email not found: %s", id), utils.Warning)
+		return sendError(c, fiber.StatusNotFound, "email_not_found")
+	}
+	if msg.Status != models.EmailFailed {
+		return sendError(c, fiber.StatusConflict, "email_not_failed")
+	}
+
+	now := time.Now()
+	msg.Status = models.EmailPending
+	msg.Attempts = 0
+	msg.NextAttemptAt = &now
+	if err := emailRepo.Update(msg); err != nil {
+		utils.HandleError(err, fmt.Sprintf("Failed to retry email %s", id), utils.Error)
+		return sendError(c, fiber.StatusInternalServerError, "email_retry_failed")
+	}
+	recordAudit(c, "email.retry", models.AuditTargetEmail, msg.ID, fiber.Map{"status": models.EmailFailed}, fiber.Map{"status": models.EmailPending})
+	wakeEmailSender()
+
+	return c.JSON(msg)
+}
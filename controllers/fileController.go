@@ -5,19 +5,26 @@ import (
 	"context"
 	"crypto/sha256"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
+	"mime"
 	"mime/multipart"
+	"net/url"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"tawtheeq-backend/config"
+	"tawtheeq-backend/models"
+	"tawtheeq-backend/repositories"
+	"tawtheeq-backend/storage"
 	"tawtheeq-backend/utils"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
 	"github.com/joho/godotenv"
-	"github.com/minio/minio-go/v7"
 )
 
 func UploadFileLocal(c *fiber.Ctx, uploadDir string) (*os.File, string, string, string, string, error) {
@@ -96,69 +103,55 @@ func UploadFile(c *fiber.Ctx) (hash string, savePath string, ext string, id stri
 	hash = hex.EncodeToString(hasher.Sum(nil))
 	hashedFileName := fmt.Sprintf("%s%s", hash, ext)
 
-	// S3 upload
-	if os.Getenv("S3_ENABLED") == "true" {
-		bucket := os.Getenv("S3_BUCKET")
-		_, s3Err := config.S3Client.StatObject(context.Background(), bucket, hashedFileName, minio.StatObjectOptions{})
-		if s3Err == nil {
-			savePath = hashedFileName
-			return
-		}
-		_, s3Err = config.S3Client.PutObject(context.Background(), bucket, hashedFileName, &buf, int64(buf.Len()), minio.PutObjectOptions{
-			ContentType: fileHeader.Header.Get("Content-Type"),
-		})
-		if s3Err != nil {
-			err = utils.HandleError(s3Err, "Failed to upload file to S3", utils.Error)
-			return
-		}
-		savePath = hashedFileName
+	// skip the upload when the same content is already stored
+	savePath = hashedFileName
+	if _, statErr := config.Storage.Stat(context.Background(), hashedFileName); statErr == nil {
 		return
 	}
-
-	// Local upload fallback
-	uploadDir := os.Getenv("UPLOAD_DIR")
-	if uploadDir == "" {
-		uploadDir = "./uploads"
+	err = config.Storage.Put(context.Background(), hashedFileName, &buf, int64(buf.Len()), fileHeader.Header.Get("Content-Type"))
+	if err != nil {
+		err = utils.HandleError(err, "Failed to store file", utils.Error)
+		return
 	}
-	if _, err = os.Stat(uploadDir); os.IsNotExist(err) {
-		err = os.MkdirAll(uploadDir, os.ModePerm)
-		if err != nil {
-			err = utils.HandleError(err, "Failed to create upload directory", utils.Error)
-			return
-		}
+
+	return
+}
+
+// storeFile copies a local file into the configured storage under key,
+// unless an object with that key already exists.
+func storeFile(localPath string, key string, contentType string) error {
+	ctx := context.Background()
+	if _, err := config.Storage.Stat(ctx, key); err == nil {
+		return nil
+	} else if !errors.Is(err, storage.ErrNotFound) {
+		return err
 	}
 
-	savePath = filepath.Join(uploadDir, hashedFileName)
-	if _, err = os.Stat(savePath); os.IsNotExist(err) {
-		err = os.WriteFile(savePath, buf.Bytes(), 0644)
-		if err != nil {
-			err = utils.HandleError(err, "Failed to save file locally", utils.Error)
-			return
-		}
+	f, err := os.Open(localPath)
+	if err != nil {
+		return err
 	}
+	defer f.Close()
 
-	return
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	return config.Storage.Put(ctx, key, f, info.Size(), contentType)
 }
 
+// RemoveFile deletes a stored file. Only the last path element is used as
+// the key, so callers may pass either a key or a legacy local path.
 func RemoveFile(filePath string) error {
-	if os.Getenv("S3_ENABLED") == "true" {
-		bucket := os.Getenv("S3_BUCKET")
-
-		key := filePath
-		if strings.Contains(filePath, "/") {
-			parts := strings.Split(filePath, "/")
-			key = parts[len(parts)-1]
-		}
-
-		err := config.S3Client.RemoveObject(context.Background(), bucket, key, minio.RemoveObjectOptions{})
-		if err != nil {
-			return utils.HandleError(err, "Failed to remove file from S3", utils.Error)
-		}
-		return nil
+	key := filePath
+	if strings.Contains(filePath, "/") {
+		parts := strings.Split(filePath, "/")
+		key = parts[len(parts)-1]
 	}
 
-	if err := os.Remove(filePath); err != nil {
-		return utils.HandleError(err, "Failed to remove file locally", utils.Error)
+	err := config.Storage.Delete(context.Background(), key)
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		return utils.HandleError(err, "Failed to remove stored file", utils.Error)
 	}
 	return nil
 }
@@ -177,3 +170,196 @@ func GetFileHashFromPath(filepath string) string {
 	}
 	return hex.EncodeToString(hasher.Sum(nil))
 }
+
+// documentContentType returns the MIME type for a stored file extension.
+func documentContentType(ext string) string {
+	if t := mime.TypeByExtension(strings.ToLower(ext)); t != "" {
+		return t
+	}
+	return "application/octet-stream"
+}
+
+// contentDisposition builds an attachment header that keeps non-ASCII
+// (e.g. Arabic) file names intact.
+func contentDisposition(filename string) string {
+	filename = filepath.Base(filename)
+	fallback := strings.Map(func(r rune) rune {
+		if r < 0x20 || r > 0x7e || r == '"' || r == '\\' {
+			return '_'
+		}
+		return r
+	}, filename)
+	return fmt.Sprintf(`attachment; filename="%s"; filename*=UTF-8''%s`, fallback, url.PathEscape(filename))
+}
+
+// canAccessDocument reports whether the caller may read a document: its
+// signer, members of the signing team and super admins.
+func canAccessDocument(c *fiber.Ctx, doc *models.Document) bool {
+	role, _ := c.Locals("userRole").(string)
+	if role == string(models.SuperAdminRole) {
+		return true
+	}
+	userID, _ := c.Locals("userID").(string)
+	if userID != "" && doc.SignedByUserID == userID {
+		return true
+	}
+	teamID, _ := c.Locals("teamId").(string)
+	return teamID != "" && doc.SignedByTeamID != nil && *doc.SignedByTeamID == teamID
+}
+
+// GetDocumentFile godoc
+// @Summary Download signed file
+// @Description Streams the signed file from local or encrypted storage (with range support) or redirects to a short-lived presigned S3 URL. Pass redirect=false to get the URL as JSON instead
+// @Tags documents
+// @Produce octet-stream
+// @Param id path string true "Document ID"
+// @Param redirect query bool false "Redirect to the presigned URL when S3 is enabled" default(true)
+// @Success 200 {file} file
+// @Success 302 {string} string "Redirect to presigned URL"
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /documents/{id}/file [get]
+// @Security Bearer
+func GetDocumentFile(c *fiber.Ctx) error {
+	id := c.Params("id")
+	docRepo := repositories.NewDocumentRepository(config.DB)
+	doc, err := docRepo.FindWithRelations(id)
+	if err != nil {
+		utils.HandleError(err, fmt.Sprintf("Document not found: %s", id), utils.Warning)
+		return sendError(c, fiber.StatusNotFound, "document_not_found")
+	}
+	if !canAccessDocument(c, doc) {
+		return sendError(c, fiber.StatusForbidden, "access_denied")
+	}
+
+	// documents whose file was never matched to a key have nothing to serve
+	key := doc.StorageKey
+	if key == "" {
+		return sendError(c, fiber.StatusNotFound, "file_not_found")
+	}
+	contentType := documentContentType(doc.FileFormat)
+	disposition := contentDisposition(doc.OriginalName)
+
+	ctx := context.Background()
+	expiry, err := strconv.Atoi(os.Getenv("S3_PRESIGN_EXPIRY"))
+	if err != nil || expiry <= 0 {
+		expiry = 300
+	}
+
+	presigned, err := config.Storage.PresignGet(ctx, key, time.Duration(expiry)*time.Second, storage.PresignOptions{
+		ContentType:        contentType,
+		ContentDisposition: disposition,
+	})
+	if err == nil {
+		if c.Query("redirect", "true") == "false" {
+			return c.JSON(fiber.Map{
+				"url":        presigned,
+				"expires_at": time.Now().Add(time.Duration(expiry) * time.Second),
+			})
+		}
+		return c.Redirect(presigned, fiber.StatusFound)
+	}
+	if !errors.Is(err, storage.ErrPresignUnsupported) {
+		utils.HandleError(err, fmt.Sprintf("Failed to presign document %s", id), utils.Error)
+		return sendError(c, fiber.StatusInternalServerError, "download_link_failed")
+	}
+
+	info, err := config.Storage.Stat(ctx, key)
+	if err != nil {
+		utils.HandleError(err, fmt.Sprintf("Stored file missing for document %s", id), utils.Error)
+		return sendError(c, fiber.StatusNotFound, "file_not_found")
+	}
+
+	c.Set(fiber.HeaderContentDisposition, disposition)
+
+	// files on local disk are served with range support
+	if locator, ok := config.Storage.(storage.FileLocator); ok {
+		path, err := locator.LocalPath(key)
+		if err != nil {
+			return sendError(c, fiber.StatusNotFound, "file_not_found")
+		}
+		if err := c.SendFile(path); err != nil {
+			return err
+		}
+		c.Set(fiber.HeaderContentType, contentType)
+		return nil
+	}
+
+	reader, err := config.Storage.Get(ctx, key)
+	if err != nil {
+		utils.HandleError(err, fmt.Sprintf("Failed to read stored file for document %s", id), utils.Error)
+		return sendError(c, fiber.StatusInternalServerError, "file_read_failed")
+	}
+	c.Set(fiber.HeaderContentType, contentType)
+	// encrypted files can seek, so a range only decrypts the chunks it covers
+	if seeker, ok := reader.(io.ReadSeekCloser); ok {
+		return sendSeekable(c, seeker, info.Size)
+	}
+	return c.SendStream(reader)
+}
+
+// sendSeekable answers with r, or with the byte range the Range header asks
+// for. Requests for several ranges get the whole file.
+func sendSeekable(c *fiber.Ctx, r io.ReadSeekCloser, size int64) error {
+	c.Set(fiber.HeaderAcceptRanges, "bytes")
+	start, end, partial, ok := parseByteRange(c.Get(fiber.HeaderRange), size)
+	if !ok {
+		r.Close()
+		c.Set(fiber.HeaderContentRange, fmt.Sprintf("bytes */%d", size))
+		return sendError(c, fiber.StatusRequestedRangeNotSatisfiable, "invalid_range")
+	}
+	if !partial {
+		return c.SendStream(r, int(size))
+	}
+
+	if _, err := r.Seek(start, io.SeekStart); err != nil {
+		r.Close()
+		utils.HandleError(err, "Failed to seek stored file", utils.Error)
+		return sendError(c, fiber.StatusInternalServerError, "file_read_failed")
+	}
+	length := end - start + 1
+	c.Status(fiber.StatusPartialContent)
+	c.Set(fiber.HeaderContentRange, fmt.Sprintf("bytes %d-%d/%d", start, end, size))
+	return c.SendStream(struct {
+		io.Reader
+		io.Closer
+	}{io.LimitReader(r, length), r}, int(length))
+}
+
+// parseByteRange reads a single "bytes=" range of a size byte file, with
+// end inclusive. partial is false when the whole file should be sent and ok
+// is false when the range cannot be satisfied.
+func parseByteRange(header string, size int64) (start, end int64, partial, ok bool) {
+	spec, found := strings.CutPrefix(strings.TrimSpace(header), "bytes=")
+	if !found || strings.Contains(spec, ",") {
+		return 0, size - 1, false, true
+	}
+	first, last, found := strings.Cut(strings.TrimSpace(spec), "-")
+	if !found {
+		return 0, 0, false, false
+	}
+
+	// "-n" is the last n bytes
+	if first == "" {
+		n, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || n <= 0 || size == 0 {
+			return 0, 0, false, false
+		}
+		return max(size-n, 0), size - 1, true, true
+	}
+
+	start, err := strconv.ParseInt(first, 10, 64)
+	if err != nil || start < 0 || start >= size {
+		return 0, 0, false, false
+	}
+	end = size - 1
+	if last != "" {
+		n, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || n < start {
+			return 0, 0, false, false
+		}
+		end = min(n, end)
+	}
+	return start, end, true, true
+}
@@ -0,0 +1,35 @@
+package controllers
+
+import "testing"
+
+func TestParseByteRange(t *testing.T) {
+	tests := []struct {
+		header     string
+		size       int64
+		start, end int64
+		partial    bool
+		ok         bool
+	}{
+		{"", 100, 0, 99, false, true},
+		{"bytes=0-9", 100, 0, 9, true, true},
+		{"bytes=90-", 100, 90, 99, true, true},
+		{"bytes=90-500", 100, 90, 99, true, true},
+		{"bytes=-10", 100, 90, 99, true, true},
+		{"bytes=-500", 100, 0, 99, true, true},
+		{"bytes=0-9,20-29", 100, 0, 99, false, true},
+		{"items=0-9", 100, 0, 99, false, true},
+		{"bytes=100-", 100, 0, 0, false, false},
+		{"bytes=9-0", 100, 0, 0, false, false},
+		{"bytes=-0", 100, 0, 0, false, false},
+		{"bytes=-5", 0, 0, 0, false, false},
+		{"bytes=a-b", 100, 0, 0, false, false},
+		{"bytes=5", 100, 0, 0, false, false},
+	}
+	for _, tt := range tests {
+		start, end, partial, ok := parseByteRange(tt.header, tt.size)
+		if ok != tt.ok || partial != tt.partial || (ok && (start != tt.start || end != tt.end)) {
+			t.Errorf("parseByteRange(%q, %d) = %d, %d, %v, %v, want %d, %d, %v, %v",
+				tt.header, tt.size, start, end, partial, ok, tt.start, tt.end, tt.partial, tt.ok)
+		}
+	}
+}
@@ -1,9 +1,11 @@
 package controllers
 
 import (
+	"crypto/ed25519"
 	"crypto/rsa"
 	"crypto/x509"
 	"encoding/pem"
+	"fmt"
 	"os"
 	"tawtheeq-backend/utils"
 )
@@ -57,3 +59,51 @@ func PrivateKey() (*rsa.PrivateKey, error) {
 
 	return rsaPrivateKey, nil
 }
+
+func QRPublicKey() (ed25519.PublicKey, error) {
+	keyPath := os.Getenv("QR_PUBLIC_KEY_PATH")
+	keyBytes, err := os.ReadFile(keyPath)
+	if err != nil {
+		return nil, utils.HandleError(err, "Failed to read QR public key", utils.Error)
+	}
+
+	block, _ := pem.Decode(keyBytes)
+	if block == nil || block.Type != "PUBLIC KEY" {
+		return nil, utils.HandleError(fmt.Errorf("invalid PEM block"), "Invalid QR public key format", utils.Error)
+	}
+
+	publicKey, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, utils.HandleError(err, "Failed to parse QR public key", utils.Error)
+	}
+
+	edPublicKey, ok := publicKey.(ed25519.PublicKey)
+	if !ok {
+		return nil, utils.HandleError(fmt.Errorf("unexpected key type %T", publicKey), "QR public key is not of type ed25519.PublicKey", utils.Error)
+	}
+	return edPublicKey, nil
+}
+
+func QRPrivateKey() (ed25519.PrivateKey, error) {
+	keyPath := os.Getenv("QR_PRIVATE_KEY_PATH")
+	keyBytes, err := os.ReadFile(keyPath)
+	if err != nil {
+		return nil, utils.HandleError(err, "Failed to read QR private key", utils.Error)
+	}
+
+	block, _ := pem.Decode(keyBytes)
+	if block == nil || block.Type != "PRIVATE KEY" {
+		return nil, utils.HandleError(fmt.Errorf("invalid PEM block"), "Invalid QR private key format", utils.Error)
+	}
+
+	privateKey, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, utils.HandleError(err, "Failed to parse QR private key", utils.Error)
+	}
+
+	edPrivateKey, ok := privateKey.(ed25519.PrivateKey)
+	if !ok {
+		return nil, utils.HandleError(fmt.Errorf("unexpected key type %T", privateKey), "QR private key is not of type ed25519.PrivateKey", utils.Error)
+	}
+	return edPrivateKey, nil
+}
@@ -0,0 +1,99 @@
+// Locale
+package controllers
+
+import (
+	"errors"
+	"time"
+
+	"tawtheeq-backend/config"
+	"tawtheeq-backend/i18n"
+	"tawtheeq-backend/models"
+	"tawtheeq-backend/repositories"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// requestLanguage returns the language to answer the request in: the saved
+// preference of the signed-in user, then the Accept-Language header, then
+// the default. The user is only loaded once per request.
+func requestLanguage(c *fiber.Ctx) string {
+	if lang, ok := c.Locals("lang").(string); ok {
+		return lang
+	}
+
+	lang := ""
+	if userID, ok := c.Locals("userID").(string); ok && userID != "" {
+		if user, err := repositories.NewUserRepository(config.DB).FindByID(userID); err == nil && i18n.Supported(user.Language) {
+			lang = user.Language
+		}
+	}
+	if lang == "" {
+		lang = i18n.Negotiate(c.Get(fiber.HeaderAcceptLanguage))
+	}
+	if lang == "" {
+		lang = i18n.DefaultLanguage()
+	}
+	c.Locals("lang", lang)
+	return lang
+}
+
+// localize returns the message for code in the language of the request.
+func localize(c *fiber.Ctx, code string, args ...interface{}) string {
+	return i18n.Message(requestLanguage(c), code, args...)
+}
+
+// sendError answers with the message for code in the language of the
+// request.
+func sendError(c *fiber.Ctx, status int, code string, args ...interface{}) error {
+	return c.Status(status).JSON(models.ErrorResponse{
+		Error:    localize(c, code, args...),
+		Code:     code,
+		CreateAt: time.Now(),
+	})
+}
+
+// sendErrorFrom answers with err. Coded errors are translated; other errors,
+// such as body parser failures, are sent as they are with code
+// invalid_request.
+func sendErrorFrom(c *fiber.Ctx, status int, err error) error {
+	var coded *i18n.Error
+	if errors.As(err, &coded) {
+		return sendError(c, status, coded.Code, coded.Args...)
+	}
+	return sendError(c, status, "invalid_request", err.Error())
+}
+
+// fiberErrorCodes are the codes of the errors Fiber itself returns.
+var fiberErrorCodes = map[int]string{
+	fiber.StatusNotFound:              "not_found",
+	fiber.StatusMethodNotAllowed:      "method_not_allowed",
+	fiber.StatusRequestEntityTooLarge: "request_too_large",
+}
+
+// ErrorHandler answers errors returned by handlers and Fiber. Handlers log
+// their errors with utils.HandleError, so unexpected ones are reported as
+// internal errors without their details.
+func ErrorHandler(c *fiber.Ctx, err error) error {
+	status := fiber.StatusInternalServerError
+	code := "internal_error"
+	var fiberErr *fiber.Error
+	if errors.As(err, &fiberErr) {
+		status = fiberErr.Code
+		if known, ok := fiberErrorCodes[status]; ok {
+			code = known
+		} else if status < fiber.StatusInternalServerError {
+			code = "invalid_request"
+		}
+	}
+
+	message := localize(c, code)
+	if code == "invalid_request" {
+		message = localize(c, code, fiberErr.Message)
+	}
+	return c.Status(status).JSON(fiber.Map{
+		"error":      message,
+		"code":       code,
+		"status":     status,
+		"created_at": time.Now(),
+	})
+}
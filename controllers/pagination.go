@@ -0,0 +1,69 @@
+package controllers
+
+import (
+	"strconv"
+
+	"tawtheeq-backend/i18n"
+	"tawtheeq-backend/models"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+var errCursorUnsupported = i18n.Errorf("cursor_unsupported")
+
+// paginationFromQuery reads limit, page and cursor from the query string.
+// limit defaults to defaultLimit and is capped at models.MaxPageSize; a
+// cursor takes precedence over page.
+func paginationFromQuery(c *fiber.Ctx, defaultLimit int) (models.Pagination, error) {
+	p := models.Pagination{Limit: defaultLimit, Page: 1}
+
+	if v := c.Query("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit <= 0 {
+			return p, i18n.Errorf("invalid_limit")
+		}
+		p.Limit = limit
+	}
+	if p.Limit > models.MaxPageSize {
+		p.Limit = models.MaxPageSize
+	}
+
+	if v := c.Query("cursor"); v != "" {
+		cursor, err := models.DecodeCursor(v)
+		if err != nil {
+			return p, err
+		}
+		p.Cursor = cursor
+		return p, nil
+	}
+	if v := c.Query("page"); v != "" {
+		page, err := strconv.Atoi(v)
+		if err != nil || page <= 0 {
+			return p, i18n.Errorf("invalid_page")
+		}
+		p.Page = page
+	}
+	return p, nil
+}
+
+// nextCursor returns the cursor of the page after items, or "" when items
+// is the last page. position gives the sort key of an item.
+func nextCursor[T any](p models.Pagination, items []T, position func(T) models.Cursor) string {
+	if len(items) == 0 || len(items) < p.Limit {
+		return ""
+	}
+	return position(items[len(items)-1]).Encode()
+}
+
+// sendList writes data in the list envelope.
+func sendList(c *fiber.Ctx, data interface{}, p models.Pagination, total int64, next string) error {
+	meta := models.PageMeta{Limit: p.Limit, Total: total, NextCursor: next}
+	if p.Cursor == nil {
+		meta.Page = p.Page
+	}
+	return c.JSON(models.ListResponse{Data: data, Meta: meta})
+}
+
+func documentCreated(doc models.Document) models.Cursor {
+	return models.Cursor{Time: doc.CreatedAt, ID: doc.ID}
+}
@@ -0,0 +1,86 @@
+package controllers
+
+import (
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"tawtheeq-backend/i18n"
+	"tawtheeq-backend/models"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestPaginationFromQuery(t *testing.T) {
+	cursor := models.Cursor{Time: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC), ID: "doc"}
+
+	tests := []struct {
+		query  string
+		limit  int
+		page   int
+		cursor bool
+		code   string
+	}{
+		{"", 20, 1, false, ""},
+		{"?limit=5&page=3", 5, 3, false, ""},
+		{"?limit=1000", models.MaxPageSize, 1, false, ""},
+		{"?limit=5&page=3&cursor=" + cursor.Encode(), 5, 1, true, ""},
+		{"?limit=0", 0, 0, false, "invalid_limit"},
+		{"?limit=ten", 0, 0, false, "invalid_limit"},
+		{"?page=0", 0, 0, false, "invalid_page"},
+		{"?cursor=nope", 0, 0, false, "invalid_cursor"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			app := fiber.New()
+			var got models.Pagination
+			var err error
+			app.Get("/", func(c *fiber.Ctx) error {
+				got, err = paginationFromQuery(c, 20)
+				return nil
+			})
+			if _, testErr := app.Test(httptest.NewRequest("GET", "/"+tt.query, nil)); testErr != nil {
+				t.Fatal(testErr)
+			}
+
+			if tt.code != "" {
+				var coded *i18n.Error
+				if !errors.As(err, &coded) || coded.Code != tt.code {
+					t.Errorf("error %v, want %s", err, tt.code)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Limit != tt.limit || got.Page != tt.page || (got.Cursor != nil) != tt.cursor {
+				t.Errorf("pagination %+v, want limit %d page %d cursor %v", got, tt.limit, tt.page, tt.cursor)
+			}
+			if tt.cursor && (got.Cursor.ID != cursor.ID || !got.Cursor.Time.Equal(cursor.Time)) {
+				t.Errorf("cursor %+v, want %+v", *got.Cursor, cursor)
+			}
+		})
+	}
+}
+
+func TestNextCursor(t *testing.T) {
+	now := time.Now()
+	docs := []models.Document{{ID: "a", CreatedAt: now}, {ID: "b", CreatedAt: now.Add(-time.Minute)}}
+
+	tests := []struct {
+		name  string
+		limit int
+		items []models.Document
+		want  string
+	}{
+		{"full page", 2, docs, documentCreated(docs[1]).Encode()},
+		{"last page", 3, docs, ""},
+		{"empty", 2, nil, ""},
+	}
+	for _, tt := range tests {
+		if got := nextCursor(models.Pagination{Limit: tt.limit}, tt.items, documentCreated); got != tt.want {
+			t.Errorf("%s: next cursor %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
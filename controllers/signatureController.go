@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"strings"
 	"tawtheeq-backend/utils"
 
 	"crypto"
@@ -47,6 +48,22 @@ func generateSignature(data []byte) (string, error) {
 	return base64.StdEncoding.EncodeToString(signature), nil
 }
 
+// verifySignature checks a base64 signature made by generateSignature.
+func verifySignature(data []byte, signature string) error {
+	publicKey, err := PublicKey()
+	if err != nil {
+		return err
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return err
+	}
+
+	hashed := sha256.Sum256(data)
+	return rsa.VerifyPKCS1v15(publicKey, crypto.SHA256, hashed[:], sig)
+}
+
 func writeSignatureOnFile(filePath, id, signature string) error {
 
 	comment := fmt.Sprintf("ID:%s;SIG:%s", id, signature)
@@ -68,3 +85,30 @@ func writeSignatureOnFile(filePath, id, signature string) error {
 
 	return nil
 }
+
+// readSignatureComment returns the upload ID and signature that
+// writeSignatureOnFile embedded in a signed file.
+func readSignatureComment(filePath string) (string, string, error) {
+	output, err := exec.Command("exiftool", "-s3", "-UserComment", filePath).Output()
+	if err != nil {
+		return "", "", err
+	}
+	id, signature, ok := parseSignatureComment(strings.TrimSpace(string(output)))
+	if !ok {
+		return "", "", fmt.Errorf("no signature comment in %s", filePath)
+	}
+	return id, signature, nil
+}
+
+// parseSignatureComment splits an "ID:<id>;SIG:<signature>" comment.
+func parseSignatureComment(comment string) (string, string, bool) {
+	rest, ok := strings.CutPrefix(comment, "ID:")
+	if !ok {
+		return "", "", false
+	}
+	id, signature, ok := strings.Cut(rest, ";SIG:")
+	if !ok || id == "" || signature == "" {
+		return "", "", false
+	}
+	return id, signature, true
+}
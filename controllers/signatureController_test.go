@@ -0,0 +1,25 @@
+package controllers
+
+import "testing"
+
+func TestParseSignatureComment(t *testing.T) {
+	tests := []struct {
+		comment       string
+		id, signature string
+		ok            bool
+	}{
+		{"ID:3f1c;SIG:c2lnbmF0dXJl==", "3f1c", "c2lnbmF0dXJl==", true},
+		{"ID:3f1c;SIG:a;b", "3f1c", "a;b", true},
+		{"ID:;SIG:abc", "", "", false},
+		{"ID:3f1c;SIG:", "", "", false},
+		{"ID:3f1c", "", "", false},
+		{"SIG:abc", "", "", false},
+		{"", "", "", false},
+	}
+	for _, tt := range tests {
+		id, signature, ok := parseSignatureComment(tt.comment)
+		if id != tt.id || signature != tt.signature || ok != tt.ok {
+			t.Errorf("parseSignatureComment(%q) = %q, %q, %v, want %q, %q, %v", tt.comment, id, signature, ok, tt.id, tt.signature, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,618 @@
+// StampTemplateController
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"tawtheeq-backend/config"
+	"tawtheeq-backend/i18n"
+	"tawtheeq-backend/models"
+	"tawtheeq-backend/repositories"
+	"tawtheeq-backend/storage"
+	"tawtheeq-backend/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+var stampCorners = map[string]bool{"top-left": true, "top-right": true, "bottom-left": true, "bottom-right": true}
+
+// stampLogoPrefix is the storage prefix of stamp template logos. The storage
+// scrubber leaves these keys alone.
+const stampLogoPrefix = "stamp-logos/"
+
+// maxStampLogoSize is the largest logo upload accepted, in bytes.
+const maxStampLogoSize = 2 << 20
+
+// stampFontDir holds the fonts a stamp template may use. Templates name a
+// font file in it; they never point at other files on the server.
+const stampFontDir = "assets/fonts"
+
+// resolveStampFont turns a font name such as "Cairo.ttf" into its path in
+// stampFontDir. The stored path form "assets/fonts/Cairo.ttf" is accepted too.
+func resolveStampFont(name string) (string, error) {
+	name = strings.TrimPrefix(name, stampFontDir+"/")
+	ext := strings.ToLower(filepath.Ext(name))
+	if strings.ContainsAny(name, `/\`) || (ext != ".ttf" && ext != ".otf") {
+		return "", i18n.Errorf("invalid_font", name)
+	}
+	path := filepath.Join(stampFontDir, name)
+	info, err := os.Stat(path)
+	if err != nil || !info.Mode().IsRegular() {
+		return "", i18n.Errorf("font_not_found", name)
+	}
+	return path, nil
+}
+
+// stampFontAllowed reports whether a stored font path may be used: a font in
+// stampFontDir or the IMAGE_FONT_PATH set by the operator. Older templates
+// could hold any path.
+func stampFontAllowed(path string) bool {
+	return path == "" || path == utils.DefaultStampStyle().FontPath || filepath.Dir(path) == stampFontDir
+}
+
+// stampStyleFromTemplate converts a stored template into the style used by
+// the stamping code.
+func stampStyleFromTemplate(tpl *models.StampTemplate) utils.StampStyle {
+	style := utils.StampStyle{
+		TextTemplate: tpl.TextTemplate,
+		FontPath:     tpl.FontPath,
+		FontSize:     tpl.FontSize,
+		TextColor:    tpl.TextColor,
+		BgColor:      tpl.BgColor,
+		BgOpacity:    tpl.BgOpacity,
+		TextAlign:    tpl.TextAlign,
+		BarPosition:  tpl.BarPosition,
+		LogoPath:     tpl.LogoPath,
+		LogoSize:     tpl.LogoSize,
+		LogoPosition: tpl.LogoPosition,
+		QREnabled:    tpl.QREnabled,
+		QRPosition:   tpl.QRPosition,
+		QRSize:       tpl.QRSize,
+		QRMarginX:    tpl.QRMarginX,
+		QRMarginY:    tpl.QRMarginY,
+	}
+	if !stampFontAllowed(tpl.FontPath) {
+		style.FontPath = utils.DefaultStampStyle().FontPath
+	}
+	if strings.HasPrefix(tpl.LogoPath, stampLogoPrefix) {
+		style.LogoPath = ""
+		style.Logo = loadStoredStampLogo(tpl.LogoPath)
+	}
+	return style
+}
+
+// loadStoredStampLogo reads and decodes a logo from storage, or returns nil
+// so the stamp is drawn without it.
+func loadStoredStampLogo(key string) image.Image {
+	rc, err := config.Storage.Get(context.Background(), key)
+	if err != nil {
+		utils.HandleError(err, fmt.Sprintf("Failed to read stamp logo %s", key), utils.Warning)
+		return nil
+	}
+	defer rc.Close()
+	logo, _, err := image.Decode(rc)
+	if err != nil {
+		utils.HandleError(err, fmt.Sprintf("Failed to decode stamp logo %s", key), utils.Warning)
+		return nil
+	}
+	return logo
+}
+
+// removeStampLogo deletes a logo from storage, or from the local assets
+// directory for logos saved before they moved to storage.
+func removeStampLogo(path string) {
+	var err error
+	if strings.HasPrefix(path, stampLogoPrefix) {
+		err = config.Storage.Delete(context.Background(), path)
+	} else {
+		err = os.Remove(path)
+	}
+	if err != nil && !errors.Is(err, storage.ErrNotFound) && !errors.Is(err, os.ErrNotExist) {
+		utils.HandleError(err, fmt.Sprintf("Failed to remove stamp logo %s", path), utils.Warning)
+	}
+}
+
+// newStampTemplateFromDefaults returns a template seeded from the IMAGE_* and
+// QR_* environment settings.
+func newStampTemplateFromDefaults(name string, teamID *string) *models.StampTemplate {
+	style := utils.DefaultStampStyle()
+	return &models.StampTemplate{
+		TeamID:       teamID,
+		Name:         name,
+		TextTemplate: style.TextTemplate,
+		FontPath:     style.FontPath,
+		FontSize:     style.FontSize,
+		TextColor:    style.TextColor,
+		BgColor:      style.BgColor,
+		BgOpacity:    style.BgOpacity,
+		TextAlign:    style.TextAlign,
+		BarPosition:  style.BarPosition,
+		LogoSize:     80,
+		LogoPosition: "top-left",
+		QREnabled:    style.QREnabled,
+		QRPosition:   style.QRPosition,
+		QRSize:       style.QRSize,
+		QRMarginX:    style.QRMarginX,
+		QRMarginY:    style.QRMarginY,
+	}
+}
+
+// resolveStampStyle picks the stamp style for an upload: the requested
+// template if the team may use it, otherwise the team default, the global
+// default and finally the environment settings.
+func resolveStampStyle(templateID string, teamID string) (utils.StampStyle, error) {
+	repo := repositories.NewStampTemplateRepository(config.DB)
+
+	if templateID != "" {
+		tpl, err := repo.FindByID(templateID)
+		if err != nil {
+			return utils.StampStyle{}, i18n.Errorf("stamp_template_missing", templateID)
+		}
+		if tpl.TeamID != nil && *tpl.TeamID != teamID {
+			return utils.StampStyle{}, i18n.Errorf("stamp_template_other_team", templateID)
+		}
+		return stampStyleFromTemplate(tpl), nil
+	}
+
+	if teamID != "" {
+		if tpl, err := repo.FindDefaultForTeam(teamID); err == nil {
+			return stampStyleFromTemplate(tpl), nil
+		}
+	}
+	if tpl, err := repo.FindGlobalDefault(); err == nil {
+		return stampStyleFromTemplate(tpl), nil
+	}
+
+	return utils.DefaultStampStyle(), nil
+}
+
+// stampOptionsFromForm reads the stamp template, page selection and placement
+// of an upload and validates them against the uploaded file.
+func stampOptionsFromForm(c *fiber.Ctx, filePath string, teamID string) (utils.StampOptions, error) {
+	style, err := resolveStampStyle(c.FormValue("template_id"), teamID)
+	if err != nil {
+		return utils.StampOptions{}, err
+	}
+
+	pages, err := utils.ParsePageSelection(c.FormValue("pages"))
+	if err != nil {
+		return utils.StampOptions{}, err
+	}
+
+	placement, err := utils.ParseStampPlacement(
+		c.FormValue("anchor"),
+		c.FormValue("offset_x"),
+		c.FormValue("offset_y"),
+		c.FormValue("width"),
+		c.FormValue("height"),
+	)
+	if err != nil {
+		return utils.StampOptions{}, err
+	}
+
+	opts := utils.StampOptions{Style: style, Pages: pages, Placement: placement}
+	if err := utils.ValidateStampOptions(filePath, opts); err != nil {
+		return utils.StampOptions{}, err
+	}
+	return opts, nil
+}
+
+// canManageStampTemplate reports whether the caller may change the template.
+// Super admins manage every template, team leaders only their team's.
+func canManageStampTemplate(c *fiber.Ctx, tpl *models.StampTemplate) bool {
+	role, _ := c.Locals("userRole").(string)
+	if role == string(models.SuperAdminRole) {
+		return true
+	}
+	teamID, _ := c.Locals("teamId").(string)
+	return role == string(models.TeamLeaderRole) && tpl.TeamID != nil && *tpl.TeamID == teamID
+}
+
+func applyStampTemplateInput(tpl *models.StampTemplate, input *models.StampTemplateInput) error {
+	if input.Name != nil {
+		if strings.TrimSpace(*input.Name) == "" {
+			return i18n.Errorf("name_empty")
+		}
+		tpl.Name = strings.TrimSpace(*input.Name)
+	}
+	if input.TextTemplate != nil {
+		tpl.TextTemplate = *input.TextTemplate
+	}
+	if input.FontPath != nil {
+		fontPath := ""
+		if *input.FontPath != "" {
+			path, err := resolveStampFont(*input.FontPath)
+			if err != nil {
+				return err
+			}
+			fontPath = path
+		}
+		tpl.FontPath = fontPath
+	}
+	if input.FontSize != nil {
+		if *input.FontSize <= 0 {
+			return i18n.Errorf("invalid_font_size")
+		}
+		tpl.FontSize = *input.FontSize
+	}
+	if input.TextColor != nil {
+		if !utils.ValidRGB(*input.TextColor) {
+			return i18n.Errorf("invalid_text_color")
+		}
+		tpl.TextColor = *input.TextColor
+	}
+	if input.BgColor != nil {
+		if !utils.ValidRGB(*input.BgColor) {
+			return i18n.Errorf("invalid_bg_color")
+		}
+		tpl.BgColor = *input.BgColor
+	}
+	if input.BgOpacity != nil {
+		if *input.BgOpacity < 0 || *input.BgOpacity > 1 {
+			return i18n.Errorf("invalid_bg_opacity")
+		}
+		tpl.BgOpacity = *input.BgOpacity
+	}
+	if input.TextAlign != nil {
+		switch *input.TextAlign {
+		case "left", "center", "right":
+		default:
+			return i18n.Errorf("invalid_text_align")
+		}
+		tpl.TextAlign = *input.TextAlign
+	}
+	if input.BarPosition != nil {
+		if *input.BarPosition != "top" && *input.BarPosition != "bottom" {
+			return i18n.Errorf("invalid_bar_position")
+		}
+		tpl.BarPosition = *input.BarPosition
+	}
+	if input.LogoSize != nil {
+		if *input.LogoSize <= 0 {
+			return i18n.Errorf("invalid_logo_size")
+		}
+		tpl.LogoSize = *input.LogoSize
+	}
+	if input.LogoPosition != nil {
+		if !stampCorners[*input.LogoPosition] {
+			return i18n.Errorf("invalid_logo_position")
+		}
+		tpl.LogoPosition = *input.LogoPosition
+	}
+	if input.QREnabled != nil {
+		tpl.QREnabled = *input.QREnabled
+	}
+	if input.QRPosition != nil {
+		if !stampCorners[*input.QRPosition] {
+			return i18n.Errorf("invalid_qr_position")
+		}
+		tpl.QRPosition = *input.QRPosition
+	}
+	if input.QRSize != nil {
+		if *input.QRSize < 32 {
+			return i18n.Errorf("invalid_qr_size")
+		}
+		tpl.QRSize = *input.QRSize
+	}
+	if input.QRMarginX != nil {
+		tpl.QRMarginX = *input.QRMarginX
+	}
+	if input.QRMarginY != nil {
+		tpl.QRMarginY = *input.QRMarginY
+	}
+	return nil
+}
+
+// GetStampTemplates godoc
+// @Summary List stamp templates
+// @Description Super admins see every template, other users their team's templates and the global ones
+// @Tags stamp-templates
+// @Accept json
+// @Produce json
+// @Success 200 {array} models.StampTemplate
+// @Failure 500 {object} models.ErrorResponse
+// @Router /stamp-templates [get]
+// @Security Bearer
+func GetStampTemplates(c *fiber.Ctx) error {
+	repo := repositories.NewStampTemplateRepository(config.DB)
+	role, _ := c.Locals("userRole").(string)
+	teamID, _ := c.Locals("teamId").(string)
+
+	var tpls []models.StampTemplate
+	var err error
+	if role == string(models.SuperAdminRole) {
+		tpls, err = repo.FindAll()
+	} else {
+		tpls, err = repo.FindAvailableForTeam(teamID)
+	}
+	if err != nil {
+		utils.HandleError(err, "Failed to fetch stamp templates", utils.Error)
+		return sendError(c, fiber.StatusInternalServerError, "stamp_templates_fetch_failed")
+	}
+
+	return c.JSON(fiber.Map{"templates": tpls})
+}
+
+// GetStampTemplate godoc
+// @Summary Get stamp template
+// @Description Get a stamp template by ID
+// @Tags stamp-templates
+// @Accept json
+// @Produce json
+// @Param id path string true "Template ID"
+// @Success 200 {object} models.StampTemplate
+// @Failure 404 {object} models.ErrorResponse
+// @Router /stamp-templates/{id} [get]
+// @Security Bearer
+func GetStampTemplate(c *fiber.Ctx) error {
+	repo := repositories.NewStampTemplateRepository(config.DB)
+	id := c.Params("id")
+
+	tpl, err := repo.FindByID(id)
+	if err != nil {
+		utils.HandleError(err, fmt.Sprintf("Stamp template not found: %s", id), utils.Warning)
+		return sendError(c, fiber.StatusNotFound, "stamp_template_not_found")
+	}
+
+	role, _ := c.Locals("userRole").(string)
+	teamID, _ := c.Locals("teamId").(string)
+	if role != string(models.SuperAdminRole) && tpl.TeamID != nil && *tpl.TeamID != teamID {
+		return sendError(c, fiber.StatusNotFound, "stamp_template_not_found")
+	}
+
+	return c.JSON(tpl)
+}
+
+// CreateStampTemplate godoc
+// @Summary Create stamp template
+// @Description Create a stamp template. Team leaders create templates for their own team; super admins may set team_id or leave it empty for a global template
+// @Tags stamp-templates
+// @Accept json
+// @Produce json
+// @Param input body models.StampTemplateInput true "Stamp template"
+// @Success 201 {object} models.StampTemplate
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /stamp-templates [post]
+// @Security Bearer
+func CreateStampTemplate(c *fiber.Ctx) error {
+	input := new(models.StampTemplateInput)
+	if err := c.BodyParser(input); err != nil {
+		utils.HandleError(err, "Failed to parse request body", utils.Error)
+		return sendError(c, fiber.StatusBadRequest, "invalid_input")
+	}
+	if input.Name == nil {
+		return sendError(c, fiber.StatusBadRequest, "name_required")
+	}
+
+	role, _ := c.Locals("userRole").(string)
+	var teamID *string
+	if role == string(models.SuperAdminRole) {
+		if input.TeamID != nil && *input.TeamID != "" {
+			teamID = input.TeamID
+		}
+	} else {
+		myTeamID, _ := c.Locals("teamId").(string)
+		if myTeamID == "" {
+			return sendError(c, fiber.StatusBadRequest, "not_in_team")
+		}
+		teamID = &myTeamID
+	}
+
+	tpl := newStampTemplateFromDefaults("", teamID)
+	if err := applyStampTemplateInput(tpl, input); err != nil {
+		return sendErrorFrom(c, fiber.StatusBadRequest, err)
+	}
+
+	repo := repositories.NewStampTemplateRepository(config.DB)
+	if err := repo.Create(tpl); err != nil {
+		utils.HandleError(err, "Failed to create stamp template", utils.Error)
+		return sendError(c, fiber.StatusInternalServerError, "stamp_template_create_failed")
+	}
+	recordAudit(c, "stamp_template.create", models.AuditTargetStampTemplate, tpl.ID, nil, tpl)
+
+	return c.Status(fiber.StatusCreated).JSON(tpl)
+}
+
+// UpdateStampTemplate godoc
+// @Summary Update stamp template
+// @Description Update the fields of a stamp template; omitted fields are kept
+// @Tags stamp-templates
+// @Accept json
+// @Produce json
+// @Param id path string true "Template ID"
+// @Param input body models.StampTemplateInput true "Stamp template"
+// @Success 200 {object} models.StampTemplate
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Router /stamp-templates/{id} [put]
+// @Security Bearer
+func UpdateStampTemplate(c *fiber.Ctx) error {
+	repo := repositories.NewStampTemplateRepository(config.DB)
+	id := c.Params("id")
+
+	tpl, err := repo.FindByID(id)
+	if err != nil {
+		utils.HandleError(err, fmt.Sprintf("Stamp template not found: %s", id), utils.Warning)
+		return sendError(c, fiber.StatusNotFound, "stamp_template_not_found")
+	}
+	if !canManageStampTemplate(c, tpl) {
+		return sendError(c, fiber.StatusForbidden, "access_denied")
+	}
+
+	input := new(models.StampTemplateInput)
+	if err := c.BodyParser(input); err != nil {
+		utils.HandleError(err, "Failed to parse request body", utils.Error)
+		return sendError(c, fiber.StatusBadRequest, "invalid_input")
+	}
+	before := *tpl
+	if err := applyStampTemplateInput(tpl, input); err != nil {
+		return sendErrorFrom(c, fiber.StatusBadRequest, err)
+	}
+
+	if err := repo.Update(tpl); err != nil {
+		utils.HandleError(err, fmt.Sprintf("Failed to update stamp template %s", id), utils.Error)
+		return sendError(c, fiber.StatusInternalServerError, "stamp_template_update_failed")
+	}
+	recordAudit(c, "stamp_template.update", models.AuditTargetStampTemplate, tpl.ID, before, tpl)
+
+	return c.JSON(tpl)
+}
+
+// SetDefaultStampTemplate godoc
+// @Summary Set default stamp template
+// @Description Make the template the default of its team (or the global default)
+// @Tags stamp-templates
+// @Accept json
+// @Produce json
+// @Param id path string true "Template ID"
+// @Success 200 {object} models.SuccessResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Router /stamp-templates/{id}/default [put]
+// @Security Bearer
+func SetDefaultStampTemplate(c *fiber.Ctx) error {
+	repo := repositories.NewStampTemplateRepository(config.DB)
+	id := c.Params("id")
+
+	tpl, err := repo.FindByID(id)
+	if err != nil {
+		utils.HandleError(err, fmt.Sprintf("Stamp template not found: %s", id), utils.Warning)
+		return sendError(c, fiber.StatusNotFound, "stamp_template_not_found")
+	}
+	if !canManageStampTemplate(c, tpl) {
+		return sendError(c, fiber.StatusForbidden, "access_denied")
+	}
+
+	wasDefault := tpl.IsDefault
+	if err := repo.SetDefault(tpl); err != nil {
+		utils.HandleError(err, fmt.Sprintf("Failed to set default stamp template %s", id), utils.Error)
+		return sendError(c, fiber.StatusInternalServerError, "default_stamp_template_failed")
+	}
+	recordAudit(c, "stamp_template.set_default", models.AuditTargetStampTemplate, tpl.ID, fiber.Map{"is_default": wasDefault}, fiber.Map{"is_default": true, "team_id": tpl.TeamID})
+
+	return c.JSON(fiber.Map{"message": localize(c, "default_stamp_template_updated"), "created_at": time.Now()})
+}
+
+// UploadStampTemplateLogo godoc
+// @Summary Upload stamp logo
+// @Description Upload the PNG or JPEG logo (up to 2 MB) drawn by a stamp template
+// @Tags stamp-templates
+// @Accept multipart/form-data
+// @Produce json
+// @Param id path string true "Template ID"
+// @Param logo formData file true "Logo image"
+// @Success 200 {object} models.StampTemplate
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Router /stamp-templates/{id}/logo [post]
+// @Security Bearer
+func UploadStampTemplateLogo(c *fiber.Ctx) error {
+	repo := repositories.NewStampTemplateRepository(config.DB)
+	id := c.Params("id")
+
+	tpl, err := repo.FindByID(id)
+	if err != nil {
+		utils.HandleError(err, fmt.Sprintf("Stamp template not found: %s", id), utils.Warning)
+		return sendError(c, fiber.StatusNotFound, "stamp_template_not_found")
+	}
+	if !canManageStampTemplate(c, tpl) {
+		return sendError(c, fiber.StatusForbidden, "access_denied")
+	}
+
+	fileHeader, err := c.FormFile("logo")
+	if err != nil {
+		return sendError(c, fiber.StatusBadRequest, "invalid_file")
+	}
+	if fileHeader.Size > maxStampLogoSize {
+		return sendError(c, fiber.StatusBadRequest, "invalid_logo")
+	}
+	file, err := fileHeader.Open()
+	if err != nil {
+		return sendError(c, fiber.StatusBadRequest, "invalid_file")
+	}
+	data, err := io.ReadAll(io.LimitReader(file, maxStampLogoSize+1))
+	file.Close()
+	if err != nil {
+		return sendError(c, fiber.StatusBadRequest, "invalid_file")
+	}
+
+	// trust the decoded format, not the file name
+	_, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || len(data) > maxStampLogoSize || (format != "png" && format != "jpeg") {
+		return sendError(c, fiber.StatusBadRequest, "invalid_logo")
+	}
+
+	logoPath := stampLogoPrefix + tpl.ID + "." + format
+	if err := config.Storage.Put(c.Context(), logoPath, bytes.NewReader(data), int64(len(data)), "image/"+format); err != nil {
+		utils.HandleError(err, "Failed to save stamp logo", utils.Error)
+		return sendError(c, fiber.StatusInternalServerError, "logo_save_failed")
+	}
+
+	previousLogo := tpl.LogoPath
+	tpl.LogoPath = logoPath
+	if err := repo.Update(tpl); err != nil {
+		utils.HandleError(err, fmt.Sprintf("Failed to update stamp template %s", id), utils.Error)
+		if previousLogo != logoPath {
+			removeStampLogo(logoPath)
+		}
+		return sendError(c, fiber.StatusInternalServerError, "stamp_template_update_failed")
+	}
+	// the template points at the new logo now, so the old one can go
+	if previousLogo != "" && previousLogo != logoPath {
+		removeStampLogo(previousLogo)
+	}
+	recordAudit(c, "stamp_template.logo_change", models.AuditTargetStampTemplate, tpl.ID, fiber.Map{"logo_path": previousLogo}, fiber.Map{"logo_path": logoPath})
+
+	return c.JSON(tpl)
+}
+
+// RemoveStampTemplate godoc
+// @Summary Remove stamp template
+// @Description Remove a stamp template by ID
+// @Tags stamp-templates
+// @Accept json
+// @Produce json
+// @Param id path string true "Template ID"
+// @Success 200 {object} models.SuccessResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Router /stamp-templates/{id}/remove [delete]
+// @Security Bearer
+func RemoveStampTemplate(c *fiber.Ctx) error {
+	repo := repositories.NewStampTemplateRepository(config.DB)
+	id := c.Params("id")
+
+	tpl, err := repo.FindByID(id)
+	if err != nil {
+		utils.HandleError(err, fmt.Sprintf("Stamp template not found: %s", id), utils.Warning)
+		return sendError(c, fiber.StatusNotFound, "stamp_template_not_found")
+	}
+	if !canManageStampTemplate(c, tpl) {
+		return sendError(c, fiber.StatusForbidden, "access_denied")
+	}
+
+	if err := repo.Delete(id); err != nil {
+		utils.HandleError(err, fmt.Sprintf("Failed to delete stamp template %s", id), utils.Error)
+		return sendError(c, fiber.StatusInternalServerError, "stamp_template_delete_failed")
+	}
+	if tpl.LogoPath != "" {
+		removeStampLogo(tpl.LogoPath)
+	}
+	recordAudit(c, "stamp_template.remove", models.AuditTargetStampTemplate, id, tpl, nil)
+
+	return c.JSON(fiber.Map{"message": localize(c, "stamp_template_deleted"), "template_id": id})
+}
@@ -0,0 +1,71 @@
+package controllers
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"tawtheeq-backend/i18n"
+)
+
+func TestResolveStampFont(t *testing.T) {
+	t.Chdir(t.TempDir())
+	if err := os.MkdirAll(stampFontDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(stampFontDir, "Cairo.ttf"), []byte("font"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(stampFontDir, "dir.ttf"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		want string
+		code string
+	}{
+		{"Cairo.ttf", "assets/fonts/Cairo.ttf", ""},
+		{"assets/fonts/Cairo.ttf", "assets/fonts/Cairo.ttf", ""},
+		{"Missing.otf", "", "font_not_found"},
+		{"dir.ttf", "", "font_not_found"},
+		{"../fonts/Cairo.ttf", "", "invalid_font"},
+		{"/etc/passwd", "", "invalid_font"},
+		{`..\Cairo.ttf`, "", "invalid_font"},
+		{"assets/fonts/../../secret.ttf", "", "invalid_font"},
+		{"Cairo.txt", "", "invalid_font"},
+		{".ttf", "", "font_not_found"},
+	}
+	for _, tt := range tests {
+		got, err := resolveStampFont(tt.name)
+		code := ""
+		var coded *i18n.Error
+		if errors.As(err, &coded) {
+			code = coded.Code
+		}
+		if code != tt.code || got != tt.want {
+			t.Errorf("resolveStampFont(%q) = %q, %q, want %q, %q", tt.name, got, code, tt.want, tt.code)
+		}
+	}
+}
+
+func TestStampFontAllowed(t *testing.T) {
+	t.Setenv("IMAGE_FONT_PATH", "/usr/share/fonts/Amiri.ttf")
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"", true},
+		{"assets/fonts/Cairo.ttf", true},
+		{"/usr/share/fonts/Amiri.ttf", true},
+		{"/etc/passwd", false},
+		{"assets/fonts/../keys/jwt/private.pem", false},
+		{"assets/fonts/sub/Cairo.ttf", false},
+	}
+	for _, tt := range tests {
+		if got := stampFontAllowed(tt.path); got != tt.want {
+			t.Errorf("stampFontAllowed(%q) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+}
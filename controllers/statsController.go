@@ -0,0 +1,188 @@
+// StatsController
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"tawtheeq-backend/config"
+	"tawtheeq-backend/i18n"
+	"tawtheeq-backend/models"
+	"tawtheeq-backend/repositories"
+	"tawtheeq-backend/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+const statsTopSigners = 10
+
+// dateRangeFromQuery reads the from and to dates (YYYY-MM-DD, to inclusive)
+// and returns them as a half open range of whole UTC days. It defaults to the
+// 30 days up to and including today.
+func dateRangeFromQuery(c *fiber.Ctx) (time.Time, time.Time, error) {
+	// whole days, so the range matches the dates in the cache key
+	to := time.Now().UTC().Truncate(24*time.Hour).AddDate(0, 0, 1)
+	if v := c.Query("to"); v != "" {
+		parsed, err := time.Parse("2006-01-02", v)
+		if err != nil {
+			return time.Time{}, time.Time{}, i18n.Errorf("invalid_to_date")
+		}
+		to = parsed.AddDate(0, 0, 1)
+	}
+	from := to.AddDate(0, 0, -30)
+	if v := c.Query("from"); v != "" {
+		parsed, err := time.Parse("2006-01-02", v)
+		if err != nil {
+			return time.Time{}, time.Time{}, i18n.Errorf("invalid_from_date")
+		}
+		from = parsed
+	}
+	if !from.Before(to) {
+		return time.Time{}, time.Time{}, i18n.Errorf("from_after_to")
+	}
+	return from, to, nil
+}
+
+// cachedStats returns the dashboard stored under key, if the cache is on.
+func cachedStats(key string) (*models.DashboardStats, bool) {
+	if config.StatsCacheTTL <= 0 {
+		return nil, false
+	}
+	data, err := config.Redis.Get(config.Ctx, key).Bytes()
+	if err != nil {
+		if !errors.Is(err, redis.Nil) {
+			utils.HandleError(err, "Failed to read cached statistics", utils.Warning)
+		}
+		return nil, false
+	}
+	var stats models.DashboardStats
+	if err := json.Unmarshal(data, &stats); err != nil {
+		utils.HandleError(err, "Failed to decode cached statistics", utils.Warning)
+		return nil, false
+	}
+	return &stats, true
+}
+
+func cacheStats(key string, stats *models.DashboardStats) {
+	if config.StatsCacheTTL <= 0 {
+		return
+	}
+	data, err := json.Marshal(stats)
+	if err != nil {
+		utils.HandleError(err, "Failed to encode statistics", utils.Warning)
+		return
+	}
+	if err := config.Redis.Set(config.Ctx, key, data, config.StatsCacheTTL).Err(); err != nil {
+		utils.HandleError(err, "Failed to cache statistics", utils.Warning)
+	}
+}
+
+// buildDashboardStats runs the aggregates for teamID, or for every team when
+// teamID is empty.
+func buildDashboardStats(teamID string, from time.Time, to time.Time, interval string) (*models.DashboardStats, error) {
+	statsRepo := repositories.NewStatsRepository(config.DB)
+	stats := &models.DashboardStats{
+		TeamID:      teamID,
+		From:        from.Format("2006-01-02"),
+		To:          to.AddDate(0, 0, -1).Format("2006-01-02"),
+		Interval:    interval,
+		GeneratedAt: time.Now(),
+	}
+
+	var err error
+	if stats.Documents, err = statsRepo.DocumentTotals(teamID, from, to); err != nil {
+		return nil, err
+	}
+	if stats.SignedPer, err = statsRepo.SignedPerPeriod(teamID, from, to, interval); err != nil {
+		return nil, err
+	}
+	if stats.ByFormat, err = statsRepo.ByFormat(teamID, from, to); err != nil {
+		return nil, err
+	}
+	if teamID == "" {
+		if stats.ByTeam, err = statsRepo.ByTeam(from, to); err != nil {
+			return nil, err
+		}
+	}
+	if stats.TopSigners, err = statsRepo.TopSigners(teamID, from, to, statsTopSigners); err != nil {
+		return nil, err
+	}
+	if stats.Verifications, err = statsRepo.Verifications(teamID, from, to, interval); err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+// dashboardStats answers a dashboard request for teamID.
+func dashboardStats(c *fiber.Ctx, teamID string) error {
+	interval := c.Query("interval", "day")
+	if !repositories.ValidTrendInterval(interval) {
+		return sendError(c, fiber.StatusBadRequest, "invalid_interval")
+	}
+	from, to, err := dateRangeFromQuery(c)
+	if err != nil {
+		return sendErrorFrom(c, fiber.StatusBadRequest, err)
+	}
+
+	scope := teamID
+	if scope == "" {
+		scope = "all"
+	}
+	key := fmt.Sprintf("stats:dashboard:%s:%s:%s:%s", scope, from.Format("2006-01-02"), to.Format("2006-01-02"), interval)
+	if stats, ok := cachedStats(key); ok {
+		stats.Cached = true
+		return c.JSON(stats)
+	}
+
+	stats, err := buildDashboardStats(teamID, from, to, interval)
+	if err != nil {
+		utils.HandleError(err, fmt.Sprintf("Failed to compute statistics for %s", scope), utils.Error)
+		return sendError(c, fiber.StatusInternalServerError, "stats_failed")
+	}
+	cacheStats(key, stats)
+
+	return c.JSON(stats)
+}
+
+// GetDashboardStats godoc
+// @Summary Statistics dashboard
+// @Description Documents signed per period, by format, by team and by signer, verification activity, storage used and hidden or revoked counts. Covers every team unless team_id is given. Defaults to the last 30 days
+// @Tags stats
+// @Produce json
+// @Param team_id query string false "Limit to one team"
+// @Param from query string false "Start date (YYYY-MM-DD)"
+// @Param to query string false "End date, inclusive (YYYY-MM-DD)"
+// @Param interval query string false "day, week or month" default(day)
+// @Success 200 {object} models.DashboardStats
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /stats/dashboard [get]
+// @Security Bearer
+func GetDashboardStats(c *fiber.Ctx) error {
+	return dashboardStats(c, c.Query("team_id"))
+}
+
+// GetMyTeamStats godoc
+// @Summary My team statistics dashboard
+// @Description The statistics dashboard limited to your team's documents and their verifications
+// @Tags stats
+// @Produce json
+// @Param from query string false "Start date (YYYY-MM-DD)"
+// @Param to query string false "End date, inclusive (YYYY-MM-DD)"
+// @Param interval query string false "day, week or month" default(day)
+// @Success 200 {object} models.DashboardStats
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /my/team/stats [get]
+// @Security Bearer
+func GetMyTeamStats(c *fiber.Ctx) error {
+	teamId, ok := c.Locals("teamId").(string)
+	if !ok || teamId == "" {
+		utils.HandleError(fmt.Errorf("invalid or missing user context"), "Invalid or missing user context", utils.Error)
+		return sendError(c, fiber.StatusBadRequest, "missing_user_context")
+	}
+	return dashboardStats(c, teamId)
+}
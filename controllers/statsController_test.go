@@ -0,0 +1,48 @@
+package controllers
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestDateRangeFromQuery(t *testing.T) {
+	now := time.Now().UTC()
+	tomorrow := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.UTC)
+	day := func(y int, m time.Month, d int) time.Time { return time.Date(y, m, d, 0, 0, 0, 0, time.UTC) }
+
+	tests := []struct {
+		query    string
+		from, to time.Time
+		ok       bool
+	}{
+		{"", tomorrow.AddDate(0, 0, -30), tomorrow, true},
+		{"?from=2025-03-01&to=2025-03-31", day(2025, 3, 1), day(2025, 4, 1), true},
+		{"?to=2025-03-31", day(2025, 3, 2), day(2025, 4, 1), true},
+		{"?from=2025-03-05&to=2025-03-05", day(2025, 3, 5), day(2025, 3, 6), true},
+		{"?from=2025-03-06&to=2025-03-05", time.Time{}, time.Time{}, false},
+		{"?from=03/01/2025", time.Time{}, time.Time{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			app := fiber.New()
+			var from, to time.Time
+			var err error
+			app.Get("/", func(c *fiber.Ctx) error {
+				from, to, err = dateRangeFromQuery(c)
+				return nil
+			})
+			if _, testErr := app.Test(httptest.NewRequest("GET", "/"+tt.query, nil)); testErr != nil {
+				t.Fatal(testErr)
+			}
+			if (err == nil) != tt.ok {
+				t.Fatalf("error %v, want ok %v", err, tt.ok)
+			}
+			if !from.Equal(tt.from) || !to.Equal(tt.to) {
+				t.Errorf("range %s - %s, want %s - %s", from, to, tt.from, tt.to)
+			}
+		})
+	}
+}
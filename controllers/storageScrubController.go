@@ -0,0 +1,505 @@
+// StorageScrubController
+package controllers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"tawtheeq-backend/config"
+	"tawtheeq-backend/i18n"
+	"tawtheeq-backend/models"
+	"tawtheeq-backend/repositories"
+	"tawtheeq-backend/storage"
+	"tawtheeq-backend/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// scrubMu makes sure only one scrubber run is active at a time.
+var scrubMu sync.Mutex
+
+// storageKeyHash matches keys named after the SHA-256 of the stored file.
+var storageKeyHash = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+const scrubBatchSize = 200
+
+// scrubGracePeriod keeps the scrubber away from objects and temp files that
+// may still belong to an upload in progress.
+func scrubGracePeriod() time.Duration {
+	minutes, err := strconv.Atoi(os.Getenv("STORAGE_SCRUB_GRACE_MINUTES"))
+	if err != nil || minutes < 0 {
+		minutes = 60
+	}
+	return time.Duration(minutes) * time.Minute
+}
+
+// expectedStoredHash returns the hash a stored object must have. Keys are
+// "<sha256 of the stamped file><ext>"; legacy keys carry no hash, so only
+// their existence can be checked.
+func expectedStoredHash(key string) string {
+	name := strings.TrimSuffix(filepath.Base(key), filepath.Ext(key))
+	if storageKeyHash.MatchString(name) {
+		return name
+	}
+	return ""
+}
+
+func hashStoredObject(ctx context.Context, key string) (string, error) {
+	r, err := config.Storage.Get(ctx, key)
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, r); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+// BackfillDocumentStorageKeys records the storage key of documents signed
+// before keys were recorded. Their files were stored under the upload ID
+// (local) or the hash of the stamped file (S3), neither of which is in the
+// row, so a file is matched by the signature embedded in it. Documents that
+// match no file keep an empty key and are reported missing by the scrubber.
+func BackfillDocumentStorageKeys() error {
+	ctx := context.Background()
+	docRepo := repositories.NewDocumentRepository(config.DB)
+	docs, err := docRepo.FindWithoutStorageKey()
+	if err != nil || len(docs) == 0 {
+		return err
+	}
+
+	pending := map[string]string{}
+	for _, doc := range docs {
+		if doc.Signature != "" {
+			pending[doc.Signature] = doc.ID
+		}
+	}
+	matched := 0
+	match := func(key string) {
+		signature, err := storedSignature(ctx, key)
+		if err != nil {
+			return
+		}
+		id, ok := pending[signature]
+		if !ok {
+			return
+		}
+		if err := docRepo.SetStorageKey(id, key); err != nil {
+			utils.HandleError(err, fmt.Sprintf("Failed to record storage key of document %s", id), utils.Warning)
+			return
+		}
+		delete(pending, signature)
+		matched++
+	}
+
+	// S3 kept the object name in original_name, so try that first
+	for _, doc := range docs {
+		if _, ok := pending[doc.Signature]; ok && doc.OriginalName != "" && !strings.Contains(doc.OriginalName, "/") {
+			match(doc.OriginalName)
+		}
+	}
+
+	if len(pending) > 0 {
+		keys, err := docRepo.StorageKeys()
+		if err != nil {
+			return err
+		}
+		referenced := map[string]bool{}
+		for _, key := range keys {
+			referenced[key] = true
+		}
+		objects, err := config.Storage.List(ctx, "")
+		if err != nil {
+			return err
+		}
+		for _, obj := range objects {
+			if len(pending) == 0 {
+				break
+			}
+			if referenced[obj.Key] || strings.Contains(obj.Key, "/") {
+				continue
+			}
+			match(obj.Key)
+		}
+	}
+
+	fmt.Printf("✅ Storage keys recorded for %d of %d legacy documents\n", matched, len(docs))
+	return nil
+}
+
+// storedSignature returns the signature embedded in a stored file. exiftool
+// reads files, so the object is copied to the temp directory first.
+func storedSignature(ctx context.Context, key string) (string, error) {
+	r, err := config.Storage.Get(ctx, key)
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+
+	tempDir := os.Getenv("TEMP_DIR")
+	if tempDir == "" {
+		tempDir = "./temp"
+	}
+	os.MkdirAll(tempDir, os.ModePerm)
+	file, err := os.CreateTemp(tempDir, "backfill-*"+filepath.Ext(key))
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(file.Name())
+	_, err = io.Copy(file, r)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", err
+	}
+
+	_, signature, err := readSignatureComment(file.Name())
+	return signature, err
+}
+
+// StartStorageScrubber runs the scrubber every STORAGE_SCRUB_INTERVAL_HOURS
+// hours. It does nothing when the interval is unset or zero. Orphans are only
+// removed when STORAGE_SCRUB_CLEANUP is true.
+func StartStorageScrubber() {
+	scrubRepo := repositories.NewStorageScrubRepository(config.DB)
+	if err := scrubRepo.MarkRunningAsFailed("interrupted by restart"); err != nil {
+		utils.HandleError(err, "Failed to close stale scrub reports", utils.Warning)
+	}
+
+	hours, err := strconv.Atoi(os.Getenv("STORAGE_SCRUB_INTERVAL_HOURS"))
+	if err != nil || hours <= 0 {
+		return
+	}
+	cleanup := os.Getenv("STORAGE_SCRUB_CLEANUP") == "true"
+
+	go func() {
+		ticker := time.NewTicker(time.Duration(hours) * time.Hour)
+		defer ticker.Stop()
+		for range ticker.C {
+			_, done, err := startStorageScrub(models.ScrubTriggerScheduled, nil, true, cleanup)
+			if err != nil {
+				utils.HandleError(err, "Scheduled storage scrub skipped", utils.Warning)
+				continue
+			}
+			<-done
+		}
+	}()
+}
+
+// startStorageScrub creates a report and runs the scrub in the background.
+// It returns the report ID and a channel closed when the run has finished.
+func startStorageScrub(trigger string, triggeredBy *string, rehash bool, cleanup bool) (string, <-chan struct{}, error) {
+	if !scrubMu.TryLock() {
+		return "", nil, i18n.Errorf("scrub_running")
+	}
+
+	report := &models.StorageScrubReport{
+		Trigger:     trigger,
+		Status:      models.ScrubStatusRunning,
+		Rehash:      rehash,
+		Cleanup:     cleanup,
+		TriggeredBy: triggeredBy,
+		StartedAt:   time.Now(),
+	}
+	scrubRepo := repositories.NewStorageScrubRepository(config.DB)
+	if err := scrubRepo.CreateReport(report); err != nil {
+		scrubMu.Unlock()
+		return "", nil, err
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		defer scrubMu.Unlock()
+		runStorageScrub(report)
+	}()
+	return report.ID, done, nil
+}
+
+func runStorageScrub(report *models.StorageScrubReport) {
+	ctx := context.Background()
+	scrubRepo := repositories.NewStorageScrubRepository(config.DB)
+	docRepo := repositories.NewDocumentRepository(config.DB)
+
+	addIssue := func(issue models.StorageScrubIssue) {
+		issue.ReportID = report.ID
+		switch issue.Kind {
+		case models.ScrubIssueMissing:
+			report.Missing++
+		case models.ScrubIssueCorrupted:
+			report.Corrupted++
+		case models.ScrubIssueOrphan, models.ScrubIssueTempOrphan:
+			report.Orphans++
+			if issue.Removed {
+				report.OrphansRemoved++
+			}
+		case models.ScrubIssueError:
+			report.Errors++
+		}
+		if err := scrubRepo.AddIssue(&issue); err != nil {
+			utils.HandleError(err, "Failed to store scrub issue", utils.Warning)
+		}
+	}
+
+	finish := func(err error) {
+		now := time.Now()
+		report.FinishedAt = &now
+		report.Status = models.ScrubStatusCompleted
+		if err != nil {
+			report.Status = models.ScrubStatusFailed
+			report.Error = err.Error()
+			utils.HandleError(err, "Storage scrub failed", utils.Error)
+		}
+		if err := scrubRepo.UpdateReport(report); err != nil {
+			utils.HandleError(err, "Failed to save scrub report", utils.Error)
+		}
+	}
+
+	// 1. every document must point to an existing, unchanged object
+	referenced := map[string]bool{}
+	keyless := 0
+	for offset := 0; ; offset += scrubBatchSize {
+		docs, err := docRepo.FindBatch(scrubBatchSize, offset)
+		if err != nil {
+			finish(err)
+			return
+		}
+
+		for i := range docs {
+			doc := &docs[i]
+			key := doc.StorageKey
+			report.DocumentsChecked++
+			if key == "" {
+				keyless++
+				addIssue(models.StorageScrubIssue{Kind: models.ScrubIssueMissing, DocumentID: &doc.ID, Detail: "no storage key recorded"})
+				continue
+			}
+			referenced[key] = true
+
+			info, err := config.Storage.Stat(ctx, key)
+			if errors.Is(err, storage.ErrNotFound) {
+				addIssue(models.StorageScrubIssue{Kind: models.ScrubIssueMissing, DocumentID: &doc.ID, StorageKey: key})
+				continue
+			}
+			if err != nil {
+				addIssue(models.StorageScrubIssue{Kind: models.ScrubIssueError, DocumentID: &doc.ID, StorageKey: key, Detail: err.Error()})
+				continue
+			}
+			// documents signed before file sizes were recorded
+			if doc.FileSize == 0 && info.Size > 0 {
+				if err := docRepo.SetFileSize(doc.ID, info.Size); err != nil {
+					utils.HandleError(err, fmt.Sprintf("Failed to record file size of document %s", doc.ID), utils.Warning)
+				}
+			}
+
+			expected := expectedStoredHash(key)
+			if !report.Rehash || expected == "" {
+				continue
+			}
+			actual, err := hashStoredObject(ctx, key)
+			if err != nil {
+				addIssue(models.StorageScrubIssue{Kind: models.ScrubIssueError, DocumentID: &doc.ID, StorageKey: key, Size: info.Size, Detail: err.Error()})
+				continue
+			}
+			if actual != expected {
+				addIssue(models.StorageScrubIssue{
+					Kind:       models.ScrubIssueCorrupted,
+					DocumentID: &doc.ID,
+					StorageKey: key,
+					Size:       info.Size,
+					Detail:     fmt.Sprintf("expected sha256 %s, got %s", expected, actual),
+				})
+			}
+		}
+
+		if len(docs) < scrubBatchSize {
+			break
+		}
+	}
+
+	// 2. stored objects no document points to. While some documents have no
+	// storage key, any unreferenced object may be one of their files, so
+	// orphans are only reported.
+	cutoff := time.Now().Add(-scrubGracePeriod())
+	removeOrphans := report.Cleanup && keyless == 0
+	if report.Cleanup && keyless > 0 {
+		utils.HandleError(fmt.Errorf("%d documents have no storage key", keyless), "Storage scrub keeps orphaned objects", utils.Warning)
+	}
+	objects, err := config.Storage.List(ctx, "")
+	if err != nil {
+		finish(err)
+		return
+	}
+	for _, obj := range objects {
+		report.ObjectsScanned++
+		if referenced[obj.Key] || obj.LastModified.After(cutoff) || strings.HasPrefix(obj.Key, documentExportPrefix) || strings.HasPrefix(obj.Key, stampLogoPrefix) {
+			continue
+		}
+
+		issue := models.StorageScrubIssue{Kind: models.ScrubIssueOrphan, StorageKey: obj.Key, Size: obj.Size}
+		if report.Cleanup && !removeOrphans {
+			issue.Detail = fmt.Sprintf("kept: %d documents have no storage key", keyless)
+		}
+		if removeOrphans {
+			if err := config.Storage.Delete(ctx, obj.Key); err != nil {
+				issue.Detail = err.Error()
+			} else {
+				issue.Removed = true
+			}
+		}
+		addIssue(issue)
+	}
+
+	// 3. leftovers of failed uploads in the temp directory
+	tempDir := os.Getenv("TEMP_DIR")
+	if tempDir == "" {
+		tempDir = "./temp"
+	}
+	entries, err := os.ReadDir(tempDir)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		addIssue(models.StorageScrubIssue{Kind: models.ScrubIssueError, StorageKey: tempDir, Detail: err.Error()})
+	}
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || entry.IsDir() || info.ModTime().After(cutoff) {
+			continue
+		}
+
+		path := filepath.Join(tempDir, entry.Name())
+		issue := models.StorageScrubIssue{Kind: models.ScrubIssueTempOrphan, StorageKey: path, Size: info.Size()}
+		if report.Cleanup {
+			if err := os.Remove(path); err != nil {
+				issue.Detail = err.Error()
+			} else {
+				issue.Removed = true
+			}
+		}
+		addIssue(issue)
+	}
+
+	finish(nil)
+}
+
+// StartStorageScrubHandler godoc
+// @Summary Run the storage scrubber
+// @Description Starts a scrubber run in the background. It checks that every document's stored file exists and still matches its hash, and lists stored objects and temp files no document points to. With cleanup=true those orphans are deleted, unless some documents have no storage key yet. Poll the returned report for results
+// @Tags storage
+// @Produce json
+// @Param rehash query bool false "Re-hash stored files" default(true)
+// @Param cleanup query bool false "Delete orphaned objects and temp files" default(false)
+// @Success 202 {object} map[string]interface{}
+// @Failure 409 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /storage/scrub [post]
+// @Security Bearer
+func StartStorageScrubHandler(c *fiber.Ctx) error {
+	var triggeredBy *string
+	if userID, ok := c.Locals("userID").(string); ok && userID != "" {
+		triggeredBy = &userID
+	}
+	rehash := c.Query("rehash", "true") != "false"
+	cleanup := c.Query("cleanup") == "true"
+
+	reportID, _, err := startStorageScrub(models.ScrubTriggerManual, triggeredBy, rehash, cleanup)
+	if err != nil {
+		utils.HandleError(err, "Failed to start storage scrub", utils.Warning)
+		return sendErrorFrom(c, fiber.StatusConflict, err)
+	}
+	recordAudit(c, "storage.scrub", models.AuditTargetStorage, reportID, nil, fiber.Map{"rehash": rehash, "cleanup": cleanup})
+
+	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{
+		"message":   localize(c, "scrub_started"),
+		"report_id": reportID,
+	})
+}
+
+// GetStorageScrubReports godoc
+// @Summary List storage scrub reports
+// @Description Returns scrubber runs, newest first
+// @Tags storage
+// @Produce json
+// @Param limit query int false "Limit" default(10)
+// @Param page query int false "Page" default(1)
+// @Param cursor query string false "meta.next_cursor of the previous page"
+// @Success 200 {object} models.ListResponse{data=[]models.StorageScrubReport}
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /storage/scrub/reports [get]
+// @Security Bearer
+func GetStorageScrubReports(c *fiber.Ctx) error {
+	p, err := paginationFromQuery(c, models.DefaultPageSize)
+	if err != nil {
+		return sendErrorFrom(c, fiber.StatusBadRequest, err)
+	}
+
+	scrubRepo := repositories.NewStorageScrubRepository(config.DB)
+	reports, total, err := scrubRepo.FindReports(p)
+	if err != nil {
+		utils.HandleError(err, "Failed to fetch scrub reports", utils.Warning)
+		return sendError(c, fiber.StatusInternalServerError, "scrub_reports_fetch_failed")
+	}
+
+	return sendList(c, reports, p, total, nextCursor(p, reports, func(r models.StorageScrubReport) models.Cursor {
+		return models.Cursor{Time: r.StartedAt, ID: r.ID}
+	}))
+}
+
+// GetStorageScrubReport godoc
+// @Summary Get a storage scrub report
+// @Description Returns one scrubber run with its issues, optionally filtered by kind
+// @Tags storage
+// @Produce json
+// @Param id path string true "Report ID"
+// @Param kind query string false "Issue kind: missing, corrupted, orphan, temp_orphan or error"
+// @Param limit query int false "Limit" default(100)
+// @Param page query int false "Page" default(1)
+// @Success 200 {object} models.StorageScrubReport
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /storage/scrub/reports/{id} [get]
+// @Security Bearer
+func GetStorageScrubReport(c *fiber.Ctx) error {
+	id := c.Params("id")
+	p, err := paginationFromQuery(c, models.MaxPageSize)
+	if err != nil {
+		return sendErrorFrom(c, fiber.StatusBadRequest, err)
+	}
+	// issues are listed in the order they were found
+	if p.Cursor != nil {
+		return sendErrorFrom(c, fiber.StatusBadRequest, errCursorUnsupported)
+	}
+
+	scrubRepo := repositories.NewStorageScrubRepository(config.DB)
+	report, err := scrubRepo.FindReportByID(id)
+	if err != nil {
+		utils.HandleError(err, fmt.Sprintf("Scrub report not found: %s", id), utils.Warning)
+		return sendError(c, fiber.StatusNotFound, "report_not_found")
+	}
+
+	issues, total, err := scrubRepo.FindIssues(id, c.Query("kind"), p)
+	if err != nil {
+		utils.HandleError(err, "Failed to fetch scrub issues", utils.Warning)
+		return sendError(c, fiber.StatusInternalServerError, "scrub_issues_fetch_failed")
+	}
+	report.Issues = issues
+
+	return c.JSON(fiber.Map{
+		"report": report,
+		"meta":   models.PageMeta{Limit: p.Limit, Page: p.Page, Total: total},
+	})
+}
@@ -3,7 +3,6 @@ package controllers
 
 import (
 	"fmt"
-	"strconv"
 	"time"
 
 	"tawtheeq-backend/config"
@@ -32,7 +31,7 @@ func CreateTeam(c *fiber.Ctx) error {
 	input := new(models.CreateTeamInput)
 	if err := c.BodyParser(input); err != nil {
 		utils.HandleError(err, "Failed to parse request body", utils.Error)
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error(), "created_at": time.Now()})
+		return sendErrorFrom(c, fiber.StatusBadRequest, err)
 	}
 
 	team := &models.Team{
@@ -45,25 +44,51 @@ func CreateTeam(c *fiber.Ctx) error {
 	leader, err := leaderRepo.FindByID(input.LeaderID)
 	if err != nil {
 		utils.HandleError(err, "Failed to find leader", utils.Error)
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Leader not found", "created_at": time.Now()})
+		return sendError(c, fiber.StatusNotFound, "leader_not_found")
 	}
+	oldLeaderRole := leader.Role
 	if leader.Role != models.TeamLeaderRole {
 		leader.Role = models.TeamLeaderRole
 	}
 
 	if err := leaderRepo.Update(leader); err != nil {
 		utils.HandleError(err, "Failed to update leader role", utils.Error)
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update leader role", "created_at": time.Now()})
+		return sendError(c, fiber.StatusInternalServerError, "leader_role_update_failed")
+	}
+	if oldLeaderRole != leader.Role {
+		recordAudit(c, "user.role_change", models.AuditTargetUser, leader.ID, fiber.Map{"role": oldLeaderRole}, fiber.Map{"role": leader.Role})
+		revokeUserTokens(leader.ID)
+		emitUserWebhook(models.WebhookEventUserUpdated, leader, fiber.Map{"role": oldLeaderRole}, fiber.Map{"role": leader.Role})
 	}
 
 	if err := repo.Create(team); err != nil {
 		utils.HandleError(err, "Failed to create team", utils.Error)
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to create team", "created_at": time.Now()})
+		return sendError(c, fiber.StatusInternalServerError, "team_create_failed")
+	}
+	config.InvalidateUserAccess(leader.ID)
+
+	// every team starts with a default stamp template seeded from the env settings
+	tpl := newStampTemplateFromDefaults("Default", &team.ID)
+	tpl.IsDefault = true
+	if err := repositories.NewStampTemplateRepository(config.DB).Create(tpl); err != nil {
+		utils.HandleError(err, fmt.Sprintf("Failed to create default stamp template for team %s", team.ID), utils.Warning)
 	}
 
+	recordAudit(c, "team.create", models.AuditTargetTeam, team.ID, nil, teamAuditSnapshot(team))
+	emitTeamWebhook(models.WebhookEventTeamCreated, team, nil, nil)
+
 	return c.Status(fiber.StatusCreated).JSON(team)
 }
 
+// teamUserIDs returns the leader and members of a team.
+func teamUserIDs(team *models.Team) []string {
+	ids := []string{team.LeaderID}
+	for _, member := range team.Members {
+		ids = append(ids, member.UserID)
+	}
+	return ids
+}
+
 // RemoveTeam godoc
 // @Summary Remove team
 // @Description Remove a team by ID
@@ -80,12 +105,22 @@ func RemoveTeam(c *fiber.Ctx) error {
 	repo := repositories.NewTeamRepository(config.DB)
 	id := c.Params("id")
 
+	var before interface{}
+	team, err := repo.FindByID(id)
+	if err == nil {
+		before = teamAuditSnapshot(team)
+	}
 	if err := repo.Delete(id); err != nil {
 		utils.HandleError(err, fmt.Sprintf("Failed to delete team %s", id), utils.Error)
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to delete team"})
+		return sendError(c, fiber.StatusInternalServerError, "team_delete_failed")
+	}
+	recordAudit(c, "team.remove", models.AuditTargetTeam, id, before, nil)
+	if before != nil {
+		config.InvalidateUserAccess(teamUserIDs(team)...)
+		emitTeamWebhook(models.WebhookEventTeamRemoved, team, nil, nil)
 	}
 
-	return c.JSON(fiber.Map{"message": "Team deleted", "team_id": id})
+	return c.JSON(fiber.Map{"message": localize(c, "team_deleted"), "team_id": id})
 }
 
 // UpdateTeamName godoc
@@ -108,16 +143,19 @@ func UpdateTeamName(c *fiber.Ctx) error {
 	team, err := repo.FindByID(id)
 	if err != nil {
 		utils.HandleError(err, fmt.Sprintf("Failed to find team %s", id), utils.Error)
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Team not found"})
+		return sendError(c, fiber.StatusNotFound, "team_not_found")
 	}
 
+	oldName := team.Name
 	team.Name = c.FormValue("name")
 	if err := repo.Update(team); err != nil {
 		utils.HandleError(err, fmt.Sprintf("Failed to update team %s", id), utils.Error)
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update team name"})
+		return sendError(c, fiber.StatusInternalServerError, "team_name_update_failed")
 	}
+	recordAudit(c, "team.name_change", models.AuditTargetTeam, id, fiber.Map{"name": oldName}, fiber.Map{"name": team.Name})
+	emitTeamWebhook(models.WebhookEventTeamUpdated, team, fiber.Map{"name": oldName}, fiber.Map{"name": team.Name})
 
-	return c.JSON(fiber.Map{"message": "Team name updated"})
+	return c.JSON(fiber.Map{"message": localize(c, "team_name_updated")})
 }
 
 // UpdateTeamLeader godoc
@@ -140,7 +178,7 @@ func UpdateTeamLeader(c *fiber.Ctx) error {
 	team, err := repo.FindByID(id)
 	if err != nil {
 		utils.HandleError(err, fmt.Sprintf("Failed to find team %s", id), utils.Error)
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Team not found", "created_at": time.Now()})
+		return sendError(c, fiber.StatusNotFound, "team_not_found")
 	}
 
 	// update old leader role to TeamMemberRole
@@ -148,44 +186,118 @@ func UpdateTeamLeader(c *fiber.Ctx) error {
 	oldLeader, err := oldLeaderRepo.FindByID(team.LeaderID)
 	if err != nil {
 		utils.HandleError(err, fmt.Sprintf("Failed to find old leader %s", team.LeaderID), utils.Error)
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Old leader not found", "created_at": time.Now()})
+		return sendError(c, fiber.StatusNotFound, "old_leader_not_found")
 	}
 	if oldLeader.Role != models.TeamLeaderRole {
 		utils.HandleError(err, fmt.Sprintf("Old leader %s is not a team leader", team.LeaderID), utils.Error)
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Old leader is not a team leader", "created_at": time.Now()})
+		return sendError(c, fiber.StatusBadRequest, "old_leader_not_team_leader")
 	}
 	oldLeader.Role = models.TeamMemberRole
 	if err := oldLeaderRepo.Update(oldLeader); err != nil {
 		utils.HandleError(err, fmt.Sprintf("Failed to update old leader %s role", team.LeaderID), utils.Error)
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update old leader role", "created_at": time.Now()})
+		return sendError(c, fiber.StatusInternalServerError, "old_leader_role_update_failed")
 	}
+	recordAudit(c, "user.role_change", models.AuditTargetUser, oldLeader.ID, fiber.Map{"role": models.TeamLeaderRole}, fiber.Map{"role": oldLeader.Role})
+	revokeUserTokens(oldLeader.ID)
+	emitUserWebhook(models.WebhookEventUserUpdated, oldLeader, fiber.Map{"role": models.TeamLeaderRole}, fiber.Map{"role": oldLeader.Role})
 
 	leaderID := c.FormValue("leader_id")
 	leaderRepo := repositories.NewUserRepository(config.DB)
 	leader, err := leaderRepo.FindByID(leaderID)
 	if err != nil {
 		utils.HandleError(err, fmt.Sprintf("Failed to find new leader %s", leaderID), utils.Error)
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Leader not found", "created_at": time.Now()})
+		return sendError(c, fiber.StatusNotFound, "leader_not_found")
 	}
 	if leader.Role != models.TeamLeaderRole {
 		utils.HandleError(err, fmt.Sprintf("New leader %s is not a team leader", leaderID), utils.Error)
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "User is not a team leader", "created_at": time.Now()})
+		return sendError(c, fiber.StatusBadRequest, "user_not_team_leader")
 	}
 
+	oldLeaderID := team.LeaderID
 	team.LeaderID = leaderID
 	if err := repo.Update(team); err != nil {
 		utils.HandleError(err, fmt.Sprintf("Failed to update team %s leader", id), utils.Error)
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update team leader", "created_at": time.Now()})
+		return sendError(c, fiber.StatusInternalServerError, "team_leader_update_failed")
 	}
+	recordAudit(c, "team.leader_change", models.AuditTargetTeam, id, fiber.Map{"leader_id": oldLeaderID}, fiber.Map{"leader_id": team.LeaderID})
+	emitTeamWebhook(models.WebhookEventTeamUpdated, team, fiber.Map{"leader_id": oldLeaderID}, fiber.Map{"leader_id": team.LeaderID})
 
 	// update new leader role to TeamLeaderRole
 	leader.Role = models.TeamLeaderRole
 	if err := leaderRepo.Update(leader); err != nil {
 		utils.HandleError(err, fmt.Sprintf("Failed to update new leader %s role", leaderID), utils.Error)
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update new leader role", "created_at": time.Now()})
+		return sendError(c, fiber.StatusInternalServerError, "new_leader_role_update_failed")
 	}
+	config.InvalidateUserAccess(oldLeaderID, leaderID)
 
-	return c.JSON(fiber.Map{"message": "Team leader updated"})
+	return c.JSON(fiber.Map{"message": localize(c, "team_leader_updated")})
+}
+
+// setTeamVerificationVisibility stores the public verification visibility of
+// a team from the request body.
+func setTeamVerificationVisibility(c *fiber.Ctx, teamID string) error {
+	var input models.ChangeVerificationVisibilityInput
+	if err := c.BodyParser(&input); err != nil || !models.ValidVerificationVisibility(input.Visibility) {
+		return sendError(c, fiber.StatusBadRequest, "invalid_visibility")
+	}
+
+	repo := repositories.NewTeamRepository(config.DB)
+	team, err := repo.FindByID(teamID)
+	if err != nil {
+		utils.HandleError(err, fmt.Sprintf("Failed to find team %s", teamID), utils.Error)
+		return sendError(c, fiber.StatusNotFound, "team_not_found")
+	}
+
+	oldVisibility := team.VerificationVisibility
+	team.VerificationVisibility = input.Visibility
+	if err := repo.Update(team); err != nil {
+		utils.HandleError(err, fmt.Sprintf("Failed to update team %s verification visibility", teamID), utils.Error)
+		return sendError(c, fiber.StatusInternalServerError, "visibility_update_failed")
+	}
+	recordAudit(c, "team.verification_visibility_change", models.AuditTargetTeam, teamID,
+		fiber.Map{"verification_visibility": oldVisibility}, fiber.Map{"verification_visibility": team.VerificationVisibility})
+	emitTeamWebhook(models.WebhookEventTeamUpdated, team,
+		fiber.Map{"verification_visibility": oldVisibility}, fiber.Map{"verification_visibility": team.VerificationVisibility})
+
+	return c.JSON(fiber.Map{"message": localize(c, "visibility_updated"), "visibility": team.VerificationVisibility})
+}
+
+// UpdateTeamVerificationVisibility godoc
+// @Summary Update team verification visibility
+// @Description Choose what anonymous visitors see when verifying the team's documents: name (signer name), name_team (signer and team name) or full (also email, file name, hash and verification count)
+// @Tags teams
+// @Accept json
+// @Produce json
+// @Param id path string true "Team ID"
+// @Param input body models.ChangeVerificationVisibilityInput true "Visibility level"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Router /teams/{id}/verification-visibility [put]
+// @Security Bearer
+func UpdateTeamVerificationVisibility(c *fiber.Ctx) error {
+	return setTeamVerificationVisibility(c, c.Params("id"))
+}
+
+// UpdateMyTeamVerificationVisibility godoc
+// @Summary Update my team verification visibility
+// @Description Choose what anonymous visitors see when verifying your team's documents: name, name_team or full
+// @Tags teams
+// @Accept json
+// @Produce json
+// @Param input body models.ChangeVerificationVisibilityInput true "Visibility level"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Router /my/team/verification-visibility [put]
+// @Security Bearer
+func UpdateMyTeamVerificationVisibility(c *fiber.Ctx) error {
+	teamId, ok := c.Locals("teamId").(string)
+	if !ok || teamId == "" {
+		utils.HandleError(fmt.Errorf("invalid or missing user context"), "Invalid or missing user context", utils.Error)
+		return sendError(c, fiber.StatusBadRequest, "missing_user_context")
+	}
+	return setTeamVerificationVisibility(c, teamId)
 }
 
 // GetMyTeam godoc
@@ -205,10 +317,7 @@ func GetMyTeam(c *fiber.Ctx) error {
 	teamId, ok1 := teamIdRaw.(string)
 	if !ok1 {
 		utils.HandleError(fmt.Errorf("invalid or missing user context"), "Invalid or missing user context", utils.Error)
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error":      "Invalid or missing user context",
-			"created_at": time.Now(),
-		})
+		return sendError(c, fiber.StatusBadRequest, "missing_user_context")
 	}
 
 	repo := repositories.NewTeamRepository(config.DB)
@@ -216,7 +325,7 @@ func GetMyTeam(c *fiber.Ctx) error {
 	team, err := repo.FindByID(teamId)
 	if err != nil {
 		utils.HandleError(err, fmt.Sprintf("Failed to find team %s", teamId), utils.Error)
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Team not found"})
+		return sendError(c, fiber.StatusNotFound, "team_not_found")
 	}
 
 	return c.JSON(team)
@@ -230,7 +339,8 @@ func GetMyTeam(c *fiber.Ctx) error {
 // @Produce json
 // @Param limit query int false "Limit" default(10)
 // @Param page query int false "Page" default(1)
-// @Success 200 {array} models.Team
+// @Param cursor query string false "meta.next_cursor of the previous page"
+// @Success 200 {object} models.ListResponse{data=[]models.Team}
 // @Failure 400 {object} models.ErrorResponse
 // @Failure 500 {object} models.ErrorResponse
 // @Router /teams [get]
@@ -238,37 +348,20 @@ func GetMyTeam(c *fiber.Ctx) error {
 func GetAllTeams(c *fiber.Ctx) error {
 	repo := repositories.NewTeamRepository(config.DB)
 
-	limit, err := strconv.Atoi(c.Query("limit", "10"))
-	if err != nil || limit <= 0 {
-		limit = 10
-	}
-
-	page, err := strconv.Atoi(c.Query("page", "1"))
-	if err != nil || page <= 0 {
-		page = 1
-	}
-	offset := (page - 1) * limit
-
-	total, err := repo.Count()
+	p, err := paginationFromQuery(c, models.DefaultPageSize)
 	if err != nil {
-		utils.HandleError(err, "Failed to count teams", utils.Error)
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to count teams"})
+		return sendErrorFrom(c, fiber.StatusBadRequest, err)
 	}
 
-	teams, err := repo.FindAllPaginated(limit, offset)
+	teams, total, err := repo.FindAllPaginated(p)
 	if err != nil {
 		utils.HandleError(err, "Failed to get teams", utils.Error)
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to get teams"})
+		return sendError(c, fiber.StatusInternalServerError, "teams_fetch_failed")
 	}
 
-	return c.JSON(fiber.Map{
-		"teams": teams,
-		"meta": fiber.Map{
-			"page":  page,
-			"limit": limit,
-			"total": total,
-		},
-	})
+	return sendList(c, teams, p, total, nextCursor(p, teams, func(t models.Team) models.Cursor {
+		return models.Cursor{Time: t.CreatedAt, ID: t.ID}
+	}))
 }
 
 // GetAllUsersInTeam godoc
@@ -280,7 +373,8 @@ func GetAllTeams(c *fiber.Ctx) error {
 // @Param team_id path string true "Team ID"
 // @Param limit query int false "Limit" default(10)
 // @Param page query int false "Page" default(1)
-// @Success 200 {array} models.UserShortResponse
+// @Param cursor query string false "meta.next_cursor of the previous page"
+// @Success 200 {object} models.ListResponse{data=[]models.TeamMember}
 // @Failure 400 {object} models.ErrorResponse
 // @Failure 500 {object} models.ErrorResponse
 // @Router /teams/{team_id}/users [get]
@@ -289,35 +383,18 @@ func GetAllUsersInTeam(c *fiber.Ctx) error {
 	repo := repositories.NewTeamMemberRepository(config.DB)
 	teamID := c.Params("team_id")
 
-	limit, err := strconv.Atoi(c.Query("limit", "10"))
-	if err != nil || limit <= 0 {
-		limit = 10
-	}
-	page, err := strconv.Atoi(c.Query("page", "1"))
-	if err != nil || page <= 0 {
-		page = 1
-	}
-	offset := (page - 1) * limit
-	total, err := repo.CountMembers(teamID)
+	p, err := paginationFromQuery(c, models.DefaultPageSize)
 	if err != nil {
-		utils.HandleError(err, "Failed to count team members", utils.Error)
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to count team members", "created_at": time.Now()})
+		return sendErrorFrom(c, fiber.StatusBadRequest, err)
 	}
 
-	members, err := repo.GetMembersPaginated(teamID, limit, offset)
+	members, total, err := repo.GetMembersPaginated(teamID, p)
 	if err != nil {
 		utils.HandleError(err, "Failed to get team members", utils.Error)
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to get team members", "created_at": time.Now()})
+		return sendError(c, fiber.StatusInternalServerError, "team_members_fetch_failed")
 	}
 
-	return c.JSON(fiber.Map{
-		"members": members,
-		"meta": fiber.Map{
-			"page":  page,
-			"limit": limit,
-			"total": total,
-		},
-	})
+	return sendList(c, members, p, total, nextCursor(p, members, teamMemberAdded))
 }
 
 // AddUserToTeam godoc
@@ -338,7 +415,7 @@ func AddUserToTeam(c *fiber.Ctx) error {
 	input := new(models.AddTeamMemberInput)
 	if err := c.BodyParser(input); err != nil {
 		utils.HandleError(err, "Failed to parse request body", utils.Error)
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		return sendErrorFrom(c, fiber.StatusBadRequest, err)
 	}
 
 	member := &models.TeamMember{
@@ -348,10 +425,13 @@ func AddUserToTeam(c *fiber.Ctx) error {
 
 	if err := repo.Add(member); err != nil {
 		utils.HandleError(err, "Failed to add user to team", utils.Error)
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to add user to team"})
+		return sendError(c, fiber.StatusInternalServerError, "team_member_add_failed")
 	}
+	config.InvalidateUserAccess(member.UserID)
+	recordAudit(c, "team.member_add", models.AuditTargetTeam, member.TeamID, nil, fiber.Map{"user_id": member.UserID})
+	emitTeamMemberWebhook(models.WebhookEventTeamMemberAdded, member.TeamID, member.UserID)
 
-	return c.JSON(fiber.Map{"message": "User added to team"})
+	return c.JSON(fiber.Map{"message": localize(c, "team_member_added")})
 }
 
 // RemoveUserFromTeam godoc
@@ -374,19 +454,25 @@ func RemoveUserFromTeam(c *fiber.Ctx) error {
 
 	if err := repo.Remove(teamID, userID); err != nil {
 		utils.HandleError(err, "Failed to remove user from team", utils.Error)
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to remove user from team", "created_at": time.Now()})
+		return sendError(c, fiber.StatusInternalServerError, "team_member_remove_failed")
 	}
+	config.InvalidateUserAccess(userID)
+	recordAudit(c, "team.member_remove", models.AuditTargetTeam, teamID, fiber.Map{"user_id": userID}, nil)
+	emitTeamMemberWebhook(models.WebhookEventTeamMemberRemoved, teamID, userID)
 
-	return c.JSON(fiber.Map{"message": "User removed from team"})
+	return c.JSON(fiber.Map{"message": localize(c, "team_member_removed")})
 }
 
 // GetAllUsersInMyTeam godoc
 // @Summary Get all users in my team
-// @Description Get all users in the authenticated user's team
+// @Description Get all users in the authenticated user's team with pagination
 // @Tags teams
 // @Accept json
 // @Produce json
-// @Success 200 {array} models.UserShortResponse
+// @Param limit query int false "Limit" default(10)
+// @Param page query int false "Page" default(1)
+// @Param cursor query string false "meta.next_cursor of the previous page"
+// @Success 200 {object} models.ListResponse{data=[]models.TeamMember}
 // @Failure 400 {object} models.ErrorResponse
 // @Failure 500 {object} models.ErrorResponse
 // @Router /my/team/members [get]
@@ -396,21 +482,27 @@ func GetAllUsersInMyTeam(c *fiber.Ctx) error {
 	teamId, ok1 := teamIdRaw.(string)
 	if !ok1 {
 		utils.HandleError(fmt.Errorf("invalid or missing user context"), "Invalid or missing user context", utils.Error)
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error":      "Invalid or missing user context",
-			"created_at": time.Now(),
-		})
+		return sendError(c, fiber.StatusBadRequest, "missing_user_context")
 	}
 
 	repo := repositories.NewTeamMemberRepository(config.DB)
 
-	members, err := repo.GetMembers(teamId)
+	p, err := paginationFromQuery(c, models.DefaultPageSize)
+	if err != nil {
+		return sendErrorFrom(c, fiber.StatusBadRequest, err)
+	}
+
+	members, total, err := repo.GetMembersPaginated(teamId, p)
 	if err != nil {
 		utils.HandleError(err, "Failed to get team members", utils.Error)
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to get team members", "created_at": time.Now()})
+		return sendError(c, fiber.StatusInternalServerError, "team_members_fetch_failed")
 	}
 
-	return c.JSON(members)
+	return sendList(c, members, p, total, nextCursor(p, members, teamMemberAdded))
+}
+
+func teamMemberAdded(m models.TeamMember) models.Cursor {
+	return models.Cursor{Time: m.CreatedAt, ID: m.ID}
 }
 
 // AddUserToMyTeam godoc
@@ -430,10 +522,7 @@ func AddUserToMyTeam(c *fiber.Ctx) error {
 	teamId, ok1 := teamIdRaw.(string)
 	if !ok1 {
 		utils.HandleError(fmt.Errorf("invalid or missing user context"), "Invalid or missing user context", utils.Error)
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error":      "Invalid or missing user context",
-			"created_at": time.Now(),
-		})
+		return sendError(c, fiber.StatusBadRequest, "missing_user_context")
 	}
 
 	repo := repositories.NewTeamMemberRepository(config.DB)
@@ -441,7 +530,7 @@ func AddUserToMyTeam(c *fiber.Ctx) error {
 	input := new(models.AddTeamMemberToMyInput)
 	if err := c.BodyParser(input); err != nil {
 		utils.HandleError(err, "Failed to parse request body", utils.Error)
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		return sendErrorFrom(c, fiber.StatusBadRequest, err)
 	}
 
 	member := &models.TeamMember{
@@ -451,10 +540,13 @@ func AddUserToMyTeam(c *fiber.Ctx) error {
 
 	if err := repo.Add(member); err != nil {
 		utils.HandleError(err, "Failed to add user to team", utils.Error)
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to add user to team"})
+		return sendError(c, fiber.StatusInternalServerError, "team_member_add_failed")
 	}
+	config.InvalidateUserAccess(member.UserID)
+	recordAudit(c, "team.member_add", models.AuditTargetTeam, member.TeamID, nil, fiber.Map{"user_id": member.UserID})
+	emitTeamMemberWebhook(models.WebhookEventTeamMemberAdded, member.TeamID, member.UserID)
 
-	return c.JSON(fiber.Map{"message": "User added to team"})
+	return c.JSON(fiber.Map{"message": localize(c, "team_member_added")})
 }
 
 // RemoveUserFromMyTeam godoc
@@ -474,10 +566,7 @@ func RemoveUserFromMyTeam(c *fiber.Ctx) error {
 	teamId, ok1 := teamIdRaw.(string)
 	if !ok1 {
 		utils.HandleError(fmt.Errorf("invalid or missing user context"), "Invalid or missing user context", utils.Error)
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error":      "Invalid or missing user context",
-			"created_at": time.Now(),
-		})
+		return sendError(c, fiber.StatusBadRequest, "missing_user_context")
 	}
 
 	repo := repositories.NewTeamMemberRepository(config.DB)
@@ -485,8 +574,11 @@ func RemoveUserFromMyTeam(c *fiber.Ctx) error {
 
 	if err := repo.Remove(teamId, userID); err != nil {
 		utils.HandleError(err, "Failed to remove user from team", utils.Error)
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to remove user from team", "created_at": time.Now()})
+		return sendError(c, fiber.StatusInternalServerError, "team_member_remove_failed")
 	}
+	config.InvalidateUserAccess(userID)
+	recordAudit(c, "team.member_remove", models.AuditTargetTeam, teamId, fiber.Map{"user_id": userID}, nil)
+	emitTeamMemberWebhook(models.WebhookEventTeamMemberRemoved, teamId, userID)
 
-	return c.JSON(fiber.Map{"message": "User removed from team", "created_at": time.Now()})
+	return c.JSON(fiber.Map{"message": localize(c, "team_member_removed"), "created_at": time.Now()})
 }
@@ -1,10 +1,11 @@
 package controllers
 
 import (
-	"strconv"
+	"strings"
 	"time"
 
 	"tawtheeq-backend/config"
+	"tawtheeq-backend/i18n"
 	"tawtheeq-backend/models"
 	"tawtheeq-backend/repositories"
 	"tawtheeq-backend/utils"
@@ -29,10 +30,11 @@ func CreateUser(c *fiber.Ctx) error {
 	var input models.CreateUserInput
 	if err := c.BodyParser(&input); err != nil {
 		utils.HandleError(err, "Failed to parse request body", utils.Error)
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error":      "Invalid input",
-			"created_at": time.Now(),
-		})
+		return sendError(c, fiber.StatusBadRequest, "invalid_input")
+	}
+
+	if input.Language != "" && !i18n.Supported(input.Language) {
+		return sendError(c, fiber.StatusBadRequest, "invalid_language", strings.Join(i18n.Languages(), ", "))
 	}
 
 	repo := repositories.NewUserRepository(config.DB)
@@ -40,10 +42,7 @@ func CreateUser(c *fiber.Ctx) error {
 	password, err := utils.HashPassword(input.Password)
 	if err != nil {
 		utils.HandleError(err, "Failed to hash password", utils.Error)
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error":      "Failed to hash password",
-			"created_at": time.Now(),
-		})
+		return sendError(c, fiber.StatusInternalServerError, "password_hash_failed")
 	}
 
 	newUser := models.User{
@@ -51,6 +50,7 @@ func CreateUser(c *fiber.Ctx) error {
 		FullName: input.FullName,
 		Email:    input.Email,
 		Password: password,
+		Language: input.Language,
 		Role:     models.Role(models.TeamMemberRole), // Default role
 		// Role:     models.Role(c.FormValue("role")),
 	}
@@ -59,14 +59,18 @@ func CreateUser(c *fiber.Ctx) error {
 
 	if err != nil {
 		utils.HandleError(err, "Failed to create user", utils.Error)
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error":      "Failed to create user",
-			"created_at": time.Now(),
-		})
+		return sendError(c, fiber.StatusInternalServerError, "user_create_failed")
 	}
 
+	recordAudit(c, "user.create", models.AuditTargetUser, user.ID, nil, userAuditSnapshot(user))
+	emitUserWebhook(models.WebhookEventUserCreated, user, nil, nil)
+	queueEmail(user, models.EmailWelcome, user.ID, fiber.Map{
+		"Email":    user.Email,
+		"LoginURL": frontendURL(),
+	})
+
 	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
-		"message": "User created successfully",
+		"message": localize(c, "user_created"),
 		"user":    user,
 	})
 }
@@ -87,15 +91,27 @@ func CreateUser(c *fiber.Ctx) error {
 func RemoveUser(c *fiber.Ctx) error {
 	repo := repositories.NewUserRepository(config.DB)
 	id := c.Params("id")
-	err := repo.Delete(id)
+	var before interface{}
+	removed, err := repo.FindByID(id)
+	var removedTeamID *string
+	if err == nil {
+		before = userAuditSnapshot(removed)
+		removedTeamID = webhookUserTeam(id)
+	}
+	// sessions are deleted with the user, so their access tokens are denied first
+	revokeUserTokens(id)
+	err = repo.Delete(id)
 	if err != nil {
 		utils.HandleError(err, "Failed to delete user", utils.Error)
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to delete user",
-		})
+		return sendError(c, fiber.StatusInternalServerError, "user_delete_failed")
+	}
+	config.InvalidateUserAccess(id)
+	recordAudit(c, "user.remove", models.AuditTargetUser, id, before, nil)
+	if before != nil {
+		emitWebhook(models.WebhookEventUserRemoved, removedTeamID, fiber.Map{"user": webhookUser(removed)})
 	}
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{
-		"message": "User deleted successfully",
+		"message": localize(c, "user_deleted"),
 		"userID":  id,
 	})
 }
@@ -121,24 +137,31 @@ func ChangeUserRole(c *fiber.Ctx) error {
 	var input models.ChangeUserRoleInput
 	if err := c.BodyParser(&input); err != nil {
 		utils.HandleError(err, "Failed to parse request body", utils.Error)
-		return c.Status(400).JSON(models.ErrorResponse{Error: "Invalid input", CreateAt: time.Now()})
+		return sendError(c, 400, "invalid_input")
 	}
 
 	userRepo := repositories.NewUserRepository(config.DB)
 	user, err := userRepo.FindByID(id)
 	if err != nil {
 		utils.HandleError(err, "User not found", utils.Error)
-		return c.Status(404).JSON(models.ErrorResponse{Error: "User not found", CreateAt: time.Now()})
+		return sendError(c, 404, "user_not_found")
 	}
 
+	oldRole := user.Role
 	user.Role = models.Role(input.Role)
 	if err := userRepo.Update(user); err != nil {
 		utils.HandleError(err, "Failed to update user role", utils.Error)
-		return c.Status(500).JSON(models.ErrorResponse{Error: "Failed to update user role", CreateAt: time.Now()})
+		return sendError(c, 500, "user_role_update_failed")
+	}
+	recordAudit(c, "user.role_change", models.AuditTargetUser, user.ID, fiber.Map{"role": oldRole}, fiber.Map{"role": user.Role})
+	config.InvalidateUserAccess(user.ID)
+	if oldRole != user.Role {
+		revokeUserTokens(user.ID)
 	}
+	emitUserWebhook(models.WebhookEventUserUpdated, user, fiber.Map{"role": oldRole}, fiber.Map{"role": user.Role})
 
 	return c.JSON(fiber.Map{
-		"message":   "User role updated successfully",
+		"message":   localize(c, "user_role_updated"),
 		"user_id":   user.ID,
 		"new_role":  user.Role,
 		"updatedAt": time.Now(),
@@ -167,31 +190,72 @@ func UpdateMyName(c *fiber.Ctx) error {
 	userID, ok1 := userIDRaw.(string)
 	if !ok1 {
 		utils.HandleError(nil, "Invalid or missing user context", utils.Error)
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error":      "Invalid or missing user context",
-			"created_at": time.Now(),
-		})
+		return sendError(c, fiber.StatusBadRequest, "missing_user_context")
 	}
 
 	user, err := repo.FindByID(userID)
 	if err != nil {
 		utils.HandleError(err, "User not found", utils.Error)
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-			"error": "User not found",
-		})
+		return sendError(c, fiber.StatusNotFound, "user_not_found")
 	}
 
+	oldName := user.FullName
 	user.FullName = c.FormValue("full_name")
 
 	err = repo.Update(user)
 	if err != nil {
 		utils.HandleError(err, "Failed to update user name", utils.Error)
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to update user name",
-		})
+		return sendError(c, fiber.StatusInternalServerError, "user_name_update_failed")
+	}
+	recordAudit(c, "user.name_change", models.AuditTargetUser, user.ID, fiber.Map{"full_name": oldName}, fiber.Map{"full_name": user.FullName})
+	emitUserWebhook(models.WebhookEventUserUpdated, user, fiber.Map{"full_name": oldName}, fiber.Map{"full_name": user.FullName})
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": localize(c, "user_name_updated"),
+		"user":    user,
+	})
+}
+
+// UpdateMyLanguage godoc
+// @Summary Change language
+// @Description Allows user to choose the language of the emails they receive and of API messages
+// @Tags myself
+// @Accept json
+// @Produce json
+// @Param language query string true "ar or en"
+// @Success 200 {object} fiber.Map
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /myself/language [put]
+// @Security Bearer
+func UpdateMyLanguage(c *fiber.Ctx) error {
+	userID, ok := c.Locals("userID").(string)
+	if !ok {
+		utils.HandleError(nil, "Invalid or missing user context", utils.Error)
+		return sendError(c, fiber.StatusBadRequest, "missing_user_context")
+	}
+
+	language := c.FormValue("language")
+	if !i18n.Supported(language) {
+		return sendError(c, fiber.StatusBadRequest, "invalid_language", strings.Join(i18n.Languages(), ", "))
+	}
+
+	repo := repositories.NewUserRepository(config.DB)
+	user, err := repo.FindByID(userID)
+	if err != nil {
+		utils.HandleError(err, "User not found", utils.Error)
+		return sendError(c, fiber.StatusNotFound, "user_not_found")
+	}
+
+	oldLanguage := user.Language
+	user.Language = language
+	if err := repo.Update(user); err != nil {
+		utils.HandleError(err, "Failed to update user language", utils.Error)
+		return sendError(c, fiber.StatusInternalServerError, "user_language_update_failed")
 	}
+	recordAudit(c, "user.language_change", models.AuditTargetUser, user.ID, fiber.Map{"language": oldLanguage}, fiber.Map{"language": user.Language})
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{
-		"message": "User name updated successfully",
+		"message": localize(c, "user_language_updated"),
 		"user":    user,
 	})
 }
@@ -219,57 +283,42 @@ func UpdateMyPassword(c *fiber.Ctx) error {
 	userID, ok1 := userIDRaw.(string)
 	if !ok1 {
 		utils.HandleError(nil, "Invalid or missing user context", utils.Error)
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error":      "Invalid or missing user context",
-			"created_at": time.Now(),
-		})
+		return sendError(c, fiber.StatusBadRequest, "missing_user_context")
 	}
 
 	user, err := repo.FindByID(userID)
 	if err != nil {
 		utils.HandleError(err, "User not found", utils.Error)
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-			"error":      "User not found",
-			"created_at": time.Now(),
-		})
+		return sendError(c, fiber.StatusNotFound, "user_not_found")
 	}
 
 	passwordOld, err := utils.HashPassword(c.FormValue("old_password"))
 	if err != nil {
 		utils.HandleError(err, "Failed to hash old password", utils.Error)
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error":      "Failed to hash password",
-			"created_at": time.Now(),
-		})
+		return sendError(c, fiber.StatusInternalServerError, "password_hash_failed")
 	}
 	password, err := utils.HashPassword(c.FormValue("password"))
 	if err != nil {
 		utils.HandleError(err, "Failed to hash new password", utils.Error)
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error":      "Failed to hash password",
-			"created_at": time.Now(),
-		})
+		return sendError(c, fiber.StatusInternalServerError, "password_hash_failed")
 	}
 
 	if user.Password != passwordOld {
 		utils.HandleError(nil, "Old password is incorrect", utils.Error)
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error":      "Old password is incorrect",
-			"created_at": time.Now(),
-		})
+		return sendError(c, fiber.StatusBadRequest, "old_password_incorrect")
 	}
 
 	user.Password = password
 	err = repo.Update(user)
 	if err != nil {
 		utils.HandleError(err, "Failed to update user password", utils.Error)
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error":      "Failed to update user password",
-			"created_at": time.Now(),
-		})
+		return sendError(c, fiber.StatusInternalServerError, "user_password_update_failed")
 	}
+	recordAudit(c, "user.password_change", models.AuditTargetUser, user.ID, nil, nil)
+	revokeUserTokens(user.ID)
+	queueEmail(user, models.EmailPasswordChanged, user.ID, fiber.Map{"ChangedAt": emailTime(time.Now())})
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{
-		"message":    "User password updated successfully",
+		"message":    localize(c, "user_password_updated"),
 		"created_at": time.Now(),
 	})
 }
@@ -282,7 +331,8 @@ func UpdateMyPassword(c *fiber.Ctx) error {
 // @Produce json
 // @Param limit query int false "Limit" default(10)
 // @Param page query int false "Page" default(1)
-// @Success 200 {array} models.UserShortResponse
+// @Param cursor query string false "meta.next_cursor of the previous page"
+// @Success 200 {object} models.ListResponse{data=[]models.User}
 // @Failure 400 {object} models.ErrorResponse
 // @Failure 500 {object} models.ErrorResponse
 // @Router /users [get]
@@ -292,24 +342,17 @@ func UpdateMyPassword(c *fiber.Ctx) error {
 func GetAllUsers(c *fiber.Ctx) error {
 	repo := repositories.NewUserRepository(config.DB)
 
-	limit, err := strconv.Atoi(c.Query("limit", "10"))
-	if err != nil || limit <= 0 {
-		limit = 10
-	}
-
-	page, err := strconv.Atoi(c.Query("page", "1"))
-	if err != nil || page <= 0 {
-		page = 1
+	p, err := paginationFromQuery(c, models.DefaultPageSize)
+	if err != nil {
+		return sendErrorFrom(c, fiber.StatusBadRequest, err)
 	}
 
-	offset := (page - 1) * limit
-
-	users, err := repo.FindAll(limit, offset)
+	users, total, err := repo.FindAll(p)
 	if err != nil {
 		utils.HandleError(err, "Failed to retrieve users", utils.Error)
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to retrieve users",
-		})
+		return sendError(c, fiber.StatusInternalServerError, "users_fetch_failed")
 	}
-	return c.Status(fiber.StatusOK).JSON(users)
+	return sendList(c, users, p, total, nextCursor(p, users, func(u models.User) models.Cursor {
+		return models.Cursor{Time: u.CreatedAt, ID: u.ID}
+	}))
 }
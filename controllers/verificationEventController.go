@@ -0,0 +1,292 @@
+// VerificationEventController
+package controllers
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"tawtheeq-backend/config"
+	"tawtheeq-backend/models"
+	"tawtheeq-backend/repositories"
+	"tawtheeq-backend/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// verificationEvents buffers events between the verify handlers and the
+// writer, so verification responses never wait for the insert.
+var verificationEvents = make(chan models.VerificationEvent, 1024)
+
+const verificationEventBatch = 100
+
+// StartVerificationEventWriter stores queued verification events in batches
+// and bumps the counters of the verified documents.
+func StartVerificationEventWriter() {
+	go func() {
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+
+		batch := make([]models.VerificationEvent, 0, verificationEventBatch)
+		flush := func() {
+			if len(batch) == 0 {
+				return
+			}
+			eventRepo := repositories.NewVerificationEventRepository(config.DB)
+			if err := eventRepo.CreateBatch(batch); err != nil {
+				utils.HandleError(err, "Failed to store verification events", utils.Error)
+			}
+
+			counts := map[string]int{}
+			for _, e := range batch {
+				if e.DocumentID != nil && e.Result == models.VerificationResultValid {
+					counts[*e.DocumentID]++
+				}
+			}
+			docRepo := repositories.NewDocumentRepository(config.DB)
+			if err := docRepo.IncrementVerificationCount(counts); err != nil {
+				utils.HandleError(err, "Failed to update verification counters", utils.Error)
+			}
+			batch = batch[:0]
+		}
+
+		for {
+			select {
+			case e := <-verificationEvents:
+				batch = append(batch, e)
+				if len(batch) >= verificationEventBatch {
+					flush()
+				}
+			case <-ticker.C:
+				flush()
+			}
+		}
+	}()
+}
+
+// truncate shortens client supplied headers to their column size.
+func truncate(s string, max int) string {
+	if len(s) > max {
+		return s[:max]
+	}
+	return s
+}
+
+// recordVerification queues a verification event for doc (nil when the
+// lookup failed) and, when a document was verified by ID or QR code, a
+// document.verified webhook. Candidates of a similarity lookup do not send
+// one. Request values are copied because fiber reuses them once the handler
+// returns.
+func recordVerification(c *fiber.Ctx, doc *models.Document, method string, result string) {
+	event := models.VerificationEvent{
+		Method:    method,
+		Result:    result,
+		ClientIP:  strings.Clone(c.IP()),
+		UserAgent: truncate(strings.Clone(c.Get(fiber.HeaderUserAgent)), 512),
+		Referrer:  truncate(strings.Clone(c.Get(fiber.HeaderReferer)), 1024),
+		CreatedAt: time.Now(),
+	}
+	if doc != nil && doc.ID != "" {
+		id := doc.ID
+		event.DocumentID = &id
+		if doc.SignedByTeamID != nil {
+			teamID := *doc.SignedByTeamID
+			event.TeamID = &teamID
+		}
+	}
+
+	select {
+	case verificationEvents <- event:
+	default:
+		utils.HandleError(fmt.Errorf("verification event queue full"), "Dropped verification event", utils.Warning)
+	}
+
+	if event.DocumentID != nil && result != models.VerificationResultSimilar && allowVerifiedWebhook(*event.DocumentID) {
+		emitWebhook(models.WebhookEventDocumentVerified, event.TeamID, fiber.Map{
+			"document": webhookDocument(doc),
+			"method":   method,
+			"result":   result,
+		})
+	}
+}
+
+// verifiedWebhookWindow returns how often a document.verified webhook may be
+// sent for the same document, from WEBHOOK_VERIFIED_WINDOW_SECONDS (default
+// 300).
+func verifiedWebhookWindow() time.Duration {
+	sec, err := strconv.Atoi(os.Getenv("WEBHOOK_VERIFIED_WINDOW_SECONDS"))
+	if err != nil || sec <= 0 {
+		sec = 300
+	}
+	return time.Duration(sec) * time.Second
+}
+
+const verifiedWebhookPrefix = "webhook_verified:"
+
+var (
+	verifiedWebhookMu   sync.Mutex
+	verifiedWebhookSent = map[string]time.Time{}
+)
+
+// allowVerifiedWebhook reports whether a document.verified webhook may be
+// sent for docID, so anonymous verifications cannot fan out into deliveries.
+// Verifications within one window are coalesced into the first: through
+// Redis when it is connected, so instances share the window, otherwise per
+// instance.
+func allowVerifiedWebhook(docID string) bool {
+	window := verifiedWebhookWindow()
+	if config.Redis != nil {
+		ok, err := config.Redis.SetNX(config.Ctx, verifiedWebhookPrefix+docID, 1, window).Result()
+		if err == nil {
+			return ok
+		}
+		utils.HandleError(err, "Failed to check document.verified webhook window", utils.Warning)
+	}
+
+	verifiedWebhookMu.Lock()
+	defer verifiedWebhookMu.Unlock()
+	now := time.Now()
+	if sent, ok := verifiedWebhookSent[docID]; ok && now.Sub(sent) < window {
+		return false
+	}
+	for id, sent := range verifiedWebhookSent {
+		if now.Sub(sent) >= window {
+			delete(verifiedWebhookSent, id)
+		}
+	}
+	verifiedWebhookSent[docID] = now
+	return true
+}
+
+// GetDocumentVerifications godoc
+// @Summary Document verification history
+// @Description Lists when and how a document was verified, newest first. Available to the signer, the signing team and super admins
+// @Tags verifications
+// @Produce json
+// @Param id path string true "Document ID"
+// @Param limit query int false "Limit" default(20)
+// @Param page query int false "Page" default(1)
+// @Param cursor query string false "meta.next_cursor of the previous page"
+// @Success 200 {object} models.ListResponse{data=[]models.VerificationEvent}
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /documents/{id}/verifications [get]
+// @Security Bearer
+func GetDocumentVerifications(c *fiber.Ctx) error {
+	id := c.Params("id")
+	docRepo := repositories.NewDocumentRepository(config.DB)
+	doc, err := docRepo.FindByID(id)
+	if err != nil {
+		utils.HandleError(err, fmt.Sprintf("Document not found: %s", id), utils.Warning)
+		return sendError(c, fiber.StatusNotFound, "document_not_found")
+	}
+	if !canAccessDocument(c, doc) {
+		return sendError(c, fiber.StatusForbidden, "access_denied")
+	}
+
+	p, err := paginationFromQuery(c, 20)
+	if err != nil {
+		return sendErrorFrom(c, fiber.StatusBadRequest, err)
+	}
+
+	eventRepo := repositories.NewVerificationEventRepository(config.DB)
+	events, total, err := eventRepo.FindByDocument(id, p)
+	if err != nil {
+		utils.HandleError(err, "Failed to fetch verification events", utils.Error)
+		return sendError(c, fiber.StatusInternalServerError, "verifications_fetch_failed")
+	}
+
+	return sendList(c, events, p, total, nextCursor(p, events, func(e models.VerificationEvent) models.Cursor {
+		return models.Cursor{Time: e.CreatedAt, ID: e.ID}
+	}))
+}
+
+// teamVerificationTrends answers a trend request for teamID.
+func teamVerificationTrends(c *fiber.Ctx, teamID string) error {
+	interval := c.Query("interval", "day")
+	if !repositories.ValidTrendInterval(interval) {
+		return sendError(c, fiber.StatusBadRequest, "invalid_interval")
+	}
+
+	from, to, err := dateRangeFromQuery(c)
+	if err != nil {
+		return sendErrorFrom(c, fiber.StatusBadRequest, err)
+	}
+
+	eventRepo := repositories.NewVerificationEventRepository(config.DB)
+	points, err := eventRepo.TeamTrend(teamID, from, to, interval)
+	if err != nil {
+		utils.HandleError(err, fmt.Sprintf("Failed to aggregate verifications for team %s", teamID), utils.Error)
+		return sendError(c, fiber.StatusInternalServerError, "verification_aggregate_failed")
+	}
+	top, err := eventRepo.TopDocuments(teamID, from, to, 10)
+	if err != nil {
+		utils.HandleError(err, fmt.Sprintf("Failed to rank verified documents for team %s", teamID), utils.Warning)
+	}
+
+	totals := fiber.Map{}
+	var total int64
+	for _, p := range points {
+		total += p.Count
+		key := p.Method + ":" + p.Result
+		current, _ := totals[key].(int64)
+		totals[key] = current + p.Count
+	}
+
+	return c.JSON(fiber.Map{
+		"trend":         points,
+		"top_documents": top,
+		"totals":        totals,
+		"meta": fiber.Map{
+			"team_id":  teamID,
+			"from":     from.Format("2006-01-02"),
+			"to":       to.AddDate(0, 0, -1).Format("2006-01-02"),
+			"interval": interval,
+			"total":    total,
+		},
+	})
+}
+
+// GetTeamVerificationTrends godoc
+// @Summary Team verification trends
+// @Description Counts verifications of a team's documents per period, method and result, with the most verified documents. Defaults to the last 30 days
+// @Tags verifications
+// @Produce json
+// @Param team_id path string true "Team ID"
+// @Param from query string false "Start date (YYYY-MM-DD)"
+// @Param to query string false "End date, inclusive (YYYY-MM-DD)"
+// @Param interval query string false "day, week or month" default(day)
+// @Success 200 {array} models.VerificationTrendPoint
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /verifications/teams/{team_id}/trends [get]
+// @Security Bearer
+func GetTeamVerificationTrends(c *fiber.Ctx) error {
+	return teamVerificationTrends(c, c.Params("team_id"))
+}
+
+// GetMyTeamVerificationTrends godoc
+// @Summary My team verification trends
+// @Description Counts verifications of your team's documents per period, method and result, with the most verified documents
+// @Tags verifications
+// @Produce json
+// @Param from query string false "Start date (YYYY-MM-DD)"
+// @Param to query string false "End date, inclusive (YYYY-MM-DD)"
+// @Param interval query string false "day, week or month" default(day)
+// @Success 200 {array} models.VerificationTrendPoint
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /my/team/verification-trends [get]
+// @Security Bearer
+func GetMyTeamVerificationTrends(c *fiber.Ctx) error {
+	teamId, ok := c.Locals("teamId").(string)
+	if !ok || teamId == "" {
+		utils.HandleError(fmt.Errorf("invalid or missing user context"), "Invalid or missing user context", utils.Error)
+		return sendError(c, fiber.StatusBadRequest, "missing_user_context")
+	}
+	return teamVerificationTrends(c, teamId)
+}
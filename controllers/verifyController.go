@@ -0,0 +1,308 @@
+// VerifyController
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"tawtheeq-backend/config"
+	"tawtheeq-backend/i18n"
+	"tawtheeq-backend/models"
+	"tawtheeq-backend/repositories"
+	"tawtheeq-backend/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	// maxSimilarLimit caps the candidates of a similarity lookup; the limit
+	// applies to every page of the upload.
+	maxSimilarLimit = 50
+	// maxSimilarDistance caps max_distance. Beyond it unrelated pages start
+	// to match, and at 64 every stored hash would.
+	maxSimilarDistance = 12
+)
+
+// similarMaxPages returns how many pages an uploaded PDF may have, from
+// VERIFY_SIMILAR_MAX_PAGES (default 20).
+func similarMaxPages() int {
+	pages, err := strconv.Atoi(os.Getenv("VERIFY_SIMILAR_MAX_PAGES"))
+	if err != nil || pages <= 0 {
+		pages = 20
+	}
+	return pages
+}
+
+// similarMaxFileSize returns the largest upload in bytes, from
+// VERIFY_SIMILAR_MAX_FILE_MB (default 20).
+func similarMaxFileSize() int64 {
+	mb, err := strconv.Atoi(os.Getenv("VERIFY_SIMILAR_MAX_FILE_MB"))
+	if err != nil || mb <= 0 {
+		mb = 20
+	}
+	return int64(mb) << 20
+}
+
+// VerifySimilarHandler godoc
+// @Summary Find signed documents similar to a file
+// @Description Upload an image or PDF and get the signed documents whose stamped pages look alike, ranked by Hamming distance of their perceptual hashes. Blank and uniform pages are not matched
+// @Tags verify
+// @Accept multipart/form-data
+// @Produce json
+// @Param file formData file true "File to compare"
+// @Param max_distance query int false "Maximum Hamming distance (0-12)" default(10)
+// @Param limit query int false "Maximum number of candidates (1-50)" default(10)
+// @Success 200 {array} models.SimilarDocumentResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 413 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /verify/similar [post]
+// @Security Bearer
+func VerifySimilarHandler(c *fiber.Ctx) error {
+	maxDistance, err := strconv.Atoi(c.Query("max_distance", "10"))
+	if err != nil || maxDistance < 0 || maxDistance > maxSimilarDistance {
+		return sendError(c, fiber.StatusBadRequest, "invalid_max_distance", maxSimilarDistance)
+	}
+
+	limit, err := strconv.Atoi(c.Query("limit", "10"))
+	if err != nil || limit <= 0 {
+		limit = 10
+	}
+	if limit > maxSimilarLimit {
+		limit = maxSimilarLimit
+	}
+
+	tempDir := os.Getenv("TEMP_DIR")
+	if tempDir == "" {
+		tempDir = "./temp"
+	}
+
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		return sendError(c, fiber.StatusBadRequest, "invalid_file")
+	}
+	if maxSize := similarMaxFileSize(); fileHeader.Size > maxSize {
+		return sendError(c, fiber.StatusRequestEntityTooLarge, "file_too_large", maxSize>>20)
+	}
+
+	localFile, localPath, ext, _, _, err := UploadFileLocal(c, tempDir)
+	if err != nil {
+		return sendError(c, fiber.StatusBadRequest, "invalid_file")
+	}
+	localFile.Close()
+	defer func() {
+		if err := os.Remove(localPath); err != nil {
+			utils.HandleError(err, "Failed to remove temporary file", utils.Warning)
+		}
+	}()
+
+	switch strings.ToLower(ext) {
+	case ".jpg", ".jpeg", ".png", ".pdf":
+	default:
+		return sendError(c, fiber.StatusBadRequest, "unsupported_file_format")
+	}
+
+	hashes, err := utils.ComputePerceptualHashes(localPath, similarMaxPages())
+	var coded *i18n.Error
+	if errors.As(err, &coded) {
+		return sendErrorFrom(c, fiber.StatusBadRequest, err)
+	}
+	if err != nil {
+		utils.HandleError(err, "Failed to compute perceptual hashes", utils.Warning)
+		return sendError(c, fiber.StatusBadRequest, "file_read_failed")
+	}
+
+	// keep the closest page per document across all pages of the upload
+	phashRepo := repositories.NewPerceptualHashRepository(config.DB)
+	best := map[string]models.SimilarDocumentMatch{}
+	skipped := 0
+	for _, hash := range hashes {
+		if !utils.HashHasDetail(hash) {
+			skipped++
+			continue
+		}
+		matches, err := phashRepo.FindSimilar(hash, maxDistance, utils.MinHashDetail, limit)
+		if err != nil {
+			utils.HandleError(err, "Failed to search perceptual hashes", utils.Error)
+			return sendError(c, fiber.StatusInternalServerError, "document_search_failed")
+		}
+		for _, m := range matches {
+			if current, ok := best[m.DocumentID]; !ok || m.Distance < current.Distance {
+				best[m.DocumentID] = m
+			}
+		}
+	}
+
+	ranked := make([]models.SimilarDocumentMatch, 0, len(best))
+	for _, m := range best {
+		ranked = append(ranked, m)
+	}
+	sort.Slice(ranked, func(i, j int) bool {
+		if ranked[i].Distance != ranked[j].Distance {
+			return ranked[i].Distance < ranked[j].Distance
+		}
+		return ranked[i].DocumentID < ranked[j].DocumentID
+	})
+	if len(ranked) > limit {
+		ranked = ranked[:limit]
+	}
+
+	docRepo := repositories.NewDocumentRepository(config.DB)
+	results := make([]models.SimilarDocumentResponse, 0, len(ranked))
+	for _, m := range ranked {
+		doc, err := docRepo.FindWithRelations(m.DocumentID)
+		if err != nil {
+			utils.HandleError(err, fmt.Sprintf("Document not found: %s", m.DocumentID), utils.Warning)
+			continue
+		}
+		recordVerification(c, doc, models.VerificationMethodFile, models.VerificationResultSimilar)
+		results = append(results, models.SimilarDocumentResponse{
+			Document: models.BuildPublicVerificationResponse(doc, verificationVisibility(doc)),
+			Page:     m.Page,
+			Distance: m.Distance,
+		})
+	}
+
+	if len(results) == 0 {
+		recordVerification(c, nil, models.VerificationMethodFile, models.VerificationResultNoMatch)
+	}
+
+	return c.JSON(fiber.Map{
+		"matches": results,
+		"meta": fiber.Map{
+			"max_distance":  maxDistance,
+			"pages_hashed":  len(hashes),
+			"pages_skipped": skipped,
+		},
+	})
+}
+
+// verificationVisibility returns how much the public may see of doc: the
+// signing team's setting, or VERIFY_DEFAULT_VISIBILITY for documents signed
+// without a team.
+func verificationVisibility(doc *models.Document) string {
+	if doc.SignedByTeam != nil && models.ValidVerificationVisibility(doc.SignedByTeam.VerificationVisibility) {
+		return doc.SignedByTeam.VerificationVisibility
+	}
+	if v := os.Getenv("VERIFY_DEFAULT_VISIBILITY"); models.ValidVerificationVisibility(v) {
+		return v
+	}
+	return models.VerificationVisibilityName
+}
+
+// buildQRContent returns what the stamped QR code should encode. In the
+// default URL mode it returns an empty string so the stamp falls back to the
+// frontend verification link; in signed mode it returns a self-contained
+// payload signed with the QR key.
+func buildQRContent(id string, hash string, userID string) string {
+	if utils.QRMode() != utils.QRModeSigned {
+		return ""
+	}
+
+	key, err := QRPrivateKey()
+	if err != nil {
+		utils.HandleError(err, "QR signing key unavailable, falling back to URL mode", utils.Warning)
+		return ""
+	}
+
+	signer := ""
+	userRepo := repositories.NewUserRepository(config.DB)
+	if user, err := userRepo.FindByID(userID); err == nil {
+		signer = user.FullName
+	}
+
+	content, err := utils.EncodeSignedQRPayload(utils.QRPayload{
+		DocumentID: id,
+		Hash:       hash,
+		Signer:     signer,
+		SignedAt:   time.Now(),
+	}, key)
+	if err != nil {
+		utils.HandleError(err, "Failed to build signed QR payload, falling back to URL mode", utils.Warning)
+		return ""
+	}
+	return content
+}
+
+// VerifyQRPayloadHandler godoc
+// @Summary Decode a signed QR payload
+// @Description Checks the signature of a self-contained QR payload and compares it with the stored document
+// @Tags verify
+// @Accept json
+// @Produce json
+// @Param input body models.VerifyQRInput true "Scanned QR payload"
+// @Success 200 {object} models.VerifyQRResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /verify/qr [post]
+func VerifyQRPayloadHandler(c *fiber.Ctx) error {
+	var input models.VerifyQRInput
+	if err := c.BodyParser(&input); err != nil || input.Payload == "" {
+		return sendError(c, fiber.StatusBadRequest, "invalid_input")
+	}
+
+	pub, err := QRPublicKey()
+	if err != nil {
+		return sendError(c, fiber.StatusInternalServerError, "qr_verification_key_unavailable")
+	}
+
+	payload, err := utils.DecodeSignedQRPayload(strings.TrimSpace(input.Payload), pub)
+	if err != nil {
+		utils.HandleError(err, "Rejected QR payload", utils.Info)
+		recordVerification(c, nil, models.VerificationMethodQR, models.VerificationResultInvalidSignature)
+		return c.JSON(models.VerifyQRResponse{Valid: false, Reason: err.Error()})
+	}
+
+	resp := models.VerifyQRResponse{
+		Valid:      true,
+		DocumentID: payload.DocumentID,
+		Hash:       payload.Hash,
+		Signer:     payload.Signer,
+		SignedAt:   payload.SignedAt.Format("2006-01-02"),
+	}
+
+	docRepo := repositories.NewDocumentRepository(config.DB)
+	if doc, err := docRepo.FindWithRelations(payload.DocumentID); err == nil {
+		resp.Registered = true
+		resp.HashMatches = strings.HasPrefix(doc.Hash, payload.Hash)
+		result := models.VerificationResultValid
+		if !resp.HashMatches {
+			result = models.VerificationResultHashMismatch
+		}
+		recordVerification(c, doc, models.VerificationMethodQR, result)
+	} else if doc, err := docRepo.FindDeletedWithRelations(payload.DocumentID); err == nil {
+		resp.Registered = true
+		resp.HashMatches = strings.HasPrefix(doc.Hash, payload.Hash)
+		resp.Withdrawn = true
+		recordVerification(c, doc, models.VerificationMethodQR, models.VerificationResultWithdrawn)
+	} else {
+		recordVerification(c, nil, models.VerificationMethodQR, models.VerificationResultNotFound)
+	}
+
+	return c.JSON(resp)
+}
+
+// GetQRPublicKeyHandler godoc
+// @Summary Get QR public key
+// @Description Returns the PEM encoded Ed25519 public key used to check signed QR payloads offline
+// @Tags verify
+// @Produce plain
+// @Success 200 {string} string "PEM public key"
+// @Failure 500 {object} models.ErrorResponse
+// @Router /verify/qr/public-key [get]
+func GetQRPublicKeyHandler(c *fiber.Ctx) error {
+	keyBytes, err := os.ReadFile(os.Getenv("QR_PUBLIC_KEY_PATH"))
+	if err != nil {
+		utils.HandleError(err, "Failed to read QR public key", utils.Error)
+		return sendError(c, fiber.StatusInternalServerError, "qr_public_key_unavailable")
+	}
+
+	c.Set(fiber.HeaderContentType, "application/x-pem-file")
+	return c.Send(keyBytes)
+}
@@ -0,0 +1,851 @@
+// WebhookController
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"tawtheeq-backend/config"
+	"tawtheeq-backend/i18n"
+	"tawtheeq-backend/models"
+	"tawtheeq-backend/repositories"
+	"tawtheeq-backend/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+const (
+	webhookBatchSize     = 20
+	webhookBackoffBase   = 30 * time.Second
+	webhookBackoffMax    = 12 * time.Hour
+	webhookResponseLimit = 1024
+	webhookResolveLimit  = 5 * time.Second
+
+	webhookEventHeader     = "X-Tawtheeq-Event"
+	webhookDeliveryHeader  = "X-Tawtheeq-Delivery"
+	webhookSignatureHeader = "X-Tawtheeq-Signature"
+)
+
+// queuedWebhookEvent is an event waiting to be fanned out to subscriptions,
+// with its already encoded body.
+type queuedWebhookEvent struct {
+	event   models.WebhookEvent
+	payload []byte
+}
+
+// webhookEvents buffers emitted events so requests never wait for the
+// subscription lookup; webhookWake tells the sender that deliveries are due.
+var (
+	webhookEvents = make(chan queuedWebhookEvent, 1024)
+	webhookWake   = make(chan struct{}, 1)
+)
+
+// webhookTransport only connects to public addresses and ignores proxy
+// settings, so subscriptions cannot reach internal services.
+var webhookTransport = &http.Transport{
+	DialContext: (&net.Dialer{
+		Timeout: 10 * time.Second,
+		Control: utils.WebhookDialControl,
+	}).DialContext,
+	ForceAttemptHTTP2:   true,
+	MaxIdleConns:        20,
+	IdleConnTimeout:     90 * time.Second,
+	TLSHandshakeTimeout: 10 * time.Second,
+}
+
+// webhookMaxAttempts returns how often a delivery is tried before it is
+// marked failed, from WEBHOOK_MAX_ATTEMPTS (default 8).
+func webhookMaxAttempts() int {
+	attempts, err := strconv.Atoi(os.Getenv("WEBHOOK_MAX_ATTEMPTS"))
+	if err != nil || attempts <= 0 {
+		attempts = 8
+	}
+	return attempts
+}
+
+// webhookTimeout returns how long a subscriber has to answer, from
+// WEBHOOK_TIMEOUT_SECONDS (default 10).
+func webhookTimeout() time.Duration {
+	sec, err := strconv.Atoi(os.Getenv("WEBHOOK_TIMEOUT_SECONDS"))
+	if err != nil || sec <= 0 {
+		sec = 10
+	}
+	return time.Duration(sec) * time.Second
+}
+
+// webhookDeliveryRetention returns how long finished deliveries are logged,
+// from WEBHOOK_DELIVERY_RETENTION_DAYS (default 30).
+func webhookDeliveryRetention() time.Duration {
+	days, err := strconv.Atoi(os.Getenv("WEBHOOK_DELIVERY_RETENTION_DAYS"))
+	if err != nil || days <= 0 {
+		days = 30
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// webhookBackoff returns the wait before the attempt after attempts failed
+// ones: 30s, 1m, 2m, ... up to 12h.
+func webhookBackoff(attempts int) time.Duration {
+	wait := webhookBackoffBase
+	for i := 1; i < attempts && wait < webhookBackoffMax; i++ {
+		wait *= 2
+	}
+	if wait > webhookBackoffMax {
+		wait = webhookBackoffMax
+	}
+	return wait
+}
+
+func wakeWebhookSender() {
+	select {
+	case webhookWake <- struct{}{}:
+	default:
+	}
+}
+
+// emitWebhook queues an event for the global subscriptions and, when teamID
+// is set, the team's own. data is encoded right away, so it may hold request
+// values.
+func emitWebhook(eventType string, teamID *string, data interface{}) {
+	event := models.WebhookEvent{
+		ID:        uuid.New().String(),
+		Type:      eventType,
+		CreatedAt: time.Now(),
+		Data:      data,
+	}
+	if teamID != nil && *teamID != "" {
+		id := strings.Clone(*teamID)
+		event.TeamID = &id
+	}
+	payload, err := json.Marshal(event)
+	if err != nil {
+		utils.HandleError(err, fmt.Sprintf("Failed to encode webhook event %s", eventType), utils.Error)
+		return
+	}
+	event.Data = nil
+
+	select {
+	case webhookEvents <- queuedWebhookEvent{event: event, payload: payload}:
+	default:
+		utils.HandleError(fmt.Errorf("webhook event queue full"), fmt.Sprintf("Dropped webhook event %s", eventType), utils.Warning)
+	}
+}
+
+// webhookDocument is the part of a document sent in webhook events.
+func webhookDocument(doc *models.Document) fiber.Map {
+	return fiber.Map{
+		"id":                doc.ID,
+		"original_name":     doc.OriginalName,
+		"title":             doc.Title,
+		"reference_number":  doc.ReferenceNumber,
+		"file_format":       doc.FileFormat,
+		"hash":              doc.Hash,
+		"is_hidden":         doc.IsHidden,
+		"signed_by_user_id": doc.SignedByUserID,
+		"signed_by_team_id": doc.SignedByTeamID,
+		"signed_at":         doc.CreatedAt,
+	}
+}
+
+// emitDocumentWebhook queues eventType for a document that is still active.
+func emitDocumentWebhook(eventType string, doc *models.Document) {
+	emitWebhook(eventType, doc.SignedByTeamID, fiber.Map{"document": webhookDocument(doc)})
+}
+
+// emitDocumentWebhookByID loads document id and queues eventType for it if
+// check accepts the loaded document, so no event is sent when the change
+// did not apply.
+func emitDocumentWebhookByID(eventType string, id string, check func(*models.Document) bool) {
+	doc, err := repositories.NewDocumentRepository(config.DB).FindByID(id)
+	if err != nil {
+		utils.HandleError(err, fmt.Sprintf("Failed to load document %s for webhook %s", id, eventType), utils.Warning)
+		return
+	}
+	if check(doc) {
+		emitDocumentWebhook(eventType, doc)
+	}
+}
+
+// webhookUser is the part of a user sent in webhook events.
+func webhookUser(user *models.User) fiber.Map {
+	snapshot := userAuditSnapshot(user)
+	snapshot["id"] = user.ID
+	return snapshot
+}
+
+// webhookUserTeam returns the team of userID, so its subscriptions receive
+// the user's events.
+func webhookUserTeam(userID string) *string {
+	team, err := repositories.NewTeamRepository(config.DB).FindTeamByMemberId(userID)
+	if err != nil || team == nil {
+		return nil
+	}
+	return &team.ID
+}
+
+// emitUserWebhook queues eventType for user, with the changed values when
+// there are some.
+func emitUserWebhook(eventType string, user *models.User, before interface{}, after interface{}) {
+	data := fiber.Map{"user": webhookUser(user)}
+	if before != nil || after != nil {
+		data["changes"] = fiber.Map{"before": before, "after": after}
+	}
+	emitWebhook(eventType, webhookUserTeam(user.ID), data)
+}
+
+// emitTeamWebhook queues eventType for team, with the changed values when
+// there are some.
+func emitTeamWebhook(eventType string, team *models.Team, before interface{}, after interface{}) {
+	snapshot := teamAuditSnapshot(team)
+	snapshot["id"] = team.ID
+	data := fiber.Map{"team": snapshot}
+	if before != nil || after != nil {
+		data["changes"] = fiber.Map{"before": before, "after": after}
+	}
+	emitWebhook(eventType, &team.ID, data)
+}
+
+// emitTeamMemberWebhook queues a membership event of teamID.
+func emitTeamMemberWebhook(eventType string, teamID string, userID string) {
+	emitWebhook(eventType, &teamID, fiber.Map{"team_id": teamID, "user_id": userID})
+}
+
+// StartWebhookDispatcher fans emitted events out to the matching
+// subscriptions and sends due deliveries, retrying failures with
+// exponential backoff. Finished deliveries are pruned every hour.
+func StartWebhookDispatcher() {
+	go func() {
+		for queued := range webhookEvents {
+			fanOutWebhookEvent(queued)
+		}
+	}()
+
+	go func() {
+		ticker := time.NewTicker(5 * time.Second)
+		defer ticker.Stop()
+		prune := time.NewTicker(time.Hour)
+		defer prune.Stop()
+
+		pruneWebhookDeliveries()
+		for {
+			sendDueWebhooks()
+			select {
+			case <-webhookWake:
+			case <-ticker.C:
+			case <-prune.C:
+				pruneWebhookDeliveries()
+			}
+		}
+	}()
+}
+
+func fanOutWebhookEvent(queued queuedWebhookEvent) {
+	webhookRepo := repositories.NewWebhookRepository(config.DB)
+	subs, err := webhookRepo.FindActiveFor(queued.event.TeamID)
+	if err != nil {
+		utils.HandleError(err, fmt.Sprintf("Failed to find subscriptions for webhook event %s", queued.event.ID), utils.Error)
+		return
+	}
+
+	now := time.Now()
+	var deliveries []models.WebhookDelivery
+	for _, sub := range subs {
+		if !sub.EventTypes.Matches(queued.event.Type) {
+			continue
+		}
+		deliveries = append(deliveries, models.WebhookDelivery{
+			SubscriptionID: sub.ID,
+			EventID:        queued.event.ID,
+			EventType:      queued.event.Type,
+			Payload:        string(queued.payload),
+			Status:         models.WebhookDeliveryPending,
+			NextAttemptAt:  &now,
+		})
+	}
+	if err := webhookRepo.CreateDeliveries(deliveries); err != nil {
+		utils.HandleError(err, fmt.Sprintf("Failed to queue deliveries of webhook event %s", queued.event.ID), utils.Error)
+		return
+	}
+	if len(deliveries) > 0 {
+		wakeWebhookSender()
+	}
+}
+
+// sendDueWebhooks sends due deliveries in batches, each batch in parallel.
+func sendDueWebhooks() {
+	webhookRepo := repositories.NewWebhookRepository(config.DB)
+	for {
+		due, err := webhookRepo.FindDue(time.Now(), webhookBatchSize)
+		if err != nil {
+			utils.HandleError(err, "Failed to find due webhook deliveries", utils.Error)
+			return
+		}
+
+		var wg sync.WaitGroup
+		for i := range due {
+			wg.Add(1)
+			go func(delivery *models.WebhookDelivery) {
+				defer wg.Done()
+				attemptWebhookDelivery(delivery)
+			}(&due[i])
+		}
+		wg.Wait()
+
+		if len(due) < webhookBatchSize {
+			return
+		}
+	}
+}
+
+// attemptWebhookDelivery sends a delivery once and schedules the next
+// attempt when it fails.
+func attemptWebhookDelivery(delivery *models.WebhookDelivery) {
+	webhookRepo := repositories.NewWebhookRepository(config.DB)
+	timeout := webhookTimeout()
+	claimed, err := webhookRepo.Claim(delivery, time.Now().Add(2*timeout))
+	if err != nil {
+		utils.HandleError(err, fmt.Sprintf("Failed to claim webhook delivery %s", delivery.ID), utils.Error)
+		return
+	}
+	if !claimed || delivery.Subscription == nil {
+		return
+	}
+
+	started := time.Now()
+	status, err := postWebhook(delivery.Subscription, delivery, timeout)
+	now := time.Now()
+	delivery.Attempts++
+	delivery.ResponseStatus = status
+	delivery.DurationMs = now.Sub(started).Milliseconds()
+	delivery.Error = ""
+	switch {
+	case err == nil && status >= 200 && status < 300:
+		delivery.Status = models.WebhookDeliverySucceeded
+		delivery.DeliveredAt = &now
+		delivery.NextAttemptAt = nil
+	default:
+		if err != nil {
+			delivery.Error = err.Error()
+		} else {
+			delivery.Error = fmt.Sprintf("subscriber answered %d", status)
+		}
+		if delivery.Attempts >= webhookMaxAttempts() {
+			delivery.Status = models.WebhookDeliveryFailed
+			delivery.NextAttemptAt = nil
+		} else {
+			next := now.Add(webhookBackoff(delivery.Attempts))
+			delivery.NextAttemptAt = &next
+		}
+	}
+
+	if err := webhookRepo.UpdateDelivery(delivery); err != nil {
+		utils.HandleError(err, fmt.Sprintf("Failed to save webhook delivery %s", delivery.ID), utils.Error)
+	}
+}
+
+// postWebhook posts the delivery payload to the subscription URL, signed
+// with its secret, and returns the status code. Redirects are not followed
+// and the response body is discarded, so the delivery log cannot be used to
+// read what a URL answers.
+func postWebhook(sub *models.WebhookSubscription, delivery *models.WebhookDelivery, timeout time.Duration) (int, error) {
+	payload := []byte(delivery.Payload)
+	req, err := http.NewRequest(http.MethodPost, sub.URL, bytes.NewReader(payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	req.Header.Set(fiber.HeaderUserAgent, "Tawtheeq-Webhooks/1.0")
+	req.Header.Set(webhookEventHeader, delivery.EventType)
+	req.Header.Set(webhookDeliveryHeader, delivery.ID)
+	req.Header.Set(webhookSignatureHeader, utils.SignWebhookPayload(sub.Secret, time.Now().Unix(), payload))
+
+	client := &http.Client{
+		Timeout:   timeout,
+		Transport: webhookTransport,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	// drain a little so the connection can be reused
+	io.Copy(io.Discard, io.LimitReader(resp.Body, webhookResponseLimit))
+	return resp.StatusCode, nil
+}
+
+func pruneWebhookDeliveries() {
+	webhookRepo := repositories.NewWebhookRepository(config.DB)
+	if _, err := webhookRepo.DeleteDeliveriesBefore(time.Now().Add(-webhookDeliveryRetention())); err != nil {
+		utils.HandleError(err, "Failed to prune webhook deliveries", utils.Warning)
+	}
+}
+
+// canManageWebhook reports whether the caller may see and change the
+// subscription. Super admins manage every subscription, team leaders only
+// their team's.
+func canManageWebhook(c *fiber.Ctx, sub *models.WebhookSubscription) bool {
+	role, _ := c.Locals("userRole").(string)
+	if role == string(models.SuperAdminRole) {
+		return true
+	}
+	teamID, _ := c.Locals("teamId").(string)
+	return role == string(models.TeamLeaderRole) && sub.TeamID != nil && *sub.TeamID == teamID
+}
+
+// findWebhook returns the subscription in the id route parameter, or nil
+// after answering the request when it is missing or not the caller's.
+func findWebhook(c *fiber.Ctx) (*models.WebhookSubscription, error) {
+	id := c.Params("id")
+	webhookRepo := repositories.NewWebhookRepository(config.DB)
+	sub, err := webhookRepo.FindSubscriptionByID(id)
+	if err != nil || !canManageWebhook(c, sub) {
+		if err != nil {
+			utils.HandleError(err, fmt.Sprintf("Webhook subscription not found: %s", id), utils.Warning)
+		}
+		return nil, sendError(c, fiber.StatusNotFound, "webhook_not_found")
+	}
+	return sub, nil
+}
+
+// applyWebhookInput validates input and copies the given fields onto sub.
+func applyWebhookInput(sub *models.WebhookSubscription, input *models.WebhookSubscriptionInput) error {
+	if input.URL != nil {
+		u, err := url.Parse(strings.TrimSpace(*input.URL))
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+			return i18n.Errorf("invalid_webhook_url")
+		}
+		// checked again on every connection, this only rejects obvious cases early
+		ctx, cancel := context.WithTimeout(context.Background(), webhookResolveLimit)
+		err = utils.CheckWebhookHost(ctx, u.Hostname())
+		cancel()
+		if err != nil {
+			return i18n.Errorf("webhook_url_not_allowed")
+		}
+		sub.URL = u.String()
+	}
+	if input.EventTypes != nil {
+		types := models.WebhookEventTypes{}
+		seen := map[string]bool{}
+		for _, t := range *input.EventTypes {
+			t = strings.TrimSpace(t)
+			if !models.ValidWebhookEvent(t) {
+				return i18n.Errorf("unknown_event_type", t)
+			}
+			if !seen[t] {
+				seen[t] = true
+				types = append(types, t)
+			}
+		}
+		sub.EventTypes = types
+	}
+	if input.Description != nil {
+		sub.Description = strings.TrimSpace(*input.Description)
+		if len(sub.Description) > 255 {
+			return i18n.Errorf("webhook_description_too_long")
+		}
+	}
+	if input.Active != nil {
+		sub.Active = *input.Active
+	}
+	if sub.URL == "" {
+		return i18n.Errorf("webhook_url_required")
+	}
+	return nil
+}
+
+// webhookAuditSnapshot is the part of a subscription recorded in audit
+// events.
+func webhookAuditSnapshot(sub *models.WebhookSubscription) fiber.Map {
+	return fiber.Map{"url": sub.URL, "team_id": sub.TeamID, "event_types": sub.EventTypes, "active": sub.Active}
+}
+
+// GetWebhookEventTypes godoc
+// @Summary Webhook event types
+// @Description Lists the event types subscriptions can filter on
+// @Tags webhooks
+// @Produce json
+// @Success 200 {array} string
+// @Router /webhooks/events [get]
+// @Security Bearer
+func GetWebhookEventTypes(c *fiber.Ctx) error {
+	return c.JSON(models.WebhookEvents)
+}
+
+// GetWebhooks godoc
+// @Summary List webhook subscriptions
+// @Description Super admins see every subscription (or one team's with team_id); team leaders see their team's
+// @Tags webhooks
+// @Produce json
+// @Param team_id query string false "Team ID (super admins)"
+// @Param limit query int false "Limit" default(10)
+// @Param page query int false "Page" default(1)
+// @Param cursor query string false "meta.next_cursor of the previous page"
+// @Success 200 {object} models.ListResponse{data=[]models.WebhookSubscription}
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /webhooks [get]
+// @Security Bearer
+func GetWebhooks(c *fiber.Ctx) error {
+	p, err := paginationFromQuery(c, models.DefaultPageSize)
+	if err != nil {
+		return sendErrorFrom(c, fiber.StatusBadRequest, err)
+	}
+
+	role, _ := c.Locals("userRole").(string)
+	teamID := c.Query("team_id")
+	if role != string(models.SuperAdminRole) {
+		teamID, _ = c.Locals("teamId").(string)
+		if teamID == "" {
+			return sendError(c, fiber.StatusBadRequest, "not_in_team")
+		}
+	}
+
+	webhookRepo := repositories.NewWebhookRepository(config.DB)
+	subs, total, err := webhookRepo.FindSubscriptions(teamID, p)
+	if err != nil {
+		utils.HandleError(err, "Failed to fetch webhook subscriptions", utils.Error)
+		return sendError(c, fiber.StatusInternalServerError, "webhooks_fetch_failed")
+	}
+
+	return sendList(c, subs, p, total, nextCursor(p, subs, func(s models.WebhookSubscription) models.Cursor {
+		return models.Cursor{Time: s.CreatedAt, ID: s.ID}
+	}))
+}
+
+// GetWebhook godoc
+// @Summary Get webhook subscription
+// @Tags webhooks
+// @Produce json
+// @Param id path string true "Subscription ID"
+// @Success 200 {object} models.WebhookSubscription
+// @Failure 404 {object} models.ErrorResponse
+// @Router /webhooks/{id} [get]
+// @Security Bearer
+func GetWebhook(c *fiber.Ctx) error {
+	sub, err := findWebhook(c)
+	if sub == nil {
+		return err
+	}
+	return c.JSON(sub)
+}
+
+// CreateWebhook godoc
+// @Summary Create webhook subscription
+// @Description Subscribe a URL to events. Team leaders subscribe to their own team's events; super admins may set team_id or leave it empty to receive every event. An empty event_types receives all events. The signing secret is only returned here and when it is rotated
+// @Tags webhooks
+// @Accept json
+// @Produce json
+// @Param input body models.WebhookSubscriptionInput true "Subscription"
+// @Success 201 {object} models.WebhookSecretResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /webhooks [post]
+// @Security Bearer
+func CreateWebhook(c *fiber.Ctx) error {
+	input := new(models.WebhookSubscriptionInput)
+	if err := c.BodyParser(input); err != nil {
+		utils.HandleError(err, "Failed to parse request body", utils.Error)
+		return sendError(c, fiber.StatusBadRequest, "invalid_input")
+	}
+
+	role, _ := c.Locals("userRole").(string)
+	userID, _ := c.Locals("userID").(string)
+	sub := &models.WebhookSubscription{Active: true, CreatedByUserID: userID}
+	if role == string(models.SuperAdminRole) {
+		if input.TeamID != nil && *input.TeamID != "" {
+			if _, err := repositories.NewTeamRepository(config.DB).FindByID(*input.TeamID); err != nil {
+				return sendError(c, fiber.StatusBadRequest, "team_not_found")
+			}
+			sub.TeamID = input.TeamID
+		}
+	} else {
+		myTeamID, _ := c.Locals("teamId").(string)
+		if myTeamID == "" {
+			return sendError(c, fiber.StatusBadRequest, "not_in_team")
+		}
+		sub.TeamID = &myTeamID
+	}
+	if err := applyWebhookInput(sub, input); err != nil {
+		return sendErrorFrom(c, fiber.StatusBadRequest, err)
+	}
+
+	secret, err := utils.GenerateWebhookSecret()
+	if err != nil {
+		utils.HandleError(err, "Failed to generate webhook secret", utils.Error)
+		return sendError(c, fiber.StatusInternalServerError, "webhook_create_failed")
+	}
+	sub.Secret = secret
+
+	webhookRepo := repositories.NewWebhookRepository(config.DB)
+	if err := webhookRepo.CreateSubscription(sub); err != nil {
+		utils.HandleError(err, "Failed to create webhook subscription", utils.Error)
+		return sendError(c, fiber.StatusInternalServerError, "webhook_create_failed")
+	}
+	recordAudit(c, "webhook.create", models.AuditTargetWebhook, sub.ID, nil, webhookAuditSnapshot(sub))
+
+	return c.Status(fiber.StatusCreated).JSON(models.WebhookSecretResponse{WebhookSubscription: *sub, Secret: sub.Secret})
+}
+
+// UpdateWebhook godoc
+// @Summary Update webhook subscription
+// @Description Change the URL, event filter, description or active flag; omitted fields are kept. Deliveries of a disabled subscription wait until it is enabled again
+// @Tags webhooks
+// @Accept json
+// @Produce json
+// @Param id path string true "Subscription ID"
+// @Param input body models.WebhookSubscriptionInput true "Subscription"
+// @Success 200 {object} models.WebhookSubscription
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /webhooks/{id} [put]
+// @Security Bearer
+func UpdateWebhook(c *fiber.Ctx) error {
+	sub, err := findWebhook(c)
+	if sub == nil {
+		return err
+	}
+
+	input := new(models.WebhookSubscriptionInput)
+	if err := c.BodyParser(input); err != nil {
+		utils.HandleError(err, "Failed to parse request body", utils.Error)
+		return sendError(c, fiber.StatusBadRequest, "invalid_input")
+	}
+	before := webhookAuditSnapshot(sub)
+	if err := applyWebhookInput(sub, input); err != nil {
+		return sendErrorFrom(c, fiber.StatusBadRequest, err)
+	}
+
+	webhookRepo := repositories.NewWebhookRepository(config.DB)
+	if err := webhookRepo.UpdateSubscription(sub); err != nil {
+		utils.HandleError(err, fmt.Sprintf("Failed to update webhook subscription %s", sub.ID), utils.Error)
+		return sendError(c, fiber.StatusInternalServerError, "webhook_update_failed")
+	}
+	recordAudit(c, "webhook.update", models.AuditTargetWebhook, sub.ID, before, webhookAuditSnapshot(sub))
+	if sub.Active {
+		wakeWebhookSender()
+	}
+
+	return c.JSON(sub)
+}
+
+// RotateWebhookSecret godoc
+// @Summary Rotate webhook secret
+// @Description Replace the signing secret. Deliveries sent from now on, including retries, are signed with the new secret
+// @Tags webhooks
+// @Produce json
+// @Param id path string true "Subscription ID"
+// @Success 200 {object} models.WebhookSecretResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /webhooks/{id}/secret [post]
+// @Security Bearer
+func RotateWebhookSecret(c *fiber.Ctx) error {
+	sub, err := findWebhook(c)
+	if sub == nil {
+		return err
+	}
+
+	secret, err := utils.GenerateWebhookSecret()
+	if err != nil {
+		utils.HandleError(err, "Failed to generate webhook secret", utils.Error)
+		return sendError(c, fiber.StatusInternalServerError, "webhook_secret_rotate_failed")
+	}
+	sub.Secret = secret
+
+	webhookRepo := repositories.NewWebhookRepository(config.DB)
+	if err := webhookRepo.UpdateSubscription(sub); err != nil {
+		utils.HandleError(err, fmt.Sprintf("Failed to rotate secret of webhook subscription %s", sub.ID), utils.Error)
+		return sendError(c, fiber.StatusInternalServerError, "webhook_secret_rotate_failed")
+	}
+	recordAudit(c, "webhook.secret_rotate", models.AuditTargetWebhook, sub.ID, nil, nil)
+
+	return c.JSON(models.WebhookSecretResponse{WebhookSubscription: *sub, Secret: sub.Secret})
+}
+
+// RemoveWebhook godoc
+// @Summary Remove webhook subscription
+// @Description Delete a subscription and its delivery log
+// @Tags webhooks
+// @Produce json
+// @Param id path string true "Subscription ID"
+// @Success 200 {object} models.SuccessResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /webhooks/{id}/remove [delete]
+// @Security Bearer
+func RemoveWebhook(c *fiber.Ctx) error {
+	sub, err := findWebhook(c)
+	if sub == nil {
+		return err
+	}
+
+	webhookRepo := repositories.NewWebhookRepository(config.DB)
+	if err := webhookRepo.DeleteSubscription(sub.ID); err != nil {
+		utils.HandleError(err, fmt.Sprintf("Failed to delete webhook subscription %s", sub.ID), utils.Error)
+		return sendError(c, fiber.StatusInternalServerError, "webhook_delete_failed")
+	}
+	recordAudit(c, "webhook.remove", models.AuditTargetWebhook, sub.ID, webhookAuditSnapshot(sub), nil)
+
+	return c.JSON(fiber.Map{"message": localize(c, "webhook_deleted")})
+}
+
+// PingWebhook godoc
+// @Summary Ping webhook subscription
+// @Description Queue a webhook.ping event for this subscription only, to test the endpoint and signature check
+// @Tags webhooks
+// @Produce json
+// @Param id path string true "Subscription ID"
+// @Success 202 {object} models.WebhookDelivery
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /webhooks/{id}/ping [post]
+// @Security Bearer
+func PingWebhook(c *fiber.Ctx) error {
+	sub, err := findWebhook(c)
+	if sub == nil {
+		return err
+	}
+	if !sub.Active {
+		return sendError(c, fiber.StatusConflict, "webhook_disabled")
+	}
+
+	event := models.WebhookEvent{
+		ID:        uuid.New().String(),
+		Type:      models.WebhookEventPing,
+		TeamID:    sub.TeamID,
+		CreatedAt: time.Now(),
+		Data:      fiber.Map{"subscription_id": sub.ID},
+	}
+	payload, err := json.Marshal(event)
+	if err != nil {
+		utils.HandleError(err, "Failed to encode webhook ping", utils.Error)
+		return sendError(c, fiber.StatusInternalServerError, "webhook_ping_failed")
+	}
+
+	now := time.Now()
+	delivery := models.WebhookDelivery{
+		SubscriptionID: sub.ID,
+		EventID:        event.ID,
+		EventType:      event.Type,
+		Payload:        string(payload),
+		Status:         models.WebhookDeliveryPending,
+		NextAttemptAt:  &now,
+	}
+	webhookRepo := repositories.NewWebhookRepository(config.DB)
+	if err := webhookRepo.CreateDelivery(&delivery); err != nil {
+		utils.HandleError(err, fmt.Sprintf("Failed to queue ping for webhook subscription %s", sub.ID), utils.Error)
+		return sendError(c, fiber.StatusInternalServerError, "webhook_ping_failed")
+	}
+	wakeWebhookSender()
+
+	return c.Status(fiber.StatusAccepted).JSON(delivery)
+}
+
+// GetWebhookDeliveries godoc
+// @Summary Webhook delivery log
+// @Description Lists the deliveries of a subscription, newest first, with the outcome of their last attempt
+// @Tags webhooks
+// @Produce json
+// @Param id path string true "Subscription ID"
+// @Param status query string false "pending, succeeded or failed"
+// @Param limit query int false "Limit" default(20)
+// @Param page query int false "Page" default(1)
+// @Param cursor query string false "meta.next_cursor of the previous page"
+// @Success 200 {object} models.ListResponse{data=[]models.WebhookDelivery}
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /webhooks/{id}/deliveries [get]
+// @Security Bearer
+func GetWebhookDeliveries(c *fiber.Ctx) error {
+	sub, err := findWebhook(c)
+	if sub == nil {
+		return err
+	}
+
+	status := c.Query("status")
+	switch status {
+	case "", models.WebhookDeliveryPending, models.WebhookDeliverySucceeded, models.WebhookDeliveryFailed:
+	default:
+		return sendError(c, fiber.StatusBadRequest, "invalid_webhook_status")
+	}
+	p, err := paginationFromQuery(c, 20)
+	if err != nil {
+		return sendErrorFrom(c, fiber.StatusBadRequest, err)
+	}
+
+	webhookRepo := repositories.NewWebhookRepository(config.DB)
+	deliveries, total, err := webhookRepo.FindDeliveries(sub.ID, status, p)
+	if err != nil {
+		utils.HandleError(err, fmt.Sprintf("Failed to fetch deliveries of webhook subscription %s", sub.ID), utils.Error)
+		return sendError(c, fiber.StatusInternalServerError, "webhook_deliveries_fetch_failed")
+	}
+
+	return sendList(c, deliveries, p, total, nextCursor(p, deliveries, func(d models.WebhookDelivery) models.Cursor {
+		return models.Cursor{Time: d.CreatedAt, ID: d.ID}
+	}))
+}
+
+// RedeliverWebhook godoc
+// @Summary Redeliver webhook
+// @Description Queue the payload of a past delivery again as a new delivery, keeping the same event ID so receivers can de-duplicate
+// @Tags webhooks
+// @Produce json
+// @Param id path string true "Subscription ID"
+// @Param delivery_id path string true "Delivery ID"
+// @Success 202 {object} models.WebhookDelivery
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /webhooks/{id}/deliveries/{delivery_id}/redeliver [post]
+// @Security Bearer
+func RedeliverWebhook(c *fiber.Ctx) error {
+	sub, err := findWebhook(c)
+	if sub == nil {
+		return err
+	}
+
+	deliveryID := c.Params("delivery_id")
+	webhookRepo := repositories.NewWebhookRepository(config.DB)
+	original, err := webhookRepo.FindDeliveryByID(sub.ID, deliveryID)
+	if err != nil {
+		utils.HandleError(err, fmt.Sprintf("Webhook delivery not found: %s", deliveryID), utils.Warning)
+		return sendError(c, fiber.StatusNotFound, "webhook_delivery_not_found")
+	}
+
+	now := time.Now()
+	delivery := models.WebhookDelivery{
+		SubscriptionID: sub.ID,
+		EventID:        original.EventID,
+		EventType:      original.EventType,
+		Payload:        original.Payload,
+		Status:         models.WebhookDeliveryPending,
+		RedeliveryOf:   &original.ID,
+		NextAttemptAt:  &now,
+	}
+	if err := webhookRepo.CreateDelivery(&delivery); err != nil {
+		utils.HandleError(err, fmt.Sprintf("Failed to redeliver webhook delivery %s", original.ID), utils.Error)
+		return sendError(c, fiber.StatusInternalServerError, "webhook_redeliver_failed")
+	}
+	recordAudit(c, "webhook.redeliver", models.AuditTargetWebhook, sub.ID, nil, fiber.Map{"delivery_id": original.ID})
+	wakeWebhookSender()
+
+	return c.Status(fiber.StatusAccepted).JSON(delivery)
+}
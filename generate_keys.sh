@@ -22,3 +22,33 @@ else
   echo "✅ Public key already exists"
 fi
 
+
+QR_PRIVATE_KEY_PATH="assets/keys/qr_private.pem"
+QR_PUBLIC_KEY_PATH="assets/keys/qr_public.pem"
+
+# Generate Ed25519 key pair for signed QR payloads if not exists
+if [ ! -f "$QR_PRIVATE_KEY_PATH" ]; then
+  echo "🔐 Generating Ed25519 QR private key..."
+  openssl genpkey -algorithm ED25519 -out "$QR_PRIVATE_KEY_PATH"
+else
+  echo "✅ QR private key already exists"
+fi
+
+if [ ! -f "$QR_PUBLIC_KEY_PATH" ]; then
+  echo "📤 Generating Ed25519 QR public key..."
+  openssl pkey -pubout -in "$QR_PRIVATE_KEY_PATH" -out "$QR_PUBLIC_KEY_PATH"
+else
+  echo "✅ QR public key already exists"
+fi
+
+
+STORAGE_MASTER_KEY_PATH="assets/keys/storage_master.key"
+
+# Generate the master key that wraps per-file encryption keys if not exists
+if [ ! -f "$STORAGE_MASTER_KEY_PATH" ]; then
+  echo "🔐 Generating storage master key..."
+  openssl rand -base64 32 > "$STORAGE_MASTER_KEY_PATH"
+  chmod 600 "$STORAGE_MASTER_KEY_PATH"
+else
+  echo "✅ Storage master key already exists"
+fi
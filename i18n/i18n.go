@@ -0,0 +1,143 @@
+// Package i18n holds the catalog of API messages. Every message has a stable
+// code clients can switch on and a translation per language, in
+// locales/<language>.json.
+package i18n
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// fallback is the language of messages missing from a catalog.
+const fallback = "en"
+
+//go:embed locales/*.json
+var localeFS embed.FS
+
+// catalogs maps language and then code to its message, a format string for
+// the message arguments.
+var catalogs = loadCatalogs()
+
+func loadCatalogs() map[string]map[string]string {
+	catalogs := map[string]map[string]string{}
+	files, err := fs.Glob(localeFS, "locales/*.json")
+	if err != nil {
+		panic(err)
+	}
+	for _, file := range files {
+		data, err := localeFS.ReadFile(file)
+		if err != nil {
+			panic(err)
+		}
+		messages := map[string]string{}
+		if err := json.Unmarshal(data, &messages); err != nil {
+			panic(fmt.Sprintf("i18n: %s: %v", file, err))
+		}
+		catalogs[strings.TrimSuffix(path.Base(file), ".json")] = messages
+	}
+	return catalogs
+}
+
+// Languages returns the languages messages exist in.
+func Languages() []string {
+	langs := make([]string, 0, len(catalogs))
+	for lang := range catalogs {
+		langs = append(langs, lang)
+	}
+	sort.Strings(langs)
+	return langs
+}
+
+// Supported reports whether messages exist in lang.
+func Supported(lang string) bool {
+	_, ok := catalogs[lang]
+	return ok
+}
+
+// DefaultLanguage returns the language of requests that ask for none we
+// have, from DEFAULT_LANGUAGE (default en).
+func DefaultLanguage() string {
+	if lang := os.Getenv("DEFAULT_LANGUAGE"); Supported(lang) {
+		return lang
+	}
+	return fallback
+}
+
+// Message returns the message for code in lang, filled in with args. Codes
+// missing from lang are looked up in English, and unknown codes are returned
+// as they are. Arguments that are coded errors are translated as well.
+func Message(lang string, code string, args ...interface{}) string {
+	format, ok := catalogs[lang][code]
+	if !ok {
+		if format, ok = catalogs[fallback][code]; !ok {
+			return code
+		}
+	}
+	if len(args) == 0 {
+		return format
+	}
+	localized := make([]interface{}, len(args))
+	for i, arg := range args {
+		if e, ok := arg.(*Error); ok {
+			arg = e.Message(lang)
+		}
+		localized[i] = arg
+	}
+	return fmt.Sprintf(format, localized...)
+}
+
+// Negotiate picks the supported language the Accept-Language header prefers,
+// matching on the primary subtag so "ar-SA" gets Arabic. It returns "" when
+// none of the listed languages is supported.
+func Negotiate(acceptLanguage string) string {
+	best, bestQ := "", 0.0
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		fields := strings.Split(strings.TrimSpace(part), ";")
+		tag := strings.ToLower(strings.TrimSpace(fields[0]))
+		if tag == "" || tag == "*" {
+			continue
+		}
+		q := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if v, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					q = v
+				}
+			}
+		}
+		lang, _, _ := strings.Cut(tag, "-")
+		if q > bestQ && Supported(lang) {
+			best, bestQ = lang, q
+		}
+	}
+	return best
+}
+
+// Error is an error with a message code, so handlers can answer in the
+// language of the request. Error() gives the English message, for logs.
+type Error struct {
+	Code string
+	Args []interface{}
+}
+
+// Errorf returns an error with the message for code, filled in with args.
+func Errorf(code string, args ...interface{}) error {
+	return &Error{Code: code, Args: args}
+}
+
+func (e *Error) Error() string {
+	return e.Message(fallback)
+}
+
+// Message returns the error message in lang.
+func (e *Error) Message(lang string) string {
+	return Message(lang, e.Code, e.Args...)
+}
@@ -0,0 +1,90 @@
+package i18n
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"testing"
+)
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		header string
+		want   string
+	}{
+		{"", ""},
+		{"ar", "ar"},
+		{"ar-SA", "ar"},
+		{"EN-us", "en"},
+		{"fr-FR, ar;q=0.8, en;q=0.9", "en"},
+		{"en;q=0.5, ar;q=0.7", "ar"},
+		{"fr, de", ""},
+		{"*", ""},
+		{"ar;q=0, en;q=0.1", "en"},
+		{"ar;q=abc", "ar"},
+	}
+	for _, tt := range tests {
+		if got := Negotiate(tt.header); got != tt.want {
+			t.Errorf("Negotiate(%q) = %q, want %q", tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestMessage(t *testing.T) {
+	tests := []struct {
+		name string
+		lang string
+		code string
+		args []interface{}
+		want string
+	}{
+		{"english", "en", "invalid_cursor", nil, catalogs["en"]["invalid_cursor"]},
+		{"arabic", "ar", "invalid_cursor", nil, catalogs["ar"]["invalid_cursor"]},
+		{"unknown language", "fr", "invalid_cursor", nil, catalogs["en"]["invalid_cursor"]},
+		{"unknown code", "ar", "no_such_code", nil, "no_such_code"},
+		{"arguments", "en", "page_out_of_range", []interface{}{5, 4}, "page 5 does not exist, the document has 4 pages"},
+		{"coded error argument", "ar", "invalid_page_number", []interface{}{Errorf("invalid_cursor")}, fmt.Sprintf(catalogs["ar"]["invalid_page_number"], catalogs["ar"]["invalid_cursor"])},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Message(tt.lang, tt.code, tt.args...); got != tt.want {
+				t.Errorf("Message = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	err := Errorf("page_out_of_range", 5, 4)
+	if err.Error() != Message("en", "page_out_of_range", 5, 4) {
+		t.Errorf("Error() = %q, want the English message", err.Error())
+	}
+}
+
+// verbs matches the fmt verbs of a message. Every translation has to take
+// the same ones, or its arguments come out wrong.
+var verbs = regexp.MustCompile(`%[-+# 0-9.]*[a-zA-Z]`)
+
+func TestCatalogsMatch(t *testing.T) {
+	for _, lang := range Languages() {
+		if lang == fallback {
+			continue
+		}
+		for code, format := range catalogs[fallback] {
+			translated, ok := catalogs[lang][code]
+			if !ok {
+				t.Errorf("%s: %s is missing", lang, code)
+				continue
+			}
+			want, got := verbs.FindAllString(format, -1), verbs.FindAllString(translated, -1)
+			sort.Strings(want)
+			sort.Strings(got)
+			if fmt.Sprint(want) != fmt.Sprint(got) {
+				t.Errorf("%s: %s takes %v, English takes %v", lang, code, got, want)
+			}
+		}
+		for code := range catalogs[lang] {
+			if _, ok := catalogs[fallback][code]; !ok {
+				t.Errorf("%s: %s is not in the English catalog", lang, code)
+			}
+		}
+	}
+}
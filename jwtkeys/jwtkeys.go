@@ -0,0 +1,263 @@
+// Package jwtkeys keeps the asymmetric keys access tokens are signed with.
+// Keys live in a directory as <kid>.pem PKCS#8 private keys, RSA for RS256
+// or Ed25519 for EdDSA, and a file named "current" holds the ID of the key
+// new tokens are signed with. The other keys only verify tokens, so a key
+// that was rotated out keeps accepting the tokens it signed until it is
+// retired.
+package jwtkeys
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Signing algorithms, as in the JWT alg header.
+const (
+	RS256 = "RS256"
+	EdDSA = "EdDSA"
+)
+
+// rsaKeyBits is the size of generated RSA keys.
+const rsaKeyBits = 2048
+
+const currentFile = "current"
+
+// ErrUnknownKey is returned for key IDs the keyring does not hold.
+var ErrUnknownKey = errors.New("jwtkeys: unknown key")
+
+// Key is one signing key.
+type Key struct {
+	ID        string
+	Alg       string
+	CreatedAt time.Time
+	signer    crypto.Signer
+}
+
+// Signer returns the private key, for signing.
+func (k *Key) Signer() crypto.Signer {
+	return k.signer
+}
+
+// Public returns the public key, for verifying.
+func (k *Key) Public() crypto.PublicKey {
+	return k.signer.Public()
+}
+
+// Method returns the JWT signing method of the key.
+func (k *Key) Method() jwt.SigningMethod {
+	return jwt.GetSigningMethod(k.Alg)
+}
+
+// ValidAlg reports whether alg is an algorithm keys can be generated for.
+func ValidAlg(alg string) bool {
+	return alg == RS256 || alg == EdDSA
+}
+
+// Generate creates a key for alg with a fresh ID.
+func Generate(alg string) (*Key, error) {
+	var signer crypto.Signer
+	var err error
+	switch alg {
+	case RS256:
+		signer, err = rsa.GenerateKey(rand.Reader, rsaKeyBits)
+	case EdDSA:
+		_, signer, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		return nil, fmt.Errorf("jwtkeys: unsupported algorithm %q, use %s or %s", alg, RS256, EdDSA)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	return &Key{
+		ID:        now.Format("20060102T150405") + "-" + hex.EncodeToString(suffix),
+		Alg:       alg,
+		CreatedAt: now,
+		signer:    signer,
+	}, nil
+}
+
+// parseKey reads a PEM encoded PKCS#8 private key.
+func parseKey(id string, data []byte, createdAt time.Time) (*Key, error) {
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "PRIVATE KEY" {
+		return nil, fmt.Errorf("jwtkeys: key %s is not a PEM private key", id)
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("jwtkeys: key %s: %w", id, err)
+	}
+
+	key := &Key{ID: id, CreatedAt: createdAt}
+	switch k := parsed.(type) {
+	case *rsa.PrivateKey:
+		key.Alg, key.signer = RS256, k
+	case ed25519.PrivateKey:
+		key.Alg, key.signer = EdDSA, k
+	default:
+		return nil, fmt.Errorf("jwtkeys: key %s has unsupported type %T", id, parsed)
+	}
+	return key, nil
+}
+
+// Keyring is the set of keys in a directory.
+type Keyring struct {
+	dir     string
+	mu      sync.RWMutex
+	current *Key
+	keys    map[string]*Key
+}
+
+// Load reads the keys in dir. A missing directory gives an empty keyring.
+func Load(dir string) (*Keyring, error) {
+	r := &Keyring{dir: dir}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Reload reads the directory again, to pick up keys rotated by another
+// process.
+func (r *Keyring) Reload() error {
+	keys := map[string]*Key{}
+	entries, err := os.ReadDir(r.dir)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".pem") {
+			continue
+		}
+		id := strings.TrimSuffix(entry.Name(), ".pem")
+		data, err := os.ReadFile(filepath.Join(r.dir, entry.Name()))
+		if err != nil {
+			return err
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		key, err := parseKey(id, data, info.ModTime())
+		if err != nil {
+			return err
+		}
+		keys[id] = key
+	}
+
+	var current *Key
+	data, err := os.ReadFile(filepath.Join(r.dir, currentFile))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if id := strings.TrimSpace(string(data)); id != "" {
+		if current = keys[id]; current == nil {
+			return fmt.Errorf("jwtkeys: current key %s is missing from %s", id, r.dir)
+		}
+	}
+
+	r.mu.Lock()
+	r.keys, r.current = keys, current
+	r.mu.Unlock()
+	return nil
+}
+
+// Current returns the key new tokens are signed with, or nil when there is
+// none yet.
+func (r *Keyring) Current() *Key {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.current
+}
+
+// Key returns the key with ID id.
+func (r *Keyring) Key(id string) (*Key, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	key, ok := r.keys[id]
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+	return key, nil
+}
+
+// Keys returns every key, newest first.
+func (r *Keyring) Keys() []*Key {
+	r.mu.RLock()
+	keys := make([]*Key, 0, len(r.keys))
+	for _, key := range r.keys {
+		keys = append(keys, key)
+	}
+	r.mu.RUnlock()
+	sort.Slice(keys, func(i, j int) bool { return keys[i].ID > keys[j].ID })
+	return keys
+}
+
+// Rotate generates a key for alg and makes it the current one. The previous
+// keys stay to verify the tokens they signed.
+func (r *Keyring) Rotate(alg string) (*Key, error) {
+	key, err := Generate(alg)
+	if err != nil {
+		return nil, err
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key.signer)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(r.dir, 0o700); err != nil {
+		return nil, err
+	}
+	data := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	if err := writeFile(filepath.Join(r.dir, key.ID+".pem"), data); err != nil {
+		return nil, err
+	}
+	if err := writeFile(filepath.Join(r.dir, currentFile), []byte(key.ID+"\n")); err != nil {
+		return nil, err
+	}
+	return key, r.Reload()
+}
+
+// Retire removes a key that is no longer current, which rejects the tokens
+// it signed.
+func (r *Keyring) Retire(id string) error {
+	if _, err := r.Key(id); err != nil {
+		return err
+	}
+	if current := r.Current(); current != nil && current.ID == id {
+		return fmt.Errorf("jwtkeys: key %s is the current key, rotate first", id)
+	}
+	if err := os.Remove(filepath.Join(r.dir, id+".pem")); err != nil {
+		return err
+	}
+	return r.Reload()
+}
+
+// writeFile replaces path atomically, readable by the owner only.
+func writeFile(path string, data []byte) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,107 @@
+package jwtkeys
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestRotateAndRetire(t *testing.T) {
+	dir := t.TempDir()
+	keys, err := Load(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keys.Current() != nil {
+		t.Fatal("empty directory has a current key")
+	}
+
+	first, err := keys.Rotate(RS256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := keys.Rotate(EdDSA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keys.Current().ID != second.ID {
+		t.Errorf("current = %s, want %s", keys.Current().ID, second.ID)
+	}
+
+	// another instance sees the same keys
+	reloaded, err := Load(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reloaded.Current().ID != second.ID || len(reloaded.Keys()) != 2 {
+		t.Errorf("reloaded current %s with %d keys", reloaded.Current().ID, len(reloaded.Keys()))
+	}
+	if key, err := reloaded.Key(first.ID); err != nil || key.Alg != RS256 {
+		t.Errorf("Key(%s) = %v, %v", first.ID, key, err)
+	}
+
+	if err := keys.Retire(second.ID); err == nil {
+		t.Error("retired the current key")
+	}
+	if err := keys.Retire(first.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := keys.Key(first.ID); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("retired key: %v, want ErrUnknownKey", err)
+	}
+	if err := keys.Retire("missing"); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("retire unknown key: %v, want ErrUnknownKey", err)
+	}
+}
+
+func TestGenerateRejectsUnknownAlg(t *testing.T) {
+	for _, alg := range []string{"", "HS256", "ES256", "none"} {
+		if _, err := Generate(alg); err == nil {
+			t.Errorf("Generate(%q) succeeded", alg)
+		}
+		if ValidAlg(alg) {
+			t.Errorf("ValidAlg(%q) = true", alg)
+		}
+	}
+}
+
+func TestJWKS(t *testing.T) {
+	keys, err := Load(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaKey, _ := keys.Rotate(RS256)
+	edKey, _ := keys.Rotate(EdDSA)
+
+	tests := []struct {
+		key  *Key
+		want JWK
+	}{
+		{rsaKey, JWK{Kty: "RSA", Kid: rsaKey.ID, Use: "sig", Alg: RS256}},
+		{edKey, JWK{Kty: "OKP", Kid: edKey.ID, Use: "sig", Alg: EdDSA, Crv: "Ed25519"}},
+	}
+	set := keys.JWKS()
+	if len(set.Keys) != len(tests) {
+		t.Fatalf("JWKS has %d keys, want %d", len(set.Keys), len(tests))
+	}
+	for _, tt := range tests {
+		var got *JWK
+		for i := range set.Keys {
+			if set.Keys[i].Kid == tt.key.ID {
+				got = &set.Keys[i]
+			}
+		}
+		if got == nil {
+			t.Errorf("%s missing from JWKS", tt.key.ID)
+			continue
+		}
+		if got.Kty != tt.want.Kty || got.Use != tt.want.Use || got.Alg != tt.want.Alg || got.Crv != tt.want.Crv {
+			t.Errorf("%s: JWK = %+v, want %+v", tt.key.ID, *got, tt.want)
+		}
+		if tt.want.Kty == "RSA" && (got.N == "" || got.E != "AQAB" || got.X != "") {
+			t.Errorf("%s: RSA JWK = %+v", tt.key.ID, *got)
+		}
+		if tt.want.Kty == "OKP" && (got.X == "" || got.N != "") {
+			t.Errorf("%s: OKP JWK = %+v", tt.key.ID, *got)
+		}
+	}
+}
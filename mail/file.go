@@ -0,0 +1,64 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+func init() {
+	Register("file", func() (Transport, error) {
+		dir := os.Getenv("MAIL_FILE_DIR")
+		if dir == "" {
+			dir = "./mail-outbox"
+		}
+		return NewFile(dir)
+	})
+	Register("log", func() (Transport, error) {
+		return Log{}, nil
+	})
+}
+
+// File writes every message as an .eml file below a directory, for local
+// development. The files open in any mail client.
+type File struct {
+	dir string
+}
+
+func NewFile(dir string) (*File, error) {
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return nil, fmt.Errorf("mail: create %s: %w", dir, err)
+	}
+	return &File{dir: dir}, nil
+}
+
+func (f *File) Send(ctx context.Context, msg Message) error {
+	body, err := msg.Bytes()
+	if err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%s-%s.eml", time.Now().Format("20060102-150405.000000"), safeFileName(msg.To))
+	return os.WriteFile(filepath.Join(f.dir, name), body, 0o644)
+}
+
+func safeFileName(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || r == os.PathSeparator {
+			return '_'
+		}
+		return r
+	}, s)
+}
+
+// Log prints the plain text version of every message instead of sending
+// it, for local development.
+type Log struct{}
+
+func (Log) Send(ctx context.Context, msg Message) error {
+	log.Printf("📧 mail to %s: %s\n%s", msg.To, msg.Subject, msg.Text)
+	return nil
+}
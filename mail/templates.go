@@ -0,0 +1,115 @@
+package mail
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	texttemplate "text/template"
+)
+
+// Templates live in templates/<language>/<name>.txt and <name>.html. The
+// text file defines "subject" and "text"; the HTML file defines "content",
+// which is wrapped in templates/layout.html.
+//
+//go:embed templates
+var templateFS embed.FS
+
+type templateSet struct {
+	text *texttemplate.Template
+	html *htmltemplate.Template
+}
+
+// templates maps language and then template name to its parsed files.
+var templates = loadTemplates()
+
+func loadTemplates() map[string]map[string]templateSet {
+	sets := map[string]map[string]templateSet{}
+	files, err := fs.Glob(templateFS, "templates/*/*.txt")
+	if err != nil {
+		panic(err)
+	}
+	for _, file := range files {
+		lang := path.Base(path.Dir(file))
+		name := strings.TrimSuffix(path.Base(file), ".txt")
+		if sets[lang] == nil {
+			sets[lang] = map[string]templateSet{}
+		}
+		// a value the caller forgot fails the render instead of printing
+		// "<no value>" to the recipient
+		sets[lang][name] = templateSet{
+			text: texttemplate.Must(texttemplate.New(name).Option("missingkey=error").ParseFS(templateFS, file)),
+			html: htmltemplate.Must(htmltemplate.New(name).Option("missingkey=error").ParseFS(templateFS, "templates/layout.html", strings.TrimSuffix(file, ".txt")+".html")),
+		}
+	}
+	return sets
+}
+
+// rtlLanguages are written right to left.
+var rtlLanguages = map[string]bool{"ar": true}
+
+// Languages returns the languages templates exist in.
+func Languages() []string {
+	langs := make([]string, 0, len(templates))
+	for lang := range templates {
+		langs = append(langs, lang)
+	}
+	sort.Strings(langs)
+	return langs
+}
+
+// HasLanguage reports whether templates exist in lang.
+func HasLanguage(lang string) bool {
+	_, ok := templates[lang]
+	return ok
+}
+
+// Rendered is a template filled in for one recipient.
+type Rendered struct {
+	Subject string
+	Text    string
+	HTML    string
+}
+
+// view is what templates are executed with; the caller's values are in
+// Data.
+type view struct {
+	Lang    string
+	Dir     string
+	Subject string
+	Data    interface{}
+}
+
+// Render fills in template name in lang with data.
+func Render(name string, lang string, data interface{}) (Rendered, error) {
+	set, ok := templates[lang][name]
+	if !ok {
+		return Rendered{}, fmt.Errorf("mail: no template %q in language %q", name, lang)
+	}
+
+	v := view{Lang: lang, Dir: "ltr", Data: data}
+	if rtlLanguages[lang] {
+		v.Dir = "rtl"
+	}
+
+	var subject, text, html bytes.Buffer
+	if err := set.text.ExecuteTemplate(&subject, "subject", v); err != nil {
+		return Rendered{}, err
+	}
+	v.Subject = strings.TrimSpace(subject.String())
+	if err := set.text.ExecuteTemplate(&text, "text", v); err != nil {
+		return Rendered{}, err
+	}
+	if err := set.html.ExecuteTemplate(&html, "layout", v); err != nil {
+		return Rendered{}, err
+	}
+	return Rendered{
+		Subject: v.Subject,
+		Text:    strings.TrimSpace(text.String()) + "\n",
+		HTML:    html.String(),
+	}, nil
+}
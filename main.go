@@ -20,11 +20,13 @@ import (
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
+	"github.com/gofiber/fiber/v2/middleware/requestid"
 	"github.com/gofiber/swagger"
 
 	"github.com/joho/godotenv"
 
 	"tawtheeq-backend/config"
+	"tawtheeq-backend/controllers"
 	"tawtheeq-backend/models"
 	"tawtheeq-backend/routes"
 	"tawtheeq-backend/utils"
@@ -57,14 +59,57 @@ func main() {
 		port = "3000"
 	}
 
-	S3_ENABLED := os.Getenv("S3_ENABLED")
-	if S3_ENABLED == "true" {
-		err := config.InitS3()
-		if err != nil {
-			utils.HandleError(err, "Failed to initialize S3", utils.Error)
+	// "rotate-jwt-key [RS256|EdDSA]", "retire-jwt-key <kid>" and
+	// "list-jwt-keys" manage the access token keys and exit
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "rotate-jwt-key":
+			alg := ""
+			if len(os.Args) > 2 {
+				alg = os.Args[2]
+			}
+			if err := config.RotateJWTKey(alg); err != nil {
+				log.Fatal("Failed to rotate JWT key:", err)
+			}
+			return
+		case "retire-jwt-key":
+			if len(os.Args) < 3 {
+				log.Fatal("Usage: retire-jwt-key <kid>")
+			}
+			if err := config.RetireJWTKey(os.Args[2]); err != nil {
+				log.Fatal("Failed to retire JWT key:", err)
+			}
+			return
+		case "list-jwt-keys":
+			if err := config.ListJWTKeys(); err != nil {
+				log.Fatal("Failed to list JWT keys:", err)
+			}
+			return
 		}
 	}
 
+	if err := config.InitStorage(); err != nil {
+		log.Fatal("Failed to init storage:", err)
+	}
+
+	// "rewrap-keys [--encrypt-plain]" re-wraps stored files under the current
+	// storage master key and exits instead of starting the server
+	if len(os.Args) > 1 && os.Args[1] == "rewrap-keys" {
+		encryptPlain := len(os.Args) > 2 && os.Args[2] == "--encrypt-plain"
+		if err := config.RewrapStorageKeys(encryptPlain); err != nil {
+			log.Fatal("Failed to rewrap storage keys:", err)
+		}
+		return
+	}
+
+	if err := config.InitMail(); err != nil {
+		log.Fatal("Failed to init mail:", err)
+	}
+
+	if err := config.InitJWT(); err != nil {
+		log.Fatal("Failed to init JWT keys:", err)
+	}
+
 	frontendOrigin := os.Getenv("FRONTEND_ORIGIN")
 	if frontendOrigin == "" {
 		utils.HandleError(
@@ -77,16 +122,18 @@ func main() {
 
 	// Start Fiber app
 	app := fiber.New(fiber.Config{
-		ErrorHandler: utils.MainErrorHandler,
+		ErrorHandler: controllers.ErrorHandler,
 	})
 
 	// Middlewares
 	app.Use(cors.New(cors.Config{
 		AllowOrigins:     frontendOrigin,
 		AllowMethods:     "GET,POST,PUT,DELETE,OPTIONS",
-		AllowHeaders:     "Origin, Content-Type, Accept, Authorization",
+		AllowHeaders:     "Origin, Content-Type, Accept, Accept-Language, Authorization",
 		AllowCredentials: true,
 	}))
+	// X-Request-ID, stored in audit events so a change can be traced to its request
+	app.Use(requestid.New())
 
 	// connect to database
 	config.ConnectDatabase()
@@ -96,8 +143,34 @@ func main() {
 		&models.Team{},
 		&models.TeamMember{},
 		&models.Document{},
+		&models.DocumentPerceptualHash{},
+		&models.DocumentTag{},
+		&models.DocumentField{},
+		&models.DocumentContent{},
+		&models.DocumentExport{},
+		&models.StampTemplate{},
+		&models.StorageScrubReport{},
+		&models.StorageScrubIssue{},
+		&models.VerificationEvent{},
+		&models.AuditEvent{},
+		&models.WebhookSubscription{},
+		&models.WebhookDelivery{},
+		&models.EmailMessage{},
+		&models.RefreshToken{},
 		models.PasswordResetToken{},
 	)
+	// the document hash used to be unique; duplicates are now checked per
+	// DUPLICATE_SCOPE under a lock on the hash, so the old unique index has
+	// to go
+	if config.DB.Migrator().HasIndex(&models.Document{}, "idx_documents_hash") {
+		if err := config.DB.Migrator().DropIndex(&models.Document{}, "idx_documents_hash"); err != nil {
+			utils.HandleError(err, "Failed to drop unique document hash index", utils.Error)
+		}
+	}
+	// documents signed before storage keys were recorded
+	if err := controllers.BackfillDocumentStorageKeys(); err != nil {
+		utils.HandleError(err, "Failed to backfill document storage keys", utils.Error)
+	}
 	// Create super admin if not exists
 	config.CreateSuperAdminIfNotExists()
 
@@ -109,6 +182,22 @@ func main() {
 
 	// Initialize Redis rate limiting
 	config.InitRateLimiting()
+	// Optional Redis cache for dashboard statistics
+	config.InitStatsCache()
+	// Redis denylist of revoked access tokens
+	config.InitTokenDenylist()
+	// Redis cache of the role and team of users, looked up on every request
+	config.InitUserAccessCache()
+
+	// Background jobs
+	controllers.StartStorageScrubber()
+	controllers.StartVerificationEventWriter()
+	controllers.StartDocumentPurger()
+	controllers.StartDocumentExportCleaner()
+	controllers.StartWebhookDispatcher()
+	controllers.StartEmailSender()
+	controllers.StartRefreshTokenCleaner()
+	config.WatchJWTKeys()
 
 	routes.SetupRoutes(app)
 
@@ -1,56 +1,121 @@
 package middlewares
 
 import (
-	"os"
+	"errors"
+	"fmt"
 	"strings"
+	"time"
+
+	"tawtheeq-backend/config"
+	"tawtheeq-backend/utils"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
 )
 
-func RequireRoles(allowedRoles ...string) fiber.Handler {
-	return func(c *fiber.Ctx) error {
-		authHeader := c.Get("Authorization")
-		if authHeader == "" || !strings.HasPrefix(authHeader, "Bearer ") {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Missing or invalid Authorization header"})
-		}
+// bearerToken is the caller of a request with a valid bearer token.
+type bearerToken struct {
+	role      string
+	userID    string
+	teamId    string
+	id        string
+	expiresAt time.Time
+}
 
-		tokenStr := strings.TrimPrefix(authHeader, "Bearer ")
-		secret := os.Getenv("JWT_SECRET")
+// setLocals makes the caller known to handlers.
+func (t bearerToken) setLocals(c *fiber.Ctx) {
+	c.Locals("userRole", t.role)
+	c.Locals("userID", t.userID)
+	c.Locals("teamId", t.teamId)
+	c.Locals("tokenID", t.id)
+	c.Locals("tokenExpiresAt", t.expiresAt)
+}
 
-		token, err := jwt.Parse(tokenStr, func(t *jwt.Token) (interface{}, error) {
-			return []byte(secret), nil
-		})
-		if err != nil || !token.Valid {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid token"})
-		}
+// parseBearerToken validates the bearer token of the request, including that
+// it was not revoked, or returns the message code of why it is rejected. The
+// role and team are looked up for every request rather than taken from the
+// token, so changes to them take effect immediately.
+func parseBearerToken(c *fiber.Ctx) (bearerToken, string) {
+	authHeader := c.Get("Authorization")
+	if authHeader == "" || !strings.HasPrefix(authHeader, "Bearer ") {
+		return bearerToken{}, "missing_authorization"
+	}
 
-		claims, ok := token.Claims.(jwt.MapClaims)
-		if !ok {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid token claims"})
-		}
+	token, err := config.ParseJWT(strings.TrimPrefix(authHeader, "Bearer "))
+	if err != nil || !token.Valid {
+		return bearerToken{}, "invalid_token"
+	}
 
-		role, ok := claims["role"].(string)
-		if !ok {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Role not found in token"})
-		}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return bearerToken{}, "invalid_token_claims"
+	}
 
-		teamId, ok := claims["teamId"].(string)
-		if !ok {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Team ID not found in token"})
-		}
+	var t bearerToken
+	t.userID, _ = claims["id"].(string)
+	if t.userID == "" {
+		return bearerToken{}, "invalid_token_claims"
+	}
+
+	// tokens without an ID cannot be revoked, so they are not accepted
+	t.id, _ = claims["jti"].(string)
+	exp, err := claims.GetExpirationTime()
+	if t.id == "" || err != nil || exp == nil {
+		return bearerToken{}, "invalid_token_claims"
+	}
+	t.expiresAt = exp.Time
 
-		userID, _ := claims["id"].(string)
-		c.Locals("userRole", role)
-		c.Locals("userID", userID)
-		c.Locals("teamId", teamId)
+	denied, err := config.IsTokenDenied(t.id)
+	if err != nil {
+		utils.HandleError(err, "Failed to check token denylist", utils.Error)
+		return bearerToken{}, "token_check_failed"
+	}
+	if denied {
+		return bearerToken{}, "token_revoked"
+	}
+
+	access, err := config.UserAccess(t.userID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return bearerToken{}, "user_not_found"
+	}
+	if err != nil {
+		utils.HandleError(err, fmt.Sprintf("Failed to look up access of user %s", t.userID), utils.Error)
+		return bearerToken{}, "token_check_failed"
+	}
+	t.role = string(access.Role)
+	t.teamId = access.TeamID
+	return t, ""
+}
+
+func RequireRoles(allowedRoles ...string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		token, errCode := parseBearerToken(c)
+		if errCode == "token_check_failed" {
+			return sendError(c, fiber.StatusInternalServerError, errCode)
+		}
+		if errCode != "" {
+			return sendError(c, fiber.StatusUnauthorized, errCode)
+		}
+		token.setLocals(c)
 
 		for _, allowed := range allowedRoles {
-			if allowed == "*" || role == allowed {
+			if allowed == "*" || token.role == allowed {
 				return c.Next()
 			}
 		}
 
-		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Access denied"})
+		return sendError(c, fiber.StatusForbidden, "access_denied")
+	}
+}
+
+// OptionalAuth sets the same locals as RequireRoles when the request carries
+// a valid bearer token, and lets anonymous requests through unchanged.
+func OptionalAuth() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if token, errCode := parseBearerToken(c); errCode == "" {
+			token.setLocals(c)
+		}
+		return c.Next()
 	}
 }
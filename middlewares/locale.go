@@ -0,0 +1,30 @@
+package middlewares
+
+import (
+	"time"
+
+	"tawtheeq-backend/i18n"
+	"tawtheeq-backend/models"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// language returns the language the request asks for in Accept-Language.
+// Middlewares run before the user is known, so saved preferences are not
+// looked at here.
+func language(c *fiber.Ctx) string {
+	if lang := i18n.Negotiate(c.Get(fiber.HeaderAcceptLanguage)); lang != "" {
+		return lang
+	}
+	return i18n.DefaultLanguage()
+}
+
+// sendError answers with the message for code in the language of the
+// request.
+func sendError(c *fiber.Ctx, status int, code string) error {
+	return c.Status(status).JSON(models.ErrorResponse{
+		Error:    i18n.Message(language(c), code),
+		Code:     code,
+		CreateAt: time.Now(),
+	})
+}
@@ -2,8 +2,10 @@ package middlewares
 
 import (
 	"fmt"
+	"time"
 
 	"tawtheeq-backend/config"
+	"tawtheeq-backend/i18n"
 	"tawtheeq-backend/utils"
 
 	"github.com/gofiber/fiber/v2"
@@ -21,7 +23,7 @@ func RedisRateLimiter() fiber.Handler {
 		count, err := config.Redis.Incr(config.Ctx, key).Result()
 		if err != nil {
 			utils.HandleError(err, "Rate limiter failed", utils.Error)
-			return c.Status(500).JSON(fiber.Map{"error": "Rate limiter failed"})
+			return sendError(c, fiber.StatusInternalServerError, "rate_limiter_failed")
 		}
 
 		if count == 1 {
@@ -31,8 +33,10 @@ func RedisRateLimiter() fiber.Handler {
 		if int(count) > config.RateLimitMax {
 			ttl, _ := config.Redis.TTL(config.Ctx, key).Result()
 			return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
-				"error":        "Too many requests",
+				"error":        i18n.Message(language(c), "too_many_requests"),
+				"code":         "too_many_requests",
 				"try_again_in": ttl.Seconds(),
+				"created_at":   time.Now(),
 			})
 		}
 
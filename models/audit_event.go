@@ -0,0 +1,66 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ErrAuditEventImmutable is returned when something tries to change or
+// remove a stored audit event.
+var ErrAuditEventImmutable = errors.New("audit events are append-only")
+
+// Audit target types.
+const (
+	AuditTargetUser          = "user"
+	AuditTargetTeam          = "team"
+	AuditTargetDocument      = "document"
+	AuditTargetStampTemplate = "stamp_template"
+	AuditTargetStorage       = "storage"
+	AuditTargetWebhook       = "webhook"
+	AuditTargetEmail         = "email"
+)
+
+// AuditEvent records one change made through the API. Rows are never
+// updated or deleted.
+type AuditEvent struct {
+	ID         string    `gorm:"type:char(36);primaryKey" json:"id"`
+	ActorID    *string   `gorm:"type:char(36);index" json:"actor_id,omitempty"`
+	ActorRole  string    `gorm:"type:varchar(50)" json:"actor_role,omitempty"`
+	Action     string    `gorm:"type:varchar(100);not null;index" json:"action"`
+	TargetType string    `gorm:"type:varchar(50);not null;index:idx_audit_events_target" json:"target_type"`
+	TargetID   string    `gorm:"type:varchar(64);index:idx_audit_events_target" json:"target_id"`
+	Before     string    `gorm:"type:text" json:"before,omitempty"`
+	After      string    `gorm:"type:text" json:"after,omitempty"`
+	IP         string    `gorm:"type:varchar(64)" json:"ip"`
+	RequestID  string    `gorm:"type:varchar(64);index" json:"request_id"`
+	CreatedAt  time.Time `gorm:"index" json:"created_at"`
+}
+
+func (e *AuditEvent) BeforeCreate(tx *gorm.DB) (err error) {
+	if e.ID == "" {
+		e.ID = uuid.New().String()
+	}
+	return
+}
+
+func (e *AuditEvent) BeforeUpdate(tx *gorm.DB) (err error) {
+	return ErrAuditEventImmutable
+}
+
+func (e *AuditEvent) BeforeDelete(tx *gorm.DB) (err error) {
+	return ErrAuditEventImmutable
+}
+
+// AuditEventFilter narrows an audit query. Empty fields are ignored.
+type AuditEventFilter struct {
+	ActorID    string
+	Action     string
+	TargetType string
+	TargetID   string
+	RequestID  string
+	From       *time.Time
+	To         *time.Time
+}
@@ -10,12 +10,21 @@ import (
 type Document struct {
 	ID                string `gorm:"type:char(36);primaryKey" json:"id"`
 	OriginalName      string `gorm:"not null" json:"original_name"`
-	FileFormat        string `gorm:"not null" json:"file_format"`
+	StorageKey        string `gorm:"type:varchar(255)" json:"-"`
+	FileFormat        string `gorm:"type:varchar(20);not null;index" json:"file_format"`
+	FileSize          int64  `gorm:"default:0" json:"file_size"`
 	Signature         string `gorm:"not null" json:"signature"`
-	VerificationCount int    `gorm:"default:0" json:"verification_count"`
+	VerificationCount int    `gorm:"default:0;index" json:"verification_count"`
 	IsHidden          bool   `gorm:"default:false" json:"is_hidden"`
 
-	Hash string `gorm:"type:varchar(64);uniqueIndex"`
+	Title             string               `gorm:"type:varchar(255);index" json:"title"`
+	Description       string               `gorm:"type:text" json:"description"`
+	ReferenceNumber   string               `gorm:"type:varchar(100);index" json:"reference_number"`
+	Tags              []DocumentTag        `gorm:"foreignKey:DocumentID;constraint:OnDelete:CASCADE" json:"tags"`
+	CustomFields      DocumentCustomFields `gorm:"type:text" json:"custom_fields"`
+	MetadataSignature string               `gorm:"type:text" json:"-"`
+
+	Hash string `gorm:"type:varchar(64);index:idx_documents_hash_lookup"`
 
 	SignedByUserID string `gorm:"type:uuid;not null" json:"signed_by_user_id"`
 	SignedByUser   User   `gorm:"foreignKey:SignedByUserID" json:"signed_by_user"`
@@ -23,8 +32,12 @@ type Document struct {
 	SignedByTeamID *string `gorm:"type:uuid" json:"signed_by_team_id,omitempty"`
 	SignedByTeam   *Team   `gorm:"foreignKey:SignedByTeamID" json:"signed_by_team,omitempty"`
 
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	CreatedAt time.Time `gorm:"index" json:"created_at"`
+	UpdatedAt time.Time `gorm:"index" json:"updated_at"`
+
+	// Deleted documents stay in the trash until they are restored or purged.
+	DeletedAt       gorm.DeletedAt `gorm:"index" json:"deleted_at,omitempty"`
+	DeletedByUserID *string        `gorm:"type:char(36)" json:"deleted_by_user_id,omitempty"`
 }
 
 func (d *Document) BeforeCreate(tx *gorm.DB) (err error) {
@@ -49,10 +62,43 @@ type DocumentResponse struct {
 	FileFormat        string             `json:"file_format"`
 	VerificationCount int                `json:"verification_count"`
 	Hash              string             `json:"hash"`
+	Title             string             `json:"title"`
+	Description       string             `json:"description"`
+	ReferenceNumber   string             `json:"reference_number"`
+	Tags              []string           `json:"tags"`
+	CustomFields      map[string]string  `json:"custom_fields"`
+	MetadataSealed    bool               `json:"metadata_sealed"`
+	MetadataIntact    *bool              `json:"metadata_intact,omitempty"`
 	SignedByUser      UserShortResponse  `json:"signed_by_user"`
 	SignedByTeam      *TeamShortResponse `json:"signed_by_team,omitempty"`
 	CreatedAt         string             `json:"created_at"`
 	UpdatedAt         string             `json:"updated_at"`
+	DeletedAt         string             `json:"deleted_at,omitempty"`
+}
+
+// PublicVerificationResponse is what anonymous visitors see when verifying a
+// document. Which optional fields are filled depends on the signing team's
+// verification visibility; internal IDs are never included.
+type PublicVerificationResponse struct {
+	ID                string            `json:"id"`
+	Valid             bool              `json:"valid"`
+	FileFormat        string            `json:"file_format"`
+	SignedAt          string            `json:"signed_at"`
+	SignerName        string            `json:"signer_name"`
+	TeamName          string            `json:"team_name,omitempty"`
+	SignerEmail       string            `json:"signer_email,omitempty"`
+	OriginalName      string            `json:"original_name,omitempty"`
+	Hash              string            `json:"hash,omitempty"`
+	VerificationCount int               `json:"verification_count,omitempty"`
+	Title             string            `json:"title,omitempty"`
+	ReferenceNumber   string            `json:"reference_number,omitempty"`
+	Description       string            `json:"description,omitempty"`
+	Tags              []string          `json:"tags,omitempty"`
+	CustomFields      map[string]string `json:"custom_fields,omitempty"`
+	MetadataSealed    bool              `json:"metadata_sealed"`
+	MetadataIntact    *bool             `json:"metadata_intact,omitempty"`
+	Withdrawn         bool              `json:"withdrawn,omitempty"`
+	WithdrawnAt       string            `json:"withdrawn_at,omitempty"`
 }
 
 type UploadResponse struct {
@@ -68,6 +114,12 @@ func BuildDocumentResponse(doc *Document) DocumentResponse {
 		FileFormat:        doc.FileFormat,
 		VerificationCount: doc.VerificationCount,
 		Hash:              doc.Hash,
+		Title:             doc.Title,
+		Description:       doc.Description,
+		ReferenceNumber:   doc.ReferenceNumber,
+		Tags:              doc.TagNames(),
+		CustomFields:      doc.CustomFields,
+		MetadataSealed:    doc.MetadataSignature != "",
 		SignedByUser: UserShortResponse{
 			ID:       doc.SignedByUser.ID,
 			FullName: doc.SignedByUser.FullName,
@@ -76,6 +128,9 @@ func BuildDocumentResponse(doc *Document) DocumentResponse {
 		CreatedAt: doc.CreatedAt.Format("2006-01-02 15:04:05"),
 		UpdatedAt: doc.UpdatedAt.Format("2006-01-02 15:04:05"),
 	}
+	if doc.DeletedAt.Valid {
+		resp.DeletedAt = doc.DeletedAt.Time.Format("2006-01-02 15:04:05")
+	}
 
 	if doc.SignedByTeam != nil {
 		resp.SignedByTeam = &TeamShortResponse{
@@ -86,3 +141,51 @@ func BuildDocumentResponse(doc *Document) DocumentResponse {
 
 	return resp
 }
+
+// BuildPublicVerificationResponse projects doc for the public verification
+// endpoint. visibility is one of the VerificationVisibility* levels; unknown
+// values fall back to the signer name only. The title is shown from
+// name_team on, the other metadata only with full.
+func BuildPublicVerificationResponse(doc *Document, visibility string) PublicVerificationResponse {
+	resp := PublicVerificationResponse{
+		ID:         doc.ID,
+		Valid:      true,
+		FileFormat: doc.FileFormat,
+		SignedAt:   doc.CreatedAt.Format("2006-01-02 15:04:05"),
+		SignerName: doc.SignedByUser.FullName,
+
+		MetadataSealed: doc.MetadataSignature != "",
+	}
+
+	if visibility == VerificationVisibilityNameTeam || visibility == VerificationVisibilityFull {
+		if doc.SignedByTeam != nil {
+			resp.TeamName = doc.SignedByTeam.Name
+		}
+		resp.Title = doc.Title
+	}
+
+	if visibility == VerificationVisibilityFull {
+		resp.SignerEmail = doc.SignedByUser.Email
+		resp.OriginalName = doc.OriginalName
+		resp.Hash = doc.Hash
+		resp.VerificationCount = doc.VerificationCount
+		resp.ReferenceNumber = doc.ReferenceNumber
+		resp.Description = doc.Description
+		resp.Tags = doc.TagNames()
+		resp.CustomFields = doc.CustomFields
+	}
+
+	return resp
+}
+
+// BuildWithdrawnVerificationResponse is the public answer for a document that
+// was deleted by its signer: the same projection, marked as no longer valid.
+func BuildWithdrawnVerificationResponse(doc *Document, visibility string) PublicVerificationResponse {
+	resp := BuildPublicVerificationResponse(doc, visibility)
+	resp.Valid = false
+	resp.Withdrawn = true
+	if doc.DeletedAt.Valid {
+		resp.WithdrawnAt = doc.DeletedAt.Time.Format("2006-01-02 15:04:05")
+	}
+	return resp
+}
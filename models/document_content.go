@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+// DocumentContent holds the text extracted from a signed PDF. Text keeps the
+// pages as extracted, separated by form feeds; NormalizedText is the search
+// form (see utils.NormalizeText) behind the FULLTEXT index.
+type DocumentContent struct {
+	DocumentID     string    `gorm:"type:char(36);primaryKey" json:"document_id"`
+	Text           string    `gorm:"type:longtext" json:"-"`
+	NormalizedText string    `gorm:"type:longtext;index:idx_document_contents_fulltext,class:FULLTEXT" json:"-"`
+	Pages          int       `json:"pages"`
+	CreatedAt      time.Time `gorm:"autoCreateTime" json:"created_at"`
+}
+
+// DocumentContentMatch is a document found by the content search with its
+// relevance score.
+type DocumentContentMatch struct {
+	DocumentID string
+	Score      float64
+}
@@ -0,0 +1,43 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	ExportFormatCSV  = "csv"
+	ExportFormatXLSX = "xlsx"
+	ExportFormatPDF  = "pdf"
+
+	ExportStatusRunning   = "running"
+	ExportStatusCompleted = "completed"
+	ExportStatusFailed    = "failed"
+)
+
+// DocumentExport is a document register built in the background because it
+// was too large to stream in the request. The file is kept in storage under
+// StorageKey until ExpiresAt.
+type DocumentExport struct {
+	ID                string     `gorm:"type:char(36);primaryKey" json:"id"`
+	Format            string     `gorm:"type:varchar(10);not null" json:"format"`
+	Status            string     `gorm:"type:varchar(20);not null;index" json:"status"`
+	RequestedByUserID string     `gorm:"type:char(36);not null;index" json:"requested_by_user_id"`
+	Filter            string     `gorm:"type:text" json:"filter"`
+	Rows              int        `json:"rows"`
+	Size              int64      `json:"size"`
+	StorageKey        string     `gorm:"type:varchar(255)" json:"-"`
+	Error             string     `gorm:"type:text" json:"error,omitempty"`
+	CreatedAt         time.Time  `gorm:"index" json:"created_at"`
+	FinishedAt        *time.Time `json:"finished_at,omitempty"`
+	ExpiresAt         *time.Time `gorm:"index" json:"expires_at,omitempty"`
+}
+
+func (e *DocumentExport) BeforeCreate(tx *gorm.DB) (err error) {
+	if e.ID == "" {
+		e.ID = uuid.New().String()
+	}
+	return
+}
@@ -0,0 +1,164 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Custom field types a team can define for its documents.
+const (
+	DocumentFieldTypeText   = "text"
+	DocumentFieldTypeNumber = "number"
+	DocumentFieldTypeDate   = "date"
+)
+
+// ValidDocumentFieldType reports whether t is a known custom field type.
+func ValidDocumentFieldType(t string) bool {
+	switch t {
+	case DocumentFieldTypeText, DocumentFieldTypeNumber, DocumentFieldTypeDate:
+		return true
+	}
+	return false
+}
+
+// DocumentCustomFields holds the values of a document's team-defined fields,
+// keyed by field key. It is stored as a JSON object.
+type DocumentCustomFields map[string]string
+
+func (f DocumentCustomFields) Value() (driver.Value, error) {
+	if len(f) == 0 {
+		return "", nil
+	}
+	data, err := json.Marshal(map[string]string(f))
+	return string(data), err
+}
+
+func (f *DocumentCustomFields) Scan(value interface{}) error {
+	var data []byte
+	switch v := value.(type) {
+	case nil:
+		*f = nil
+		return nil
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return errors.New("unsupported custom fields value")
+	}
+	if len(data) == 0 {
+		*f = nil
+		return nil
+	}
+	values := map[string]string{}
+	if err := json.Unmarshal(data, &values); err != nil {
+		return err
+	}
+	*f = values
+	return nil
+}
+
+// DocumentTag is one tag of a document.
+type DocumentTag struct {
+	ID         string `gorm:"type:char(36);primaryKey"`
+	DocumentID string `gorm:"type:char(36);not null;uniqueIndex:idx_document_tags_document_tag"`
+	Tag        string `gorm:"type:varchar(50);not null;uniqueIndex:idx_document_tags_document_tag;index"`
+}
+
+func (t *DocumentTag) BeforeCreate(tx *gorm.DB) (err error) {
+	if t.ID == "" {
+		t.ID = uuid.New().String()
+	}
+	return
+}
+
+// MarshalJSON writes a tag as its plain name.
+func (t DocumentTag) MarshalJSON() ([]byte, error) {
+	return json.Marshal(t.Tag)
+}
+
+// TagNames returns the tag names of doc in alphabetical order.
+func (d *Document) TagNames() []string {
+	names := make([]string, 0, len(d.Tags))
+	for _, t := range d.Tags {
+		names = append(names, t.Tag)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// DocumentField is a custom metadata field defined by a team for its
+// documents.
+type DocumentField struct {
+	ID        string    `gorm:"type:char(36);primaryKey" json:"id"`
+	TeamID    string    `gorm:"type:char(36);not null;uniqueIndex:idx_document_fields_team_key" json:"team_id"`
+	Key       string    `gorm:"type:varchar(64);not null;uniqueIndex:idx_document_fields_team_key" json:"key"`
+	Label     string    `gorm:"type:varchar(255);not null" json:"label"`
+	Type      string    `gorm:"type:varchar(20);not null;default:'text'" json:"type"`
+	Required  bool      `gorm:"default:false" json:"required"`
+	Position  int       `gorm:"default:0" json:"position"`
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
+}
+
+func (f *DocumentField) BeforeCreate(tx *gorm.DB) (err error) {
+	if f.ID == "" {
+		f.ID = uuid.New().String()
+	}
+	return
+}
+
+type DocumentFieldInput struct {
+	Key      string `json:"key" example:"contract_value"`
+	Label    string `json:"label" example:"Contract value"`
+	Type     string `json:"type" example:"number"`
+	Required bool   `json:"required"`
+}
+
+type DocumentFieldsInput struct {
+	Fields []DocumentFieldInput `json:"fields"`
+}
+
+// DocumentMetadataInput changes the descriptive fields of a document. Omitted
+// fields are kept. Seal signs the resulting metadata; sealed metadata can no
+// longer be edited.
+type DocumentMetadataInput struct {
+	Title           *string            `json:"title,omitempty" example:"Lease agreement"`
+	Description     *string            `json:"description,omitempty"`
+	ReferenceNumber *string            `json:"reference_number,omitempty" example:"HR-2025-0042"`
+	Tags            *[]string          `json:"tags,omitempty"`
+	CustomFields    *map[string]string `json:"custom_fields,omitempty"`
+	Seal            bool               `json:"seal"`
+}
+
+// DocumentMetadataPayload is the canonical form of a document's metadata
+// covered by its metadata signature. It is bound to the document ID and the
+// content hash so it cannot be moved to another document.
+func DocumentMetadataPayload(doc *Document) ([]byte, error) {
+	fields := map[string]string{}
+	for k, v := range doc.CustomFields {
+		fields[k] = v
+	}
+	return json.Marshal(struct {
+		ID              string            `json:"id"`
+		Hash            string            `json:"hash"`
+		Title           string            `json:"title"`
+		Description     string            `json:"description"`
+		ReferenceNumber string            `json:"reference_number"`
+		Tags            []string          `json:"tags"`
+		CustomFields    map[string]string `json:"custom_fields"`
+	}{
+		ID:              doc.ID,
+		Hash:            doc.Hash,
+		Title:           doc.Title,
+		Description:     doc.Description,
+		ReferenceNumber: doc.ReferenceNumber,
+		Tags:            doc.TagNames(),
+		CustomFields:    fields,
+	})
+}
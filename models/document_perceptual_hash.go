@@ -0,0 +1,36 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type DocumentPerceptualHash struct {
+	ID         string    `gorm:"type:char(36);primaryKey" json:"id"`
+	DocumentID string    `gorm:"type:char(36);not null;index" json:"document_id"`
+	Document   Document  `gorm:"foreignKey:DocumentID;constraint:OnDelete:CASCADE" json:"-"`
+	Page       int       `gorm:"not null;default:0" json:"page"`
+	Hash       uint64    `gorm:"type:bigint unsigned;not null;index" json:"hash"`
+	CreatedAt  time.Time `gorm:"autoCreateTime" json:"created_at"`
+}
+
+func (p *DocumentPerceptualHash) BeforeCreate(tx *gorm.DB) (err error) {
+	if p.ID == "" {
+		p.ID = uuid.New().String()
+	}
+	return
+}
+
+type SimilarDocumentMatch struct {
+	DocumentID string `json:"document_id"`
+	Page       int    `json:"page"`
+	Distance   int    `json:"distance"`
+}
+
+type SimilarDocumentResponse struct {
+	Document PublicVerificationResponse `json:"document"`
+	Page     int                        `json:"page"`
+	Distance int                        `json:"distance"`
+}
@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+// DocumentSearchFilter narrows a document search. Empty fields are ignored.
+// ScopeUserID and ScopeTeamID restrict the search to what the caller may see:
+// documents signed by ScopeUserID or by ScopeTeamID.
+type DocumentSearchFilter struct {
+	Query          string
+	OriginalName   string
+	FileFormat     string
+	SignedByUserID string
+	SignedByTeamID string
+	HashPrefix     string
+	Hidden         *bool
+	Tags           []string
+	From           *time.Time
+	To             *time.Time
+
+	ScopeUserID string
+	ScopeTeamID string
+}
@@ -0,0 +1,54 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Email templates, one per notification.
+const (
+	EmailWelcome          = "welcome"
+	EmailPasswordReset    = "password_reset"
+	EmailPasswordChanged  = "password_changed"
+	EmailDocumentSigned   = "document_signed"
+	EmailDocumentRevoked  = "document_revoked"
+	EmailDocumentExpiring = "document_expiring"
+)
+
+// Email statuses.
+const (
+	EmailPending = "pending"
+	EmailSent    = "sent"
+	EmailFailed  = "failed"
+)
+
+// EmailMessage is a rendered email in the outbox. Reference names what the
+// email is about, such as a document ID. The bodies are cleared once the
+// email is sent, since they may hold password reset links.
+type EmailMessage struct {
+	ID            string     `gorm:"type:char(36);primaryKey" json:"id"`
+	UserID        *string    `gorm:"type:char(36);index" json:"user_id,omitempty"`
+	To            string     `gorm:"type:varchar(191);not null" json:"to"`
+	Template      string     `gorm:"type:varchar(50);not null;index:idx_email_messages_reference" json:"template"`
+	Reference     string     `gorm:"type:varchar(64);index:idx_email_messages_reference" json:"reference,omitempty"`
+	Language      string     `gorm:"type:varchar(5)" json:"language"`
+	Subject       string     `gorm:"type:varchar(255)" json:"subject"`
+	TextBody      string     `gorm:"type:mediumtext" json:"-"`
+	HTMLBody      string     `gorm:"type:mediumtext" json:"-"`
+	Status        string     `gorm:"type:varchar(20);not null;index" json:"status"`
+	Attempts      int        `json:"attempts"`
+	Error         string     `gorm:"type:text" json:"error,omitempty"`
+	NextAttemptAt *time.Time `gorm:"index" json:"next_attempt_at,omitempty"`
+	SentAt        *time.Time `json:"sent_at,omitempty"`
+	CreatedAt     time.Time  `gorm:"index" json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
+
+func (m *EmailMessage) BeforeCreate(tx *gorm.DB) (err error) {
+	if m.ID == "" {
+		m.ID = uuid.New().String()
+	}
+	return
+}
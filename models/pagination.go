@@ -0,0 +1,77 @@
+package models
+
+import (
+	"encoding/base64"
+	"strings"
+	"time"
+
+	"tawtheeq-backend/i18n"
+)
+
+const (
+	// DefaultPageSize is the page size of list endpoints that do not set
+	// their own.
+	DefaultPageSize = 10
+	// MaxPageSize caps the limit a client can ask for.
+	MaxPageSize = 100
+)
+
+// Cursor is the position of an item in a list sorted newest first on a time
+// column and then on id. The next page starts right after it.
+type Cursor struct {
+	Time time.Time
+	ID   string
+}
+
+// Encode returns the opaque form of c handed to clients as next_cursor.
+func (c Cursor) Encode() string {
+	return base64.RawURLEncoding.EncodeToString([]byte(c.Time.UTC().Format(time.RFC3339Nano) + "|" + c.ID))
+}
+
+// DecodeCursor parses a cursor produced by Encode.
+func DecodeCursor(s string) (*Cursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, i18n.Errorf("invalid_cursor")
+	}
+	at, id, ok := strings.Cut(string(raw), "|")
+	if !ok || id == "" {
+		return nil, i18n.Errorf("invalid_cursor")
+	}
+	t, err := time.Parse(time.RFC3339Nano, at)
+	if err != nil {
+		return nil, i18n.Errorf("invalid_cursor")
+	}
+	return &Cursor{Time: t, ID: id}, nil
+}
+
+// Pagination is the page a list request asks for: the Limit items after
+// Cursor when one is given, otherwise the Page-th page of Limit items.
+type Pagination struct {
+	Limit  int
+	Page   int
+	Cursor *Cursor
+}
+
+// Offset is the number of rows skipped for page based requests.
+func (p Pagination) Offset() int {
+	if p.Cursor != nil {
+		return 0
+	}
+	return (p.Page - 1) * p.Limit
+}
+
+// PageMeta describes the page returned by a list endpoint. Page is left out
+// for cursor requests and NextCursor on the last page.
+type PageMeta struct {
+	Limit      int    `json:"limit"`
+	Page       int    `json:"page,omitempty"`
+	Total      int64  `json:"total"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// ListResponse is the envelope of every list endpoint.
+type ListResponse struct {
+	Data interface{} `json:"data"`
+	Meta PageMeta    `json:"meta"`
+}
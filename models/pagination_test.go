@@ -0,0 +1,61 @@
+package models
+
+import (
+	"encoding/base64"
+	"testing"
+	"time"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	tests := []Cursor{
+		{Time: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC), ID: "a1b2"},
+		{Time: time.Date(2024, 5, 1, 12, 0, 0, 123456789, time.UTC), ID: "c3d4"},
+		{Time: time.Date(2024, 5, 1, 15, 0, 0, 0, time.FixedZone("AST", 3*3600)), ID: "e5f6"},
+		{Time: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC), ID: "id|with|pipes"},
+	}
+	for _, c := range tests {
+		got, err := DecodeCursor(c.Encode())
+		if err != nil {
+			t.Fatalf("%+v: %v", c, err)
+		}
+		if !got.Time.Equal(c.Time) || got.ID != c.ID {
+			t.Errorf("decoded %+v, want %+v", *got, c)
+		}
+	}
+}
+
+func TestDecodeCursorRejects(t *testing.T) {
+	encode := func(s string) string { return base64.RawURLEncoding.EncodeToString([]byte(s)) }
+	tests := []struct {
+		name   string
+		cursor string
+	}{
+		{"not base64", "!!!"},
+		{"padded base64", base64.URLEncoding.EncodeToString([]byte("2024-05-01T12:00:00Z|a"))},
+		{"no separator", encode("2024-05-01T12:00:00Z")},
+		{"no id", encode("2024-05-01T12:00:00Z|")},
+		{"bad time", encode("yesterday|a")},
+		{"empty", ""},
+	}
+	for _, tt := range tests {
+		if got, err := DecodeCursor(tt.cursor); err == nil {
+			t.Errorf("%s: decoded %+v", tt.name, *got)
+		}
+	}
+}
+
+func TestPaginationOffset(t *testing.T) {
+	tests := []struct {
+		p    Pagination
+		want int
+	}{
+		{Pagination{Limit: 10, Page: 1}, 0},
+		{Pagination{Limit: 10, Page: 3}, 20},
+		{Pagination{Limit: 25, Page: 2, Cursor: &Cursor{ID: "a"}}, 0},
+	}
+	for _, tt := range tests {
+		if got := tt.p.Offset(); got != tt.want {
+			t.Errorf("%+v: Offset = %d, want %d", tt.p, got, tt.want)
+		}
+	}
+}
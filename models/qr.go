@@ -0,0 +1,17 @@
+package models
+
+type VerifyQRInput struct {
+	Payload string `json:"payload" example:"TWQ1|123e4567-e89b-12d3-a456-426614174000|9f86d081884c7d65|Jane Doe|2025-01-31|..."`
+}
+
+type VerifyQRResponse struct {
+	Valid       bool   `json:"valid"`
+	Reason      string `json:"reason,omitempty"`
+	DocumentID  string `json:"document_id,omitempty"`
+	Hash        string `json:"hash,omitempty"`
+	Signer      string `json:"signer,omitempty"`
+	SignedAt    string `json:"signed_at,omitempty"`
+	Registered  bool   `json:"registered"`
+	HashMatches bool   `json:"hash_matches"`
+	Withdrawn   bool   `json:"withdrawn,omitempty"`
+}
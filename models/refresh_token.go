@@ -0,0 +1,41 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// RefreshToken is a login session step. Only the SHA-256 hash of the token
+// is stored. Every refresh revokes the token and issues a new one in the
+// same family, so a family is one login; a revoked token that comes back
+// means it was stolen and the whole family is revoked. AccessTokenID and
+// AccessExpiresAt describe the access token issued with it, which is denied
+// when the session is revoked, even if the refresh token was rotated.
+type RefreshToken struct {
+	ID              string     `gorm:"type:char(36);primaryKey" json:"id"`
+	UserID          string     `gorm:"type:char(36);not null;index" json:"user_id"`
+	FamilyID        string     `gorm:"type:char(36);not null;index" json:"family_id"`
+	TokenHash       string     `gorm:"type:char(64);uniqueIndex;not null" json:"-"`
+	AccessTokenID   string     `gorm:"type:char(36)" json:"-"`
+	AccessExpiresAt time.Time  `json:"-"`
+	ExpiresAt       time.Time  `gorm:"not null;index" json:"expires_at"`
+	RevokedAt       *time.Time `json:"revoked_at,omitempty"`
+	ReplacedByID    *string    `gorm:"type:char(36)" json:"replaced_by_id,omitempty"`
+	CreatedAt       time.Time  `json:"created_at"`
+
+	User User `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE" json:"-"`
+}
+
+func (t *RefreshToken) BeforeCreate(tx *gorm.DB) (err error) {
+	if t.ID == "" {
+		t.ID = uuid.New().String()
+	}
+	return
+}
+
+// RefreshTokenInput carries the refresh token of a session.
+type RefreshTokenInput struct {
+	RefreshToken string `json:"refresh_token" example:"kq3W..."`
+}
@@ -4,8 +4,11 @@ import (
 	"time"
 )
 
+// ErrorResponse carries the error message in the language of the request
+// and its stable code, which clients should switch on instead of the text.
 type ErrorResponse struct {
 	Error    string    `json:"error"`
+	Code     string    `json:"code"`
 	CreateAt time.Time `json:"created_at"`
 }
 
@@ -33,12 +36,17 @@ type LoginInput struct {
 	Password string `json:"password"`
 }
 
+// LoginResponse is the body of a login or a refresh. Token is the access
+// token, valid for ExpiresIn seconds; RefreshToken gets the next pair.
 type LoginResponse struct {
-	Token string `json:"token"`
-	User  struct {
-		ID    string `json:"id"`
-		Name  string `json:"name"`
-		Email string `json:"email"`
-		Role  string `json:"role"`
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int    `json:"expires_in"`
+	User         struct {
+		ID     string `json:"id"`
+		Name   string `json:"name"`
+		Email  string `json:"email"`
+		Role   string `json:"role"`
+		TeamID string `json:"teamId"`
 	} `json:"user"`
 }
@@ -0,0 +1,69 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// StampTemplate describes the look of the stamp drawn on signed files. A
+// template with no team is global and can be used by every team.
+type StampTemplate struct {
+	ID        string  `gorm:"type:char(36);primaryKey" json:"id"`
+	TeamID    *string `gorm:"type:char(36);index" json:"team_id,omitempty"`
+	Team      *Team   `gorm:"foreignKey:TeamID;constraint:OnDelete:CASCADE" json:"-"`
+	Name      string  `gorm:"type:varchar(255);not null" json:"name"`
+	IsDefault bool    `gorm:"default:false" json:"is_default"`
+
+	TextTemplate string  `gorm:"type:varchar(255)" json:"text_template"`
+	FontPath     string  `gorm:"type:varchar(255)" json:"font_path"`
+	FontSize     float64 `gorm:"default:18" json:"font_size"`
+	TextColor    string  `gorm:"type:varchar(20)" json:"text_color"`
+	BgColor      string  `gorm:"type:varchar(20)" json:"bg_color"`
+	BgOpacity    float64 `json:"bg_opacity"`
+	TextAlign    string  `gorm:"type:varchar(10)" json:"text_align"`
+	BarPosition  string  `gorm:"type:varchar(10)" json:"bar_position"`
+
+	LogoPath     string  `gorm:"type:varchar(255)" json:"logo_path"`
+	LogoSize     float64 `gorm:"default:80" json:"logo_size"`
+	LogoPosition string  `gorm:"type:varchar(20)" json:"logo_position"`
+
+	QREnabled  bool    `json:"qr_enabled"`
+	QRPosition string  `gorm:"type:varchar(20)" json:"qr_position"`
+	QRSize     float64 `gorm:"default:100" json:"qr_size"`
+	QRMarginX  float64 `json:"qr_margin_x"`
+	QRMarginY  float64 `json:"qr_margin_y"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func (t *StampTemplate) BeforeCreate(tx *gorm.DB) (err error) {
+	if t.ID == "" {
+		t.ID = uuid.New().String()
+	}
+	return
+}
+
+// StampTemplateInput is used to create and update templates. Omitted fields
+// keep their current (or default) value.
+type StampTemplateInput struct {
+	TeamID       *string  `json:"team_id,omitempty"`
+	Name         *string  `json:"name" example:"Finance letters"`
+	TextTemplate *string  `json:"text_template" example:"رقم الوثيقة: {id} - {date}"`
+	FontPath     *string  `json:"font_path" example:"Cairo.ttf"`
+	FontSize     *float64 `json:"font_size" example:"18"`
+	TextColor    *string  `json:"text_color" example:"255,255,255"`
+	BgColor      *string  `json:"bg_color" example:"0,0,0"`
+	BgOpacity    *float64 `json:"bg_opacity" example:"0.5"`
+	TextAlign    *string  `json:"text_align" example:"left"`
+	BarPosition  *string  `json:"bar_position" example:"bottom"`
+	LogoSize     *float64 `json:"logo_size" example:"80"`
+	LogoPosition *string  `json:"logo_position" example:"top-left"`
+	QREnabled    *bool    `json:"qr_enabled" example:"true"`
+	QRPosition   *string  `json:"qr_position" example:"bottom-right"`
+	QRSize       *float64 `json:"qr_size" example:"100"`
+	QRMarginX    *float64 `json:"qr_margin_x" example:"30"`
+	QRMarginY    *float64 `json:"qr_margin_y" example:"30"`
+}
@@ -0,0 +1,71 @@
+package models
+
+import "time"
+
+// StatsPeriodCount is a count for one day, week or month.
+type StatsPeriodCount struct {
+	Period string `json:"period"`
+	Count  int64  `json:"count"`
+}
+
+// StatsKeyCount is a count for one value of a grouping column, such as a
+// file format or a verification result.
+type StatsKeyCount struct {
+	Key   string `json:"key"`
+	Count int64  `json:"count"`
+}
+
+// StatsTeamCount is the number of documents signed for a team. TeamID is
+// empty for documents signed without a team.
+type StatsTeamCount struct {
+	TeamID string `json:"team_id"`
+	Name   string `json:"name"`
+	Count  int64  `json:"count"`
+}
+
+// StatsSigner is the number of documents signed by a user.
+type StatsSigner struct {
+	UserID   string `json:"user_id"`
+	FullName string `json:"full_name"`
+	Email    string `json:"email"`
+	Count    int64  `json:"count"`
+}
+
+// DocumentTotals counts documents in a date range. Signed includes documents
+// later hidden or deleted; Hidden is the part of them hidden and still
+// active; Revoked counts documents deleted in the range. Active and
+// StorageBytes cover every document in scope, whenever it was signed.
+type DocumentTotals struct {
+	Signed            int64 `json:"signed"`
+	Hidden            int64 `json:"hidden"`
+	Revoked           int64 `json:"revoked"`
+	Active            int64 `json:"active"`
+	StorageBytes      int64 `json:"storage_bytes"`
+	StorageAddedBytes int64 `json:"storage_added_bytes"`
+}
+
+// VerificationTotals summarises verifications in a date range.
+type VerificationTotals struct {
+	Total     int64              `json:"total"`
+	Valid     int64              `json:"valid"`
+	ByResult  []StatsKeyCount    `json:"by_result"`
+	ByMethod  []StatsKeyCount    `json:"by_method"`
+	PerPeriod []StatsPeriodCount `json:"per_period"`
+}
+
+// DashboardStats is the statistics dashboard of the whole system or of one
+// team. ByTeam is only filled for the whole system.
+type DashboardStats struct {
+	TeamID        string             `json:"team_id,omitempty"`
+	From          string             `json:"from"`
+	To            string             `json:"to"`
+	Interval      string             `json:"interval"`
+	Documents     DocumentTotals     `json:"documents"`
+	SignedPer     []StatsPeriodCount `json:"signed_per_period"`
+	ByFormat      []StatsKeyCount    `json:"by_format"`
+	ByTeam        []StatsTeamCount   `json:"by_team,omitempty"`
+	TopSigners    []StatsSigner      `json:"top_signers"`
+	Verifications VerificationTotals `json:"verifications"`
+	GeneratedAt   time.Time          `json:"generated_at"`
+	Cached        bool               `json:"cached"`
+}
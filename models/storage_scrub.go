@@ -0,0 +1,77 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	ScrubStatusRunning   = "running"
+	ScrubStatusCompleted = "completed"
+	ScrubStatusFailed    = "failed"
+
+	ScrubTriggerScheduled = "scheduled"
+	ScrubTriggerManual    = "manual"
+
+	// ScrubIssueMissing: the document's stored object does not exist.
+	ScrubIssueMissing = "missing"
+	// ScrubIssueCorrupted: the stored object no longer matches its hash.
+	ScrubIssueCorrupted = "corrupted"
+	// ScrubIssueOrphan: a stored object no document points to.
+	ScrubIssueOrphan = "orphan"
+	// ScrubIssueTempOrphan: a leftover file in the temp directory.
+	ScrubIssueTempOrphan = "temp_orphan"
+	// ScrubIssueError: the object could not be checked.
+	ScrubIssueError = "error"
+)
+
+// StorageScrubReport is the summary of one scrubber run.
+type StorageScrubReport struct {
+	ID               string     `gorm:"type:char(36);primaryKey" json:"id"`
+	Trigger          string     `gorm:"type:varchar(20);not null" json:"trigger"`
+	Status           string     `gorm:"type:varchar(20);not null;index" json:"status"`
+	Rehash           bool       `json:"rehash"`
+	Cleanup          bool       `json:"cleanup"`
+	TriggeredBy      *string    `gorm:"type:char(36)" json:"triggered_by,omitempty"`
+	DocumentsChecked int        `json:"documents_checked"`
+	ObjectsScanned   int        `json:"objects_scanned"`
+	Missing          int        `json:"missing"`
+	Corrupted        int        `json:"corrupted"`
+	Orphans          int        `json:"orphans"`
+	OrphansRemoved   int        `json:"orphans_removed"`
+	Errors           int        `json:"errors"`
+	Error            string     `gorm:"type:text" json:"error,omitempty"`
+	StartedAt        time.Time  `gorm:"index" json:"started_at"`
+	FinishedAt       *time.Time `json:"finished_at,omitempty"`
+
+	Issues []StorageScrubIssue `gorm:"foreignKey:ReportID;constraint:OnDelete:CASCADE" json:"issues,omitempty"`
+}
+
+func (r *StorageScrubReport) BeforeCreate(tx *gorm.DB) (err error) {
+	if r.ID == "" {
+		r.ID = uuid.New().String()
+	}
+	return
+}
+
+// StorageScrubIssue is one problem found by a scrubber run.
+type StorageScrubIssue struct {
+	ID         string    `gorm:"type:char(36);primaryKey" json:"id"`
+	ReportID   string    `gorm:"type:char(36);not null;index" json:"report_id"`
+	Kind       string    `gorm:"type:varchar(20);not null;index" json:"kind"`
+	DocumentID *string   `gorm:"type:char(36);index" json:"document_id,omitempty"`
+	StorageKey string    `gorm:"type:varchar(255)" json:"storage_key"`
+	Size       int64     `json:"size"`
+	Detail     string    `gorm:"type:text" json:"detail,omitempty"`
+	Removed    bool      `json:"removed"`
+	CreatedAt  time.Time `gorm:"autoCreateTime" json:"created_at"`
+}
+
+func (i *StorageScrubIssue) BeforeCreate(tx *gorm.DB) (err error) {
+	if i.ID == "" {
+		i.ID = uuid.New().String()
+	}
+	return
+}
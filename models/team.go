@@ -7,13 +7,31 @@ import (
 	"gorm.io/gorm"
 )
 
+// Verification visibility levels: what anonymous visitors of the public
+// verification endpoint learn about a team's documents.
+const (
+	VerificationVisibilityName     = "name"
+	VerificationVisibilityNameTeam = "name_team"
+	VerificationVisibilityFull     = "full"
+)
+
+// ValidVerificationVisibility reports whether v is a known visibility level.
+func ValidVerificationVisibility(v string) bool {
+	switch v {
+	case VerificationVisibilityName, VerificationVisibilityNameTeam, VerificationVisibilityFull:
+		return true
+	}
+	return false
+}
+
 type Team struct {
-	ID        string       `gorm:"type:char(36);primaryKey" json:"id"`
-	Name      string       `gorm:"not null"`
-	LeaderID  string       `gorm:"type:char(36);not null"`
-	Leader    User         `gorm:"foreignKey:LeaderID;references:ID"`
-	Members   []TeamMember `gorm:"foreignKey:TeamID" json:"members"`
-	CreatedAt time.Time    `gorm:"autoCreateTime"`
+	ID                     string       `gorm:"type:char(36);primaryKey" json:"id"`
+	Name                   string       `gorm:"not null"`
+	LeaderID               string       `gorm:"type:char(36);not null"`
+	Leader                 User         `gorm:"foreignKey:LeaderID;references:ID"`
+	Members                []TeamMember `gorm:"foreignKey:TeamID" json:"members"`
+	VerificationVisibility string       `gorm:"type:varchar(20);default:'name'" json:"verification_visibility"`
+	CreatedAt              time.Time    `gorm:"autoCreateTime"`
 }
 
 func (t *Team) BeforeCreate(tx *gorm.DB) (err error) {
@@ -59,3 +77,7 @@ func BuildTeamResponse(team *Team) TeamResponse {
 type ChangeTeamNameInput struct {
 	Name string `json:"name"`
 }
+
+type ChangeVerificationVisibilityInput struct {
+	Visibility string `json:"visibility" example:"name_team"`
+}
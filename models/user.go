@@ -15,12 +15,15 @@ const (
 	TeamMemberRole Role = "team_member"
 )
 
+// User is an account. Language is the preferred language of emails and API
+// messages; empty means the default one.
 type User struct {
 	ID        string    `gorm:"type:char(36);primaryKey" json:"id"`
 	FullName  string    `gorm:"type:varchar(255)" json:"full_name"`
 	Email     string    `gorm:"type:varchar(191);uniqueIndex" json:"email"`
 	Password  string    `gorm:"not null" json:"-"`
 	Role      Role      `gorm:"type:varchar(50)" json:"role"`
+	Language  string    `gorm:"type:varchar(5)" json:"language"`
 	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
 }
 
@@ -31,10 +34,18 @@ func (u *User) BeforeCreate(tx *gorm.DB) (err error) {
 	return
 }
 
+// UserAccess is what a request may do: the current role of the user and the
+// team they lead or belong to, empty without one.
+type UserAccess struct {
+	Role   Role   `json:"role"`
+	TeamID string `json:"team_id"`
+}
+
 type CreateUserInput struct {
 	FullName string `json:"full_name"`
 	Email    string `json:"email"`
 	Password string `json:"password"`
+	Language string `json:"language" example:"ar"`
 	// Role     Role   `json:"role"`
 }
 
@@ -0,0 +1,65 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Verification methods.
+const (
+	VerificationMethodID   = "id"
+	VerificationMethodFile = "file"
+	VerificationMethodQR   = "qr"
+)
+
+// Verification results.
+const (
+	VerificationResultValid            = "valid"
+	VerificationResultNotFound         = "not_found"
+	VerificationResultInvalidSignature = "invalid_signature"
+	VerificationResultHashMismatch     = "hash_mismatch"
+	VerificationResultSimilar          = "similar"
+	VerificationResultNoMatch          = "no_match"
+	VerificationResultWithdrawn        = "withdrawn"
+)
+
+// VerificationEvent records one check of a document through the public
+// verification endpoints. DocumentID and TeamID are empty when the lookup
+// did not resolve to a document.
+type VerificationEvent struct {
+	ID         string    `gorm:"type:char(36);primaryKey" json:"id"`
+	DocumentID *string   `gorm:"type:char(36);index" json:"document_id,omitempty"`
+	TeamID     *string   `gorm:"type:char(36);index" json:"team_id,omitempty"`
+	Method     string    `gorm:"type:varchar(20);not null" json:"method"`
+	Result     string    `gorm:"type:varchar(30);not null" json:"result"`
+	ClientIP   string    `gorm:"type:varchar(64)" json:"client_ip"`
+	UserAgent  string    `gorm:"type:varchar(512)" json:"user_agent"`
+	Referrer   string    `gorm:"type:varchar(1024)" json:"referrer"`
+	CreatedAt  time.Time `gorm:"index" json:"created_at"`
+}
+
+func (e *VerificationEvent) BeforeCreate(tx *gorm.DB) (err error) {
+	if e.ID == "" {
+		e.ID = uuid.New().String()
+	}
+	return
+}
+
+// VerificationTrendPoint is the number of verifications in one period for a
+// method and result.
+type VerificationTrendPoint struct {
+	Period string `json:"period"`
+	Method string `json:"method"`
+	Result string `json:"result"`
+	Count  int64  `json:"count"`
+}
+
+// VerificationDocumentCount is the number of verifications of one document.
+type VerificationDocumentCount struct {
+	DocumentID   string    `json:"document_id"`
+	OriginalName string    `json:"original_name"`
+	Count        int64     `json:"count"`
+	LastAt       time.Time `json:"last_at"`
+}
@@ -0,0 +1,182 @@
+package models
+
+import (
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Webhook event types.
+const (
+	WebhookEventDocumentSigned    = "document.signed"
+	WebhookEventDocumentVerified  = "document.verified"
+	WebhookEventDocumentHidden    = "document.hidden"
+	WebhookEventDocumentShown     = "document.shown"
+	WebhookEventDocumentRevoked   = "document.revoked"
+	WebhookEventDocumentRestored  = "document.restored"
+	WebhookEventUserCreated       = "user.created"
+	WebhookEventUserUpdated       = "user.updated"
+	WebhookEventUserRemoved       = "user.removed"
+	WebhookEventTeamCreated       = "team.created"
+	WebhookEventTeamUpdated       = "team.updated"
+	WebhookEventTeamRemoved       = "team.removed"
+	WebhookEventTeamMemberAdded   = "team.member_added"
+	WebhookEventTeamMemberRemoved = "team.member_removed"
+	// WebhookEventPing is only sent by the ping endpoint.
+	WebhookEventPing = "webhook.ping"
+)
+
+// WebhookEvents lists the event types a subscription can filter on.
+var WebhookEvents = []string{
+	WebhookEventDocumentSigned,
+	WebhookEventDocumentVerified,
+	WebhookEventDocumentHidden,
+	WebhookEventDocumentShown,
+	WebhookEventDocumentRevoked,
+	WebhookEventDocumentRestored,
+	WebhookEventUserCreated,
+	WebhookEventUserUpdated,
+	WebhookEventUserRemoved,
+	WebhookEventTeamCreated,
+	WebhookEventTeamUpdated,
+	WebhookEventTeamRemoved,
+	WebhookEventTeamMemberAdded,
+	WebhookEventTeamMemberRemoved,
+}
+
+// ValidWebhookEvent reports whether t is a known event type.
+func ValidWebhookEvent(t string) bool {
+	for _, e := range WebhookEvents {
+		if e == t {
+			return true
+		}
+	}
+	return false
+}
+
+// Webhook delivery statuses.
+const (
+	WebhookDeliveryPending   = "pending"
+	WebhookDeliverySucceeded = "succeeded"
+	WebhookDeliveryFailed    = "failed"
+)
+
+// WebhookEventTypes is the event filter of a subscription; empty means every
+// event. It is stored as a comma separated list.
+type WebhookEventTypes []string
+
+func (t WebhookEventTypes) Value() (driver.Value, error) {
+	return strings.Join(t, ","), nil
+}
+
+func (t *WebhookEventTypes) Scan(value interface{}) error {
+	var s string
+	switch v := value.(type) {
+	case nil:
+	case []byte:
+		s = string(v)
+	case string:
+		s = v
+	default:
+		return errors.New("unsupported webhook event types value")
+	}
+	*t = nil
+	if s != "" {
+		*t = strings.Split(s, ",")
+	}
+	return nil
+}
+
+// Matches reports whether the filter lets eventType through.
+func (t WebhookEventTypes) Matches(eventType string) bool {
+	if len(t) == 0 || eventType == WebhookEventPing {
+		return true
+	}
+	for _, e := range t {
+		if e == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// WebhookSubscription sends events to URL. A subscription with a team only
+// receives that team's events; a global one receives every event. Payloads
+// are signed with Secret, which is only shown when it is generated.
+type WebhookSubscription struct {
+	ID              string            `gorm:"type:char(36);primaryKey" json:"id"`
+	TeamID          *string           `gorm:"type:char(36);index" json:"team_id,omitempty"`
+	URL             string            `gorm:"type:varchar(1024);not null" json:"url"`
+	Secret          string            `gorm:"type:varchar(100);not null" json:"-"`
+	EventTypes      WebhookEventTypes `gorm:"type:text" json:"event_types"`
+	Description     string            `gorm:"type:varchar(255)" json:"description"`
+	Active          bool              `gorm:"default:true;index" json:"active"`
+	CreatedByUserID string            `gorm:"type:char(36)" json:"created_by_user_id"`
+	CreatedAt       time.Time         `gorm:"index" json:"created_at"`
+	UpdatedAt       time.Time         `json:"updated_at"`
+}
+
+func (s *WebhookSubscription) BeforeCreate(tx *gorm.DB) (err error) {
+	if s.ID == "" {
+		s.ID = uuid.New().String()
+	}
+	return
+}
+
+// WebhookSubscriptionInput is used to create and update subscriptions.
+// Omitted fields keep their current value.
+type WebhookSubscriptionInput struct {
+	TeamID      *string   `json:"team_id,omitempty"`
+	URL         *string   `json:"url" example:"https://erp.example.com/hooks/tawtheeq"`
+	EventTypes  *[]string `json:"event_types" example:"document.signed,document.revoked"`
+	Description *string   `json:"description" example:"ERP archive"`
+	Active      *bool     `json:"active"`
+}
+
+// WebhookSecretResponse returns a subscription with its signing secret.
+type WebhookSecretResponse struct {
+	WebhookSubscription
+	Secret string `json:"secret"`
+}
+
+// WebhookEvent is the JSON body posted to subscribers.
+type WebhookEvent struct {
+	ID        string      `json:"id"`
+	Type      string      `json:"type"`
+	TeamID    *string     `json:"team_id,omitempty"`
+	CreatedAt time.Time   `json:"created_at"`
+	Data      interface{} `json:"data"`
+}
+
+// WebhookDelivery is one event sent to one subscription, with the status code
+// and duration of its last attempt. A redelivery is a new delivery pointing
+// at the original.
+type WebhookDelivery struct {
+	ID             string               `gorm:"type:char(36);primaryKey" json:"id"`
+	SubscriptionID string               `gorm:"type:char(36);not null;index" json:"subscription_id"`
+	Subscription   *WebhookSubscription `gorm:"foreignKey:SubscriptionID;constraint:OnDelete:CASCADE" json:"-"`
+	EventID        string               `gorm:"type:char(36);not null;index" json:"event_id"`
+	EventType      string               `gorm:"type:varchar(50);not null" json:"event_type"`
+	Payload        string               `gorm:"type:mediumtext" json:"payload"`
+	Status         string               `gorm:"type:varchar(20);not null;index" json:"status"`
+	Attempts       int                  `json:"attempts"`
+	ResponseStatus int                  `json:"response_status,omitempty"`
+	DurationMs     int64                `json:"duration_ms,omitempty"`
+	Error          string               `gorm:"type:text" json:"error,omitempty"`
+	RedeliveryOf   *string              `gorm:"type:char(36)" json:"redelivery_of,omitempty"`
+	NextAttemptAt  *time.Time           `gorm:"index" json:"next_attempt_at,omitempty"`
+	DeliveredAt    *time.Time           `json:"delivered_at,omitempty"`
+	CreatedAt      time.Time            `gorm:"index" json:"created_at"`
+	UpdatedAt      time.Time            `json:"updated_at"`
+}
+
+func (d *WebhookDelivery) BeforeCreate(tx *gorm.DB) (err error) {
+	if d.ID == "" {
+		d.ID = uuid.New().String()
+	}
+	return
+}
@@ -0,0 +1,78 @@
+package repositories
+
+import (
+	"tawtheeq-backend/models"
+
+	"gorm.io/gorm"
+)
+
+// AuditEventRepository only appends and reads; audit events are never
+// changed.
+type AuditEventRepository struct {
+	db *gorm.DB
+}
+
+func NewAuditEventRepository(db *gorm.DB) *AuditEventRepository {
+	return &AuditEventRepository{db}
+}
+
+func (r *AuditEventRepository) Create(event *models.AuditEvent) error {
+	return r.db.Create(event).Error
+}
+
+func (r *AuditEventRepository) filtered(filter models.AuditEventFilter) *gorm.DB {
+	query := r.db.Model(&models.AuditEvent{})
+	if filter.ActorID != "" {
+		query = query.Where("actor_id = ?", filter.ActorID)
+	}
+	if filter.Action != "" {
+		query = query.Where("action = ?", filter.Action)
+	}
+	if filter.TargetType != "" {
+		query = query.Where("target_type = ?", filter.TargetType)
+	}
+	if filter.TargetID != "" {
+		query = query.Where("target_id = ?", filter.TargetID)
+	}
+	if filter.RequestID != "" {
+		query = query.Where("request_id = ?", filter.RequestID)
+	}
+	if filter.From != nil {
+		query = query.Where("created_at >= ?", *filter.From)
+	}
+	if filter.To != nil {
+		query = query.Where("created_at < ?", *filter.To)
+	}
+	return query
+}
+
+func (r *AuditEventRepository) Find(filter models.AuditEventFilter, p models.Pagination) ([]models.AuditEvent, int64, error) {
+	total, err := countRows(r.filtered(filter))
+	if err != nil {
+		return nil, 0, err
+	}
+	var events []models.AuditEvent
+	err = paginate(r.filtered(filter), "created_at", p).Find(&events).Error
+	return events, total, err
+}
+
+// Each calls fn for every matching event, oldest first, in batches so large
+// exports do not load the whole table.
+func (r *AuditEventRepository) Each(filter models.AuditEventFilter, fn func(models.AuditEvent) error) error {
+	const batchSize = 500
+	for offset := 0; ; offset += batchSize {
+		var batch []models.AuditEvent
+		err := r.filtered(filter).Order("created_at ASC, id ASC").Limit(batchSize).Offset(offset).Find(&batch).Error
+		if err != nil {
+			return err
+		}
+		for _, e := range batch {
+			if err := fn(e); err != nil {
+				return err
+			}
+		}
+		if len(batch) < batchSize {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package repositories
+
+import (
+	"tawtheeq-backend/models"
+
+	"gorm.io/gorm"
+)
+
+type DocumentContentRepository struct {
+	db *gorm.DB
+}
+
+func NewDocumentContentRepository(db *gorm.DB) *DocumentContentRepository {
+	return &DocumentContentRepository{db}
+}
+
+func (r *DocumentContentRepository) Create(content *models.DocumentContent) error {
+	return r.db.Create(content).Error
+}
+
+// FindByDocumentIDs returns the extracted text of the given documents keyed
+// by document ID.
+func (r *DocumentContentRepository) FindByDocumentIDs(ids []string) (map[string]models.DocumentContent, error) {
+	contents := map[string]models.DocumentContent{}
+	if len(ids) == 0 {
+		return contents, nil
+	}
+	var rows []models.DocumentContent
+	if err := r.db.Where("document_id IN ?", ids).Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		contents[row.DocumentID] = row
+	}
+	return contents, nil
+}
@@ -0,0 +1,65 @@
+package repositories
+
+import (
+	"time"
+
+	"tawtheeq-backend/models"
+
+	"gorm.io/gorm"
+)
+
+type DocumentExportRepository struct {
+	db *gorm.DB
+}
+
+func NewDocumentExportRepository(db *gorm.DB) *DocumentExportRepository {
+	return &DocumentExportRepository{db}
+}
+
+func (r *DocumentExportRepository) Create(export *models.DocumentExport) error {
+	return r.db.Create(export).Error
+}
+
+func (r *DocumentExportRepository) Update(export *models.DocumentExport) error {
+	return r.db.Save(export).Error
+}
+
+func (r *DocumentExportRepository) FindByID(id string) (*models.DocumentExport, error) {
+	var export models.DocumentExport
+	err := r.db.First(&export, "id = ?", id).Error
+	return &export, err
+}
+
+// FindByUser lists the exports requested by userID, or every export when
+// userID is empty.
+func (r *DocumentExportRepository) FindByUser(userID string, p models.Pagination) ([]models.DocumentExport, int64, error) {
+	query := r.db.Model(&models.DocumentExport{})
+	if userID != "" {
+		query = query.Where("requested_by_user_id = ?", userID)
+	}
+	total, err := countRows(query)
+	if err != nil {
+		return nil, 0, err
+	}
+	var exports []models.DocumentExport
+	err = paginate(query, "created_at", p).Find(&exports).Error
+	return exports, total, err
+}
+
+// FindExpired returns exports whose files are due for removal.
+func (r *DocumentExportRepository) FindExpired(now time.Time) ([]models.DocumentExport, error) {
+	var exports []models.DocumentExport
+	err := r.db.Where("expires_at IS NOT NULL AND expires_at < ?", now).Find(&exports).Error
+	return exports, err
+}
+
+func (r *DocumentExportRepository) Delete(id string) error {
+	return r.db.Delete(&models.DocumentExport{}, "id = ?", id).Error
+}
+
+// MarkRunningAsFailed closes exports left running by a previous process.
+func (r *DocumentExportRepository) MarkRunningAsFailed(reason string) error {
+	return r.db.Model(&models.DocumentExport{}).
+		Where("status = ?", models.ExportStatusRunning).
+		Updates(map[string]interface{}{"status": models.ExportStatusFailed, "error": reason}).Error
+}
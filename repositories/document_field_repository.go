@@ -0,0 +1,35 @@
+package repositories
+
+import (
+	"tawtheeq-backend/models"
+
+	"gorm.io/gorm"
+)
+
+type DocumentFieldRepository struct {
+	db *gorm.DB
+}
+
+func NewDocumentFieldRepository(db *gorm.DB) *DocumentFieldRepository {
+	return &DocumentFieldRepository{db}
+}
+
+func (r *DocumentFieldRepository) FindByTeam(teamID string) ([]models.DocumentField, error) {
+	var fields []models.DocumentField
+	err := r.db.Where("team_id = ?", teamID).Order("position ASC").Find(&fields).Error
+	return fields, err
+}
+
+// ReplaceForTeam swaps the custom field definitions of a team for fields.
+// Values already stored on documents are left untouched.
+func (r *DocumentFieldRepository) ReplaceForTeam(teamID string, fields []models.DocumentField) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("team_id = ?", teamID).Delete(&models.DocumentField{}).Error; err != nil {
+			return err
+		}
+		if len(fields) == 0 {
+			return nil
+		}
+		return tx.Create(&fields).Error
+	})
+}
@@ -1,9 +1,16 @@
 package repositories
 
 import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
 	"tawtheeq-backend/models"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type DocumentRepository struct {
@@ -21,16 +28,57 @@ func (r *DocumentRepository) Create(doc *models.Document) error {
 func (r *DocumentRepository) FindByID(id string) (*models.Document, error) {
 	var doc models.Document
 	err := r.db.First(&doc, "id = ?", id).Error
+	return &doc, err
+}
 
-	if err == nil {
-		doc.VerificationCount++
-		err = r.db.Save(&doc).Error
+// IncrementVerificationCount bumps the verification counter of the given
+// documents by their number of occurrences in ids.
+func (r *DocumentRepository) IncrementVerificationCount(ids map[string]int) error {
+	for id, n := range ids {
+		err := r.db.Model(&models.Document{}).Where("id = ?", id).
+			UpdateColumn("verification_count", gorm.Expr("verification_count + ?", n)).Error
 		if err != nil {
-			return nil, err
+			return err
 		}
 	}
+	return nil
+}
 
-	return &doc, err
+// hashLockTimeout is how long an upload waits for another upload of the same
+// content, in seconds.
+const hashLockTimeout = 30
+
+// WithHashLock runs fn while holding a MySQL named lock on hash. Duplicates
+// are checked per scope, so no unique index covers them; the lock keeps two
+// uploads of the same content from both passing the check before either row
+// is inserted.
+func (r *DocumentRepository) WithHashLock(hash string, fn func() error) error {
+	sqlDB, err := r.db.DB()
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	// named locks belong to a connection, so one is kept for the whole call
+	conn, err := sqlDB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	name := "document-hash-" + hash
+	if len(name) > 64 {
+		name = name[:64]
+	}
+	var acquired sql.NullInt64
+	if err := conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, ?)", name, hashLockTimeout).Scan(&acquired); err != nil {
+		return err
+	}
+	if !acquired.Valid || acquired.Int64 != 1 {
+		return fmt.Errorf("timed out waiting for the lock on document hash %s", hash)
+	}
+	defer conn.ExecContext(ctx, "SELECT RELEASE_LOCK(?)", name)
+
+	return fn()
 }
 
 func (r *DocumentRepository) FindByHash(hash string) (*models.Document, error) {
@@ -42,6 +90,24 @@ func (r *DocumentRepository) FindByHash(hash string) (*models.Document, error) {
 	return &doc, nil
 }
 
+func (r *DocumentRepository) FindByHashForUser(hash string, userID string) (*models.Document, error) {
+	var doc models.Document
+	err := r.db.Where("hash = ? AND signed_by_user_id = ?", hash, userID).First(&doc).Error
+	if err != nil {
+		return nil, err
+	}
+	return &doc, nil
+}
+
+func (r *DocumentRepository) FindByHashForTeam(hash string, teamID string) (*models.Document, error) {
+	var doc models.Document
+	err := r.db.Where("hash = ? AND signed_by_team_id = ?", hash, teamID).First(&doc).Error
+	if err != nil {
+		return nil, err
+	}
+	return &doc, nil
+}
+
 func (r *DocumentRepository) FindByIDHidden(id string) (*models.Document, error) {
 	var doc models.Document
 	err := r.db.First(&doc, "id = ? AND is_hidden = ?", id, true).Error
@@ -54,58 +120,52 @@ func (r *DocumentRepository) FindByIDVisible(id string) (*models.Document, error
 	return &doc, err
 }
 
-func (r *DocumentRepository) FindAll(limit int, offset int) ([]models.Document, error) {
+// list returns the page p of the documents matching query, newest first,
+// and how many match in all.
+func (r *DocumentRepository) list(query *gorm.DB, p models.Pagination) ([]models.Document, int64, error) {
+	total, err := countRows(query)
+	if err != nil {
+		return nil, 0, err
+	}
 	var docs []models.Document
-	err := r.db.Limit(limit).Offset(offset).Find(&docs).Error
-	return docs, err
+	err = paginate(query.Preload("Tags"), "created_at", p).Find(&docs).Error
+	return docs, total, err
 }
 
-func (r *DocumentRepository) FindAllHidden(limit int, offset int) ([]models.Document, error) {
-	var docs []models.Document
-	err := r.db.Where("is_hidden = ?", true).Limit(limit).Offset(offset).Find(&docs).Error
-	return docs, err
+func (r *DocumentRepository) FindAll(p models.Pagination) ([]models.Document, int64, error) {
+	return r.list(r.db.Model(&models.Document{}), p)
 }
 
-func (r *DocumentRepository) FindAllVisible(limit int, offset int) ([]models.Document, error) {
-	var docs []models.Document
-	err := r.db.Where("is_hidden = ?", false).Limit(limit).Offset(offset).Find(&docs).Error
-	return docs, err
+func (r *DocumentRepository) FindAllHidden(p models.Pagination) ([]models.Document, int64, error) {
+	return r.list(r.db.Model(&models.Document{}).Where("is_hidden = ?", true), p)
 }
 
-func (r *DocumentRepository) FindByUser(userID string, limit int, offset int) ([]models.Document, error) {
-	var docs []models.Document
-	err := r.db.Where("signed_by_user_id = ?", userID).Limit(limit).Offset(offset).Find(&docs).Error
-	return docs, err
+func (r *DocumentRepository) FindAllVisible(p models.Pagination) ([]models.Document, int64, error) {
+	return r.list(r.db.Model(&models.Document{}).Where("is_hidden = ?", false), p)
 }
 
-func (r *DocumentRepository) FindByUserHidden(userID string, limit int, offset int) ([]models.Document, error) {
-	var docs []models.Document
-	err := r.db.Where("signed_by_user_id = ? AND is_hidden = ?", userID, true).Limit(limit).Offset(offset).Find(&docs).Error
-	return docs, err
+func (r *DocumentRepository) FindByUser(userID string, p models.Pagination) ([]models.Document, int64, error) {
+	return r.list(r.db.Model(&models.Document{}).Where("signed_by_user_id = ?", userID), p)
 }
 
-func (r *DocumentRepository) FindByUserVisible(userID string, limit int, offset int) ([]models.Document, error) {
-	var docs []models.Document
-	err := r.db.Where("signed_by_user_id = ? AND is_hidden = ?", userID, false).Limit(limit).Offset(offset).Find(&docs).Error
-	return docs, err
+func (r *DocumentRepository) FindByUserHidden(userID string, p models.Pagination) ([]models.Document, int64, error) {
+	return r.list(r.db.Model(&models.Document{}).Where("signed_by_user_id = ? AND is_hidden = ?", userID, true), p)
 }
 
-func (r *DocumentRepository) FindByTeam(teamID string, limit int, offset int) ([]models.Document, error) {
-	var docs []models.Document
-	err := r.db.Where("signed_by_team_id = ?", teamID).Limit(limit).Offset(offset).Find(&docs).Error
-	return docs, err
+func (r *DocumentRepository) FindByUserVisible(userID string, p models.Pagination) ([]models.Document, int64, error) {
+	return r.list(r.db.Model(&models.Document{}).Where("signed_by_user_id = ? AND is_hidden = ?", userID, false), p)
 }
 
-func (r *DocumentRepository) FindByTeamHidden(teamID string, limit int, offset int) ([]models.Document, error) {
-	var docs []models.Document
-	err := r.db.Where("signed_by_team_id = ? AND is_hidden = ?", teamID, true).Limit(limit).Offset(offset).Find(&docs).Error
-	return docs, err
+func (r *DocumentRepository) FindByTeam(teamID string, p models.Pagination) ([]models.Document, int64, error) {
+	return r.list(r.db.Model(&models.Document{}).Where("signed_by_team_id = ?", teamID), p)
 }
 
-func (r *DocumentRepository) FindByTeamVisible(teamID string, limit int, offset int) ([]models.Document, error) {
-	var docs []models.Document
-	err := r.db.Where("signed_by_team_id = ? AND is_hidden = ?", teamID, false).Limit(limit).Offset(offset).Find(&docs).Error
-	return docs, err
+func (r *DocumentRepository) FindByTeamHidden(teamID string, p models.Pagination) ([]models.Document, int64, error) {
+	return r.list(r.db.Model(&models.Document{}).Where("signed_by_team_id = ? AND is_hidden = ?", teamID, true), p)
+}
+
+func (r *DocumentRepository) FindByTeamVisible(teamID string, p models.Pagination) ([]models.Document, int64, error) {
+	return r.list(r.db.Model(&models.Document{}).Where("signed_by_team_id = ? AND is_hidden = ?", teamID, false), p)
 }
 
 func (r *DocumentRepository) Count() (int64, error) {
@@ -155,6 +215,7 @@ func (r *DocumentRepository) FindWithRelations(id string) (*models.Document, err
 	err := r.db.
 		Preload("SignedByUser").
 		Preload("SignedByTeam").
+		Preload("Tags").
 		First(&doc, "id = ?", id).Error
 	return &doc, err
 }
@@ -164,6 +225,7 @@ func (r *DocumentRepository) FindWithRelationsHidden(id string) (*models.Documen
 	err := r.db.
 		Preload("SignedByUser").
 		Preload("SignedByTeam").
+		Preload("Tags").
 		First(&doc, "id = ? AND is_hidden = ?", id, true).Error
 	return &doc, err
 }
@@ -173,6 +235,335 @@ func (r *DocumentRepository) FindWithRelationsVisible(id string) (*models.Docume
 	err := r.db.
 		Preload("SignedByUser").
 		Preload("SignedByTeam").
+		Preload("Tags").
 		First(&doc, "id = ? AND is_hidden = ?", id, false).Error
 	return &doc, err
 }
+
+// FindBatch returns documents ordered by ID, for jobs that walk every row.
+// Documents in the trash are included since their files are still stored.
+func (r *DocumentRepository) FindBatch(limit int, offset int) ([]models.Document, error) {
+	var docs []models.Document
+	err := r.db.Unscoped().Order("id ASC").Limit(limit).Offset(offset).Find(&docs).Error
+	return docs, err
+}
+
+// SetFileSize records the stored size of a document, including documents in
+// the trash.
+func (r *DocumentRepository) SetFileSize(id string, size int64) error {
+	return r.db.Unscoped().Model(&models.Document{}).Where("id = ?", id).UpdateColumn("file_size", size).Error
+}
+
+// FindWithoutStorageKey returns documents, including those in the trash,
+// signed before storage keys were recorded.
+func (r *DocumentRepository) FindWithoutStorageKey() ([]models.Document, error) {
+	var docs []models.Document
+	err := r.db.Unscoped().Select("id", "original_name", "signature").Where("storage_key = ''").Find(&docs).Error
+	return docs, err
+}
+
+// CountWithoutStorageKey counts documents whose stored file is not known.
+func (r *DocumentRepository) CountWithoutStorageKey() (int64, error) {
+	var count int64
+	err := r.db.Unscoped().Model(&models.Document{}).Where("storage_key = ''").Count(&count).Error
+	return count, err
+}
+
+// StorageKeys returns every recorded storage key.
+func (r *DocumentRepository) StorageKeys() ([]string, error) {
+	var keys []string
+	err := r.db.Unscoped().Model(&models.Document{}).Where("storage_key <> ''").Pluck("storage_key", &keys).Error
+	return keys, err
+}
+
+// SetStorageKey records where the file of a document signed before storage
+// keys were recorded is stored. Documents that have a key keep it.
+func (r *DocumentRepository) SetStorageKey(id string, key string) error {
+	return r.db.Unscoped().Model(&models.Document{}).Where("id = ? AND storage_key = ''", id).UpdateColumn("storage_key", key).Error
+}
+
+// UpdateMetadata stores the descriptive fields of doc and replaces its tags.
+func (r *DocumentRepository) UpdateMetadata(doc *models.Document) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(doc).Omit(clause.Associations).
+			Select("title", "description", "reference_number", "custom_fields", "metadata_signature").
+			Updates(doc).Error
+		if err != nil {
+			return err
+		}
+		if err := tx.Where("document_id = ?", doc.ID).Delete(&models.DocumentTag{}).Error; err != nil {
+			return err
+		}
+		if len(doc.Tags) == 0 {
+			return nil
+		}
+		for i := range doc.Tags {
+			doc.Tags[i].ID = ""
+			doc.Tags[i].DocumentID = doc.ID
+		}
+		return tx.Create(&doc.Tags).Error
+	})
+}
+
+// SoftDelete moves a document to the trash.
+func (r *DocumentRepository) SoftDelete(id string, deletedByUserID string) error {
+	return r.db.Model(&models.Document{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"deleted_at":         time.Now(),
+		"deleted_by_user_id": deletedByUserID,
+	}).Error
+}
+
+// Restore takes a document out of the trash.
+func (r *DocumentRepository) Restore(id string) error {
+	return r.db.Unscoped().Model(&models.Document{}).Where("id = ? AND deleted_at IS NOT NULL", id).Updates(map[string]interface{}{
+		"deleted_at":         nil,
+		"deleted_by_user_id": nil,
+	}).Error
+}
+
+// FindDeletedWithRelations returns a document from the trash.
+func (r *DocumentRepository) FindDeletedWithRelations(id string) (*models.Document, error) {
+	var doc models.Document
+	err := r.db.Unscoped().
+		Preload("SignedByUser").
+		Preload("SignedByTeam").
+		Preload("Tags").
+		First(&doc, "id = ? AND deleted_at IS NOT NULL", id).Error
+	return &doc, err
+}
+
+// trash scopes the query to deleted documents, optionally of one signer or
+// team.
+func (r *DocumentRepository) trash(userID string, teamID string) *gorm.DB {
+	q := r.db.Unscoped().Model(&models.Document{}).Where("deleted_at IS NOT NULL")
+	if userID != "" {
+		q = q.Where("signed_by_user_id = ?", userID)
+	}
+	if teamID != "" {
+		q = q.Where("signed_by_team_id = ?", teamID)
+	}
+	return q
+}
+
+// FindTrash lists deleted documents, most recently deleted first, and
+// counts them. Empty userID and teamID list the whole trash.
+func (r *DocumentRepository) FindTrash(userID string, teamID string, p models.Pagination) ([]models.Document, int64, error) {
+	query := r.trash(userID, teamID)
+	total, err := countRows(query)
+	if err != nil {
+		return nil, 0, err
+	}
+	var docs []models.Document
+	err = paginate(query.Preload("SignedByUser").Preload("SignedByTeam").Preload("Tags"), "deleted_at", p).
+		Find(&docs).Error
+	return docs, total, err
+}
+
+// FindDeletedBefore returns documents that went to the trash before cutoff.
+func (r *DocumentRepository) FindDeletedBefore(cutoff time.Time, limit int) ([]models.Document, error) {
+	var docs []models.Document
+	err := r.db.Unscoped().
+		Where("deleted_at IS NOT NULL AND deleted_at < ?", cutoff).
+		Order("deleted_at ASC").
+		Limit(limit).
+		Find(&docs).Error
+	return docs, err
+}
+
+// FindPurgeNoticeDue returns documents that went to the trash between from
+// and to and whose signer was not told yet, since that deletion, that they
+// are about to be purged.
+func (r *DocumentRepository) FindPurgeNoticeDue(from time.Time, to time.Time, limit int) ([]models.Document, error) {
+	var docs []models.Document
+	err := r.db.Unscoped().
+		Where("deleted_at >= ? AND deleted_at < ?", from, to).
+		Where("NOT EXISTS (SELECT 1 FROM email_messages e WHERE e.template = ? AND e.reference = documents.id AND e.created_at >= documents.deleted_at)", models.EmailDocumentExpiring).
+		Order("deleted_at ASC").
+		Limit(limit).
+		Find(&docs).Error
+	return docs, err
+}
+
+// Purge removes a document row for good, including its perceptual hashes,
+// tags and extracted text.
+func (r *DocumentRepository) Purge(id string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&models.DocumentPerceptualHash{}, "document_id = ?", id).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&models.DocumentTag{}, "document_id = ?", id).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&models.DocumentContent{}, "document_id = ?", id).Error; err != nil {
+			return err
+		}
+		return tx.Unscoped().Delete(&models.Document{}, "id = ?", id).Error
+	})
+}
+
+// documentSortColumns are the indexed columns a document search can sort on.
+var documentSortColumns = map[string]bool{
+	"created_at":         true,
+	"updated_at":         true,
+	"title":              true,
+	"reference_number":   true,
+	"file_format":        true,
+	"verification_count": true,
+}
+
+// ValidDocumentSort reports whether column can be used to sort a search.
+func ValidDocumentSort(column string) bool {
+	return documentSortColumns[column]
+}
+
+// escapeLike escapes the LIKE wildcards in s.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
+func (r *DocumentRepository) searched(filter models.DocumentSearchFilter) *gorm.DB {
+	query := r.db.Model(&models.Document{})
+	if filter.ScopeTeamID != "" {
+		query = query.Where("(documents.signed_by_user_id = ? OR documents.signed_by_team_id = ?)", filter.ScopeUserID, filter.ScopeTeamID)
+	} else if filter.ScopeUserID != "" {
+		query = query.Where("documents.signed_by_user_id = ?", filter.ScopeUserID)
+	}
+	if filter.Query != "" {
+		like := "%" + escapeLike(filter.Query) + "%"
+		query = query.Where("(documents.original_name LIKE ? OR documents.title LIKE ? OR documents.reference_number LIKE ?)", like, like, like)
+	}
+	if filter.OriginalName != "" {
+		query = query.Where("documents.original_name LIKE ?", "%"+escapeLike(filter.OriginalName)+"%")
+	}
+	if filter.FileFormat != "" {
+		query = query.Where("documents.file_format = ?", filter.FileFormat)
+	}
+	if filter.SignedByUserID != "" {
+		query = query.Where("documents.signed_by_user_id = ?", filter.SignedByUserID)
+	}
+	if filter.SignedByTeamID != "" {
+		query = query.Where("documents.signed_by_team_id = ?", filter.SignedByTeamID)
+	}
+	if filter.HashPrefix != "" {
+		query = query.Where("documents.hash LIKE ?", escapeLike(filter.HashPrefix)+"%")
+	}
+	if filter.Hidden != nil {
+		query = query.Where("documents.is_hidden = ?", *filter.Hidden)
+	}
+	for _, tag := range filter.Tags {
+		query = query.Where("EXISTS (SELECT 1 FROM document_tags WHERE document_tags.document_id = documents.id AND document_tags.tag = ?)", tag)
+	}
+	if filter.From != nil {
+		query = query.Where("documents.created_at >= ?", *filter.From)
+	}
+	if filter.To != nil {
+		query = query.Where("documents.created_at < ?", *filter.To)
+	}
+	return query
+}
+
+// Search returns the page p of the documents matching filter sorted on sort
+// (one of the documentSortColumns) in ascending or descending order, and
+// how many match in all. Cursors only apply to the newest first order.
+func (r *DocumentRepository) Search(filter models.DocumentSearchFilter, sort string, desc bool, p models.Pagination) ([]models.Document, int64, error) {
+	total, err := countRows(r.searched(filter))
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var docs []models.Document
+	query := r.searched(filter).
+		Preload("SignedByUser").
+		Preload("SignedByTeam").
+		Preload("Tags")
+	if sort == "created_at" && desc {
+		err = paginate(query, "documents.created_at", p).Find(&docs).Error
+		return docs, total, err
+	}
+
+	if !ValidDocumentSort(sort) {
+		sort = "created_at"
+	}
+	direction := "ASC"
+	if desc {
+		direction = "DESC"
+	}
+	err = query.
+		Order("documents." + sort + " " + direction).
+		Order("documents.id " + direction).
+		Limit(p.Limit).Offset(p.Offset()).
+		Find(&docs).Error
+	return docs, total, err
+}
+
+func (r *DocumentRepository) CountSearch(filter models.DocumentSearchFilter) (int64, error) {
+	return countRows(r.searched(filter))
+}
+
+// EachSearch calls fn for every document matching filter, oldest first, in
+// batches so large registers do not load the whole table.
+func (r *DocumentRepository) EachSearch(filter models.DocumentSearchFilter, fn func(models.Document) error) error {
+	const batchSize = 500
+	var after *models.Cursor
+	for {
+		query := r.searched(filter).Preload("SignedByUser").Preload("SignedByTeam")
+		if after != nil {
+			query = query.Where("(documents.created_at > ? OR (documents.created_at = ? AND documents.id > ?))", after.Time, after.Time, after.ID)
+		}
+		var batch []models.Document
+		err := query.Order("documents.created_at ASC").Order("documents.id ASC").Limit(batchSize).Find(&batch).Error
+		if err != nil {
+			return err
+		}
+		for _, doc := range batch {
+			if err := fn(doc); err != nil {
+				return err
+			}
+		}
+		if len(batch) < batchSize {
+			return nil
+		}
+		last := batch[len(batch)-1]
+		after = &models.Cursor{Time: last.CreatedAt, ID: last.ID}
+	}
+}
+
+// SearchContent ranks the documents matching filter whose extracted text
+// matches the FULLTEXT boolean query match, most relevant first.
+func (r *DocumentRepository) SearchContent(filter models.DocumentSearchFilter, match string, p models.Pagination) ([]models.DocumentContentMatch, error) {
+	var matches []models.DocumentContentMatch
+	err := r.searched(filter).
+		Select("documents.id AS document_id, MATCH(document_contents.normalized_text) AGAINST (? IN BOOLEAN MODE) AS score", match).
+		Joins("JOIN document_contents ON document_contents.document_id = documents.id").
+		Where("MATCH(document_contents.normalized_text) AGAINST (? IN BOOLEAN MODE)", match).
+		Order("score DESC").
+		Order("documents.created_at DESC").
+		Limit(p.Limit).Offset(p.Offset()).
+		Scan(&matches).Error
+	return matches, err
+}
+
+func (r *DocumentRepository) CountContent(filter models.DocumentSearchFilter, match string) (int64, error) {
+	var count int64
+	err := r.searched(filter).
+		Joins("JOIN document_contents ON document_contents.document_id = documents.id").
+		Where("MATCH(document_contents.normalized_text) AGAINST (? IN BOOLEAN MODE)", match).
+		Count(&count).Error
+	return count, err
+}
+
+// FindWithRelationsByIDs returns the documents with the given IDs, in no
+// particular order.
+func (r *DocumentRepository) FindWithRelationsByIDs(ids []string) ([]models.Document, error) {
+	var docs []models.Document
+	if len(ids) == 0 {
+		return docs, nil
+	}
+	err := r.db.
+		Preload("SignedByUser").
+		Preload("SignedByTeam").
+		Preload("Tags").
+		Where("id IN ?", ids).
+		Find(&docs).Error
+	return docs, err
+}
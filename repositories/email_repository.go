@@ -0,0 +1,80 @@
+package repositories
+
+import (
+	"time"
+
+	"tawtheeq-backend/models"
+
+	"gorm.io/gorm"
+)
+
+type EmailRepository struct {
+	db *gorm.DB
+}
+
+func NewEmailRepository(db *gorm.DB) *EmailRepository {
+	return &EmailRepository{db}
+}
+
+func (r *EmailRepository) Create(msg *models.EmailMessage) error {
+	return r.db.Create(msg).Error
+}
+
+func (r *EmailRepository) Update(msg *models.EmailMessage) error {
+	return r.db.Save(msg).Error
+}
+
+func (r *EmailRepository) FindByID(id string) (*models.EmailMessage, error) {
+	var msg models.EmailMessage
+	err := r.db.First(&msg, "id = ?", id).Error
+	return &msg, err
+}
+
+// FindAll lists the outbox, optionally only emails with status or of
+// template.
+func (r *EmailRepository) FindAll(status string, template string, p models.Pagination) ([]models.EmailMessage, int64, error) {
+	query := r.db.Model(&models.EmailMessage{})
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if template != "" {
+		query = query.Where("template = ?", template)
+	}
+	total, err := countRows(query)
+	if err != nil {
+		return nil, 0, err
+	}
+	var msgs []models.EmailMessage
+	err = paginate(query, "created_at", p).Find(&msgs).Error
+	return msgs, total, err
+}
+
+// FindDue returns pending emails whose next attempt is due.
+func (r *EmailRepository) FindDue(now time.Time, limit int) ([]models.EmailMessage, error) {
+	var msgs []models.EmailMessage
+	err := r.db.Where("status = ? AND next_attempt_at <= ?", models.EmailPending, now).
+		Order("next_attempt_at ASC").
+		Limit(limit).
+		Find(&msgs).Error
+	return msgs, err
+}
+
+// Claim moves the next attempt of a due email to until, so that other
+// instances skip it while it is being sent. It reports whether the email
+// was still due.
+func (r *EmailRepository) Claim(msg *models.EmailMessage, until time.Time) (bool, error) {
+	result := r.db.Model(&models.EmailMessage{}).
+		Where("id = ? AND status = ? AND next_attempt_at = ?", msg.ID, models.EmailPending, msg.NextAttemptAt).
+		UpdateColumn("next_attempt_at", until)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	msg.NextAttemptAt = &until
+	return result.RowsAffected == 1, nil
+}
+
+// DeleteFinishedBefore prunes sent and failed emails created before cutoff.
+func (r *EmailRepository) DeleteFinishedBefore(cutoff time.Time) (int64, error) {
+	result := r.db.Where("status <> ? AND created_at < ?", models.EmailPending, cutoff).Delete(&models.EmailMessage{})
+	return result.RowsAffected, result.Error
+}
@@ -0,0 +1,33 @@
+package repositories
+
+import (
+	"strings"
+
+	"tawtheeq-backend/models"
+
+	"gorm.io/gorm"
+)
+
+// paginate sorts query newest first on column, then on the id of the same
+// table, and limits it to the page p asks for. Cursor requests seek past the
+// cursor instead of skipping rows, so deep pages cost the same as the first.
+func paginate(query *gorm.DB, column string, p models.Pagination) *gorm.DB {
+	id := "id"
+	if i := strings.LastIndex(column, "."); i >= 0 {
+		id = column[:i+1] + "id"
+	}
+	if p.Cursor != nil {
+		query = query.Where("("+column+" < ? OR ("+column+" = ? AND "+id+" < ?))", p.Cursor.Time, p.Cursor.Time, p.Cursor.ID)
+	} else {
+		query = query.Offset(p.Offset())
+	}
+	return query.Order(column + " DESC").Order(id + " DESC").Limit(p.Limit)
+}
+
+// countRows returns the number of rows of query without changing it, so the
+// same query can then be paginated.
+func countRows(query *gorm.DB) (int64, error) {
+	var total int64
+	err := query.Session(&gorm.Session{}).Count(&total).Error
+	return total, err
+}
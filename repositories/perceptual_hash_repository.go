@@ -0,0 +1,56 @@
+package repositories
+
+import (
+	"tawtheeq-backend/models"
+
+	"gorm.io/gorm"
+)
+
+type PerceptualHashRepository struct {
+	db *gorm.DB
+}
+
+func NewPerceptualHashRepository(db *gorm.DB) *PerceptualHashRepository {
+	return &PerceptualHashRepository{db}
+}
+
+func (r *PerceptualHashRepository) CreateForDocument(documentID string, hashes []uint64) error {
+	if len(hashes) == 0 {
+		return nil
+	}
+
+	rows := make([]models.DocumentPerceptualHash, 0, len(hashes))
+	for page, hash := range hashes {
+		rows = append(rows, models.DocumentPerceptualHash{
+			DocumentID: documentID,
+			Page:       page,
+			Hash:       hash,
+		})
+	}
+	return r.db.Create(&rows).Error
+}
+
+func (r *PerceptualHashRepository) FindByDocument(documentID string) ([]models.DocumentPerceptualHash, error) {
+	var hashes []models.DocumentPerceptualHash
+	err := r.db.Where("document_id = ?", documentID).Order("page ASC").Find(&hashes).Error
+	return hashes, err
+}
+
+// FindSimilar returns the stored pages whose hash lies within maxDistance bits
+// of hash, closest first. Pages whose hash has fewer than minDetail set or
+// unset bits, such as blank pages, are left out.
+func (r *PerceptualHashRepository) FindSimilar(hash uint64, maxDistance int, minDetail int, limit int) ([]models.SimilarDocumentMatch, error) {
+	var matches []models.SimilarDocumentMatch
+	err := r.db.Model(&models.DocumentPerceptualHash{}).
+		Select("document_id, page, BIT_COUNT(hash ^ ?) AS distance", hash).
+		Where("BIT_COUNT(hash ^ ?) <= ?", hash, maxDistance).
+		Where("BIT_COUNT(hash) BETWEEN ? AND ?", minDetail, 64-minDetail).
+		Order("distance ASC").
+		Limit(limit).
+		Scan(&matches).Error
+	return matches, err
+}
+
+func (r *PerceptualHashRepository) DeleteByDocument(documentID string) error {
+	return r.db.Delete(&models.DocumentPerceptualHash{}, "document_id = ?", documentID).Error
+}
@@ -0,0 +1,81 @@
+package repositories
+
+import (
+	"time"
+
+	"tawtheeq-backend/models"
+
+	"gorm.io/gorm"
+)
+
+type RefreshTokenRepository struct {
+	db *gorm.DB
+}
+
+func NewRefreshTokenRepository(db *gorm.DB) *RefreshTokenRepository {
+	return &RefreshTokenRepository{db}
+}
+
+func (r *RefreshTokenRepository) Create(token *models.RefreshToken) error {
+	return r.db.Create(token).Error
+}
+
+func (r *RefreshTokenRepository) FindByHash(hash string) (*models.RefreshToken, error) {
+	var token models.RefreshToken
+	err := r.db.First(&token, "token_hash = ?", hash).Error
+	return &token, err
+}
+
+// Rotate revokes token in favour of replacement. It reports false when the
+// token was revoked in the meantime, such as by a concurrent refresh.
+func (r *RefreshTokenRepository) Rotate(token *models.RefreshToken, replacement *models.RefreshToken) (bool, error) {
+	rotated := false
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.RefreshToken{}).
+			Where("id = ? AND revoked_at IS NULL", token.ID).
+			Updates(map[string]interface{}{"revoked_at": time.Now(), "replaced_by_id": replacement.ID})
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		rotated = true
+		return tx.Create(replacement).Error
+	})
+	return rotated && err == nil, err
+}
+
+// RevokeFamily revokes the live tokens of a login. It returns every token
+// of the login whose access token has not expired yet, rotated ones
+// included, so all of those access tokens can be denied.
+func (r *RefreshTokenRepository) RevokeFamily(familyID string) ([]models.RefreshToken, error) {
+	return r.revoke("family_id = ?", familyID)
+}
+
+// RevokeUser revokes the live tokens of every login of a user and returns
+// the tokens whose access token has not expired yet.
+func (r *RefreshTokenRepository) RevokeUser(userID string) ([]models.RefreshToken, error) {
+	return r.revoke("user_id = ?", userID)
+}
+
+// revoke updates before it reads: a refresh that commits afterwards finds
+// its token revoked and issues nothing, and one that committed before has
+// its new token revoked and returned here.
+func (r *RefreshTokenRepository) revoke(condition string, value string) ([]models.RefreshToken, error) {
+	now := time.Now()
+	err := r.db.Model(&models.RefreshToken{}).
+		Where(condition, value).
+		Where("revoked_at IS NULL").
+		UpdateColumn("revoked_at", now).Error
+	if err != nil {
+		return nil, err
+	}
+
+	var tokens []models.RefreshToken
+	err = r.db.Where(condition, value).Where("access_expires_at > ?", now).Find(&tokens).Error
+	return tokens, err
+}
+
+// DeleteExpiredBefore prunes tokens that expired before cutoff.
+func (r *RefreshTokenRepository) DeleteExpiredBefore(cutoff time.Time) (int64, error) {
+	result := r.db.Where("expires_at < ?", cutoff).Delete(&models.RefreshToken{})
+	return result.RowsAffected, result.Error
+}
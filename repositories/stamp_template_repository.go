@@ -0,0 +1,75 @@
+package repositories
+
+import (
+	"tawtheeq-backend/models"
+
+	"gorm.io/gorm"
+)
+
+type StampTemplateRepository struct {
+	db *gorm.DB
+}
+
+func NewStampTemplateRepository(db *gorm.DB) *StampTemplateRepository {
+	return &StampTemplateRepository{db}
+}
+
+func (r *StampTemplateRepository) Create(tpl *models.StampTemplate) error {
+	return r.db.Create(tpl).Error
+}
+
+func (r *StampTemplateRepository) FindByID(id string) (*models.StampTemplate, error) {
+	var tpl models.StampTemplate
+	err := r.db.First(&tpl, "id = ?", id).Error
+	return &tpl, err
+}
+
+func (r *StampTemplateRepository) FindAll() ([]models.StampTemplate, error) {
+	var tpls []models.StampTemplate
+	err := r.db.Order("created_at ASC").Find(&tpls).Error
+	return tpls, err
+}
+
+// FindAvailableForTeam returns the team's own templates and the global ones.
+func (r *StampTemplateRepository) FindAvailableForTeam(teamID string) ([]models.StampTemplate, error) {
+	var tpls []models.StampTemplate
+	err := r.db.Where("team_id = ? OR team_id IS NULL", teamID).Order("created_at ASC").Find(&tpls).Error
+	return tpls, err
+}
+
+func (r *StampTemplateRepository) FindDefaultForTeam(teamID string) (*models.StampTemplate, error) {
+	var tpl models.StampTemplate
+	err := r.db.First(&tpl, "team_id = ? AND is_default = ?", teamID, true).Error
+	return &tpl, err
+}
+
+func (r *StampTemplateRepository) FindGlobalDefault() (*models.StampTemplate, error) {
+	var tpl models.StampTemplate
+	err := r.db.First(&tpl, "team_id IS NULL AND is_default = ?", true).Error
+	return &tpl, err
+}
+
+// SetDefault marks the template as the default of its scope and clears the
+// flag on its siblings.
+func (r *StampTemplateRepository) SetDefault(tpl *models.StampTemplate) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		scope := tx.Model(&models.StampTemplate{})
+		if tpl.TeamID != nil {
+			scope = scope.Where("team_id = ?", *tpl.TeamID)
+		} else {
+			scope = scope.Where("team_id IS NULL")
+		}
+		if err := scope.Update("is_default", false).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.StampTemplate{}).Where("id = ?", tpl.ID).Update("is_default", true).Error
+	})
+}
+
+func (r *StampTemplateRepository) Update(tpl *models.StampTemplate) error {
+	return r.db.Save(tpl).Error
+}
+
+func (r *StampTemplateRepository) Delete(id string) error {
+	return r.db.Delete(&models.StampTemplate{}, "id = ?", id).Error
+}
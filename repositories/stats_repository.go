@@ -0,0 +1,140 @@
+package repositories
+
+import (
+	"time"
+
+	"tawtheeq-backend/models"
+
+	"gorm.io/gorm"
+)
+
+// StatsRepository computes dashboard figures with SQL aggregates. Every
+// method takes a team ID; an empty one covers all teams. Documents in the
+// trash are included, since they were signed and their files are stored.
+type StatsRepository struct {
+	db *gorm.DB
+}
+
+func NewStatsRepository(db *gorm.DB) *StatsRepository {
+	return &StatsRepository{db}
+}
+
+func (r *StatsRepository) documents(teamID string) *gorm.DB {
+	query := r.db.Table("documents AS d")
+	if teamID != "" {
+		query = query.Where("d.signed_by_team_id = ?", teamID)
+	}
+	return query
+}
+
+func (r *StatsRepository) signedBetween(teamID string, from time.Time, to time.Time) *gorm.DB {
+	return r.documents(teamID).Where("d.created_at >= ? AND d.created_at < ?", from, to)
+}
+
+func (r *StatsRepository) verifications(teamID string, from time.Time, to time.Time) *gorm.DB {
+	query := r.db.Model(&models.VerificationEvent{}).Where("created_at >= ? AND created_at < ?", from, to)
+	if teamID != "" {
+		query = query.Where("team_id = ?", teamID)
+	}
+	return query
+}
+
+// DocumentTotals counts signed, hidden and revoked documents and the storage
+// they use in a single pass over the team's documents.
+func (r *StatsRepository) DocumentTotals(teamID string, from time.Time, to time.Time) (models.DocumentTotals, error) {
+	var totals models.DocumentTotals
+	err := r.documents(teamID).
+		Select(`COALESCE(SUM(d.created_at >= ? AND d.created_at < ?), 0) AS signed,
+			COALESCE(SUM(d.created_at >= ? AND d.created_at < ? AND d.is_hidden = ? AND d.deleted_at IS NULL), 0) AS hidden,
+			COALESCE(SUM(d.deleted_at >= ? AND d.deleted_at < ?), 0) AS revoked,
+			COALESCE(SUM(d.deleted_at IS NULL), 0) AS active,
+			COALESCE(SUM(d.file_size), 0) AS storage_bytes,
+			COALESCE(SUM(CASE WHEN d.created_at >= ? AND d.created_at < ? THEN d.file_size ELSE 0 END), 0) AS storage_added_bytes`,
+			from, to, from, to, true, from, to, from, to).
+		Scan(&totals).Error
+	return totals, err
+}
+
+// SignedPerPeriod counts signed documents per day, week or month.
+func (r *StatsRepository) SignedPerPeriod(teamID string, from time.Time, to time.Time, interval string) ([]models.StatsPeriodCount, error) {
+	var counts []models.StatsPeriodCount
+	err := r.signedBetween(teamID, from, to).
+		Select("DATE_FORMAT(d.created_at, ?) AS period, COUNT(*) AS count", periodFormats[interval]).
+		Group("period").
+		Order("period ASC").
+		Scan(&counts).Error
+	return counts, err
+}
+
+// ByFormat counts signed documents per file format.
+func (r *StatsRepository) ByFormat(teamID string, from time.Time, to time.Time) ([]models.StatsKeyCount, error) {
+	var counts []models.StatsKeyCount
+	err := r.signedBetween(teamID, from, to).
+		Select("d.file_format AS `key`, COUNT(*) AS count").
+		Group("d.file_format").
+		Order("count DESC").
+		Scan(&counts).Error
+	return counts, err
+}
+
+// ByTeam counts signed documents per team, largest first.
+func (r *StatsRepository) ByTeam(from time.Time, to time.Time) ([]models.StatsTeamCount, error) {
+	var counts []models.StatsTeamCount
+	err := r.signedBetween("", from, to).
+		Select("COALESCE(d.signed_by_team_id, '') AS team_id, COALESCE(t.name, '') AS name, COUNT(*) AS count").
+		Joins("LEFT JOIN teams t ON t.id = d.signed_by_team_id").
+		Group("d.signed_by_team_id, t.name").
+		Order("count DESC").
+		Scan(&counts).Error
+	return counts, err
+}
+
+// TopSigners returns the users who signed the most documents.
+func (r *StatsRepository) TopSigners(teamID string, from time.Time, to time.Time, limit int) ([]models.StatsSigner, error) {
+	var signers []models.StatsSigner
+	err := r.signedBetween(teamID, from, to).
+		Select("d.signed_by_user_id AS user_id, u.full_name, u.email, COUNT(*) AS count").
+		Joins("JOIN users u ON u.id = d.signed_by_user_id").
+		Group("d.signed_by_user_id, u.full_name, u.email").
+		Order("count DESC").
+		Limit(limit).
+		Scan(&signers).Error
+	return signers, err
+}
+
+// Verifications counts verifications by result, by method and per period.
+func (r *StatsRepository) Verifications(teamID string, from time.Time, to time.Time, interval string) (models.VerificationTotals, error) {
+	var totals models.VerificationTotals
+	err := r.verifications(teamID, from, to).
+		Select("result AS `key`, COUNT(*) AS count").
+		Group("result").
+		Order("count DESC").
+		Scan(&totals.ByResult).Error
+	if err != nil {
+		return totals, err
+	}
+	err = r.verifications(teamID, from, to).
+		Select("method AS `key`, COUNT(*) AS count").
+		Group("method").
+		Order("count DESC").
+		Scan(&totals.ByMethod).Error
+	if err != nil {
+		return totals, err
+	}
+	err = r.verifications(teamID, from, to).
+		Select("DATE_FORMAT(created_at, ?) AS period, COUNT(*) AS count", periodFormats[interval]).
+		Group("period").
+		Order("period ASC").
+		Scan(&totals.PerPeriod).Error
+	if err != nil {
+		return totals, err
+	}
+
+	for _, c := range totals.ByResult {
+		totals.Total += c.Count
+		if c.Key == models.VerificationResultValid {
+			totals.Valid = c.Count
+		}
+	}
+	return totals, nil
+}
@@ -0,0 +1,67 @@
+package repositories
+
+import (
+	"tawtheeq-backend/models"
+
+	"gorm.io/gorm"
+)
+
+type StorageScrubRepository struct {
+	db *gorm.DB
+}
+
+func NewStorageScrubRepository(db *gorm.DB) *StorageScrubRepository {
+	return &StorageScrubRepository{db}
+}
+
+func (r *StorageScrubRepository) CreateReport(report *models.StorageScrubReport) error {
+	return r.db.Omit("Issues").Create(report).Error
+}
+
+func (r *StorageScrubRepository) UpdateReport(report *models.StorageScrubReport) error {
+	return r.db.Omit("Issues").Save(report).Error
+}
+
+func (r *StorageScrubRepository) AddIssue(issue *models.StorageScrubIssue) error {
+	return r.db.Create(issue).Error
+}
+
+func (r *StorageScrubRepository) FindReports(p models.Pagination) ([]models.StorageScrubReport, int64, error) {
+	query := r.db.Model(&models.StorageScrubReport{})
+	total, err := countRows(query)
+	if err != nil {
+		return nil, 0, err
+	}
+	var reports []models.StorageScrubReport
+	err = paginate(query, "started_at", p).Find(&reports).Error
+	return reports, total, err
+}
+
+func (r *StorageScrubRepository) FindReportByID(id string) (*models.StorageScrubReport, error) {
+	var report models.StorageScrubReport
+	err := r.db.First(&report, "id = ?", id).Error
+	return &report, err
+}
+
+// FindIssues returns the issues of a report in the order they were found,
+// optionally only those of kind, and how many there are in all.
+func (r *StorageScrubRepository) FindIssues(reportID string, kind string, p models.Pagination) ([]models.StorageScrubIssue, int64, error) {
+	query := r.db.Model(&models.StorageScrubIssue{}).Where("report_id = ?", reportID)
+	if kind != "" {
+		query = query.Where("kind = ?", kind)
+	}
+	total, err := countRows(query)
+	if err != nil {
+		return nil, 0, err
+	}
+	var issues []models.StorageScrubIssue
+	err = query.Order("created_at ASC").Order("id ASC").Limit(p.Limit).Offset(p.Offset()).Find(&issues).Error
+	return issues, total, err
+}
+
+// MarkRunningAsFailed closes reports left running by a previous process.
+func (r *StorageScrubRepository) MarkRunningAsFailed(reason string) error {
+	return r.db.Model(&models.StorageScrubReport{}).
+		Where("status = ?", models.ScrubStatusRunning).
+		Updates(map[string]interface{}{"status": models.ScrubStatusFailed, "error": reason}).Error
+}
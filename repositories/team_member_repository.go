@@ -32,10 +32,15 @@ func (r *TeamMemberRepository) Update(member *models.TeamMember) error {
 	return r.db.Save(member).Error
 }
 
-func (r *TeamMemberRepository) GetMembersPaginated(teamID string, limit int, offset int) ([]models.TeamMember, error) {
+func (r *TeamMemberRepository) GetMembersPaginated(teamID string, p models.Pagination) ([]models.TeamMember, int64, error) {
+	query := r.db.Model(&models.TeamMember{}).Where("team_id = ?", teamID)
+	total, err := countRows(query)
+	if err != nil {
+		return nil, 0, err
+	}
 	var members []models.TeamMember
-	err := r.db.Where("team_id = ?", teamID).Limit(limit).Offset(offset).Find(&members).Error
-	return members, err
+	err = paginate(query, "created_at", p).Find(&members).Error
+	return members, total, err
 }
 
 func (r *TeamMemberRepository) CountMembers(teamID string) (int64, error) {
@@ -55,10 +55,15 @@ func (r *TeamRepository) Delete(id string) error {
 	return r.db.Delete(&models.Team{}, "id = ?", id).Error
 }
 
-func (r *TeamRepository) FindAllPaginated(limit int, offset int) ([]models.Team, error) {
+func (r *TeamRepository) FindAllPaginated(p models.Pagination) ([]models.Team, int64, error) {
+	query := r.db.Model(&models.Team{})
+	total, err := countRows(query)
+	if err != nil {
+		return nil, 0, err
+	}
 	var teams []models.Team
-	err := r.db.Limit(limit).Offset(offset).Find(&teams).Error
-	return teams, err
+	err = paginate(query, "created_at", p).Find(&teams).Error
+	return teams, total, err
 }
 
 func (r *TeamRepository) Count() (int64, error) {
@@ -30,15 +30,41 @@ func (r *UserRepository) FindByEmail(email string) (*models.User, error) {
 	return &user, err
 }
 
-func (r *UserRepository) FindAll(limit int, offset int) ([]models.User, error) {
-	var users []models.User
+// FindAccess returns the current role of a user and the team they lead or,
+// failing that, belong to. Like the login lookup it replaced, the team with
+// the lowest ID wins when there are several.
+func (r *UserRepository) FindAccess(id string) (*models.UserAccess, error) {
+	var user models.User
+	if err := r.db.Select("id", "role").First(&user, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	access := &models.UserAccess{Role: user.Role}
+
+	var teamIDs []string
+	err := r.db.Model(&models.Team{}).Where("leader_id = ?", id).Order("id ASC").Limit(1).Pluck("id", &teamIDs).Error
+	if err == nil && len(teamIDs) == 0 {
+		err = r.db.Model(&models.TeamMember{}).Where("user_id = ?", id).Order("team_id ASC").Limit(1).Pluck("team_id", &teamIDs).Error
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(teamIDs) > 0 {
+		access.TeamID = teamIDs[0]
+	}
+	return access, nil
+}
+
+func (r *UserRepository) FindAll(p models.Pagination) ([]models.User, int64, error) {
+	query := r.db.Model(&models.User{})
+	total, err := countRows(query)
+	if err != nil {
+		return nil, 0, err
+	}
 
-	err := r.db.
-		Limit(limit).
-		Offset(offset).
-		Find(&users).Error
+	var users []models.User
+	err = paginate(query, "created_at", p).Find(&users).Error
 
-	return users, err
+	return users, total, err
 }
 
 func (r *UserRepository) Update(user *models.User) error {
@@ -0,0 +1,75 @@
+package repositories
+
+import (
+	"time"
+
+	"tawtheeq-backend/models"
+
+	"gorm.io/gorm"
+)
+
+type VerificationEventRepository struct {
+	db *gorm.DB
+}
+
+func NewVerificationEventRepository(db *gorm.DB) *VerificationEventRepository {
+	return &VerificationEventRepository{db}
+}
+
+// periodFormats maps a trend interval to a MySQL DATE_FORMAT pattern.
+var periodFormats = map[string]string{
+	"day":   "%Y-%m-%d",
+	"week":  "%x-W%v",
+	"month": "%Y-%m",
+}
+
+// ValidTrendInterval reports whether interval can be used with TeamTrend.
+func ValidTrendInterval(interval string) bool {
+	_, ok := periodFormats[interval]
+	return ok
+}
+
+func (r *VerificationEventRepository) CreateBatch(events []models.VerificationEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+	return r.db.Create(&events).Error
+}
+
+func (r *VerificationEventRepository) FindByDocument(documentID string, p models.Pagination) ([]models.VerificationEvent, int64, error) {
+	query := r.db.Model(&models.VerificationEvent{}).Where("document_id = ?", documentID)
+	total, err := countRows(query)
+	if err != nil {
+		return nil, 0, err
+	}
+	var events []models.VerificationEvent
+	err = paginate(query, "created_at", p).Find(&events).Error
+	return events, total, err
+}
+
+// TeamTrend counts a team's verifications between from and to, grouped by
+// period, method and result.
+func (r *VerificationEventRepository) TeamTrend(teamID string, from time.Time, to time.Time, interval string) ([]models.VerificationTrendPoint, error) {
+	var points []models.VerificationTrendPoint
+	err := r.db.Model(&models.VerificationEvent{}).
+		Select("DATE_FORMAT(created_at, ?) AS period, method, result, COUNT(*) AS count", periodFormats[interval]).
+		Where("team_id = ? AND created_at >= ? AND created_at < ?", teamID, from, to).
+		Group("period, method, result").
+		Order("period ASC").
+		Scan(&points).Error
+	return points, err
+}
+
+// TopDocuments returns a team's most verified documents between from and to.
+func (r *VerificationEventRepository) TopDocuments(teamID string, from time.Time, to time.Time, limit int) ([]models.VerificationDocumentCount, error) {
+	var counts []models.VerificationDocumentCount
+	err := r.db.Table("verification_events AS e").
+		Select("e.document_id, d.original_name, COUNT(*) AS count, MAX(e.created_at) AS last_at").
+		Joins("JOIN documents d ON d.id = e.document_id").
+		Where("e.team_id = ? AND e.created_at >= ? AND e.created_at < ?", teamID, from, to).
+		Group("e.document_id, d.original_name").
+		Order("count DESC").
+		Limit(limit).
+		Scan(&counts).Error
+	return counts, err
+}
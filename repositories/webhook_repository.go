@@ -0,0 +1,142 @@
+package repositories
+
+import (
+	"time"
+
+	"tawtheeq-backend/models"
+
+	"gorm.io/gorm"
+)
+
+type WebhookRepository struct {
+	db *gorm.DB
+}
+
+func NewWebhookRepository(db *gorm.DB) *WebhookRepository {
+	return &WebhookRepository{db}
+}
+
+func (r *WebhookRepository) CreateSubscription(sub *models.WebhookSubscription) error {
+	return r.db.Create(sub).Error
+}
+
+func (r *WebhookRepository) UpdateSubscription(sub *models.WebhookSubscription) error {
+	return r.db.Save(sub).Error
+}
+
+func (r *WebhookRepository) FindSubscriptionByID(id string) (*models.WebhookSubscription, error) {
+	var sub models.WebhookSubscription
+	err := r.db.First(&sub, "id = ?", id).Error
+	return &sub, err
+}
+
+// FindSubscriptions lists the subscriptions of teamID, or every subscription
+// when teamID is empty.
+func (r *WebhookRepository) FindSubscriptions(teamID string, p models.Pagination) ([]models.WebhookSubscription, int64, error) {
+	query := r.db.Model(&models.WebhookSubscription{})
+	if teamID != "" {
+		query = query.Where("team_id = ?", teamID)
+	}
+	total, err := countRows(query)
+	if err != nil {
+		return nil, 0, err
+	}
+	var subs []models.WebhookSubscription
+	err = paginate(query, "created_at", p).Find(&subs).Error
+	return subs, total, err
+}
+
+// FindActiveFor returns the active subscriptions that receive events of
+// teamID: the global ones and, when teamID is set, the team's own.
+func (r *WebhookRepository) FindActiveFor(teamID *string) ([]models.WebhookSubscription, error) {
+	query := r.db.Where("active = ?", true)
+	if teamID != nil && *teamID != "" {
+		query = query.Where("team_id IS NULL OR team_id = ?", *teamID)
+	} else {
+		query = query.Where("team_id IS NULL")
+	}
+	var subs []models.WebhookSubscription
+	err := query.Find(&subs).Error
+	return subs, err
+}
+
+// DeleteSubscription removes a subscription and its delivery log.
+func (r *WebhookRepository) DeleteSubscription(id string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("subscription_id = ?", id).Delete(&models.WebhookDelivery{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&models.WebhookSubscription{}, "id = ?", id).Error
+	})
+}
+
+func (r *WebhookRepository) CreateDelivery(delivery *models.WebhookDelivery) error {
+	return r.db.Create(delivery).Error
+}
+
+func (r *WebhookRepository) CreateDeliveries(deliveries []models.WebhookDelivery) error {
+	if len(deliveries) == 0 {
+		return nil
+	}
+	return r.db.Create(&deliveries).Error
+}
+
+func (r *WebhookRepository) UpdateDelivery(delivery *models.WebhookDelivery) error {
+	return r.db.Omit("Subscription").Save(delivery).Error
+}
+
+func (r *WebhookRepository) FindDeliveryByID(subscriptionID string, id string) (*models.WebhookDelivery, error) {
+	var delivery models.WebhookDelivery
+	err := r.db.First(&delivery, "id = ? AND subscription_id = ?", id, subscriptionID).Error
+	return &delivery, err
+}
+
+// FindDeliveries lists the delivery log of a subscription, optionally only
+// deliveries with status.
+func (r *WebhookRepository) FindDeliveries(subscriptionID string, status string, p models.Pagination) ([]models.WebhookDelivery, int64, error) {
+	query := r.db.Model(&models.WebhookDelivery{}).Where("subscription_id = ?", subscriptionID)
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	total, err := countRows(query)
+	if err != nil {
+		return nil, 0, err
+	}
+	var deliveries []models.WebhookDelivery
+	err = paginate(query, "created_at", p).Find(&deliveries).Error
+	return deliveries, total, err
+}
+
+// FindDue returns pending deliveries whose next attempt is due, for active
+// subscriptions only; deliveries of a disabled subscription wait until it
+// is enabled again.
+func (r *WebhookRepository) FindDue(now time.Time, limit int) ([]models.WebhookDelivery, error) {
+	var deliveries []models.WebhookDelivery
+	err := r.db.Preload("Subscription").
+		Joins("JOIN webhook_subscriptions s ON s.id = webhook_deliveries.subscription_id AND s.active = ?", true).
+		Where("webhook_deliveries.status = ? AND webhook_deliveries.next_attempt_at <= ?", models.WebhookDeliveryPending, now).
+		Order("webhook_deliveries.next_attempt_at ASC").
+		Limit(limit).
+		Find(&deliveries).Error
+	return deliveries, err
+}
+
+// Claim moves the next attempt of a due delivery to until, so that other
+// instances skip it while it is being sent. It reports whether the delivery
+// was still due.
+func (r *WebhookRepository) Claim(delivery *models.WebhookDelivery, until time.Time) (bool, error) {
+	result := r.db.Model(&models.WebhookDelivery{}).
+		Where("id = ? AND status = ? AND next_attempt_at = ?", delivery.ID, models.WebhookDeliveryPending, delivery.NextAttemptAt).
+		UpdateColumn("next_attempt_at", until)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	delivery.NextAttemptAt = &until
+	return result.RowsAffected == 1, nil
+}
+
+// DeleteDeliveriesBefore prunes finished deliveries created before cutoff.
+func (r *WebhookRepository) DeleteDeliveriesBefore(cutoff time.Time) (int64, error) {
+	result := r.db.Where("status <> ? AND created_at < ?", models.WebhookDeliveryPending, cutoff).Delete(&models.WebhookDelivery{})
+	return result.RowsAffected, result.Error
+}
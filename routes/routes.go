@@ -20,11 +20,19 @@ func SetupRoutes(app *fiber.App) {
 	// Auth routes
 	auth := api.Group("/auth")
 	auth.Post("/login", controllers.Login)
+	auth.Post("/refresh", controllers.RefreshToken)
+	auth.Post("/logout", middlewares.OptionalAuth(), controllers.Logout)
 	auth.Post("/forgot-password", controllers.ForgotPassword)
 	auth.Post("/reset-password", controllers.ResetPassword)
+	// Public keys of access tokens, also at the standard location
+	auth.Get("/jwks", controllers.GetJWKS)
+	app.Get("/.well-known/jwks.json", controllers.GetJWKS)
 
 	// Verify id
-	api.Get("/verify/:id", controllers.VerifyFileByIdHandler)
+	api.Get("/verify/:id", middlewares.OptionalAuth(), controllers.VerifyFileByIdHandler)
+	api.Post("/verify/similar", middlewares.RequireRoles("*"), controllers.VerifySimilarHandler)
+	api.Post("/verify/qr", controllers.VerifyQRPayloadHandler)
+	api.Get("/verify/qr/public-key", controllers.GetQRPublicKeyHandler)
 	// Upload file
 	api.Post("/upload", middlewares.RequireRoles("*"), controllers.SignFileHandler)
 
@@ -39,6 +47,7 @@ func SetupRoutes(app *fiber.App) {
 	myself := api.Group("/myself")
 	myself.Put("/name", middlewares.RequireRoles("*"), controllers.UpdateMyName)
 	myself.Put("/password", middlewares.RequireRoles("*"), controllers.UpdateMyPassword)
+	myself.Put("/language", middlewares.RequireRoles("*"), controllers.UpdateMyLanguage)
 
 	// Teams
 	teams := api.Group("/teams")
@@ -47,6 +56,9 @@ func SetupRoutes(app *fiber.App) {
 	teams.Delete("/:id/remove", middlewares.RequireRoles(string(models.SuperAdminRole)), controllers.RemoveTeam)
 	teams.Put("/:id/name", middlewares.RequireRoles(string(models.SuperAdminRole)), controllers.UpdateTeamName)
 	teams.Put("/:id/leader", middlewares.RequireRoles(string(models.SuperAdminRole)), controllers.UpdateTeamLeader)
+	teams.Put("/:id/verification-visibility", middlewares.RequireRoles(string(models.SuperAdminRole)), controllers.UpdateTeamVerificationVisibility)
+	teams.Get("/:id/document-fields", middlewares.RequireRoles(string(models.SuperAdminRole)), controllers.GetTeamDocumentFields)
+	teams.Put("/:id/document-fields", middlewares.RequireRoles(string(models.SuperAdminRole)), controllers.UpdateTeamDocumentFields)
 
 	teams.Get("/:team_id/members", middlewares.RequireRoles(string(models.SuperAdminRole)), controllers.GetAllUsersInTeam)
 	teams.Post("/members", middlewares.RequireRoles(string(models.SuperAdminRole)), controllers.AddUserToTeam)
@@ -55,10 +67,62 @@ func SetupRoutes(app *fiber.App) {
 	// my
 	my := api.Group("/my")
 	my.Get("/team", middlewares.RequireRoles("*"), controllers.GetMyTeam)
+	my.Get("/team/verification-trends", middlewares.RequireRoles(string(models.TeamLeaderRole)), controllers.GetMyTeamVerificationTrends)
+	my.Get("/team/stats", middlewares.RequireRoles(string(models.TeamLeaderRole)), controllers.GetMyTeamStats)
+	my.Put("/team/verification-visibility", middlewares.RequireRoles(string(models.TeamLeaderRole)), controllers.UpdateMyTeamVerificationVisibility)
+	my.Get("/team/document-fields", middlewares.RequireRoles("*"), controllers.GetMyTeamDocumentFields)
+	my.Put("/team/document-fields", middlewares.RequireRoles(string(models.TeamLeaderRole)), controllers.UpdateMyTeamDocumentFields)
 	my.Get("/team/members", middlewares.RequireRoles(string(models.TeamLeaderRole)), controllers.GetAllUsersInMyTeam)
 	my.Post("/team/members", middlewares.RequireRoles(string(models.TeamLeaderRole)), controllers.AddUserToMyTeam)
 	my.Delete("/team/members/:user_id", middlewares.RequireRoles(string(models.TeamLeaderRole)), controllers.RemoveUserFromMyTeam)
 
+	// Stamp templates
+	stampTemplates := api.Group("/stamp-templates")
+	stampTemplates.Get("/", middlewares.RequireRoles("*"), controllers.GetStampTemplates)
+	stampTemplates.Get("/:id", middlewares.RequireRoles("*"), controllers.GetStampTemplate)
+	stampTemplates.Post("/", middlewares.RequireRoles(string(models.SuperAdminRole), string(models.TeamLeaderRole)), controllers.CreateStampTemplate)
+	stampTemplates.Put("/:id", middlewares.RequireRoles(string(models.SuperAdminRole), string(models.TeamLeaderRole)), controllers.UpdateStampTemplate)
+	stampTemplates.Put("/:id/default", middlewares.RequireRoles(string(models.SuperAdminRole), string(models.TeamLeaderRole)), controllers.SetDefaultStampTemplate)
+	stampTemplates.Post("/:id/logo", middlewares.RequireRoles(string(models.SuperAdminRole), string(models.TeamLeaderRole)), controllers.UploadStampTemplateLogo)
+	stampTemplates.Delete("/:id/remove", middlewares.RequireRoles(string(models.SuperAdminRole), string(models.TeamLeaderRole)), controllers.RemoveStampTemplate)
+
+	// Verification analytics
+	verifications := api.Group("/verifications")
+	verifications.Get("/teams/:team_id/trends", middlewares.RequireRoles(string(models.SuperAdminRole)), controllers.GetTeamVerificationTrends)
+
+	// Statistics
+	stats := api.Group("/stats")
+	stats.Get("/dashboard", middlewares.RequireRoles(string(models.SuperAdminRole)), controllers.GetDashboardStats)
+
+	// Webhooks
+	webhooks := api.Group("/webhooks")
+	webhooks.Get("/", middlewares.RequireRoles(string(models.SuperAdminRole), string(models.TeamLeaderRole)), controllers.GetWebhooks)
+	webhooks.Post("/", middlewares.RequireRoles(string(models.SuperAdminRole), string(models.TeamLeaderRole)), controllers.CreateWebhook)
+	webhooks.Get("/events", middlewares.RequireRoles(string(models.SuperAdminRole), string(models.TeamLeaderRole)), controllers.GetWebhookEventTypes)
+	webhooks.Get("/:id", middlewares.RequireRoles(string(models.SuperAdminRole), string(models.TeamLeaderRole)), controllers.GetWebhook)
+	webhooks.Put("/:id", middlewares.RequireRoles(string(models.SuperAdminRole), string(models.TeamLeaderRole)), controllers.UpdateWebhook)
+	webhooks.Delete("/:id/remove", middlewares.RequireRoles(string(models.SuperAdminRole), string(models.TeamLeaderRole)), controllers.RemoveWebhook)
+	webhooks.Post("/:id/secret", middlewares.RequireRoles(string(models.SuperAdminRole), string(models.TeamLeaderRole)), controllers.RotateWebhookSecret)
+	webhooks.Post("/:id/ping", middlewares.RequireRoles(string(models.SuperAdminRole), string(models.TeamLeaderRole)), controllers.PingWebhook)
+	webhooks.Get("/:id/deliveries", middlewares.RequireRoles(string(models.SuperAdminRole), string(models.TeamLeaderRole)), controllers.GetWebhookDeliveries)
+	webhooks.Post("/:id/deliveries/:delivery_id/redeliver", middlewares.RequireRoles(string(models.SuperAdminRole), string(models.TeamLeaderRole)), controllers.RedeliverWebhook)
+
+	// Storage maintenance
+	storageAdmin := api.Group("/storage")
+	storageAdmin.Post("/scrub", middlewares.RequireRoles(string(models.SuperAdminRole)), controllers.StartStorageScrubHandler)
+	storageAdmin.Get("/scrub/reports", middlewares.RequireRoles(string(models.SuperAdminRole)), controllers.GetStorageScrubReports)
+	storageAdmin.Get("/scrub/reports/:id", middlewares.RequireRoles(string(models.SuperAdminRole)), controllers.GetStorageScrubReport)
+
+	// Email outbox
+	emails := api.Group("/emails")
+	emails.Get("/", middlewares.RequireRoles(string(models.SuperAdminRole)), controllers.GetEmails)
+	emails.Post("/:id/retry", middlewares.RequireRoles(string(models.SuperAdminRole)), controllers.RetryEmail)
+
+	// Audit log
+	audit := api.Group("/audit")
+	audit.Get("/", middlewares.RequireRoles(string(models.SuperAdminRole)), controllers.GetAuditEvents)
+	audit.Get("/export", middlewares.RequireRoles(string(models.SuperAdminRole)), controllers.ExportAuditEvents)
+
 	// Documents
 	documents := api.Group("/documents")
 	documents.Get("/visible", middlewares.RequireRoles(string(models.SuperAdminRole)), controllers.GetAllDocumentsVisible)
@@ -69,8 +133,21 @@ func SetupRoutes(app *fiber.App) {
 	documents.Get("/user/:user_id/hidden", middlewares.RequireRoles(string(models.SuperAdminRole)), controllers.GetAllDocumentsFromUserHidden)
 	documents.Get("/user/me", middlewares.RequireRoles("*"), controllers.GetAllDocumentsFromMeVisible)
 	documents.Get("/user/me/hidden", middlewares.RequireRoles(string(models.SuperAdminRole)), controllers.GetAllDocumentsFromMeHidden)
+	documents.Get("/search", middlewares.RequireRoles("*"), controllers.SearchDocuments)
+	documents.Get("/search/content", middlewares.RequireRoles("*"), controllers.SearchDocumentContent)
+	documents.Get("/export", middlewares.RequireRoles("*"), controllers.ExportDocuments)
+	documents.Get("/exports", middlewares.RequireRoles("*"), controllers.GetDocumentExports)
+	documents.Get("/exports/:id", middlewares.RequireRoles("*"), controllers.GetDocumentExport)
+	documents.Get("/exports/:id/download", middlewares.RequireRoles("*"), controllers.DownloadDocumentExport)
+	documents.Get("/trash", middlewares.RequireRoles("*"), controllers.GetDocumentTrash)
 	documents.Get("/:id/hide", middlewares.RequireRoles(string(models.SuperAdminRole)), controllers.HideDocumentSuperAdmin)
 	documents.Get("/:id/show", middlewares.RequireRoles(string(models.SuperAdminRole)), controllers.ShowDocumentSuperAdmin)
+	documents.Get("/:id/file", middlewares.RequireRoles("*"), controllers.GetDocumentFile)
+	documents.Get("/:id/verifications", middlewares.RequireRoles("*"), controllers.GetDocumentVerifications)
+	documents.Delete("/:id/remove", middlewares.RequireRoles("*"), controllers.DeleteDocument)
+	documents.Put("/:id/metadata", middlewares.RequireRoles("*"), controllers.UpdateDocumentMetadata)
+	documents.Put("/:id/restore", middlewares.RequireRoles("*"), controllers.RestoreDocument)
+	documents.Delete("/:id/purge", middlewares.RequireRoles(string(models.SuperAdminRole)), controllers.PurgeDocument)
 
 	documents.Get("/my", middlewares.RequireRoles("*"), controllers.GetAllDocumentsFromMeVisible)
 	documents.Get("/myteam", middlewares.RequireRoles(string(models.TeamLeaderRole)), controllers.GetAllDocumentsFromMyTeam)
@@ -0,0 +1,262 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"testing"
+)
+
+func testMasterKey(t *testing.T, fill byte) MasterKey {
+	t.Helper()
+	mk, err := NewMasterKey(bytes.Repeat([]byte{fill}, dataKeySize))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return mk
+}
+
+// testData returns n bytes that differ between chunks, so a chunk read from
+// the wrong place is noticed.
+func testData(n int) []byte {
+	data := make([]byte, n)
+	for i := range data {
+		data[i] = byte(i*7 + i/encryptionChunkSize)
+	}
+	return data
+}
+
+func readObject(t *testing.T, s Storage, key string) []byte {
+	t.Helper()
+	r, err := s.Get(context.Background(), key)
+	if err != nil {
+		t.Fatalf("get %s: %v", key, err)
+	}
+	defer r.Close()
+	data, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("read %s: %v", key, err)
+	}
+	return data
+}
+
+func putRaw(t *testing.T, s Storage, key string, data []byte) {
+	t.Helper()
+	if err := s.Put(context.Background(), key, bytes.NewReader(data), int64(len(data)), "application/octet-stream"); err != nil {
+		t.Fatalf("put %s: %v", key, err)
+	}
+}
+
+// legacyObject encrypts data the way the first format did: one GCM seal over
+// the whole file.
+func legacyObject(t *testing.T, mk MasterKey, data []byte) []byte {
+	t.Helper()
+	dataKey, _ := randomBytes(dataKeySize)
+	wrapNonce, _ := randomBytes(gcmNonceSize)
+	dataNonce, _ := randomBytes(gcmNonceSize)
+	wrapped, err := gcmSeal(mk.Key, wrapNonce, dataKey, []byte(mk.ID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	header := append([]byte(legacyEncryptionMagic), mk.ID...)
+	header = append(header, wrapNonce...)
+	header = append(header, wrapped...)
+	header = append(header, dataNonce...)
+	sealed, err := gcmSeal(dataKey, dataNonce, data, []byte(legacyEncryptionMagic))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return append(header, sealed...)
+}
+
+func TestEncryptedRoundTrip(t *testing.T) {
+	sizes := []int{0, 1, encryptionChunkSize - 1, encryptionChunkSize, encryptionChunkSize + 1, 3*encryptionChunkSize + 5}
+	for _, size := range sizes {
+		e := NewEncrypted(NewMemory(), testMasterKey(t, 1))
+		data := testData(size)
+		putRaw(t, e, "doc", data)
+
+		raw := readObject(t, e.Inner(), "doc")
+		if int64(len(raw)) != encryptedSize(int64(size)) {
+			t.Errorf("size %d: stored %d bytes, want %d", size, len(raw), encryptedSize(int64(size)))
+		}
+		if size >= 16 && bytes.Contains(raw, data) {
+			t.Errorf("size %d: plaintext is stored as-is", size)
+		}
+		if got := readObject(t, e, "doc"); !bytes.Equal(got, data) {
+			t.Errorf("size %d: read back %d different bytes", size, len(got))
+		}
+
+		info, err := e.Stat(context.Background(), "doc")
+		if err != nil || info.Size != int64(size) {
+			t.Errorf("size %d: Stat = %d, %v", size, info.Size, err)
+		}
+	}
+}
+
+func TestEncryptedSeek(t *testing.T) {
+	e := NewEncrypted(NewMemory(), testMasterKey(t, 1))
+	data := testData(3*encryptionChunkSize + 100)
+	putRaw(t, e, "doc", data)
+
+	tests := []struct {
+		name   string
+		offset int64
+		whence int
+		length int
+		want   int64
+	}{
+		{"start", 0, io.SeekStart, 10, 0},
+		{"inside first chunk", 1000, io.SeekStart, 50, 1000},
+		{"across chunks", encryptionChunkSize - 5, io.SeekStart, 20, encryptionChunkSize - 5},
+		{"chunk boundary", 2 * encryptionChunkSize, io.SeekStart, 30, 2 * encryptionChunkSize},
+		{"last chunk from end", -60, io.SeekEnd, 60, int64(len(data)) - 60},
+		{"end", 0, io.SeekEnd, 0, int64(len(data))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := e.Get(context.Background(), "doc")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer r.Close()
+			seeker, ok := r.(io.ReadSeeker)
+			if !ok {
+				t.Fatal("reader cannot seek")
+			}
+			pos, err := seeker.Seek(tt.offset, tt.whence)
+			if err != nil || pos != tt.want {
+				t.Fatalf("Seek = %d, %v, want %d", pos, err, tt.want)
+			}
+			got, err := io.ReadAll(io.LimitReader(seeker, int64(tt.length)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, data[tt.want:tt.want+int64(len(got))]) || len(got) != tt.length {
+				t.Errorf("read %d bytes at %d that do not match", len(got), tt.want)
+			}
+		})
+	}
+}
+
+func TestEncryptedRejectsTampering(t *testing.T) {
+	data := testData(2*encryptionChunkSize + 10)
+	chunk := func(i int) (int, int) {
+		start := encryptionHeader + i*sealedChunkSize
+		return start, start + sealedChunkSize
+	}
+
+	tests := []struct {
+		name   string
+		tamper func(raw []byte) []byte
+	}{
+		{"flipped bit", func(raw []byte) []byte {
+			raw[encryptionHeader+100] ^= 1
+			return raw
+		}},
+		{"truncated at chunk boundary", func(raw []byte) []byte {
+			_, end := chunk(1)
+			return raw[:end]
+		}},
+		{"truncated inside chunk", func(raw []byte) []byte {
+			return raw[:len(raw)-5]
+		}},
+		{"chunks swapped", func(raw []byte) []byte {
+			s0, e0 := chunk(0)
+			s1, e1 := chunk(1)
+			first := append([]byte(nil), raw[s0:e0]...)
+			copy(raw[s0:e0], raw[s1:e1])
+			copy(raw[s1:e1], first)
+			return raw
+		}},
+		{"chunk appended", func(raw []byte) []byte {
+			s0, e0 := chunk(0)
+			return append(raw, raw[s0:e0]...)
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := NewEncrypted(NewMemory(), testMasterKey(t, 1))
+			putRaw(t, e, "doc", data)
+			putRaw(t, e.Inner(), "doc", tt.tamper(readObject(t, e.Inner(), "doc")))
+
+			r, err := e.Get(context.Background(), "doc")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer r.Close()
+			if _, err := io.ReadAll(r); !errors.Is(err, ErrCorruptObject) {
+				t.Errorf("read error = %v, want ErrCorruptObject", err)
+			}
+		})
+	}
+}
+
+func TestEncryptedPlainAndLegacyObjects(t *testing.T) {
+	mk := testMasterKey(t, 1)
+	e := NewEncrypted(NewMemory(), mk)
+	plain := []byte("stored before encryption was enabled")
+	legacy := testData(5000)
+	putRaw(t, e.Inner(), "plain", plain)
+	putRaw(t, e.Inner(), "legacy", legacyObject(t, mk, legacy))
+	putRaw(t, e, "chunked", legacy)
+
+	want := map[string][]byte{"plain": plain, "legacy": legacy, "chunked": legacy}
+	for key, data := range want {
+		if got := readObject(t, e, key); !bytes.Equal(got, data) {
+			t.Errorf("%s: read back wrong content", key)
+		}
+		info, err := e.Stat(context.Background(), key)
+		if err != nil || info.Size != int64(len(data)) {
+			t.Errorf("%s: Stat = %d, %v, want %d", key, info.Size, err, len(data))
+		}
+	}
+
+	objects, err := e.List(context.Background(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, obj := range objects {
+		if obj.Size != int64(len(want[obj.Key])) {
+			t.Errorf("List %s: size %d, want %d", obj.Key, obj.Size, len(want[obj.Key]))
+		}
+	}
+}
+
+func TestEncryptedRewrap(t *testing.T) {
+	oldKey, newKey := testMasterKey(t, 1), testMasterKey(t, 2)
+	inner := NewMemory()
+	before := NewEncrypted(inner, oldKey)
+
+	chunked := testData(2*encryptionChunkSize + 3)
+	legacy := testData(300)
+	plain := []byte("plain")
+	putRaw(t, before, "chunked", chunked)
+	putRaw(t, inner, "legacy", legacyObject(t, oldKey, legacy))
+	putRaw(t, inner, "plain", plain)
+
+	after := NewEncrypted(inner, newKey, oldKey)
+	counts, err := after.RewrapAll(context.Background(), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if counts[RewrapUpdated] != 2 || counts[RewrapEncrypted] != 1 {
+		t.Errorf("counts = %v", counts)
+	}
+
+	// the old key is no longer needed
+	current := NewEncrypted(inner, newKey)
+	for key, data := range map[string][]byte{"chunked": chunked, "legacy": legacy, "plain": plain} {
+		if got := readObject(t, current, key); !bytes.Equal(got, data) {
+			t.Errorf("%s: read back wrong content after rewrap", key)
+		}
+		if result, err := current.Rewrap(context.Background(), key, true); err != nil || result != RewrapCurrent {
+			t.Errorf("%s: second rewrap = %s, %v", key, result, err)
+		}
+	}
+
+	if _, err := NewEncrypted(inner, oldKey).Get(context.Background(), "chunked"); !errors.Is(err, ErrUnknownMasterKey) {
+		t.Errorf("read with the old key only: %v, want ErrUnknownMasterKey", err)
+	}
+}
@@ -0,0 +1,90 @@
+// Package storage abstracts where signed files are kept. Drivers register a
+// factory under a name and one of them is opened at startup.
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrNotFound is returned when an object does not exist.
+	ErrNotFound = errors.New("storage: object not found")
+	// ErrPresignUnsupported is returned by drivers that cannot hand out
+	// direct download URLs.
+	ErrPresignUnsupported = errors.New("storage: presigned URLs not supported")
+)
+
+// ObjectInfo describes a stored object.
+type ObjectInfo struct {
+	Key          string    `json:"key"`
+	Size         int64     `json:"size"`
+	ContentType  string    `json:"content_type,omitempty"`
+	LastModified time.Time `json:"last_modified"`
+}
+
+// PresignOptions overrides response headers of a presigned download.
+type PresignOptions struct {
+	ContentType        string
+	ContentDisposition string
+}
+
+// Storage is implemented by every storage backend.
+type Storage interface {
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	Stat(ctx context.Context, key string) (ObjectInfo, error)
+	Delete(ctx context.Context, key string) error
+	List(ctx context.Context, prefix string) ([]ObjectInfo, error)
+	PresignGet(ctx context.Context, key string, expiry time.Duration, opts PresignOptions) (string, error)
+}
+
+// FileLocator is implemented by drivers whose objects live on the local
+// filesystem, so handlers can serve them with range support.
+type FileLocator interface {
+	LocalPath(key string) (string, error)
+}
+
+// Factory creates a driver, usually from environment settings.
+type Factory func() (Storage, error)
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]Factory{}
+)
+
+// Register makes a driver available under name. Registering the same name
+// twice replaces the previous factory.
+func Register(name string, factory Factory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry[name] = factory
+}
+
+// Open creates the driver registered under name.
+func Open(name string) (Storage, error) {
+	registryMu.RLock()
+	factory, ok := registry[name]
+	registryMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("storage: unknown driver %q (available: %v)", name, Drivers())
+	}
+	return factory()
+}
+
+// Drivers returns the registered driver names.
+func Drivers() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
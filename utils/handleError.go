@@ -6,8 +6,6 @@ import (
 	"os"
 	"strings"
 	"time"
-
-	"github.com/gofiber/fiber/v2"
 )
 
 const (
@@ -53,14 +51,3 @@ func shouldLogLevel(level string) bool {
 
 	return current >= threshold
 }
-
-func MainErrorHandler(c *fiber.Ctx, err error) error {
-	code := fiber.StatusInternalServerError
-	if e, ok := err.(*fiber.Error); ok {
-		code = e.Code
-	}
-	return c.Status(code).JSON(fiber.Map{
-		"error":  err.Error(),
-		"status": code,
-	})
-}
@@ -6,19 +6,22 @@ import (
 	"image"
 	"image/jpeg"
 	"image/png"
+	"math"
 	"os"
 	"os/exec"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/fogleman/gg"
-	"github.com/joho/godotenv"
 
 	arabic "github.com/abdullahdiaa/garabic"
 )
 
-func AddIDToImage(filePath string, id string, signature string) error {
-	_ = godotenv.Load()
+// AddIDToImage stamps the document ID bar and, depending on the style, a logo
+// and a QR code onto the image.
+func AddIDToImage(filePath string, id string, signature string, opts StampOptions) error {
+	style := opts.Style
 
 	file, err := os.Open(filePath)
 	if err != nil {
@@ -43,31 +46,28 @@ func AddIDToImage(filePath string, id string, signature string) error {
 	dc := gg.NewContext(w, h)
 	dc.DrawImage(img, 0, 0)
 
-	textPrefix := os.Getenv("IMAGE_TEXT_PREFIX")
-	if textPrefix == "" {
-		textPrefix = "Document ID:"
-	}
-
-	rawText := fmt.Sprintf("%s %s", textPrefix, id)
+	rawText := RenderStampText(style.TextTemplate, id, time.Now())
 	text := arabic.Shape(rawText)
 
-	fontPath := os.Getenv("IMAGE_FONT_PATH")
+	fontPath := style.FontPath
 	if fontPath == "" {
 		fontPath = "assets/fonts/Cairo.ttf"
 	}
 
-	fontSize, _ := strconv.ParseFloat(os.Getenv("IMAGE_FONT_SIZE"), 64)
-	if fontSize == 0 {
+	fontSize := style.FontSize
+	if fontSize <= 0 {
 		fontSize = 18
 	}
 
-	textColor := parseRGB(os.Getenv("IMAGE_TEXT_COLOR"), 255, 255, 255)
-	bgColor := parseRGB(os.Getenv("IMAGE_BG_COLOR"), 0, 0, 0)
-	bgOpacity := parseOpacity(os.Getenv("IMAGE_BG_OPACITY"))
+	textColor := parseRGB(style.TextColor, 255, 255, 255)
+	bgColor := parseRGB(style.BgColor, 0, 0, 0)
+	bgOpacity := style.BgOpacity
+	if bgOpacity < 0 || bgOpacity > 1 {
+		bgOpacity = 0.5
+	}
 
-	align := strings.ToLower(os.Getenv("IMAGE_TEXT_ALIGN"))
 	var anchorX float64
-	switch align {
+	switch strings.ToLower(style.TextAlign) {
 	case "left":
 		anchorX = 0
 	case "right":
@@ -76,48 +76,77 @@ func AddIDToImage(filePath string, id string, signature string) error {
 		anchorX = 0.5
 	}
 
-	boxHeight := fontSize + 20
-	dc.SetRGBA(bgColor[0], bgColor[1], bgColor[2], bgOpacity)
-	dc.DrawRectangle(0, float64(h)-boxHeight, float64(w), boxHeight)
-	dc.Fill()
-
 	if err := dc.LoadFontFace(fontPath, fontSize); err != nil {
 		// return fmt.Errorf("failed to load font: %w", err)
 		return HandleError(err, "Failed to load font", Error)
 	}
-	dc.SetRGB(textColor[0], textColor[1], textColor[2])
-	x := float64(w) * anchorX
-	y := float64(h) - boxHeight/2
-	dc.DrawStringAnchored(text, x, y, anchorX, 0.5)
-
-	generateQR := strings.ToLower(os.Getenv("QR_GENERATOR")) == "true"
-	if generateQR {
-		qrBytes, err := GenerateQRCodeImage(id)
-		if err == nil {
-			qrImg, err := png.Decode(bytes.NewReader(qrBytes))
-			if err == nil {
-				qrSize := 100.0
-				marginX := parseFloatEnv("QR_MARGIN_X", 10)
-				marginY := parseFloatEnv("QR_MARGIN_Y", 10)
-				position := strings.ToLower(os.Getenv("QR_POSITION"))
-
-				var qrX, qrY float64
-
-				switch position {
-				case "top-left":
-					qrX = marginX
-					qrY = marginY
-				case "top-right":
-					qrX = float64(w) - qrSize - marginX
-					qrY = marginY
-				case "bottom-left":
-					qrX = marginX
-					qrY = float64(h) - qrSize - marginY
-				default: // "bottom-right"
-					qrX = float64(w) - qrSize - marginX
-					qrY = float64(h) - qrSize - marginY
-				}
 
+	if opts.Placement.IsSet() {
+		// stamp box: [logo] text [qr], aligned to the requested anchor
+		bx, by, bw, bh := opts.Placement.Box(float64(w), float64(h), style)
+		dc.SetRGBA(bgColor[0], bgColor[1], bgColor[2], bgOpacity)
+		dc.DrawRectangle(bx, by, bw, bh)
+		dc.Fill()
+
+		inner := bh - 2*stampBoxPadding
+		textLeft := bx + stampBoxPadding
+		textRight := bx + bw - stampBoxPadding
+
+		if logoImg := loadStampLogo(style); logoImg != nil && inner > 0 {
+			lw := float64(logoImg.Bounds().Dx())
+			lh := float64(logoImg.Bounds().Dy())
+			scale := inner / lh
+			drawScaledImage(dc, logoImg, textLeft, by+stampBoxPadding, scale)
+			textLeft += lw*scale + stampBoxPadding
+		}
+
+		if style.QREnabled && inner >= 32 {
+			if qrImg := loadStampQR(id, opts.QRContent, int(inner)); qrImg != nil {
+				dc.DrawImageAnchored(qrImg, int(textRight-inner), int(by+stampBoxPadding), 0, 0)
+				textRight -= inner + stampBoxPadding
+			}
+		}
+
+		dc.SetRGB(textColor[0], textColor[1], textColor[2])
+		x := textLeft + (textRight-textLeft)*anchorX
+		y := by + bh/2
+		dc.DrawStringAnchored(text, x, y, anchorX, 0.5)
+	} else {
+		boxHeight := fontSize + 20
+		boxY := float64(h) - boxHeight
+		if strings.ToLower(style.BarPosition) == "top" {
+			boxY = 0
+		}
+		dc.SetRGBA(bgColor[0], bgColor[1], bgColor[2], bgOpacity)
+		dc.DrawRectangle(0, boxY, float64(w), boxHeight)
+		dc.Fill()
+
+		dc.SetRGB(textColor[0], textColor[1], textColor[2])
+		x := float64(w) * anchorX
+		y := boxY + boxHeight/2
+		dc.DrawStringAnchored(text, x, y, anchorX, 0.5)
+
+		if logoImg := loadStampLogo(style); logoImg != nil {
+			logoSize := style.LogoSize
+			if logoSize <= 0 {
+				logoSize = 80
+			}
+			lw := float64(logoImg.Bounds().Dx())
+			lh := float64(logoImg.Bounds().Dy())
+			scale := logoSize / math.Max(lw, lh)
+
+			lx, ly := cornerPosition(style.LogoPosition, "top-left", float64(w), float64(h), lw*scale, lh*scale, 10, 10)
+			drawScaledImage(dc, logoImg, lx, ly, scale)
+		}
+
+		if style.QREnabled {
+			qrSize := style.QRSize
+			if qrSize <= 0 {
+				qrSize = 100
+			}
+
+			if qrImg := loadStampQR(id, opts.QRContent, int(qrSize)); qrImg != nil {
+				qrX, qrY := cornerPosition(style.QRPosition, "bottom-right", float64(w), float64(h), qrSize, qrSize, style.QRMarginX, style.QRMarginY)
 				dc.DrawImageAnchored(qrImg, int(qrX), int(qrY), 0, 0)
 			}
 		}
@@ -151,6 +180,64 @@ func AddIDToImage(filePath string, id string, signature string) error {
 	return nil
 }
 
+// loadStampLogo returns the logo of the style, or nil when there is none or
+// it cannot be read.
+func loadStampLogo(style StampStyle) image.Image {
+	if style.Logo != nil {
+		return style.Logo
+	}
+	if style.LogoPath == "" {
+		return nil
+	}
+	logoImg, err := gg.LoadImage(style.LogoPath)
+	if err != nil {
+		HandleError(err, "Failed to load stamp logo", Warning)
+		return nil
+	}
+	return logoImg
+}
+
+// loadStampQR renders the QR code of the stamp, or nil when it fails.
+func loadStampQR(id string, content string, size int) image.Image {
+	qrBytes, err := GenerateQRCodeImage(id, content, size)
+	if err != nil {
+		return nil
+	}
+	qrImg, err := png.Decode(bytes.NewReader(qrBytes))
+	if err != nil {
+		HandleError(err, "Failed to decode QR code", Warning)
+		return nil
+	}
+	return qrImg
+}
+
+func drawScaledImage(dc *gg.Context, img image.Image, x, y, scale float64) {
+	dc.Push()
+	dc.Translate(x, y)
+	dc.Scale(scale, scale)
+	dc.DrawImage(img, 0, 0)
+	dc.Pop()
+}
+
+// cornerPosition returns the top-left point of a boxW x boxH box placed in the
+// given corner of a w x h page, keeping the margins from the edges.
+func cornerPosition(position string, def string, w, h, boxW, boxH, marginX, marginY float64) (float64, float64) {
+	if position == "" {
+		position = def
+	}
+
+	switch strings.ToLower(position) {
+	case "top-left":
+		return marginX, marginY
+	case "top-right":
+		return w - boxW - marginX, marginY
+	case "bottom-left":
+		return marginX, h - boxH - marginY
+	default: // "bottom-right"
+		return w - boxW - marginX, h - boxH - marginY
+	}
+}
+
 func parseRGB(input string, defR, defG, defB int) [3]float64 {
 	parts := strings.Split(input, ",")
 	if len(parts) != 3 {
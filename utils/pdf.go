@@ -7,12 +7,20 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strings"
+
+	"tawtheeq-backend/i18n"
 
 	"github.com/gen2brain/go-fitz"
 	"github.com/signintech/gopdf"
 )
 
-func AddIDToPDF(filePath string, id string, signature string) error {
+// pdfRenderDPI is the resolution PDF pages are rasterised at before stamping.
+const pdfRenderDPI = 300.0
+
+// AddIDToPDF stamps the selected pages of the PDF. Placement lengths are in
+// PDF points and are scaled to the rendered page size.
+func AddIDToPDF(filePath string, id string, signature string, opts StampOptions) error {
 
 	doc, err := fitz.New(filePath)
 	if err != nil {
@@ -21,13 +29,20 @@ func AddIDToPDF(filePath string, id string, signature string) error {
 	}
 	defer doc.Close()
 
-	tempDir := "./temp_pdf_pages"
-	os.MkdirAll(tempDir, os.ModePerm)
+	// pages of concurrent uploads get their own directory, removed on every path
+	tempDir, err := os.MkdirTemp("", "tawtheeq-pdf-pages-")
+	if err != nil {
+		return HandleError(err, "Failed to create page directory", Error)
+	}
+	defer os.RemoveAll(tempDir)
 
 	imagePaths := []string{}
 
+	pageOpts := opts
+	pageOpts.Placement = opts.Placement.Scaled(pdfRenderDPI / 72)
+
 	for n := 0; n < doc.NumPage(); n++ {
-		img, err := doc.Image(n)
+		img, err := doc.ImageDPI(n, pdfRenderDPI)
 		if err != nil {
 			// return fmt.Errorf("failed to render page %d: %w", n+1, err)
 			return HandleError(err, fmt.Sprintf("Failed to render page %d", n+1), Error)
@@ -46,10 +61,12 @@ func AddIDToPDF(filePath string, id string, signature string) error {
 		}
 		f.Close()
 
-		err = AddIDToImage(imgPath, id, signature)
-		if err != nil {
-			// return fmt.Errorf("failed to annotate image page %d: %w", n+1, err)
-			return HandleError(err, fmt.Sprintf("Failed to annotate image page %d", n+1), Error)
+		if opts.Pages.Includes(n, doc.NumPage()) {
+			err = AddIDToImage(imgPath, id, signature, pageOpts)
+			if err != nil {
+				// return fmt.Errorf("failed to annotate image page %d: %w", n+1, err)
+				return HandleError(err, fmt.Sprintf("Failed to annotate image page %d", n+1), Error)
+			}
 		}
 
 		imagePaths = append(imagePaths, imgPath)
@@ -88,6 +105,7 @@ func AddIDToPDF(filePath string, id string, signature string) error {
 	}
 
 	tempOutput := filePath + ".signed.pdf"
+	defer os.Remove(tempOutput)
 	err = newPDF.WritePdf(tempOutput)
 	if err != nil {
 		// return fmt.Errorf("failed to write final PDF: %w", err)
@@ -100,11 +118,6 @@ func AddIDToPDF(filePath string, id string, signature string) error {
 		return HandleError(err, "Failed to overwrite original PDF", Error)
 	}
 
-	for _, imgPath := range imagePaths {
-		_ = os.Remove(imgPath)
-	}
-	_ = os.RemoveAll(tempDir)
-
 	comment := fmt.Sprintf("ID:%s;SIG:%s", id, signature)
 	cmd := exec.Command("exiftool", "-overwrite_original", "-UserComment="+comment, filePath)
 	output, err := cmd.CombinedOutput()
@@ -115,3 +128,55 @@ func AddIDToPDF(filePath string, id string, signature string) error {
 
 	return nil
 }
+
+// ValidateStampOptions checks the page selection and the stamp placement
+// against the real page sizes of the file: pixels for images and, via
+// go-fitz, points for every selected PDF page.
+func ValidateStampOptions(filePath string, opts StampOptions) error {
+	if !strings.HasSuffix(strings.ToLower(filePath), ".pdf") {
+		if opts.Pages.Mode == PagesList {
+			return i18n.Errorf("pages_pdf_only")
+		}
+		if !opts.Placement.IsSet() {
+			return nil
+		}
+
+		f, err := os.Open(filePath)
+		if err != nil {
+			return HandleError(err, "Failed to open image", Error)
+		}
+		defer f.Close()
+		imgConf, _, err := image.DecodeConfig(f)
+		if err != nil {
+			return HandleError(err, "Failed to decode image size", Error)
+		}
+		return opts.Placement.Validate(float64(imgConf.Width), float64(imgConf.Height), opts.Style, 1)
+	}
+
+	doc, err := fitz.New(filePath)
+	if err != nil {
+		return HandleError(err, "Failed to open PDF", Error)
+	}
+	defer doc.Close()
+
+	if err := opts.Pages.Validate(doc.NumPage()); err != nil {
+		return err
+	}
+	if !opts.Placement.IsSet() {
+		return nil
+	}
+
+	for n := 0; n < doc.NumPage(); n++ {
+		if !opts.Pages.Includes(n, doc.NumPage()) {
+			continue
+		}
+		bound, err := doc.Bound(n)
+		if err != nil {
+			return HandleError(err, fmt.Sprintf("Failed to read size of page %d", n+1), Error)
+		}
+		if err := opts.Placement.Validate(float64(bound.Dx()), float64(bound.Dy()), opts.Style, pdfRenderDPI/72); err != nil {
+			return i18n.Errorf("stamp_box_on_page", n+1, err)
+		}
+	}
+	return nil
+}
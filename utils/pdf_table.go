@@ -0,0 +1,210 @@
+package utils
+
+import (
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	arabic "github.com/abdullahdiaa/garabic"
+	"github.com/signintech/gopdf"
+)
+
+const (
+	pdfTableMargin     = 24.0
+	pdfTableFontSize   = 7.0
+	pdfTableTitleSize  = 12.0
+	pdfTableLineHeight = 9.0
+	pdfTablePadding    = 2.0
+	// pdfTableMaxLines caps how many lines a wrapped cell may take.
+	pdfTableMaxLines = 2
+)
+
+// PDFTable lays out rows as a printable table on A4 landscape pages, with
+// the title and column headers repeated on every page. Arabic text is shaped
+// the same way as stamp text.
+type PDFTable struct {
+	pdf     gopdf.GoPdf
+	title   string
+	headers []string
+	widths  []float64
+	y       float64
+	page    int
+}
+
+// NewPDFTable starts a table. widths are relative column widths; they are
+// scaled to the printable page width.
+func NewPDFTable(title string, headers []string, widths []float64, fontPath string) (*PDFTable, error) {
+	if fontPath == "" {
+		fontPath = "assets/fonts/Cairo.ttf"
+	}
+
+	t := &PDFTable{title: title, headers: headers}
+	t.pdf.Start(gopdf.Config{PageSize: *gopdf.PageSizeA4Landscape})
+	if err := t.pdf.AddTTFFont("register", fontPath); err != nil {
+		return nil, HandleError(err, "Failed to load font", Error)
+	}
+
+	total := 0.0
+	for _, w := range widths {
+		total += w
+	}
+	printable := gopdf.PageSizeA4Landscape.W - 2*pdfTableMargin
+	for _, w := range widths {
+		t.widths = append(t.widths, w/total*printable)
+	}
+
+	if err := t.newPage(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func (t *PDFTable) newPage() error {
+	t.pdf.AddPage()
+	t.page++
+	t.y = pdfTableMargin
+
+	if err := t.pdf.SetFont("register", "", pdfTableTitleSize); err != nil {
+		return err
+	}
+	// Text draws on the baseline
+	t.pdf.SetXY(pdfTableMargin, t.y+pdfTableTitleSize)
+	if err := t.pdf.Text(shapeCell(t.title)); err != nil {
+		return err
+	}
+
+	if err := t.pdf.SetFont("register", "", pdfTableFontSize); err != nil {
+		return err
+	}
+	footer := time.Now().Format("2006-01-02 15:04") + "  -  " + strconv.Itoa(t.page)
+	t.pdf.SetXY(pdfTableMargin, gopdf.PageSizeA4Landscape.H-pdfTableMargin/2)
+	if err := t.pdf.Text(footer); err != nil {
+		return err
+	}
+
+	t.y += pdfTableTitleSize + 8
+	return t.writeRow(t.headers, true)
+}
+
+// WriteRow appends a row, starting a new page when it does not fit.
+func (t *PDFTable) WriteRow(cells []string) error {
+	return t.writeRow(cells, false)
+}
+
+func (t *PDFTable) writeRow(cells []string, header bool) error {
+	lines := make([][]string, len(t.widths))
+	height := 0
+	for i := range t.widths {
+		cell := ""
+		if i < len(cells) {
+			cell = cells[i]
+		}
+		lines[i] = t.fit(cell, t.widths[i]-2*pdfTablePadding)
+		if len(lines[i]) > height {
+			height = len(lines[i])
+		}
+	}
+	rowHeight := float64(height)*pdfTableLineHeight + 2*pdfTablePadding
+
+	if !header && t.y+rowHeight > gopdf.PageSizeA4Landscape.H-pdfTableMargin {
+		if err := t.newPage(); err != nil {
+			return err
+		}
+	}
+
+	x := pdfTableMargin
+	for i, w := range t.widths {
+		// Text and fill share a colour in gopdf, so both are set per cell
+		style := "D"
+		if header {
+			style = "FD"
+			t.pdf.SetFillColor(230, 230, 230)
+		}
+		t.pdf.RectFromUpperLeftWithStyle(x, t.y, w, rowHeight, style)
+		t.pdf.SetTextColor(0, 0, 0)
+		for n, line := range lines[i] {
+			t.pdf.SetXY(x+pdfTablePadding, t.y+pdfTablePadding+float64(n)*pdfTableLineHeight)
+			if err := t.pdf.Cell(&gopdf.Rect{W: w - 2*pdfTablePadding, H: pdfTableLineHeight}, line); err != nil {
+				return err
+			}
+		}
+		x += w
+	}
+	t.y += rowHeight
+	return nil
+}
+
+// fit breaks text into at most pdfTableMaxLines lines of width. Arabic text
+// is shaped and kept on one line, since shaping reverses word order and
+// wrapping would put the end of the text first.
+func (t *PDFTable) fit(text string, width float64) []string {
+	text = strings.Join(strings.Fields(text), " ")
+	if text == "" {
+		return []string{""}
+	}
+	if arabic.IsArabic(text) {
+		shaped := arabic.Shape(text)
+		if w, err := t.pdf.MeasureTextWidth(shaped); err == nil && w > width {
+			runes := []rune(text)
+			keep := int(float64(len(runes))*width/w) - 1
+			if keep < 1 {
+				keep = 1
+			}
+			shaped = arabic.Shape(string(runes[:keep]) + "...")
+		}
+		return []string{shaped}
+	}
+
+	lines := t.wrap(text, width)
+	if len(lines) > pdfTableMaxLines {
+		lines = lines[:pdfTableMaxLines]
+		last := []rune(lines[pdfTableMaxLines-1])
+		if len(last) > 3 {
+			lines[pdfTableMaxLines-1] = string(last[:len(last)-3]) + "..."
+		}
+	}
+	return lines
+}
+
+// wrap breaks text between words, splitting a word only when it is wider
+// than the column on its own.
+func (t *PDFTable) wrap(text string, width float64) []string {
+	var lines []string
+	line := ""
+	for _, word := range strings.Fields(text) {
+		candidate := word
+		if line != "" {
+			candidate = line + " " + word
+		}
+		if w, err := t.pdf.MeasureTextWidth(candidate); err == nil && w <= width {
+			line = candidate
+			continue
+		}
+		if line != "" {
+			lines = append(lines, line)
+		}
+		line = word
+		if w, err := t.pdf.MeasureTextWidth(word); err == nil && w > width {
+			parts, err := t.pdf.SplitText(word, width)
+			if err != nil || len(parts) == 0 {
+				continue
+			}
+			lines = append(lines, parts[:len(parts)-1]...)
+			line = parts[len(parts)-1]
+		}
+	}
+	return append(lines, line)
+}
+
+// WriteTo writes the finished PDF to w.
+func (t *PDFTable) WriteTo(w io.Writer) (int64, error) {
+	return t.pdf.WriteTo(w)
+}
+
+func shapeCell(text string) string {
+	if arabic.IsArabic(text) {
+		return arabic.Shape(text)
+	}
+	return text
+}
@@ -0,0 +1,149 @@
+package utils
+
+import (
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"math/bits"
+	"os"
+	"strings"
+
+	"tawtheeq-backend/i18n"
+
+	"github.com/gen2brain/go-fitz"
+)
+
+// MaxHashedImagePixels caps the size of images decoded for hashing.
+const MaxHashedImagePixels = 50_000_000
+
+// MinHashDetail is the least number of set, and of unset, bits a hash needs
+// to be matched: blank or uniform pages hash to (nearly) all zeros and would
+// match every other blank page.
+const MinHashDetail = 8
+
+// DHash computes a 64-bit difference hash of an image. The image is reduced
+// to a 9x8 grayscale grid and every bit records whether a cell is brighter
+// than its right neighbour, so re-encoding, light resizing or recompression
+// only flips a few bits.
+func DHash(img image.Image) uint64 {
+	const w, h = 9, 8
+	grid := grayGrid(img, w, h)
+
+	var hash uint64
+	for y := 0; y < h; y++ {
+		for x := 0; x < w-1; x++ {
+			hash <<= 1
+			if grid[y*w+x] > grid[y*w+x+1] {
+				hash |= 1
+			}
+		}
+	}
+	return hash
+}
+
+// HashHasDetail reports whether hash describes enough structure to be
+// matched against other hashes.
+func HashHasDetail(hash uint64) bool {
+	ones := bits.OnesCount64(hash)
+	return ones >= MinHashDetail && 64-ones >= MinHashDetail
+}
+
+// HammingDistance returns the number of differing bits between two hashes.
+func HammingDistance(a, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
+
+// grayGrid averages the luminance of the image into a w x h grid.
+func grayGrid(img image.Image, w, h int) []float64 {
+	bounds := img.Bounds()
+	iw, ih := bounds.Dx(), bounds.Dy()
+	grid := make([]float64, w*h)
+	if iw == 0 || ih == 0 {
+		return grid
+	}
+
+	for gy := 0; gy < h; gy++ {
+		y0 := bounds.Min.Y + gy*ih/h
+		y1 := bounds.Min.Y + (gy+1)*ih/h
+		if y1 <= y0 {
+			y1 = y0 + 1
+		}
+		for gx := 0; gx < w; gx++ {
+			x0 := bounds.Min.X + gx*iw/w
+			x1 := bounds.Min.X + (gx+1)*iw/w
+			if x1 <= x0 {
+				x1 = x0 + 1
+			}
+
+			var sum float64
+			var n int
+			for y := y0; y < y1; y++ {
+				for x := x0; x < x1; x++ {
+					r, g, b, _ := img.At(x, y).RGBA()
+					sum += 0.299*float64(r) + 0.587*float64(g) + 0.114*float64(b)
+					n++
+				}
+			}
+			grid[gy*w+gx] = sum / float64(n)
+		}
+	}
+	return grid
+}
+
+// ComputePerceptualHashes returns one perceptual hash per image or PDF page of
+// the file at filePath. Images yield a single hash at page 0; PDFs yield one
+// hash per page in page order. PDFs of more than maxPages pages (when
+// positive) and images of more than MaxHashedImagePixels pixels are refused
+// before anything is rendered.
+func ComputePerceptualHashes(filePath string, maxPages int) ([]uint64, error) {
+	lower := strings.ToLower(filePath)
+
+	if strings.HasSuffix(lower, ".pdf") {
+		doc, err := fitz.New(filePath)
+		if err != nil {
+			return nil, HandleError(err, "Failed to open PDF", Error)
+		}
+		defer doc.Close()
+		if maxPages > 0 && doc.NumPage() > maxPages {
+			return nil, i18n.Errorf("too_many_pages", maxPages)
+		}
+
+		hashes := make([]uint64, 0, doc.NumPage())
+		for n := 0; n < doc.NumPage(); n++ {
+			img, err := doc.Image(n)
+			if err != nil {
+				return nil, HandleError(err, "Failed to render page for hashing", Error)
+			}
+			hashes = append(hashes, DHash(img))
+		}
+		return hashes, nil
+	}
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, HandleError(err, "Failed to open image", Error)
+	}
+	defer file.Close()
+
+	decodeConfig, decode := jpeg.DecodeConfig, jpeg.Decode
+	if strings.HasSuffix(lower, ".png") {
+		decodeConfig, decode = png.DecodeConfig, png.Decode
+	}
+	cfg, err := decodeConfig(file)
+	if err != nil {
+		return nil, HandleError(err, "Failed to decode image", Error)
+	}
+	if cfg.Width*cfg.Height > MaxHashedImagePixels {
+		return nil, i18n.Errorf("image_too_large", MaxHashedImagePixels/1_000_000)
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return nil, HandleError(err, "Failed to read image", Error)
+	}
+	img, err := decode(file)
+	if err != nil {
+		return nil, HandleError(err, "Failed to decode image", Error)
+	}
+
+	return []uint64{DHash(img)}, nil
+}
@@ -0,0 +1,156 @@
+package utils
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestHammingDistance(t *testing.T) {
+	tests := []struct {
+		a, b uint64
+		want int
+	}{
+		{0, 0, 0},
+		{0, 1, 1},
+		{0b1010, 0b0101, 4},
+		{^uint64(0), 0, 64},
+		{0xF0F0, 0xF0F1, 1},
+	}
+	for _, tt := range tests {
+		if got := HammingDistance(tt.a, tt.b); got != tt.want {
+			t.Errorf("HammingDistance(%b, %b) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+		if got := HammingDistance(tt.b, tt.a); got != tt.want {
+			t.Errorf("HammingDistance(%b, %b) = %d, want %d", tt.b, tt.a, got, tt.want)
+		}
+	}
+}
+
+// testPattern draws a gradient with a few blocks, so neighbouring cells
+// differ in both directions.
+func testPattern(w, h int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			v := uint8((x*255/w + y*97/h) % 256)
+			if (x/(w/6)+y/(h/4))%3 == 0 {
+				v = 255 - v
+			}
+			img.Set(x, y, color.RGBA{v, v / 2, 255 - v, 255})
+		}
+	}
+	return img
+}
+
+// resize scales img to w x h by nearest neighbour.
+func resize(img image.Image, w, h int) *image.RGBA {
+	src := img.Bounds()
+	out := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			out.Set(x, y, img.At(src.Min.X+x*src.Dx()/w, src.Min.Y+y*src.Dy()/h))
+		}
+	}
+	return out
+}
+
+// mirror flips img horizontally.
+func mirror(img *image.RGBA) *image.RGBA {
+	b := img.Bounds()
+	out := image.NewRGBA(b)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			out.Set(b.Max.X-1-(x-b.Min.X), y, img.At(x, y))
+		}
+	}
+	return out
+}
+
+func TestDHashDistance(t *testing.T) {
+	original := testPattern(360, 240)
+	hash := DHash(original)
+
+	var recompressed bytes.Buffer
+	if err := jpeg.Encode(&recompressed, original, &jpeg.Options{Quality: 60}); err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := jpeg.Decode(&recompressed)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		img     image.Image
+		similar bool
+	}{
+		{"same image", original, true},
+		{"recompressed", decoded, true},
+		{"resized", resize(original, 200, 133), true},
+		{"mirrored", mirror(original), false},
+		{"other image", testPattern(240, 360).SubImage(image.Rect(0, 100, 240, 260)), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			distance := HammingDistance(hash, DHash(tt.img))
+			// 10 is the default max_distance of /api/verify/similar
+			if similar := distance <= 10; similar != tt.similar {
+				t.Errorf("distance %d, similar = %v, want %v", distance, similar, tt.similar)
+			}
+		})
+	}
+}
+
+func TestDHashEmptyImage(t *testing.T) {
+	if got := DHash(image.NewRGBA(image.Rect(0, 0, 0, 0))); got != 0 {
+		t.Errorf("DHash of an empty image = %x, want 0", got)
+	}
+}
+
+func TestHashHasDetail(t *testing.T) {
+	tests := []struct {
+		hash uint64
+		want bool
+	}{
+		{0, false},
+		{^uint64(0), false},
+		{0x7F, false},
+		{0xFF, true},
+		{^uint64(0xFF), true},
+		{^uint64(0x7F), false},
+		{DHash(testPattern(360, 240)), true},
+		{DHash(image.NewGray(image.Rect(0, 0, 90, 80))), false},
+	}
+	for _, tt := range tests {
+		if got := HashHasDetail(tt.hash); got != tt.want {
+			t.Errorf("HashHasDetail(%064b) = %v, want %v", tt.hash, got, tt.want)
+		}
+	}
+}
+
+func TestComputePerceptualHashesImage(t *testing.T) {
+	img := testPattern(120, 80)
+	path := filepath.Join(t.TempDir(), "page.png")
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := png.Encode(file, img); err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+
+	hashes, err := ComputePerceptualHashes(path, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hashes) != 1 || hashes[0] != DHash(img) {
+		t.Errorf("hashes %x, want [%x]", hashes, DHash(img))
+	}
+}
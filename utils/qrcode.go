@@ -1,15 +1,49 @@
 package utils
 
 import (
+	"crypto/ed25519"
+	"encoding/base64"
 	"fmt"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 	"github.com/skip2/go-qrcode"
 )
 
-func GenerateQRCodeImage(id string) ([]byte, error) {
+const (
+	QRModeURL    = "url"
+	QRModeSigned = "signed"
 
+	// QRPayloadPrefix marks a self-contained signed QR payload and its version.
+	QRPayloadPrefix = "TWQ1"
+
+	// QRHashLength is the number of hex characters of the document hash kept
+	// in a signed payload.
+	QRHashLength = 16
+
+	qrPayloadDateLayout = "2006-01-02"
+)
+
+// QRPayload is the information carried by a self-contained QR code.
+type QRPayload struct {
+	DocumentID string    `json:"document_id"`
+	Hash       string    `json:"hash"`
+	Signer     string    `json:"signer"`
+	SignedAt   time.Time `json:"signed_at"`
+}
+
+// QRMode returns the configured QR mode, defaulting to the verification URL.
+func QRMode() string {
+	if strings.ToLower(os.Getenv("QR_MODE")) == QRModeSigned {
+		return QRModeSigned
+	}
+	return QRModeURL
+}
+
+// VerifyURL returns the frontend verification link for a document ID.
+func VerifyURL(id string) string {
 	_ = godotenv.Load()
 
 	baseURL := os.Getenv("FRONTEND_VERIFY_URL")
@@ -17,10 +51,81 @@ func GenerateQRCodeImage(id string) ([]byte, error) {
 		baseURL = "http://localhost:3000/verify"
 	}
 
-	fullURL := fmt.Sprintf("%s?id=%s", baseURL, id)
+	return fmt.Sprintf("%s?id=%s", baseURL, id)
+}
+
+// EncodeSignedQRPayload builds a compact, offline-checkable payload:
+//
+//	TWQ1|<document id>|<hash prefix>|<signer>|<yyyy-mm-dd>|<base64url ed25519 signature>
+//
+// The signature covers everything before the last separator.
+func EncodeSignedQRPayload(p QRPayload, key ed25519.PrivateKey) (string, error) {
+	if len(key) != ed25519.PrivateKeySize {
+		return "", HandleError(fmt.Errorf("invalid ed25519 private key"), "Failed to sign QR payload", Error)
+	}
+
+	hash := p.Hash
+	if len(hash) > QRHashLength {
+		hash = hash[:QRHashLength]
+	}
+	signer := strings.ReplaceAll(p.Signer, "|", " ")
+
+	body := strings.Join([]string{
+		QRPayloadPrefix,
+		p.DocumentID,
+		hash,
+		signer,
+		p.SignedAt.UTC().Format(qrPayloadDateLayout),
+	}, "|")
+
+	sig := ed25519.Sign(key, []byte(body))
+	return body + "|" + base64.RawURLEncoding.EncodeToString(sig), nil
+}
+
+// DecodeSignedQRPayload parses a payload produced by EncodeSignedQRPayload and
+// checks its signature against pub.
+func DecodeSignedQRPayload(payload string, pub ed25519.PublicKey) (*QRPayload, error) {
+	idx := strings.LastIndex(payload, "|")
+	if idx < 0 {
+		return nil, fmt.Errorf("malformed QR payload")
+	}
+	body, encodedSig := payload[:idx], payload[idx+1:]
+
+	parts := strings.Split(body, "|")
+	if len(parts) != 5 || parts[0] != QRPayloadPrefix {
+		return nil, fmt.Errorf("malformed QR payload")
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(encodedSig)
+	if err != nil {
+		return nil, fmt.Errorf("malformed QR signature: %w", err)
+	}
+	if len(pub) != ed25519.PublicKeySize || !ed25519.Verify(pub, []byte(body), sig) {
+		return nil, fmt.Errorf("invalid QR signature")
+	}
+
+	signedAt, err := time.Parse(qrPayloadDateLayout, parts[4])
+	if err != nil {
+		return nil, fmt.Errorf("malformed QR date: %w", err)
+	}
+
+	return &QRPayload{
+		DocumentID: parts[1],
+		Hash:       parts[2],
+		Signer:     parts[3],
+		SignedAt:   signedAt,
+	}, nil
+}
+
+// GenerateQRCodeImage renders content as a size x size PNG QR code. An empty
+// content falls back to the verification URL of the given ID.
+func GenerateQRCodeImage(id string, content string, size int) ([]byte, error) {
+	if content == "" {
+		content = VerifyURL(id)
+	}
 
 	var png []byte
-	png, err := qrcode.Encode(fullURL, qrcode.Medium, 128)
+	png, err := qrcode.Encode(content, qrcode.Medium, size)
 	if err != nil {
 		// return nil, fmt.Errorf("failed to generate QR code: %w", err)
 		return nil, HandleError(err, "Failed to generate QR code", Error)
@@ -0,0 +1,98 @@
+package utils
+
+import (
+	"crypto/ed25519"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSignedQRPayloadRoundTrip(t *testing.T) {
+	pub, key, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signedAt := time.Date(2024, 3, 9, 23, 30, 0, 0, time.FixedZone("AST", 3*3600))
+
+	tests := []struct {
+		name string
+		in   QRPayload
+		want QRPayload
+	}{
+		{
+			"hash is shortened",
+			QRPayload{DocumentID: "doc-1", Hash: "0123456789abcdef0123456789abcdef", Signer: "Sara", SignedAt: signedAt},
+			QRPayload{DocumentID: "doc-1", Hash: "0123456789abcdef", Signer: "Sara", SignedAt: time.Date(2024, 3, 9, 0, 0, 0, 0, time.UTC)},
+		},
+		{
+			"separator in signer",
+			QRPayload{DocumentID: "doc-2", Hash: "abc", Signer: "A|B", SignedAt: signedAt},
+			QRPayload{DocumentID: "doc-2", Hash: "abc", Signer: "A B", SignedAt: time.Date(2024, 3, 9, 0, 0, 0, 0, time.UTC)},
+		},
+		{
+			"arabic signer",
+			QRPayload{DocumentID: "doc-3", Hash: "ff", Signer: "سارة", SignedAt: signedAt},
+			QRPayload{DocumentID: "doc-3", Hash: "ff", Signer: "سارة", SignedAt: time.Date(2024, 3, 9, 0, 0, 0, 0, time.UTC)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payload, err := EncodeSignedQRPayload(tt.in, key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.HasPrefix(payload, QRPayloadPrefix+"|") {
+				t.Errorf("payload %q lacks the prefix", payload)
+			}
+			got, err := DecodeSignedQRPayload(payload, pub)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if *got != tt.want {
+				t.Errorf("decoded %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSignedQRPayloadRejected(t *testing.T) {
+	pub, key, _ := ed25519.GenerateKey(nil)
+	otherPub, _, _ := ed25519.GenerateKey(nil)
+	payload, err := EncodeSignedQRPayload(QRPayload{DocumentID: "doc-1", Hash: "abc", Signer: "Sara", SignedAt: time.Now()}, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sigAt := strings.LastIndex(payload, "|")
+	tampered := []byte(payload)
+	if tampered[sigAt+1] == 'A' {
+		tampered[sigAt+1] = 'B'
+	} else {
+		tampered[sigAt+1] = 'A'
+	}
+
+	tests := []struct {
+		name    string
+		payload string
+		pub     ed25519.PublicKey
+	}{
+		{"other key", payload, otherPub},
+		{"changed document", strings.Replace(payload, "doc-1", "doc-2", 1), pub},
+		{"changed signature", string(tampered), pub},
+		{"no signature", payload[:sigAt], pub},
+		{"wrong prefix", "TWQ2" + payload[len(QRPayloadPrefix):], pub},
+		{"not base64", payload[:sigAt+1] + "!!", pub},
+		{"empty", "", pub},
+		{"no public key", payload, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, err := DecodeSignedQRPayload(tt.payload, tt.pub); err == nil {
+				t.Errorf("decoded %+v", *got)
+			}
+		})
+	}
+
+	if _, err := EncodeSignedQRPayload(QRPayload{}, ed25519.PrivateKey("short")); err == nil {
+		t.Error("signed with an invalid key")
+	}
+}
@@ -1,24 +0,0 @@
-package utils
-
-import (
-	"net/smtp"
-	"os"
-)
-
-func SendEmail(to, subject, body string) error {
-	from := os.Getenv("SMTP_EMAIL")
-	pass := os.Getenv("SMTP_PASSWORD")
-	host := os.Getenv("SMTP_HOST")
-	port := os.Getenv("SMTP_PORT")
-
-	msg := "From: " + from + "\n" +
-		"To: " + to + "\n" +
-		"Subject: " + subject + "\n\n" +
-		body
-
-	return smtp.SendMail(
-		host+":"+port,
-		smtp.PlainAuth("", from, pass, host),
-		from, []string{to}, []byte(msg),
-	)
-}
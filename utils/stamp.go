@@ -0,0 +1,307 @@
+package utils
+
+import (
+	"image"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"tawtheeq-backend/i18n"
+
+	"github.com/joho/godotenv"
+)
+
+// stampBoxPadding is the gap between the edge of a placed stamp box and its
+// logo, text and QR code.
+const stampBoxPadding = 4.0
+
+// StampStyle describes how the ID bar, logo and QR code are drawn on a page.
+type StampStyle struct {
+	TextTemplate string
+	FontPath     string
+	FontSize     float64
+	TextColor    string
+	BgColor      string
+	BgOpacity    float64
+	TextAlign    string
+	BarPosition  string
+
+	// Logo is drawn when set; otherwise the logo is loaded from LogoPath, a
+	// local file kept by stamp templates saved before logos moved to storage.
+	Logo         image.Image
+	LogoPath     string
+	LogoSize     float64
+	LogoPosition string
+
+	QREnabled  bool
+	QRPosition string
+	QRSize     float64
+	QRMarginX  float64
+	QRMarginY  float64
+}
+
+// StampOptions carries everything AddIDToImage and AddIDToPDF need besides
+// the file, the document ID and its signature.
+type StampOptions struct {
+	// QRContent is encoded as-is; leave it empty to use the verification URL.
+	QRContent string
+	Style     StampStyle
+	// Pages selects the PDF pages to stamp; the zero value stamps every page.
+	Pages PageSelection
+	// Placement positions the stamp box; the zero value draws the full-width bar.
+	Placement StampPlacement
+}
+
+const (
+	PagesAll   = "all"
+	PagesFirst = "first"
+	PagesLast  = "last"
+	PagesList  = "list"
+)
+
+// PageSelection chooses which pages of a PDF get stamped. Pages holds
+// 1-based page numbers when Mode is PagesList.
+type PageSelection struct {
+	Mode  string
+	Pages []int
+}
+
+// ParsePageSelection accepts "all", "first", "last" or a comma separated list
+// of 1-based page numbers such as "1,3,5". An empty string selects all pages.
+func ParsePageSelection(input string) (PageSelection, error) {
+	input = strings.ToLower(strings.TrimSpace(input))
+	switch input {
+	case "", PagesAll:
+		return PageSelection{Mode: PagesAll}, nil
+	case PagesFirst, PagesLast:
+		return PageSelection{Mode: input}, nil
+	}
+
+	sel := PageSelection{Mode: PagesList}
+	for _, part := range strings.Split(input, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil || n < 1 {
+			return PageSelection{}, i18n.Errorf("invalid_page_number", part)
+		}
+		sel.Pages = append(sel.Pages, n)
+	}
+	return sel, nil
+}
+
+// Includes reports whether the 0-based page index is selected in a document
+// of total pages.
+func (s PageSelection) Includes(page int, total int) bool {
+	switch s.Mode {
+	case PagesFirst:
+		return page == 0
+	case PagesLast:
+		return page == total-1
+	case PagesList:
+		for _, p := range s.Pages {
+			if p-1 == page {
+				return true
+			}
+		}
+		return false
+	default:
+		return true
+	}
+}
+
+// Validate checks that listed pages exist in a document of total pages.
+func (s PageSelection) Validate(total int) error {
+	for _, p := range s.Pages {
+		if p > total {
+			return i18n.Errorf("page_out_of_range", p, total)
+		}
+	}
+	return nil
+}
+
+// StampPlacement puts the stamp in a Width x Height box instead of the
+// full-width bar. The box is aligned to Anchor and moved inwards by the
+// offsets, so "top-left" with offsets gives exact coordinates. Units are
+// pixels for images and PDF points for PDFs.
+type StampPlacement struct {
+	Anchor  string
+	OffsetX float64
+	OffsetY float64
+	Width   float64
+	Height  float64
+}
+
+var stampAnchors = map[string]bool{
+	"top-left": true, "top-center": true, "top-right": true,
+	"middle-left": true, "center": true, "middle-right": true,
+	"bottom-left": true, "bottom-center": true, "bottom-right": true,
+}
+
+// ParseStampPlacement builds a placement from upload form values. An empty
+// anchor keeps the default bar.
+func ParseStampPlacement(anchor, offsetX, offsetY, width, height string) (StampPlacement, error) {
+	p := StampPlacement{Anchor: strings.ToLower(strings.TrimSpace(anchor))}
+	if p.Anchor == "" {
+		if offsetX != "" || offsetY != "" || width != "" || height != "" {
+			return StampPlacement{}, i18n.Errorf("anchor_required")
+		}
+		return p, nil
+	}
+	if !stampAnchors[p.Anchor] {
+		return StampPlacement{}, i18n.Errorf("invalid_anchor", anchor)
+	}
+
+	fields := []struct {
+		name  string
+		value string
+		dest  *float64
+	}{
+		{"offset_x", offsetX, &p.OffsetX},
+		{"offset_y", offsetY, &p.OffsetY},
+		{"width", width, &p.Width},
+		{"height", height, &p.Height},
+	}
+	for _, f := range fields {
+		if f.value == "" {
+			continue
+		}
+		v, err := strconv.ParseFloat(f.value, 64)
+		if err != nil || v < 0 {
+			return StampPlacement{}, i18n.Errorf("invalid_placement", f.name)
+		}
+		*f.dest = v
+	}
+	return p, nil
+}
+
+// IsSet reports whether a custom placement was requested.
+func (p StampPlacement) IsSet() bool {
+	return p.Anchor != ""
+}
+
+// Scaled returns the placement with all lengths multiplied by factor.
+func (p StampPlacement) Scaled(factor float64) StampPlacement {
+	p.OffsetX *= factor
+	p.OffsetY *= factor
+	p.Width *= factor
+	p.Height *= factor
+	return p
+}
+
+// Box resolves the placement on a pageW x pageH page, filling in the default
+// width (the page width) and height (from the style) when they are zero.
+func (p StampPlacement) Box(pageW, pageH float64, style StampStyle) (x, y, w, h float64) {
+	w, h = p.Width, p.Height
+	if w == 0 {
+		w = pageW - p.OffsetX
+	}
+	if h == 0 {
+		h = stampBoxHeight(style)
+	}
+
+	switch {
+	case strings.HasSuffix(p.Anchor, "left"):
+		x = p.OffsetX
+	case strings.HasSuffix(p.Anchor, "right"):
+		x = pageW - w - p.OffsetX
+	default:
+		x = (pageW-w)/2 + p.OffsetX
+	}
+
+	switch {
+	case strings.HasPrefix(p.Anchor, "top"):
+		y = p.OffsetY
+	case strings.HasPrefix(p.Anchor, "bottom"):
+		y = pageH - h - p.OffsetY
+	default:
+		y = (pageH-h)/2 + p.OffsetY
+	}
+	return
+}
+
+// Validate checks that the stamp box fits inside a pageW x pageH page. The
+// placement and page are in caller units while style sizes are in rendered
+// pixels; unit is the number of pixels per caller unit (1 for images).
+func (p StampPlacement) Validate(pageW, pageH float64, style StampStyle, unit float64) error {
+	if !p.IsSet() {
+		return nil
+	}
+	x, y, w, h := p.Scaled(unit).Box(pageW*unit, pageH*unit, style)
+	x, y, w, h = x/unit, y/unit, w/unit, h/unit
+	if w <= 0 || h <= 0 || x < 0 || y < 0 || x+w > pageW+0.5 || y+h > pageH+0.5 {
+		return i18n.Errorf("stamp_box_too_large", w, h, x, y, pageW, pageH)
+	}
+	return nil
+}
+
+// stampBoxHeight is the default height of a placed stamp box: tall enough
+// for the QR code when it is enabled, otherwise one line of text.
+func stampBoxHeight(style StampStyle) float64 {
+	fontSize := style.FontSize
+	if fontSize <= 0 {
+		fontSize = 18
+	}
+	h := fontSize + 20
+	if style.QREnabled {
+		qrSize := style.QRSize
+		if qrSize <= 0 {
+			qrSize = 100
+		}
+		h = math.Max(h, qrSize+2*stampBoxPadding)
+	}
+	return h
+}
+
+// DefaultStampStyle builds the stamp style from the IMAGE_* and QR_*
+// environment variables. It is used when no stamp template applies.
+func DefaultStampStyle() StampStyle {
+	_ = godotenv.Load()
+
+	textPrefix := os.Getenv("IMAGE_TEXT_PREFIX")
+	if textPrefix == "" {
+		textPrefix = "Document ID:"
+	}
+
+	return StampStyle{
+		TextTemplate: strings.TrimSpace(textPrefix) + " {id}",
+		FontPath:     os.Getenv("IMAGE_FONT_PATH"),
+		FontSize:     parseFloatEnv("IMAGE_FONT_SIZE", 18),
+		TextColor:    os.Getenv("IMAGE_TEXT_COLOR"),
+		BgColor:      os.Getenv("IMAGE_BG_COLOR"),
+		BgOpacity:    parseOpacity(os.Getenv("IMAGE_BG_OPACITY")),
+		TextAlign:    strings.ToLower(os.Getenv("IMAGE_TEXT_ALIGN")),
+		BarPosition:  "bottom",
+		QREnabled:    strings.ToLower(os.Getenv("QR_GENERATOR")) == "true",
+		QRPosition:   strings.ToLower(os.Getenv("QR_POSITION")),
+		QRSize:       100,
+		QRMarginX:    parseFloatEnv("QR_MARGIN_X", 10),
+		QRMarginY:    parseFloatEnv("QR_MARGIN_Y", 10),
+	}
+}
+
+// RenderStampText fills the {id} and {date} placeholders of a text template.
+func RenderStampText(template string, id string, at time.Time) string {
+	if template == "" {
+		template = "Document ID: {id}"
+	}
+	return strings.NewReplacer(
+		"{id}", id,
+		"{date}", at.Format("2006-01-02"),
+	).Replace(template)
+}
+
+// ValidRGB reports whether input is an "r,g,b" triple with 0-255 components.
+func ValidRGB(input string) bool {
+	parts := strings.Split(input, ",")
+	if len(parts) != 3 {
+		return false
+	}
+	for _, p := range parts {
+		v, err := strconv.Atoi(strings.TrimSpace(p))
+		if err != nil || v < 0 || v > 255 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,132 @@
+package utils
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"tawtheeq-backend/i18n"
+)
+
+// errorCode returns the message code of an i18n error, or "" for nil.
+func errorCode(t *testing.T, err error) string {
+	t.Helper()
+	if err == nil {
+		return ""
+	}
+	var coded *i18n.Error
+	if !errors.As(err, &coded) {
+		t.Fatalf("error %v has no message code", err)
+	}
+	return coded.Code
+}
+
+func TestParsePageSelection(t *testing.T) {
+	tests := []struct {
+		input string
+		want  PageSelection
+		code  string
+	}{
+		{"", PageSelection{Mode: PagesAll}, ""},
+		{"all", PageSelection{Mode: PagesAll}, ""},
+		{" FIRST ", PageSelection{Mode: PagesFirst}, ""},
+		{"last", PageSelection{Mode: PagesLast}, ""},
+		{"1,3,5", PageSelection{Mode: PagesList, Pages: []int{1, 3, 5}}, ""},
+		{"2, 4", PageSelection{Mode: PagesList, Pages: []int{2, 4}}, ""},
+		{"0", PageSelection{}, "invalid_page_number"},
+		{"-1", PageSelection{}, "invalid_page_number"},
+		{"1,,2", PageSelection{}, "invalid_page_number"},
+		{"1-3", PageSelection{}, "invalid_page_number"},
+		{"middle", PageSelection{}, "invalid_page_number"},
+	}
+	for _, tt := range tests {
+		got, err := ParsePageSelection(tt.input)
+		if code := errorCode(t, err); code != tt.code {
+			t.Errorf("ParsePageSelection(%q) error %q, want %q", tt.input, code, tt.code)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParsePageSelection(%q) = %+v, want %+v", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestPageSelectionIncludes(t *testing.T) {
+	const total = 4
+	tests := []struct {
+		input string
+		want  []bool
+	}{
+		{"all", []bool{true, true, true, true}},
+		{"first", []bool{true, false, false, false}},
+		{"last", []bool{false, false, false, true}},
+		{"2,4", []bool{false, true, false, true}},
+	}
+	for _, tt := range tests {
+		sel, err := ParsePageSelection(tt.input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for page, want := range tt.want {
+			if got := sel.Includes(page, total); got != want {
+				t.Errorf("%q includes page index %d = %v, want %v", tt.input, page, got, want)
+			}
+		}
+	}
+
+	sel, _ := ParsePageSelection("1,5")
+	if code := errorCode(t, sel.Validate(total)); code != "page_out_of_range" {
+		t.Errorf("Validate of page 5 of %d: %q, want page_out_of_range", total, code)
+	}
+	if err := sel.Validate(5); err != nil {
+		t.Errorf("Validate of page 5 of 5: %v", err)
+	}
+}
+
+func TestParseStampPlacement(t *testing.T) {
+	tests := []struct {
+		name                                    string
+		anchor, offsetX, offsetY, width, height string
+		want                                    StampPlacement
+		code                                    string
+	}{
+		{"default bar", "", "", "", "", "", StampPlacement{}, ""},
+		{"anchor only", "Bottom-Right", "", "", "", "", StampPlacement{Anchor: "bottom-right"}, ""},
+		{"full box", "top-left", "10", "20.5", "200", "80", StampPlacement{Anchor: "top-left", OffsetX: 10, OffsetY: 20.5, Width: 200, Height: 80}, ""},
+		{"offsets without anchor", "", "10", "", "", "", StampPlacement{}, "anchor_required"},
+		{"unknown anchor", "upper-left", "", "", "", "", StampPlacement{}, "invalid_anchor"},
+		{"negative offset", "center", "-5", "", "", "", StampPlacement{}, "invalid_placement"},
+		{"not a number", "center", "", "", "wide", "", StampPlacement{}, "invalid_placement"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseStampPlacement(tt.anchor, tt.offsetX, tt.offsetY, tt.width, tt.height)
+			if code := errorCode(t, err); code != tt.code {
+				t.Fatalf("error %q, want %q", code, tt.code)
+			}
+			if got != tt.want {
+				t.Errorf("placement %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStampPlacementBox(t *testing.T) {
+	const pageW, pageH = 600.0, 800.0
+	style := StampStyle{FontSize: 20}
+	tests := []struct {
+		placement  StampPlacement
+		x, y, w, h float64
+	}{
+		{StampPlacement{Anchor: "top-left", OffsetX: 10, OffsetY: 20, Width: 100, Height: 50}, 10, 20, 100, 50},
+		{StampPlacement{Anchor: "bottom-right", OffsetX: 10, OffsetY: 20, Width: 100, Height: 50}, 490, 730, 100, 50},
+		{StampPlacement{Anchor: "center", Width: 100, Height: 50}, 250, 375, 100, 50},
+		{StampPlacement{Anchor: "top-center", OffsetY: 5}, 0, 5, 600, 40},
+	}
+	for _, tt := range tests {
+		x, y, w, h := tt.placement.Box(pageW, pageH, style)
+		if x != tt.x || y != tt.y || w != tt.w || h != tt.h {
+			t.Errorf("%+v: box (%v, %v, %v, %v), want (%v, %v, %v, %v)", tt.placement, x, y, w, h, tt.x, tt.y, tt.w, tt.h)
+		}
+	}
+}
@@ -0,0 +1,193 @@
+package utils
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/gen2brain/go-fitz"
+)
+
+// MaxIndexedTextRunes caps how much text of one document is kept for the
+// content search.
+const MaxIndexedTextRunes = 1 << 20
+
+// PageSeparator separates the pages of extracted text.
+const PageSeparator = "\f"
+
+// ExtractPDFText returns the text of every page of the PDF at filePath. It has
+// to run before stamping, since stamped pages are stored as images.
+func ExtractPDFText(filePath string) ([]string, error) {
+	doc, err := fitz.New(filePath)
+	if err != nil {
+		return nil, HandleError(err, "Failed to open PDF", Error)
+	}
+	defer doc.Close()
+
+	pages := make([]string, 0, doc.NumPage())
+	total := 0
+	for n := 0; n < doc.NumPage(); n++ {
+		text, err := doc.Text(n)
+		if err != nil {
+			return nil, HandleError(err, "Failed to extract page text", Error)
+		}
+		text = strings.TrimSpace(strings.ReplaceAll(text, PageSeparator, " "))
+		if runes := []rune(text); total+len(runes) > MaxIndexedTextRunes {
+			text = string(runes[:MaxIndexedTextRunes-total])
+		}
+		total += len([]rune(text))
+		pages = append(pages, text)
+		if total >= MaxIndexedTextRunes {
+			break
+		}
+	}
+	return pages, nil
+}
+
+// normalizeRune maps r to its search form, or returns -1 when r carries no
+// meaning for search. Arabic diacritics and tatweel are dropped, alef, ya,
+// waw and ta marbuta variants are folded and Persian letters map to their
+// Arabic forms. Other letters are lowercased.
+func normalizeRune(r rune) rune {
+	switch {
+	case r >= 0x064B && r <= 0x065F, r == 0x0670, r == 0x0640:
+		return -1
+	}
+	switch r {
+	case 'أ', 'إ', 'آ', 'ٱ', 'ٲ', 'ٳ':
+		return 'ا'
+	case 'ى', 'ی', 'ئ':
+		return 'ي'
+	case 'ؤ':
+		return 'و'
+	case 'ة':
+		return 'ه'
+	case 'ک':
+		return 'ك'
+	}
+	if unicode.IsSpace(r) {
+		return ' '
+	}
+	return unicode.ToLower(r)
+}
+
+// NormalizeText returns the search form of s: see normalizeRune. Runs of
+// whitespace collapse into one space.
+func NormalizeText(s string) string {
+	normalized, _ := normalizeWithOffsets([]rune(s))
+	return string(normalized)
+}
+
+// normalizeWithOffsets normalises text and returns, for every rune of the
+// result, the index of the rune of text it came from.
+func normalizeWithOffsets(text []rune) ([]rune, []int) {
+	normalized := make([]rune, 0, len(text))
+	offsets := make([]int, 0, len(text))
+	for i, r := range text {
+		n := normalizeRune(r)
+		if n < 0 {
+			continue
+		}
+		if n == ' ' && (len(normalized) == 0 || normalized[len(normalized)-1] == ' ') {
+			continue
+		}
+		normalized = append(normalized, n)
+		offsets = append(offsets, i)
+	}
+	return normalized, offsets
+}
+
+// SearchTerms splits a search query into normalised terms.
+func SearchTerms(query string) []string {
+	return strings.Fields(NormalizeText(query))
+}
+
+// TextSnippet is an excerpt of a page around search matches. Highlights are
+// [start, end) rune offsets into Text.
+type TextSnippet struct {
+	Page       int      `json:"page"`
+	Text       string   `json:"text"`
+	Highlights [][2]int `json:"highlights"`
+}
+
+// ContentSnippets returns up to max excerpts of pages around the places where
+// terms occur. Matching ignores the differences NormalizeText removes, while
+// the excerpts keep the original text. radius is the number of runes of
+// context kept on each side of a match.
+func ContentSnippets(pages []string, terms []string, max int, radius int) []TextSnippet {
+	snippets := []TextSnippet{}
+	if len(terms) == 0 {
+		return snippets
+	}
+
+	termRunes := make([][]rune, 0, len(terms))
+	for _, term := range terms {
+		termRunes = append(termRunes, []rune(term))
+	}
+
+	for page, text := range pages {
+		original := []rune(text)
+		normalized, offsets := normalizeWithOffsets(original)
+
+		// matches as [start, end) in original runes, in text order
+		var matches [][2]int
+		for start := 0; start < len(normalized); start++ {
+			for _, t := range termRunes {
+				if !hasRunePrefix(normalized[start:], t) {
+					continue
+				}
+				matches = append(matches, [2]int{offsets[start], offsets[start+len(t)-1] + 1})
+				start += len(t) - 1
+				break
+			}
+		}
+
+		for i := 0; i < len(matches) && len(snippets) < max; {
+			from := matches[i][0] - radius
+			if from < 0 {
+				from = 0
+			}
+			// do not start in the middle of a word
+			for from > 0 && from < matches[i][0] && !unicode.IsSpace(original[from-1]) {
+				from++
+			}
+			to := matches[i][1] + radius
+			if to > len(original) {
+				to = len(original)
+			}
+
+			snippet := TextSnippet{Page: page + 1}
+			last := 0
+			for ; i < len(matches) && matches[i][1] <= to; i++ {
+				snippet.Highlights = append(snippet.Highlights, [2]int{matches[i][0] - from, matches[i][1] - from})
+				last = matches[i][1]
+			}
+			if i < len(matches) && matches[i][0] < to {
+				// a match straddles the end of the window: stop before it
+				to = matches[i][0]
+			}
+			// nor end in the middle of one
+			for to < len(original) && to > last && !unicode.IsSpace(original[to]) {
+				to--
+			}
+
+			snippet.Text = string(original[from:to])
+			snippets = append(snippets, snippet)
+		}
+		if len(snippets) >= max {
+			break
+		}
+	}
+	return snippets
+}
+
+func hasRunePrefix(s []rune, prefix []rune) bool {
+	if len(prefix) == 0 || len(s) < len(prefix) {
+		return false
+	}
+	for i, r := range prefix {
+		if s[i] != r {
+			return false
+		}
+	}
+	return true
+}
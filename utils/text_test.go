@@ -0,0 +1,131 @@
+package utils
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNormalizeText(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"diacritics", "مُحَمَّدٌ", "محمد"},
+		{"superscript alef", "هٰذا", "هذا"},
+		{"tatweel", "كتـــاب", "كتاب"},
+		{"alef variants", "أحمد إبراهيم آمنة ٱلله", "احمد ابراهيم امنه الله"},
+		{"alef maqsura and ya with hamza", "على شاطئ", "علي شاطي"},
+		{"waw with hamza", "مسؤول", "مسوول"},
+		{"ta marbuta", "مدرسة", "مدرسه"},
+		{"persian letters", "فارسی کتاب", "فارسي كتاب"},
+		{"latin case", "Contract NO. 7", "contract no. 7"},
+		{"whitespace runs", "a \t\n b", "a b"},
+		{"leading whitespace", "  a", "a"},
+		{"empty", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NormalizeText(tt.in); got != tt.want {
+				t.Errorf("NormalizeText(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSearchTerms(t *testing.T) {
+	got := SearchTerms("  مُدرِّسة   Ahmed\tعقـد ")
+	want := []string{"مدرسه", "ahmed", "عقد"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("SearchTerms = %q, want %q", got, want)
+	}
+	if got := SearchTerms(" َ "); len(got) != 0 {
+		t.Errorf("SearchTerms of diacritics only = %q", got)
+	}
+}
+
+func TestContentSnippets(t *testing.T) {
+	tests := []struct {
+		name   string
+		pages  []string
+		terms  []string
+		max    int
+		radius int
+		want   []TextSnippet
+	}{
+		{
+			"highlight keeps the original diacritics",
+			[]string{"عقد الشَّرِكَة الموقع"},
+			SearchTerms("الشركة"),
+			5, 100,
+			[]TextSnippet{{Page: 1, Text: "عقد الشَّرِكَة الموقع", Highlights: [][2]int{{4, 14}}}},
+		},
+		{
+			"highlight spans a tatweel",
+			[]string{"رقم العقـــد 12"},
+			SearchTerms("العقد"),
+			5, 100,
+			[]TextSnippet{{Page: 1, Text: "رقم العقـــد 12", Highlights: [][2]int{{4, 12}}}},
+		},
+		{
+			"window trimmed to whole words",
+			[]string{"alpha beta gamma delta epsilon"},
+			[]string{"gamma"},
+			5, 6,
+			[]TextSnippet{{Page: 1, Text: "beta gamma delta", Highlights: [][2]int{{5, 10}}}},
+		},
+		{
+			"close matches share a snippet",
+			[]string{"one gamma two gamma three"},
+			[]string{"gamma"},
+			5, 10,
+			[]TextSnippet{{Page: 1, Text: "one gamma two gamma", Highlights: [][2]int{{4, 9}, {14, 19}}}},
+		},
+		{
+			"distant matches get their own snippets",
+			[]string{"one gamma two gamma three"},
+			[]string{"gamma"},
+			5, 6,
+			[]TextSnippet{
+				{Page: 1, Text: "one gamma two", Highlights: [][2]int{{4, 9}}},
+				{Page: 1, Text: "two gamma three", Highlights: [][2]int{{4, 9}}},
+			},
+		},
+		{
+			"pages are numbered from 1 and max is respected",
+			[]string{"nothing here", "first Gamma", "second gamma"},
+			[]string{"gamma"},
+			1, 20,
+			[]TextSnippet{{Page: 2, Text: "first Gamma", Highlights: [][2]int{{6, 11}}}},
+		},
+		{
+			"no terms",
+			[]string{"gamma"},
+			nil,
+			5, 20,
+			[]TextSnippet{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ContentSnippets(tt.pages, tt.terms, tt.max, tt.radius)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("ContentSnippets = %+v, want %+v", got, tt.want)
+			}
+			// every highlight covers a term once normalised
+			for _, s := range got {
+				runes := []rune(s.Text)
+				for _, h := range s.Highlights {
+					highlighted := NormalizeText(string(runes[h[0]:h[1]]))
+					found := false
+					for _, term := range tt.terms {
+						found = found || highlighted == term
+					}
+					if !found {
+						t.Errorf("highlight %v is %q, not a term", h, highlighted)
+					}
+				}
+			}
+		})
+	}
+}
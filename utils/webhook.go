@@ -0,0 +1,105 @@
+package utils
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"syscall"
+)
+
+// ErrWebhookAddressBlocked is returned for webhook URLs that point at a
+// loopback, private, link-local or otherwise non-public address.
+var ErrWebhookAddressBlocked = errors.New("webhook address is not public")
+
+// webhookBlockedNets are non-public ranges the net.IP predicates miss:
+// "this network", carrier-grade NAT (used by some cloud metadata services),
+// IETF protocol assignments, benchmarking, reserved and NAT64.
+var webhookBlockedNets = func() []*net.IPNet {
+	var nets []*net.IPNet
+	for _, cidr := range []string{"0.0.0.0/8", "100.64.0.0/10", "192.0.0.0/24", "198.18.0.0/15", "240.0.0.0/4", "64:ff9b::/96"} {
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		nets = append(nets, n)
+	}
+	return nets
+}()
+
+// WebhookAddressAllowed reports whether webhooks may connect to ip: public
+// unicast addresses only, unless WEBHOOK_ALLOW_PRIVATE_NETWORKS is true.
+func WebhookAddressAllowed(ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	if os.Getenv("WEBHOOK_ALLOW_PRIVATE_NETWORKS") == "true" {
+		return true
+	}
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified() {
+		return false
+	}
+	for _, n := range webhookBlockedNets {
+		if n.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// WebhookDialControl is a net.Dialer Control function that refuses blocked
+// addresses. It sees the address actually dialled, after DNS resolution, so
+// a host name that resolves elsewhere later cannot get around the check.
+func WebhookDialControl(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if !WebhookAddressAllowed(net.ParseIP(host)) {
+		return fmt.Errorf("%w: %s", ErrWebhookAddressBlocked, host)
+	}
+	return nil
+}
+
+// CheckWebhookHost resolves host and returns ErrWebhookAddressBlocked when
+// any of its addresses is blocked.
+func CheckWebhookHost(ctx context.Context, host string) error {
+	ips, err := net.DefaultResolver.LookupIP(ctx, "ip", host)
+	if err != nil {
+		return err
+	}
+	for _, ip := range ips {
+		if !WebhookAddressAllowed(ip) {
+			return fmt.Errorf("%w: %s", ErrWebhookAddressBlocked, ip)
+		}
+	}
+	return nil
+}
+
+// GenerateWebhookSecret returns a random secret for signing webhook payloads.
+func GenerateWebhookSecret() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(buf), nil
+}
+
+// SignWebhookPayload returns the signature header of a webhook delivery:
+// "t=<unix time>,v1=<hex HMAC-SHA256 of "<unix time>.<body>">". Including
+// the time lets receivers reject replayed deliveries.
+func SignWebhookPayload(secret string, timestamp int64, body []byte) string {
+	ts := strconv.FormatInt(timestamp, 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(ts))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "t=" + ts + ",v1=" + hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,98 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestSignWebhookPayload(t *testing.T) {
+	tests := []struct {
+		secret    string
+		timestamp int64
+		body      string
+	}{
+		{"whsec_a", 1700000000, `{"id":"1"}`},
+		{"whsec_b", 1700000000, `{"id":"1"}`},
+		{"whsec_a", 1700000001, `{"id":"1"}`},
+		{"whsec_a", 1700000000, ``},
+	}
+	seen := map[string]bool{}
+	for _, tt := range tests {
+		got := SignWebhookPayload(tt.secret, tt.timestamp, []byte(tt.body))
+
+		// what a receiver computes from the header and the body
+		ts, sig, ok := strings.Cut(strings.TrimPrefix(got, "t="), ",v1=")
+		if !ok {
+			t.Fatalf("malformed signature header %q", got)
+		}
+		mac := hmac.New(sha256.New, []byte(tt.secret))
+		mac.Write([]byte(ts + "." + tt.body))
+		if want := hex.EncodeToString(mac.Sum(nil)); sig != want {
+			t.Errorf("signature %s, want %s", sig, want)
+		}
+		if seen[got] {
+			t.Errorf("secret %s, time %d and body %q share a signature", tt.secret, tt.timestamp, tt.body)
+		}
+		seen[got] = true
+	}
+}
+
+func TestWebhookAddressAllowed(t *testing.T) {
+	tests := []struct {
+		ip      string
+		allowed bool
+	}{
+		{"93.184.216.34", true},
+		{"2606:2800:220:1:248:1893:25c8:1946", true},
+		{"127.0.0.1", false},
+		{"::1", false},
+		{"10.1.2.3", false},
+		{"172.16.0.1", false},
+		{"192.168.1.1", false},
+		{"169.254.169.254", false},
+		{"100.100.100.200", false},
+		{"0.0.0.0", false},
+		{"::", false},
+		{"fe80::1", false},
+		{"fd00:ec2::254", false},
+		{"::ffff:127.0.0.1", false},
+		{"::ffff:10.0.0.1", false},
+		{"224.0.0.1", false},
+		{"255.255.255.255", false},
+	}
+	for _, tt := range tests {
+		if got := WebhookAddressAllowed(net.ParseIP(tt.ip)); got != tt.allowed {
+			t.Errorf("WebhookAddressAllowed(%s) = %v, want %v", tt.ip, got, tt.allowed)
+		}
+	}
+}
+
+func TestWebhookAddressAllowedPrivateNetworks(t *testing.T) {
+	t.Setenv("WEBHOOK_ALLOW_PRIVATE_NETWORKS", "true")
+	if !WebhookAddressAllowed(net.ParseIP("127.0.0.1")) {
+		t.Error("loopback refused with WEBHOOK_ALLOW_PRIVATE_NETWORKS=true")
+	}
+}
+
+func TestWebhookDialControl(t *testing.T) {
+	tests := []struct {
+		address string
+		blocked bool
+	}{
+		{"93.184.216.34:443", false},
+		{"127.0.0.1:80", true},
+		{"[::1]:8080", true},
+		{"169.254.169.254:80", true},
+	}
+	for _, tt := range tests {
+		err := WebhookDialControl("tcp", tt.address, nil)
+		if blocked := errors.Is(err, ErrWebhookAddressBlocked); blocked != tt.blocked {
+			t.Errorf("WebhookDialControl(%s) = %v, want blocked %v", tt.address, err, tt.blocked)
+		}
+	}
+}